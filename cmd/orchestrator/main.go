@@ -1,30 +1,55 @@
-package orchestrator
+package main
 
 import (
+	"babel-bft/internal/network"
+	"babel-bft/internal/protocols"
+	_ "babel-bft/internal/protocols/all" // Registra os protocolos disponíveis
 	"babel-bft/internal/run"
 	"babel-bft/pkg/orchestration"
 	"flag"
+	"fmt"
 	"log"
 	"os"
+	"strings"
 	"time"
 )
 
 // main é o ponto de entrada principal para o orquestrador do framework.
 // Ele pode operar em três modos: remote (mestre), local, ou worker (escravo).
+// O subcomando gen-certs gera os certificados TLS das réplicas.
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "gen-certs" {
+		genCerts(os.Args[2:])
+		return
+	}
+
 	// Definição das flags da linha de comando
 	mode := flag.String("mode", "local", "Modo de operação: remote, local, ou worker.")
-	protocol := flag.String("protocol", "tendermint", "Protocolo a ser executado: tendermint ou hotstuff.")
+	protocol := flag.String("protocol", "tendermint", fmt.Sprintf("Protocolo a ser executado: %s.", strings.Join(protocols.List(), ", ")))
 	duration := flag.Duration("duration", 10*time.Second, "Duração do experimento (ex: 30s, 1m).")
 	nodes := flag.Int("nodes", 4, "Número de nós para executar no modo local.")
-	hostsFile := flag.String("hosts", "configs/hosts/local_hosts.txt", "Caminho para o arquivo de hosts para o modo remoto.")
-	configFile := flag.String("config", "configs/protocols/tendermint.json", "Caminho para o arquivo de configuração do protocolo.")
+	hostsFile := flag.String("hosts", "configs/hosts/local_hosts.txt", "Caminho para o arquivo de hosts dos modos remote e worker.")
+	configFile := flag.String("config", "configs/protocols/tendermint.json", "Caminho para o arquivo de configuração do protocolo (JSON ou YAML).")
+	id := flag.Uint("id", 0, "ID da réplica no modo worker: a linha do seu endereço no arquivo de hosts, a partir de 0.")
+	control := flag.String("control", ":8080", "Endereço em que o worker aguarda comandos do mestre; vazio para terminar ao fim do experimento.")
+	listProtocols := flag.Bool("list-protocols", false, "Lista os protocolos disponíveis e sai.")
 
 	flag.Parse()
 
 	log.SetOutput(os.Stdout)
 	log.SetFlags(log.Ltime | log.Lshortfile)
 
+	if *listProtocols {
+		for _, name := range protocols.List() {
+			fmt.Println(name)
+		}
+		return
+	}
+
+	if !isRegistered(*protocol) {
+		log.Fatalf("Protocolo desconhecido: %s. Protocolos disponíveis: %s.", *protocol, strings.Join(protocols.List(), ", "))
+	}
+
 	switch *mode {
 	case "remote":
 		// Modo Mestre: Orquestra a execução em máquinas remotas
@@ -44,9 +69,9 @@ func main() {
 		}
 
 	case "worker":
-		// Modo Escravo: Executado em máquinas remotas, aguarda comandos do mestre
+		// Modo Escravo: Executa uma réplica, que se comunica por TCP ou QUIC com as réplicas do arquivo de hosts
 		log.Println("Iniciando em modo worker...")
-		worker := orchestration.NewWorker()
+		worker := orchestration.NewWorker(*id, *protocol, *duration, *configFile, *hostsFile, *control)
 		if err := worker.Run(); err != nil {
 			log.Fatalf("Erro ao executar o worker: %v", err)
 		}
@@ -55,3 +80,35 @@ func main() {
 		log.Fatalf("Modo desconhecido: %s. Use 'remote', 'local', ou 'worker'.", *mode)
 	}
 }
+
+// genCerts gera uma autoridade certificadora local e um certificado para cada réplica
+// do arquivo de hosts, a serem usados com network.tls_dir. O diretório padrão fica em
+// configs/, que a imagem Docker inclui.
+func genCerts(args []string) {
+	flags := flag.NewFlagSet("gen-certs", flag.ExitOnError)
+	hostsFile := flags.String("hosts", "configs/hosts/local_hosts.txt", "Caminho para o arquivo de hosts das réplicas.")
+	outDir := flags.String("out", "configs/certs", "Diretório em que os certificados e as chaves são gravados.")
+	flags.Parse(args)
+
+	log.SetOutput(os.Stdout)
+	log.SetFlags(log.Ltime | log.Lshortfile)
+
+	book, err := network.LoadAddressBook(*hostsFile)
+	if err != nil {
+		log.Fatalf("Erro ao carregar o arquivo de hosts: %v", err)
+	}
+	if err := network.GenerateCertificates(*outDir, book); err != nil {
+		log.Fatalf("Erro ao gerar os certificados: %v", err)
+	}
+	log.Printf("Autoridade certificadora e certificados de %d réplicas gravados em %s.", len(book), *outDir)
+}
+
+// isRegistered informa se há um protocolo registrado com o nome dado.
+func isRegistered(name string) bool {
+	for _, registered := range protocols.List() {
+		if registered == name {
+			return true
+		}
+	}
+	return false
+}
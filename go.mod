@@ -1,3 +1,24 @@
 module babel-bft
 
 go 1.23.4
+
+require gopkg.in/yaml.v3 v3.0.1
+
+require (
+	github.com/quic-go/quic-go v0.54.0
+	google.golang.org/protobuf v1.36.9
+)
+
+require (
+	go.uber.org/mock v0.5.0 // indirect
+	golang.org/x/mod v0.18.0 // indirect
+	golang.org/x/net v0.28.0 // indirect
+	golang.org/x/sync v0.8.0 // indirect
+	golang.org/x/tools v0.22.0 // indirect
+)
+
+require (
+	github.com/cloudflare/circl v1.6.1
+	golang.org/x/crypto v0.26.0 // indirect
+	golang.org/x/sys v0.23.0 // indirect
+)
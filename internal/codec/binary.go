@@ -0,0 +1,319 @@
+// File: internal/codec/binary.go
+package codec
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"babel-bft/internal/types"
+)
+
+// binaryCodec is the compact encoding: values are written field after field with no
+// names or field numbers, integers as varints, and byte strings, slices and maps
+// prefixed by their length. Pointers are preceded by a presence byte. Both sides must
+// therefore agree on the exact layout of every payload type.
+type binaryCodec struct{}
+
+// Name returns "binary".
+func (binaryCodec) Name() string {
+	return Binary
+}
+
+// Marshal encodes the message type, the sender, the payload tag and payload, and the
+// signature.
+func (binaryCodec) Marshal(msg *types.Message) ([]byte, error) {
+	tag, payload, err := payloadTag(msg.Payload)
+	if err != nil {
+		return nil, err
+	}
+	buf := appendHeader(make([]byte, 0, 128), binaryID)
+	buf = binary.AppendVarint(buf, int64(msg.Type))
+	buf = binary.AppendUvarint(buf, uint64(msg.From))
+	buf = binary.AppendUvarint(buf, uint64(tag))
+	if tag != 0 {
+		if buf, err = appendBinary(buf, payload); err != nil {
+			return nil, fmt.Errorf("encoding %s: %w", PayloadName(msg.Payload), err)
+		}
+	}
+	buf = appendBinaryBytes(buf, msg.Signature)
+	return buf, nil
+}
+
+// Unmarshal decodes a message written by Marshal.
+func (binaryCodec) Unmarshal(data []byte) (*types.Message, error) {
+	body, err := openEnvelope(data, binaryID)
+	if err != nil {
+		return nil, err
+	}
+	r := &binaryReader{data: body}
+	msg := &types.Message{}
+	msgType, err := r.varint()
+	if err != nil {
+		return nil, err
+	}
+	msg.Type = int(msgType)
+	from, err := r.uvarint()
+	if err != nil {
+		return nil, err
+	}
+	msg.From = uint(from)
+	tag, err := r.uvarint()
+	if err != nil {
+		return nil, err
+	}
+	if tag != 0 {
+		if tag > 0xffff {
+			return nil, fmt.Errorf("invalid payload tag %d", tag)
+		}
+		payload, err := newPayload(uint16(tag))
+		if err != nil {
+			return nil, err
+		}
+		if err := r.value(payload.Elem()); err != nil {
+			return nil, fmt.Errorf("decoding %s: %w", payload.Elem().Type(), err)
+		}
+		msg.Payload = payload.Interface()
+	}
+	if msg.Signature, err = r.bytes(); err != nil {
+		return nil, err
+	}
+	if len(r.data) > 0 {
+		return nil, fmt.Errorf("%d trailing bytes after the message", len(r.data))
+	}
+	return msg, nil
+}
+
+// appendBinaryBytes appends a length-prefixed byte string.
+func appendBinaryBytes(buf, data []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(data)))
+	return append(buf, data...)
+}
+
+// appendBinary appends the encoding of v.
+func appendBinary(buf []byte, v reflect.Value) ([]byte, error) {
+	var err error
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return append(buf, 1), nil
+		}
+		return append(buf, 0), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return binary.AppendVarint(buf, v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return binary.AppendUvarint(buf, v.Uint()), nil
+	case reflect.String:
+		return appendBinaryBytes(buf, []byte(v.String())), nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return appendBinaryBytes(buf, v.Bytes()), nil
+		}
+		buf = binary.AppendUvarint(buf, uint64(v.Len()))
+		for i := 0; i < v.Len(); i++ {
+			if buf, err = appendBinary(buf, v.Index(i)); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if buf, err = appendBinary(buf, v.Index(i)); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	case reflect.Map:
+		keys, encodedKeys, err := sortedKeys(v, func(key reflect.Value) ([]byte, error) { return appendBinary(nil, key) })
+		if err != nil {
+			return nil, err
+		}
+		buf = binary.AppendUvarint(buf, uint64(len(keys)))
+		for i, key := range keys {
+			buf = append(buf, encodedKeys[i]...)
+			if buf, err = appendBinary(buf, v.MapIndex(key)); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	case reflect.Pointer:
+		if v.IsNil() {
+			return append(buf, 0), nil
+		}
+		return appendBinary(append(buf, 1), v.Elem())
+	case reflect.Struct:
+		for _, i := range fields(v.Type()) {
+			if buf, err = appendBinary(buf, v.Field(i)); err != nil {
+				return nil, fmt.Errorf("field %s: %w", v.Type().Field(i).Name, err)
+			}
+		}
+		return buf, nil
+	default:
+		return nil, fmt.Errorf("cannot encode values of kind %s", v.Kind())
+	}
+}
+
+// errTruncated is returned when the data ends in the middle of a value.
+var errTruncated = errors.New("truncated message")
+
+// binaryReader decodes values written by appendBinary from the front of data.
+type binaryReader struct {
+	data []byte
+}
+
+func (r *binaryReader) uvarint() (uint64, error) {
+	x, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		return 0, errTruncated
+	}
+	r.data = r.data[n:]
+	return x, nil
+}
+
+func (r *binaryReader) varint() (int64, error) {
+	x, n := binary.Varint(r.data)
+	if n <= 0 {
+		return 0, errTruncated
+	}
+	r.data = r.data[n:]
+	return x, nil
+}
+
+// length reads the length of a string, slice or map. Every element takes at least a
+// byte, so a length beyond the remaining data is invalid; checking it keeps a corrupt
+// length from causing a huge allocation.
+func (r *binaryReader) length() (int, error) {
+	n, err := r.uvarint()
+	if err != nil {
+		return 0, err
+	}
+	if n > uint64(len(r.data)) {
+		return 0, errTruncated
+	}
+	return int(n), nil
+}
+
+// bytes reads a length-prefixed byte string. An empty string reads as nil.
+func (r *binaryReader) bytes() ([]byte, error) {
+	n, err := r.length()
+	if err != nil || n == 0 {
+		return nil, err
+	}
+	data := append([]byte(nil), r.data[:n]...)
+	r.data = r.data[n:]
+	return data, nil
+}
+
+// value decodes into v, which must be settable.
+func (r *binaryReader) value(v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Bool:
+		if len(r.data) == 0 {
+			return errTruncated
+		}
+		if r.data[0] > 1 {
+			return fmt.Errorf("invalid boolean %d", r.data[0])
+		}
+		v.SetBool(r.data[0] == 1)
+		r.data = r.data[1:]
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		x, err := r.varint()
+		if err != nil {
+			return err
+		}
+		if v.OverflowInt(x) {
+			return fmt.Errorf("%d overflows %s", x, v.Type())
+		}
+		v.SetInt(x)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		x, err := r.uvarint()
+		if err != nil {
+			return err
+		}
+		if v.OverflowUint(x) {
+			return fmt.Errorf("%d overflows %s", x, v.Type())
+		}
+		v.SetUint(x)
+	case reflect.String:
+		data, err := r.bytes()
+		if err != nil {
+			return err
+		}
+		v.SetString(string(data))
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			data, err := r.bytes()
+			if err != nil {
+				return err
+			}
+			v.SetBytes(data)
+			return nil
+		}
+		n, err := r.length()
+		if err != nil || n == 0 {
+			return err
+		}
+		s := reflect.MakeSlice(v.Type(), n, n)
+		for i := 0; i < n; i++ {
+			if err := r.value(s.Index(i)); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := r.value(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		n, err := r.length()
+		if err != nil || n == 0 {
+			return err
+		}
+		m := reflect.MakeMapWithSize(v.Type(), n)
+		for i := 0; i < n; i++ {
+			key := reflect.New(v.Type().Key()).Elem()
+			if err := r.value(key); err != nil {
+				return err
+			}
+			if m.MapIndex(key).IsValid() {
+				return fmt.Errorf("duplicate map key %v", key)
+			}
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := r.value(elem); err != nil {
+				return err
+			}
+			m.SetMapIndex(key, elem)
+		}
+		v.Set(m)
+	case reflect.Pointer:
+		if len(r.data) == 0 {
+			return errTruncated
+		}
+		present := r.data[0]
+		r.data = r.data[1:]
+		switch present {
+		case 0:
+			v.SetZero()
+		case 1:
+			elem := reflect.New(v.Type().Elem())
+			if err := r.value(elem.Elem()); err != nil {
+				return err
+			}
+			v.Set(elem)
+		default:
+			return fmt.Errorf("invalid presence byte %d", present)
+		}
+	case reflect.Struct:
+		for _, i := range fields(v.Type()) {
+			if err := r.value(v.Field(i)); err != nil {
+				return fmt.Errorf("field %s: %w", v.Type().Field(i).Name, err)
+			}
+		}
+	default:
+		return fmt.Errorf("cannot decode values of kind %s", v.Kind())
+	}
+	return nil
+}
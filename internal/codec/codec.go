@@ -0,0 +1,206 @@
+// File: internal/codec/codec.go
+package codec
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"babel-bft/internal/types"
+)
+
+// Version is the version of the envelope format written by the codecs. Every encoded
+// message starts with it, so that replicas running different versions reject each
+// other's messages instead of misreading them.
+const Version = 1
+
+// Codec names, selected by the "codec" field of the network config.
+const (
+	Binary   = "binary"
+	Protobuf = "protobuf"
+)
+
+// Codec turns messages into bytes for transports that cross process boundaries, and
+// back. Encoded messages are envelopes: a version byte and the codec's ID, followed by
+// the message. Payloads must be pointers to types registered with Register.
+type Codec interface {
+	// Name returns the codec's name.
+	Name() string
+
+	// Marshal encodes a message. The encoding is deterministic: equal messages give
+	// equal bytes.
+	Marshal(msg *types.Message) ([]byte, error)
+
+	// Unmarshal decodes a message encoded by the same codec.
+	Unmarshal(data []byte) (*types.Message, error)
+}
+
+// ErrVersion is returned when decoding an envelope of another version.
+var ErrVersion = errors.New("unsupported envelope version")
+
+// Codec IDs, written in the envelope after the version.
+const (
+	binaryID   = 1
+	protobufID = 2
+)
+
+// New returns the codec with the given name.
+func New(name string) (Codec, error) {
+	switch name {
+	case Binary:
+		return binaryCodec{}, nil
+	case Protobuf:
+		return protobufCodec{}, nil
+	default:
+		return nil, fmt.Errorf("unknown codec %q (available: %v)", name, Names())
+	}
+}
+
+// Names lists the available codecs.
+func Names() []string {
+	return []string{Binary, Protobuf}
+}
+
+// appendHeader starts an envelope of the codec with the given ID.
+func appendHeader(buf []byte, id byte) []byte {
+	return append(buf, Version, id)
+}
+
+// openEnvelope checks the header of an envelope of the codec with the given ID and
+// returns the message it carries.
+func openEnvelope(data []byte, id byte) ([]byte, error) {
+	if len(data) < 2 {
+		return nil, fmt.Errorf("envelope of %d bytes is too short", len(data))
+	}
+	if data[0] != Version {
+		return nil, fmt.Errorf("%w %d (expected %d)", ErrVersion, data[0], Version)
+	}
+	if data[1] != id {
+		return nil, fmt.Errorf("envelope of codec %d, expected codec %d", data[1], id)
+	}
+	return data[2:], nil
+}
+
+var (
+	registryMu sync.RWMutex
+	byTag      = make(map[uint16]reflect.Type) // Struct types, by tag
+	tags       = make(map[reflect.Type]uint16)
+)
+
+func init() {
+	Register(0x01, &types.Transaction{})
+}
+
+// Register makes a payload type known to the codecs under tag, which identifies it on
+// the wire. prototype is a pointer to a value of the type, which must be a struct;
+// decoded payloads are pointers to new values of it. Tags are shared by all protocols,
+// so each takes its own block of 16: 0x01-0x0f are for payloads of the node itself,
+// and Tendermint has 0x10, HotStuff 0x20, PBFT 0x30 and the threshold DKG 0x40.
+// Protocol packages call Register from an init function; registering a tag or a type
+// twice is a programming error and panics.
+func Register(tag uint16, prototype interface{}) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	t := reflect.TypeOf(prototype)
+	if tag == 0 {
+		panic("codec: Register tag 0 is reserved for nil payloads")
+	}
+	if t == nil || t.Kind() != reflect.Pointer || t.Elem().Kind() != reflect.Struct {
+		panic(fmt.Sprintf("codec: Register prototype %T is not a pointer to a struct", prototype))
+	}
+	if other, dup := byTag[tag]; dup {
+		panic(fmt.Sprintf("codec: Register tag %#x used by both %s and %s", tag, other, t.Elem()))
+	}
+	if _, dup := tags[t.Elem()]; dup {
+		panic(fmt.Sprintf("codec: Register called twice for %s", t.Elem()))
+	}
+	byTag[tag] = t.Elem()
+	tags[t.Elem()] = tag
+}
+
+// PayloadName returns the name payloads of the type of payload are reported under,
+// such as "tendermint.ProposeMessage", or "none" for a nil payload.
+func PayloadName(payload interface{}) string {
+	if payload == nil {
+		return "none"
+	}
+	return strings.TrimPrefix(reflect.TypeOf(payload).String(), "*")
+}
+
+// payloadTag returns the tag of a payload and the struct it points to. A nil payload
+// has tag 0.
+func payloadTag(payload interface{}) (uint16, reflect.Value, error) {
+	if payload == nil {
+		return 0, reflect.Value{}, nil
+	}
+	v := reflect.ValueOf(payload)
+	if v.Kind() != reflect.Pointer || v.IsNil() {
+		return 0, reflect.Value{}, fmt.Errorf("payload %T is not a non-nil pointer", payload)
+	}
+	registryMu.RLock()
+	tag, ok := tags[v.Type().Elem()]
+	registryMu.RUnlock()
+	if !ok {
+		return 0, reflect.Value{}, fmt.Errorf("payload type %T is not registered", payload)
+	}
+	return tag, v.Elem(), nil
+}
+
+// newPayload returns a pointer to a new value of the payload type with the given tag.
+func newPayload(tag uint16) (reflect.Value, error) {
+	registryMu.RLock()
+	t, ok := byTag[tag]
+	registryMu.RUnlock()
+	if !ok {
+		return reflect.Value{}, fmt.Errorf("unknown payload tag %#x", tag)
+	}
+	return reflect.New(t), nil
+}
+
+var fieldCache sync.Map // reflect.Type -> []int
+
+// fields returns the indexes of the exported fields of a struct type, which are the
+// ones encoded, in declaration order. Unexported fields, such as cached hashes, stay
+// local to each replica.
+func fields(t reflect.Type) []int {
+	if cached, ok := fieldCache.Load(t); ok {
+		return cached.([]int)
+	}
+	var indexes []int
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).IsExported() {
+			indexes = append(indexes, i)
+		}
+	}
+	fieldCache.Store(t, indexes)
+	return indexes
+}
+
+// sortedKeys returns the keys of a map ordered by their encoding, so that maps encode
+// deterministically.
+func sortedKeys(m reflect.Value, encode func(reflect.Value) ([]byte, error)) ([]reflect.Value, [][]byte, error) {
+	keys := m.MapKeys()
+	encoded := make([][]byte, len(keys))
+	for i, key := range keys {
+		var err error
+		if encoded[i], err = encode(key); err != nil {
+			return nil, nil, err
+		}
+	}
+	order := make([]int, len(keys))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return string(encoded[order[i]]) < string(encoded[order[j]]) })
+	sortedKeys := make([]reflect.Value, len(keys))
+	sortedEncoded := make([][]byte, len(keys))
+	for i, k := range order {
+		sortedKeys[i] = keys[k]
+		sortedEncoded[i] = encoded[k]
+	}
+	return sortedKeys, sortedEncoded, nil
+}
@@ -0,0 +1,304 @@
+package codec
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"babel-bft/internal/types"
+)
+
+// testPayload has a field of every kind the codecs encode.
+type testPayload struct {
+	Flag   bool
+	Int    int
+	Small  int8
+	Neg    int64
+	Uint   uint
+	U32    uint32
+	Text   string
+	Data   []byte
+	Hash   [4]byte
+	Ints   []int64
+	IDs    []uint
+	Names  []string
+	Nested *testNested
+	Value  testNested
+	List   []*testNested
+	Powers map[uint]int64
+	ByName map[string]int64
+	hidden int // Unexported fields are not encoded
+}
+
+type testNested struct {
+	ID   uint
+	Data []byte
+}
+
+type unregisteredPayload struct {
+	ID uint
+}
+
+func init() {
+	Register(0xff00, &testPayload{})
+	Register(0xff01, &testNested{})
+}
+
+func fullPayload() *testPayload {
+	return &testPayload{
+		Flag:   true,
+		Int:    -42,
+		Small:  -7,
+		Neg:    -1 << 40,
+		Uint:   1 << 50,
+		U32:    7,
+		Text:   "hello",
+		Data:   []byte{0, 1, 2, 255},
+		Hash:   [4]byte{9, 8, 7, 6},
+		Ints:   []int64{-1, 0, 1, 1 << 62},
+		IDs:    []uint{3, 1, 2},
+		Names:  []string{"a", "b"},
+		Nested: &testNested{ID: 1, Data: []byte("nested")},
+		Value:  testNested{ID: 2, Data: []byte("value")},
+		List:   []*testNested{{ID: 3, Data: []byte("x")}, {ID: 4, Data: []byte("y")}},
+		Powers: map[uint]int64{0: 10, 1: 20, 7: 70},
+		ByName: map[string]int64{"one": 1, "two": 2},
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	messages := []struct {
+		name string
+		msg  *types.Message
+	}{
+		{"nil payload", &types.Message{Type: types.TxMsg, From: 3}},
+		{"nil payload with signature", &types.Message{Type: 5, From: 1, Signature: []byte("sig")}},
+		{"negative type", &types.Message{Type: -1, From: 0, Payload: &testNested{ID: 1, Data: []byte("d")}}},
+		{"every kind", &types.Message{Type: types.ConsensusMsg, From: 2, Payload: fullPayload(), Signature: []byte("signature")}},
+		{"transaction", &types.Message{Type: types.TxMsg, From: 9, Payload: &types.Transaction{ClientID: 4, Timestamp: 1700000000, Payload: []byte("tx")}}},
+		{"validator update", &types.Message{Type: types.TxMsg, From: 9, Payload: &types.Transaction{
+			ClientID:        4,
+			Timestamp:       1700000001,
+			Payload:         []byte("tx"),
+			ValidatorUpdate: &types.ValidatorUpdate{ID: 5, PubKey: []byte("key"), VotingPower: 2},
+		}}},
+	}
+	for _, name := range Names() {
+		c, err := New(name)
+		if err != nil {
+			t.Fatalf("New(%q): %v", name, err)
+		}
+		for _, tt := range messages {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				data, err := c.Marshal(tt.msg)
+				if err != nil {
+					t.Fatalf("Marshal: %v", err)
+				}
+				got, err := c.Unmarshal(data)
+				if err != nil {
+					t.Fatalf("Unmarshal: %v", err)
+				}
+				if !reflect.DeepEqual(got, tt.msg) {
+					t.Errorf("round trip gave %+v, want %+v", got, tt.msg)
+				}
+
+				// Encoding is deterministic, including map order.
+				again, err := c.Marshal(got)
+				if err != nil {
+					t.Fatalf("Marshal of the decoded message: %v", err)
+				}
+				if !bytes.Equal(again, data) {
+					t.Errorf("re-encoding gave %x, want %x", again, data)
+				}
+			})
+		}
+	}
+}
+
+func TestRoundTripZeroValues(t *testing.T) {
+	// Zero values may come back as nil or empty, but must encode the same way again.
+	msg := &types.Message{Type: types.ConsensusMsg, Payload: &testPayload{Nested: &testNested{}}}
+	for _, name := range Names() {
+		t.Run(name, func(t *testing.T) {
+			c, _ := New(name)
+			data, err := c.Marshal(msg)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			got, err := c.Unmarshal(data)
+			if err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			payload, ok := got.Payload.(*testPayload)
+			if !ok {
+				t.Fatalf("payload is %T, want *testPayload", got.Payload)
+			}
+			if payload.Int != 0 || payload.Text != "" || len(payload.Data) != 0 || len(payload.Powers) != 0 {
+				t.Errorf("zero payload decoded as %+v", payload)
+			}
+			again, err := c.Marshal(got)
+			if err != nil {
+				t.Fatalf("Marshal of the decoded message: %v", err)
+			}
+			if !bytes.Equal(again, data) {
+				t.Errorf("re-encoding gave %x, want %x", again, data)
+			}
+		})
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	msg := &types.Message{Type: types.ConsensusMsg, From: 1, Payload: fullPayload(), Signature: []byte("sig")}
+	for _, name := range Names() {
+		c, _ := New(name)
+		data, err := c.Marshal(msg)
+		if err != nil {
+			t.Fatalf("%s: Marshal: %v", name, err)
+		}
+		other := Binary
+		if name == Binary {
+			other = Protobuf
+		}
+		otherCodec, _ := New(other)
+		fromOther, err := otherCodec.Marshal(msg)
+		if err != nil {
+			t.Fatalf("%s: Marshal: %v", other, err)
+		}
+
+		tests := []struct {
+			name string
+			data []byte
+		}{
+			{"empty", nil},
+			{"header only", data[:1]},
+			{"other version", append([]byte{Version + 1}, data[1:]...)},
+			{"other codec", fromOther},
+			{"truncated", data[:len(data)-1]},
+		}
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				if got, err := c.Unmarshal(tt.data); err == nil {
+					t.Errorf("Unmarshal succeeded with %+v, want an error", got)
+				}
+			})
+		}
+		t.Run(name+"/version error", func(t *testing.T) {
+			_, err := c.Unmarshal(append([]byte{Version + 1}, data[1:]...))
+			if !errors.Is(err, ErrVersion) {
+				t.Errorf("Unmarshal error = %v, want %v", err, ErrVersion)
+			}
+		})
+	}
+
+	t.Run("binary/trailing bytes", func(t *testing.T) {
+		c, _ := New(Binary)
+		data, _ := c.Marshal(msg)
+		if _, err := c.Unmarshal(append(data, 0)); err == nil {
+			t.Errorf("Unmarshal succeeded with trailing bytes")
+		}
+	})
+}
+
+func TestMarshalUnregistered(t *testing.T) {
+	payloads := []struct {
+		name    string
+		payload interface{}
+	}{
+		{"unregistered type", &unregisteredPayload{ID: 1}},
+		{"not a pointer", testNested{ID: 1}},
+		{"nil pointer", (*testNested)(nil)},
+	}
+	for _, name := range Names() {
+		c, _ := New(name)
+		for _, tt := range payloads {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				if _, err := c.Marshal(&types.Message{Payload: tt.payload}); err == nil {
+					t.Errorf("Marshal succeeded, want an error")
+				}
+			})
+		}
+	}
+}
+
+func TestUnknownTag(t *testing.T) {
+	for _, name := range Names() {
+		t.Run(name, func(t *testing.T) {
+			c, _ := New(name)
+			data, err := c.Marshal(&types.Message{Payload: &testNested{ID: 1}})
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			registryMu.Lock()
+			tag := tags[reflect.TypeOf(testNested{})]
+			delete(byTag, tag)
+			registryMu.Unlock()
+			defer func() {
+				registryMu.Lock()
+				byTag[tag] = reflect.TypeOf(testNested{})
+				registryMu.Unlock()
+			}()
+
+			if _, err := c.Unmarshal(data); err == nil {
+				t.Errorf("Unmarshal of an unknown tag succeeded")
+			}
+		})
+	}
+}
+
+func TestRegisterPanics(t *testing.T) {
+	type fresh struct{ ID uint }
+	tests := []struct {
+		name      string
+		tag       uint16
+		prototype interface{}
+	}{
+		{"reserved tag", 0, &fresh{}},
+		{"nil prototype", 0xff10, nil},
+		{"not a pointer", 0xff11, fresh{}},
+		{"pointer to a non-struct", 0xff12, new(int)},
+		{"tag taken", 0xff00, &fresh{}},
+		{"type registered twice", 0xff13, &testNested{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Register(%#x, %T) did not panic", tt.tag, tt.prototype)
+				}
+			}()
+			Register(tt.tag, tt.prototype)
+		})
+	}
+}
+
+func TestPayloadName(t *testing.T) {
+	tests := []struct {
+		payload interface{}
+		want    string
+	}{
+		{nil, "none"},
+		{&types.Transaction{}, "types.Transaction"},
+		{&testNested{}, "codec.testNested"},
+	}
+	for _, tt := range tests {
+		if got := PayloadName(tt.payload); got != tt.want {
+			t.Errorf("PayloadName(%T) = %q, want %q", tt.payload, got, tt.want)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	for _, name := range Names() {
+		c, err := New(name)
+		if err != nil {
+			t.Fatalf("New(%q): %v", name, err)
+		}
+		if c.Name() != name {
+			t.Errorf("New(%q).Name() = %q", name, c.Name())
+		}
+	}
+	if _, err := New("json"); err == nil {
+		t.Errorf("New of an unknown codec succeeded")
+	}
+}
@@ -0,0 +1,437 @@
+// File: internal/codec/protobuf.go
+package codec
+
+import (
+	"fmt"
+	"reflect"
+
+	"babel-bft/internal/types"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// protobufCodec writes messages in the Protocol Buffers wire format, so that tools in
+// other languages can read them given a schema. The schema follows from the Go types:
+// the exported fields of a struct are numbered from 1 in declaration order; signed
+// integers are sint64, unsigned ones uint64; nested structs are messages, slices are
+// repeated (packed for numbers) and maps are repeated key-value entries numbered 1 and
+// 2. As in proto3, zero values are left out. Unlike the binary codec, fields a reader
+// does not know are skipped, so payloads may gain fields at the end without breaking
+// older replicas.
+//
+// The envelope carries the message as:
+//
+//	1: sint64 type, 2: uint64 from, 3: uint32 payload tag, 4: bytes payload, 5: bytes signature
+type protobufCodec struct{}
+
+// Name returns "protobuf".
+func (protobufCodec) Name() string {
+	return Protobuf
+}
+
+// Marshal encodes the message in the layout documented on protobufCodec.
+func (protobufCodec) Marshal(msg *types.Message) ([]byte, error) {
+	tag, payload, err := payloadTag(msg.Payload)
+	if err != nil {
+		return nil, err
+	}
+	buf := appendHeader(make([]byte, 0, 128), protobufID)
+	if msg.Type != 0 {
+		buf = protowire.AppendTag(buf, 1, protowire.VarintType)
+		buf = protowire.AppendVarint(buf, protowire.EncodeZigZag(int64(msg.Type)))
+	}
+	if msg.From != 0 {
+		buf = protowire.AppendTag(buf, 2, protowire.VarintType)
+		buf = protowire.AppendVarint(buf, uint64(msg.From))
+	}
+	if tag != 0 {
+		buf = protowire.AppendTag(buf, 3, protowire.VarintType)
+		buf = protowire.AppendVarint(buf, uint64(tag))
+		body, err := appendProtoMessage(nil, payload)
+		if err != nil {
+			return nil, fmt.Errorf("encoding %s: %w", PayloadName(msg.Payload), err)
+		}
+		buf = protowire.AppendTag(buf, 4, protowire.BytesType)
+		buf = protowire.AppendBytes(buf, body)
+	}
+	if len(msg.Signature) > 0 {
+		buf = protowire.AppendTag(buf, 5, protowire.BytesType)
+		buf = protowire.AppendBytes(buf, msg.Signature)
+	}
+	return buf, nil
+}
+
+// Unmarshal decodes a message written by Marshal.
+func (protobufCodec) Unmarshal(data []byte) (*types.Message, error) {
+	body, err := openEnvelope(data, protobufID)
+	if err != nil {
+		return nil, err
+	}
+	msg := &types.Message{}
+	var tag uint64
+	var payload []byte
+	for len(body) > 0 {
+		num, typ, n := protowire.ConsumeTag(body)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		body = body[n:]
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			x, n := protowire.ConsumeVarint(body)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			msg.Type, body = int(protowire.DecodeZigZag(x)), body[n:]
+		case num == 2 && typ == protowire.VarintType:
+			x, n := protowire.ConsumeVarint(body)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			msg.From, body = uint(x), body[n:]
+		case num == 3 && typ == protowire.VarintType:
+			x, n := protowire.ConsumeVarint(body)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			tag, body = x, body[n:]
+		case num == 4 && typ == protowire.BytesType:
+			b, n := protowire.ConsumeBytes(body)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			payload, body = b, body[n:]
+		case num == 5 && typ == protowire.BytesType:
+			b, n := protowire.ConsumeBytes(body)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			msg.Signature, body = append([]byte(nil), b...), body[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, body)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			body = body[n:]
+		}
+	}
+	if tag != 0 {
+		if tag > 0xffff {
+			return nil, fmt.Errorf("invalid payload tag %d", tag)
+		}
+		p, err := newPayload(uint16(tag))
+		if err != nil {
+			return nil, err
+		}
+		if err := decodeProtoMessage(p.Elem(), payload); err != nil {
+			return nil, fmt.Errorf("decoding %s: %w", p.Elem().Type(), err)
+		}
+		msg.Payload = p.Interface()
+	}
+	return msg, nil
+}
+
+// appendProtoMessage appends the fields of struct v.
+func appendProtoMessage(buf []byte, v reflect.Value) ([]byte, error) {
+	var err error
+	for num, i := range fields(v.Type()) {
+		if buf, err = appendProtoField(buf, protowire.Number(num+1), v.Field(i)); err != nil {
+			return nil, fmt.Errorf("field %s: %w", v.Type().Field(i).Name, err)
+		}
+	}
+	return buf, nil
+}
+
+// isProtoScalar reports whether values of kind k encode as varints.
+func isProtoScalar(k reflect.Kind) bool {
+	switch k {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// protoVarint returns the varint a scalar encodes as.
+func protoVarint(v reflect.Value) uint64 {
+	switch v.Kind() {
+	case reflect.Bool:
+		return protowire.EncodeBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return protowire.EncodeZigZag(v.Int())
+	default:
+		return v.Uint()
+	}
+}
+
+// appendProtoField appends field num with value v, unless v is a zero scalar, an empty
+// string, slice or map, or a nil pointer.
+func appendProtoField(buf []byte, num protowire.Number, v reflect.Value) ([]byte, error) {
+	switch k := v.Kind(); {
+	case isProtoScalar(k):
+		if x := protoVarint(v); x != 0 {
+			buf = protowire.AppendTag(buf, num, protowire.VarintType)
+			buf = protowire.AppendVarint(buf, x)
+		}
+		return buf, nil
+	case k == reflect.String:
+		if v.Len() > 0 {
+			buf = protowire.AppendTag(buf, num, protowire.BytesType)
+			buf = protowire.AppendString(buf, v.String())
+		}
+		return buf, nil
+	case k == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		if v.Len() > 0 {
+			buf = protowire.AppendTag(buf, num, protowire.BytesType)
+			buf = protowire.AppendBytes(buf, v.Bytes())
+		}
+		return buf, nil
+	case k == reflect.Array && v.Type().Elem().Kind() == reflect.Uint8:
+		data := make([]byte, v.Len())
+		reflect.Copy(reflect.ValueOf(data), v)
+		buf = protowire.AppendTag(buf, num, protowire.BytesType)
+		return protowire.AppendBytes(buf, data), nil
+	case k == reflect.Slice && isProtoScalar(v.Type().Elem().Kind()):
+		if v.Len() == 0 {
+			return buf, nil
+		}
+		var packed []byte
+		for i := 0; i < v.Len(); i++ {
+			packed = protowire.AppendVarint(packed, protoVarint(v.Index(i)))
+		}
+		buf = protowire.AppendTag(buf, num, protowire.BytesType)
+		return protowire.AppendBytes(buf, packed), nil
+	case k == reflect.Slice:
+		var err error
+		for i := 0; i < v.Len(); i++ {
+			elem := v.Index(i)
+			if elem.Kind() == reflect.Pointer && elem.IsNil() {
+				return nil, fmt.Errorf("nil element %d cannot be encoded", i)
+			}
+			if buf, err = appendProtoElement(buf, num, elem); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	case k == reflect.Map:
+		keys, _, err := sortedKeys(v, func(key reflect.Value) ([]byte, error) { return appendBinary(nil, key) })
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			entry, err := appendProtoField(nil, 1, key)
+			if err != nil {
+				return nil, err
+			}
+			if entry, err = appendProtoField(entry, 2, v.MapIndex(key)); err != nil {
+				return nil, err
+			}
+			buf = protowire.AppendTag(buf, num, protowire.BytesType)
+			buf = protowire.AppendBytes(buf, entry)
+		}
+		return buf, nil
+	case k == reflect.Pointer:
+		if v.IsNil() {
+			return buf, nil
+		}
+		if v.Elem().Kind() != reflect.Struct {
+			return nil, fmt.Errorf("cannot encode pointers to %s", v.Elem().Kind())
+		}
+		return appendProtoElement(buf, num, v.Elem())
+	case k == reflect.Struct:
+		return appendProtoElement(buf, num, v)
+	default:
+		return nil, fmt.Errorf("cannot encode values of kind %s", k)
+	}
+}
+
+// appendProtoElement appends one occurrence of a repeated or message field: a nested
+// message, or a byte string.
+func appendProtoElement(buf []byte, num protowire.Number, v reflect.Value) ([]byte, error) {
+	switch v.Kind() {
+	case reflect.Pointer:
+		return appendProtoElement(buf, num, v.Elem())
+	case reflect.Struct:
+		body, err := appendProtoMessage(nil, v)
+		if err != nil {
+			return nil, err
+		}
+		buf = protowire.AppendTag(buf, num, protowire.BytesType)
+		return protowire.AppendBytes(buf, body), nil
+	case reflect.String:
+		buf = protowire.AppendTag(buf, num, protowire.BytesType)
+		return protowire.AppendString(buf, v.String()), nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			buf = protowire.AppendTag(buf, num, protowire.BytesType)
+			return protowire.AppendBytes(buf, v.Bytes()), nil
+		}
+	}
+	return nil, fmt.Errorf("cannot encode repeated values of type %s", v.Type())
+}
+
+// decodeProtoMessage decodes the fields of a message into struct v, skipping fields
+// it does not know.
+func decodeProtoMessage(v reflect.Value, data []byte) error {
+	indexes := fields(v.Type())
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		if int(num) > len(indexes) {
+			n := protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			data = data[n:]
+			continue
+		}
+		i := indexes[num-1]
+		n, err := decodeProtoField(v.Field(i), typ, data)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", v.Type().Field(i).Name, err)
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+// decodeProtoField decodes one occurrence of a field of wire type typ from the front
+// of data into v, appending to repeated fields, and returns the bytes consumed.
+func decodeProtoField(v reflect.Value, typ protowire.Type, data []byte) (int, error) {
+	k := v.Kind()
+	if isProtoScalar(k) {
+		if typ != protowire.VarintType {
+			return 0, fmt.Errorf("wire type %d for a number", typ)
+		}
+		x, n := protowire.ConsumeVarint(data)
+		if n < 0 {
+			return 0, protowire.ParseError(n)
+		}
+		return n, setProtoScalar(v, x)
+	}
+	if k == reflect.Slice && isProtoScalar(v.Type().Elem().Kind()) && typ == protowire.VarintType {
+		// Unpacked repeated number
+		x, n := protowire.ConsumeVarint(data)
+		if n < 0 {
+			return 0, protowire.ParseError(n)
+		}
+		elem := reflect.New(v.Type().Elem()).Elem()
+		if err := setProtoScalar(elem, x); err != nil {
+			return 0, err
+		}
+		v.Set(reflect.Append(v, elem))
+		return n, nil
+	}
+
+	if typ != protowire.BytesType {
+		return 0, fmt.Errorf("wire type %d for a %s", typ, k)
+	}
+	b, n := protowire.ConsumeBytes(data)
+	if n < 0 {
+		return 0, protowire.ParseError(n)
+	}
+	switch {
+	case k == reflect.String:
+		v.SetString(string(b))
+	case k == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		v.SetBytes(append([]byte(nil), b...))
+	case k == reflect.Array && v.Type().Elem().Kind() == reflect.Uint8:
+		if len(b) != v.Len() {
+			return 0, fmt.Errorf("%d bytes for an array of %d", len(b), v.Len())
+		}
+		reflect.Copy(v, reflect.ValueOf(b))
+	case k == reflect.Slice && isProtoScalar(v.Type().Elem().Kind()):
+		// Packed repeated numbers
+		for len(b) > 0 {
+			x, m := protowire.ConsumeVarint(b)
+			if m < 0 {
+				return 0, protowire.ParseError(m)
+			}
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := setProtoScalar(elem, x); err != nil {
+				return 0, err
+			}
+			v.Set(reflect.Append(v, elem))
+			b = b[m:]
+		}
+	case k == reflect.Slice:
+		elem := reflect.New(v.Type().Elem()).Elem()
+		if _, err := decodeProtoField(elem, protowire.BytesType, data); err != nil {
+			return 0, err
+		}
+		v.Set(reflect.Append(v, elem))
+	case k == reflect.Map:
+		key := reflect.New(v.Type().Key()).Elem()
+		elem := reflect.New(v.Type().Elem()).Elem()
+		for len(b) > 0 {
+			num, typ, m := protowire.ConsumeTag(b)
+			if m < 0 {
+				return 0, protowire.ParseError(m)
+			}
+			b = b[m:]
+			switch num {
+			case 1:
+				m, err := decodeProtoField(key, typ, b)
+				if err != nil {
+					return 0, err
+				}
+				b = b[m:]
+			case 2:
+				m, err := decodeProtoField(elem, typ, b)
+				if err != nil {
+					return 0, err
+				}
+				b = b[m:]
+			default:
+				m := protowire.ConsumeFieldValue(num, typ, b)
+				if m < 0 {
+					return 0, protowire.ParseError(m)
+				}
+				b = b[m:]
+			}
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		if v.MapIndex(key).IsValid() {
+			return 0, fmt.Errorf("duplicate map key %v", key)
+		}
+		v.SetMapIndex(key, elem)
+	case k == reflect.Pointer && v.Type().Elem().Kind() == reflect.Struct:
+		elem := reflect.New(v.Type().Elem())
+		if err := decodeProtoMessage(elem.Elem(), b); err != nil {
+			return 0, err
+		}
+		v.Set(elem)
+	case k == reflect.Struct:
+		if err := decodeProtoMessage(v, b); err != nil {
+			return 0, err
+		}
+	default:
+		return 0, fmt.Errorf("cannot decode values of type %s", v.Type())
+	}
+	return n, nil
+}
+
+// setProtoScalar stores the value of a varint in scalar v.
+func setProtoScalar(v reflect.Value, x uint64) error {
+	switch v.Kind() {
+	case reflect.Bool:
+		v.SetBool(protowire.DecodeBool(x))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i := protowire.DecodeZigZag(x)
+		if v.OverflowInt(i) {
+			return fmt.Errorf("%d overflows %s", i, v.Type())
+		}
+		v.SetInt(i)
+	default:
+		if v.OverflowUint(x) {
+			return fmt.Errorf("%d overflows %s", x, v.Type())
+		}
+		v.SetUint(x)
+	}
+	return nil
+}
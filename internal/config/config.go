@@ -0,0 +1,557 @@
+// File: internal/config/config.go
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds the tunable parameters of an experiment, as read from the
+// protocol configuration file passed with --config. Every field has a default,
+// so a file only needs to list the values it changes.
+type Config struct {
+	Node       NodeConfig       `json:"node"`
+	Client     ClientConfig     `json:"client"`
+	Crypto     CryptoConfig     `json:"crypto"`
+	Network    NetworkConfig    `json:"network"`
+	Quorum     QuorumConfig     `json:"quorum"`
+	Validators ValidatorsConfig `json:"validators"`
+	// Reconfiguration schedules validator-set changes during local runs
+	Reconfiguration ReconfigurationConfig `json:"reconfiguration"`
+	Tendermint      TendermintConfig      `json:"tendermint"`
+	HotStuff        HotStuffConfig        `json:"hotstuff"`
+	PBFT            PBFTConfig            `json:"pbft"`
+}
+
+// NodeConfig holds the parameters of a replica that do not depend on the protocol:
+// how many client transactions it keeps pending, how many incoming messages can be
+// queued before the transport blocks, and how many heights after being committed a
+// validator update takes effect.
+type NodeConfig struct {
+	MempoolSize          int `json:"mempool_size"`
+	InboxSize            int `json:"inbox_size"`
+	ValidatorUpdateDelay int `json:"validator_update_delay"`
+}
+
+// ClientConfig describes the load generated in local runs: Count clients each
+// submitting one transaction every Interval.
+type ClientConfig struct {
+	Count    int      `json:"count"`
+	Interval Duration `json:"interval"`
+}
+
+// CryptoConfig selects the signature scheme used to authenticate consensus messages:
+// "ed25519", whose quorum certificates list every signature, "bls", whose certificates
+// aggregate into a single signature, "threshold", whose certificates are one signature
+// under a shared group key, "mac", which authenticates with vectors of MACs over
+// pairwise keys instead of signatures, "emulated", which skips cryptography but charges
+// the costs given in Emulation, or "none" to disable authentication. Protocols
+// maps protocol names to the scheme they use instead of Scheme, so that one file can
+// run, say, PBFT with MACs and HotStuff with signatures.
+//
+// The threshold scheme needs Threshold signature shares to produce a signature; zero
+// means the quorum of the validator set. Since a threshold signature does not prove
+// which replicas signed, the scheme requires a fixed validator set where every replica
+// has voting power 1, and Threshold must be at least its quorum. Its keys come from a
+// trusted dealer, or from a distributed key generation run over the transport when
+// KeyGeneration is "dkg", which must finish within DKGTimeout.
+//
+// The keys of the other schemes are derived from KeySeed when it is set, which makes
+// them reproducible. Replicas running as separate processes need a seed to agree on
+// the keys, and anyone who knows it can forge any replica's signatures.
+type CryptoConfig struct {
+	Scheme        string            `json:"scheme"`
+	KeySeed       string            `json:"key_seed"`
+	Protocols     map[string]string `json:"protocols"`
+	Threshold     int               `json:"threshold"`
+	KeyGeneration string            `json:"key_generation"`
+	DKGTimeout    Duration          `json:"dkg_timeout"`
+	Emulation     EmulationConfig   `json:"emulation"`
+}
+
+// EmulationConfig describes the scheme the "emulated" crypto scheme stands in for, so
+// that large simulations model the cost of cryptography without paying it. Each sign
+// and verify delays the node by SignDelay and VerifyDelay, and each signature combined
+// into a certificate by AggregateDelay. Signatures take SignatureSize bytes, and
+// certificates are a single signature if Aggregated is set, or a list of them otherwise.
+type EmulationConfig struct {
+	SignDelay      Duration `json:"sign_delay"`
+	VerifyDelay    Duration `json:"verify_delay"`
+	AggregateDelay Duration `json:"aggregate_delay"`
+	SignatureSize  int      `json:"signature_size"`
+	Aggregated     bool     `json:"aggregated"`
+}
+
+// NetworkConfig sets how messages travel between replicas. Codec encodes them:
+// "binary", the compact default, or "protobuf", the Protocol Buffers wire format. Local
+// runs do not need to encode messages, but do so anyway to report the traffic.
+//
+// The rest sets the transport of runs where replicas are separate processes. Transport
+// is "tcp", the default, or "quic", which sends proposals, votes and the rest of the
+// traffic on separate streams, so that they do not wait for each other. Each replica
+// queues up to SendQueue outgoing messages per peer (per stream with QUIC), which
+// covers the time it takes to connect; messages beyond that are dropped. A failed
+// connection is retried after ReconnectBackoff, doubled after each further failure up
+// to MaxReconnectBackoff. When TLSDir is set, replicas authenticate each other with the
+// certificates in it, generated by the orchestrator's gen-certs command; TCP
+// connections are plain otherwise, and QUIC requires it.
+type NetworkConfig struct {
+	Codec               string   `json:"codec"`
+	Transport           string   `json:"transport"`
+	SendQueue           int      `json:"send_queue"`
+	ReconnectBackoff    Duration `json:"reconnect_backoff"`
+	MaxReconnectBackoff Duration `json:"max_reconnect_backoff"`
+	TLSDir              string   `json:"tls_dir"`
+	// Emulation degrades the links between nodes, in local runs and between processes
+	Emulation NetworkEmulationConfig `json:"emulation"`
+}
+
+// NetworkEmulationConfig makes the network behave like a real one when Enabled: each
+// directed link from one node to another, replicas and clients alike, delays, loses,
+// duplicates and reorders messages, and carries them at a limited bandwidth. The first
+// of the Links rules that matches a link sets its behavior, and links no rule matches
+// behave as Link. Fields a rule leaves out are zero rather than taken from Link.
+type NetworkEmulationConfig struct {
+	Enabled bool       `json:"enabled"`
+	Link    LinkConfig `json:"link"`
+	Links   []LinkRule `json:"links"`
+}
+
+// LinkConfig describes an emulated link. Each message is delayed according to
+// Distribution:
+//   - "constant": Delay, also when Distribution is empty
+//   - "uniform":  between Delay-Jitter and Delay+Jitter
+//   - "normal":   Delay on average, with Jitter as the standard deviation
+//   - "pareto":   at least Delay, with a heavy tail whose weight grows as ParetoShape
+//     decreases; the average is Delay*ParetoShape/(ParetoShape-1) when ParetoShape > 1
+//
+// Delays never go below zero. A message is lost with probability Loss, delivered twice
+// with probability Duplication, and with probability Reordering skips the delay, which
+// makes it overtake the messages in flight. A BandwidthMbps above zero caps the link at
+// that many megabits per second, measured with the sizes given by the network codec:
+// messages then wait their turn to be sent, and are dropped when QueueSize of them are
+// already waiting, unless QueueSize is zero.
+type LinkConfig struct {
+	Distribution  string   `json:"distribution"`
+	Delay         Duration `json:"delay"`
+	Jitter        Duration `json:"jitter"`
+	ParetoShape   float64  `json:"pareto_shape"`
+	Loss          float64  `json:"loss"`
+	Duplication   float64  `json:"duplication"`
+	Reordering    float64  `json:"reordering"`
+	BandwidthMbps float64  `json:"bandwidth_mbps"`
+	QueueSize     int      `json:"queue_size"`
+}
+
+// LinkRule sets the behavior of the links from the nodes in From to the nodes in To,
+// where an empty list matches every node, with the link fields of LinkConfig inline.
+type LinkRule struct {
+	From []uint `json:"from"`
+	To   []uint `json:"to"`
+	LinkConfig
+}
+
+// Matches reports whether the rule applies to the link from one node to another.
+func (r LinkRule) Matches(from, to uint) bool {
+	return matchesNode(r.From, from) && matchesNode(r.To, to)
+}
+
+func matchesNode(ids []uint, id uint) bool {
+	if len(ids) == 0 {
+		return true
+	}
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
+
+// LinkFor returns the behavior of the link from one node to another.
+func (c NetworkEmulationConfig) LinkFor(from, to uint) LinkConfig {
+	for _, rule := range c.Links {
+		if rule.Matches(from, to) {
+			return rule.LinkConfig
+		}
+	}
+	return c.Link
+}
+
+// QuorumConfig sets the voting power f held by faulty replicas that the system must
+// tolerate, which requires a total voting power of at least 3f+1. Quorums then hold
+// total-f voting power. With the default power of 1 per replica, f is a number of
+// replicas. Zero means the largest f the total voting power allows, (total-1)/3.
+type QuorumConfig struct {
+	FaultTolerance int64 `json:"fault_tolerance"`
+}
+
+// ValidatorsConfig sets the voting power of each replica, indexed by replica ID.
+// Replicas past the end of the list have power 1, as do all of them when it is empty.
+type ValidatorsConfig struct {
+	VotingPower []int64 `json:"voting_power"`
+}
+
+// ReconfigurationConfig schedules validator-set changes in local runs. SpareNodes
+// replicas are started outside the validator set, after the regular ones, so they can
+// be added later. Each event is submitted as a validator-update transaction at its
+// time from the start of the run.
+type ReconfigurationConfig struct {
+	SpareNodes int                    `json:"spare_nodes"`
+	Events     []ReconfigurationEvent `json:"events"`
+}
+
+// ReconfigurationEvent sets the voting power of a replica: a replica outside the set
+// is added, and a voting power of 0 removes it.
+type ReconfigurationEvent struct {
+	At          Duration `json:"at"`
+	Node        uint     `json:"node"`
+	VotingPower int64    `json:"voting_power"`
+}
+
+// TendermintConfig holds the Tendermint timeouts, the maximum number of transactions
+// per block, the size of the buffer for messages from future heights and how many
+// rounds ahead of the current one messages are accepted (RoundWindow). Each step
+// has a base timeout that grows with the round number according to TimeoutBackoff:
+//   - "linear":      base + round*delta
+//   - "exponential": base * 2^round
+//
+// In both cases the result is capped by TimeoutMax, if set.
+type TendermintConfig struct {
+	TimeoutPropose        Duration `json:"timeout_propose"`
+	TimeoutProposeDelta   Duration `json:"timeout_propose_delta"`
+	TimeoutPrevote        Duration `json:"timeout_prevote"`
+	TimeoutPrevoteDelta   Duration `json:"timeout_prevote_delta"`
+	TimeoutPrecommit      Duration `json:"timeout_precommit"`
+	TimeoutPrecommitDelta Duration `json:"timeout_precommit_delta"`
+	TimeoutBackoff        string   `json:"timeout_backoff"`
+	TimeoutMax            Duration `json:"timeout_max"`
+	BlockSize             int      `json:"block_size"`
+	BufferSize            int      `json:"buffer_size"`
+	RoundWindow           int      `json:"round_window"`
+}
+
+// HotStuffConfig holds the HotStuff parameters. Mode is "chained" (pipelined, one
+// generic phase per view) or "basic" (prepare, pre-commit, commit and decide phases
+// in every view). The view timeout doubles on each consecutive failed view, capped by
+// TimeoutMax if set. BlockSize is the maximum number of transactions per block and
+// BufferSize bounds the proposals kept while their ancestors are missing.
+type HotStuffConfig struct {
+	Mode        string   `json:"mode"`
+	ViewTimeout Duration `json:"view_timeout"`
+	TimeoutMax  Duration `json:"timeout_max"`
+	BlockSize   int      `json:"block_size"`
+	BufferSize  int      `json:"buffer_size"`
+}
+
+// PBFTConfig holds the PBFT parameters. The primary orders up to BatchSize requests
+// per sequence number, checking for new requests every BatchInterval. Sequence numbers
+// must stay within WindowSize of the last stable checkpoint, and a checkpoint is taken
+// every CheckpointInterval executed requests. Backups start a view change when requests
+// stay pending for ViewChangeTimeout, doubled for each consecutive failed view change
+// and capped by TimeoutMax if set.
+type PBFTConfig struct {
+	BatchSize          int      `json:"batch_size"`
+	BatchInterval      Duration `json:"batch_interval"`
+	WindowSize         int      `json:"window_size"`
+	CheckpointInterval int      `json:"checkpoint_interval"`
+	ViewChangeTimeout  Duration `json:"view_change_timeout"`
+	TimeoutMax         Duration `json:"timeout_max"`
+}
+
+// SchemeFor returns the signature scheme the named protocol runs with.
+func (c CryptoConfig) SchemeFor(protocol string) string {
+	if scheme, ok := c.Protocols[protocol]; ok {
+		return scheme
+	}
+	return c.Scheme
+}
+
+// usesScheme reports whether any protocol may run with the named scheme.
+func (c CryptoConfig) usesScheme(scheme string) bool {
+	if c.Scheme == scheme {
+		return true
+	}
+	for _, s := range c.Protocols {
+		if s == scheme {
+			return true
+		}
+	}
+	return false
+}
+
+// Default returns the configuration used when no file is given, or for any
+// field the file leaves out.
+func Default() *Config {
+	return &Config{
+		Node: NodeConfig{
+			MempoolSize:          10000,
+			InboxSize:            100,
+			ValidatorUpdateDelay: 2,
+		},
+		Client: ClientConfig{
+			Count:    1,
+			Interval: Duration{100 * time.Millisecond},
+		},
+		Crypto: CryptoConfig{
+			Scheme:        "ed25519",
+			KeyGeneration: "dealer",
+			DKGTimeout:    Duration{5 * time.Second},
+			// Roughly the cost and size of ed25519
+			Emulation: EmulationConfig{
+				SignDelay:     Duration{50 * time.Microsecond},
+				VerifyDelay:   Duration{150 * time.Microsecond},
+				SignatureSize: 64,
+			},
+		},
+		Network: NetworkConfig{
+			Codec:               "binary",
+			Transport:           "tcp",
+			SendQueue:           10000,
+			ReconnectBackoff:    Duration{100 * time.Millisecond},
+			MaxReconnectBackoff: Duration{5 * time.Second},
+			Emulation: NetworkEmulationConfig{
+				Link: LinkConfig{
+					Distribution: "constant",
+					ParetoShape:  2,
+					QueueSize:    1000,
+				},
+			},
+		},
+		Tendermint: TendermintConfig{
+			TimeoutPropose:        Duration{3 * time.Second},
+			TimeoutProposeDelta:   Duration{500 * time.Millisecond},
+			TimeoutPrevote:        Duration{1 * time.Second},
+			TimeoutPrevoteDelta:   Duration{500 * time.Millisecond},
+			TimeoutPrecommit:      Duration{1 * time.Second},
+			TimeoutPrecommitDelta: Duration{500 * time.Millisecond},
+			TimeoutBackoff:        "linear",
+			TimeoutMax:            Duration{60 * time.Second},
+			BlockSize:             1000,
+			BufferSize:            1000,
+			RoundWindow:           10,
+		},
+		HotStuff: HotStuffConfig{
+			Mode:        "chained",
+			ViewTimeout: Duration{2 * time.Second},
+			TimeoutMax:  Duration{60 * time.Second},
+			BlockSize:   1000,
+			BufferSize:  1000,
+		},
+		PBFT: PBFTConfig{
+			BatchSize:          100,
+			BatchInterval:      Duration{10 * time.Millisecond},
+			WindowSize:         200,
+			CheckpointInterval: 100,
+			ViewChangeTimeout:  Duration{2 * time.Second},
+			TimeoutMax:         Duration{60 * time.Second},
+		},
+	}
+}
+
+// Load reads the configuration file at path on top of the defaults and validates it.
+// Files ending in .yaml or .yml are read as YAML, anything else as JSON; both use
+// the same field names. Unknown fields are rejected, so typos do not go unnoticed.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config %s: %w", path, err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		if data, err = yamlToJSON(data); err != nil {
+			return nil, fmt.Errorf("parsing config %s: %w", path, err)
+		}
+	}
+
+	cfg := Default()
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("parsing config %s: %w", path, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// yamlToJSON converts a YAML document to JSON, so that both formats share the
+// field names and parsing rules of the JSON tags.
+func yamlToJSON(data []byte) ([]byte, error) {
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if doc == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(doc)
+}
+
+// Validate checks every field and reports all the problems found, each prefixed
+// with the path of the offending field.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, field, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: %s", field, fmt.Sprintf(format, args...)))
+		}
+	}
+
+	check(c.Node.MempoolSize > 0, "node.mempool_size", "must be positive, got %d", c.Node.MempoolSize)
+	check(c.Node.InboxSize > 0, "node.inbox_size", "must be positive, got %d", c.Node.InboxSize)
+	check(c.Node.ValidatorUpdateDelay > 0, "node.validator_update_delay", "must be positive, got %d", c.Node.ValidatorUpdateDelay)
+	check(c.Client.Count >= 0, "client.count", "must not be negative, got %d", c.Client.Count)
+	check(c.Client.Interval.Duration > 0, "client.interval", "must be positive, got %s", c.Client.Interval)
+	validScheme := func(scheme string) bool {
+		return scheme == "ed25519" || scheme == "bls" || scheme == "threshold" || scheme == "mac" || scheme == "emulated" || scheme == "none"
+	}
+	check(validScheme(c.Crypto.Scheme), "crypto.scheme", "must be \"ed25519\", \"bls\", \"threshold\", \"mac\", \"emulated\" or \"none\", got %q", c.Crypto.Scheme)
+	for protocol, scheme := range c.Crypto.Protocols {
+		check(validScheme(scheme), "crypto.protocols."+protocol, "must be \"ed25519\", \"bls\", \"threshold\", \"mac\", \"emulated\" or \"none\", got %q", scheme)
+	}
+	check(c.Crypto.Threshold >= 0, "crypto.threshold", "must not be negative, got %d", c.Crypto.Threshold)
+	if c.Crypto.usesScheme("threshold") {
+		for i, power := range c.Validators.VotingPower {
+			check(power == 1, fmt.Sprintf("validators.voting_power[%d]", i), "must be 1 with threshold signatures, got %d", power)
+		}
+		check(c.Reconfiguration.SpareNodes == 0, "reconfiguration.spare_nodes", "must be 0 with threshold signatures, got %d", c.Reconfiguration.SpareNodes)
+		check(len(c.Reconfiguration.Events) == 0, "reconfiguration.events", "must be empty with threshold signatures")
+	}
+	check(c.Crypto.KeyGeneration == "dealer" || c.Crypto.KeyGeneration == "dkg", "crypto.key_generation", "must be \"dealer\" or \"dkg\", got %q", c.Crypto.KeyGeneration)
+	check(c.Crypto.DKGTimeout.Duration > 0, "crypto.dkg_timeout", "must be positive, got %s", c.Crypto.DKGTimeout)
+	em := c.Crypto.Emulation
+	check(em.SignDelay.Duration >= 0, "crypto.emulation.sign_delay", "must not be negative, got %s", em.SignDelay)
+	check(em.VerifyDelay.Duration >= 0, "crypto.emulation.verify_delay", "must not be negative, got %s", em.VerifyDelay)
+	check(em.AggregateDelay.Duration >= 0, "crypto.emulation.aggregate_delay", "must not be negative, got %s", em.AggregateDelay)
+	check(em.SignatureSize >= 16, "crypto.emulation.signature_size", "must be at least 16, got %d", em.SignatureSize)
+	check(c.Network.Codec == "binary" || c.Network.Codec == "protobuf", "network.codec", "must be \"binary\" or \"protobuf\", got %q", c.Network.Codec)
+	check(c.Network.Transport == "tcp" || c.Network.Transport == "quic", "network.transport", "must be \"tcp\" or \"quic\", got %q", c.Network.Transport)
+	check(c.Network.Transport != "quic" || c.Network.TLSDir != "", "network.tls_dir", "must be set for the quic transport")
+	check(c.Network.SendQueue > 0, "network.send_queue", "must be positive, got %d", c.Network.SendQueue)
+	check(c.Network.ReconnectBackoff.Duration > 0, "network.reconnect_backoff", "must be positive, got %s", c.Network.ReconnectBackoff)
+	check(c.Network.MaxReconnectBackoff.Duration >= c.Network.ReconnectBackoff.Duration, "network.max_reconnect_backoff", "must be at least reconnect_backoff (%s), got %s", c.Network.ReconnectBackoff, c.Network.MaxReconnectBackoff)
+	checkLink("network.emulation.link", c.Network.Emulation.Link, check)
+	for i, rule := range c.Network.Emulation.Links {
+		checkLink(fmt.Sprintf("network.emulation.links[%d]", i), rule.LinkConfig, check)
+	}
+	check(c.Quorum.FaultTolerance >= 0, "quorum.fault_tolerance", "must not be negative, got %d", c.Quorum.FaultTolerance)
+	for i, power := range c.Validators.VotingPower {
+		check(power > 0, fmt.Sprintf("validators.voting_power[%d]", i), "must be positive, got %d", power)
+	}
+	check(c.Reconfiguration.SpareNodes >= 0, "reconfiguration.spare_nodes", "must not be negative, got %d", c.Reconfiguration.SpareNodes)
+	for i, event := range c.Reconfiguration.Events {
+		check(event.At.Duration >= 0, fmt.Sprintf("reconfiguration.events[%d].at", i), "must not be negative, got %s", event.At)
+		check(event.VotingPower >= 0, fmt.Sprintf("reconfiguration.events[%d].voting_power", i), "must not be negative, got %d", event.VotingPower)
+	}
+
+	tm := c.Tendermint
+	check(tm.TimeoutPropose.Duration > 0, "tendermint.timeout_propose", "must be positive, got %s", tm.TimeoutPropose)
+	check(tm.TimeoutPrevote.Duration > 0, "tendermint.timeout_prevote", "must be positive, got %s", tm.TimeoutPrevote)
+	check(tm.TimeoutPrecommit.Duration > 0, "tendermint.timeout_precommit", "must be positive, got %s", tm.TimeoutPrecommit)
+	check(tm.TimeoutProposeDelta.Duration >= 0, "tendermint.timeout_propose_delta", "must not be negative, got %s", tm.TimeoutProposeDelta)
+	check(tm.TimeoutPrevoteDelta.Duration >= 0, "tendermint.timeout_prevote_delta", "must not be negative, got %s", tm.TimeoutPrevoteDelta)
+	check(tm.TimeoutPrecommitDelta.Duration >= 0, "tendermint.timeout_precommit_delta", "must not be negative, got %s", tm.TimeoutPrecommitDelta)
+	check(tm.TimeoutBackoff == "linear" || tm.TimeoutBackoff == "exponential", "tendermint.timeout_backoff", "must be \"linear\" or \"exponential\", got %q", tm.TimeoutBackoff)
+	check(tm.TimeoutMax.Duration >= 0, "tendermint.timeout_max", "must not be negative, got %s", tm.TimeoutMax)
+	check(tm.BlockSize > 0, "tendermint.block_size", "must be positive, got %d", tm.BlockSize)
+	check(tm.BufferSize >= 0, "tendermint.buffer_size", "must not be negative, got %d", tm.BufferSize)
+	check(tm.RoundWindow >= 0, "tendermint.round_window", "must not be negative, got %d", tm.RoundWindow)
+
+	hs := c.HotStuff
+	check(hs.Mode == "chained" || hs.Mode == "basic", "hotstuff.mode", "must be \"chained\" or \"basic\", got %q", hs.Mode)
+	check(hs.ViewTimeout.Duration > 0, "hotstuff.view_timeout", "must be positive, got %s", hs.ViewTimeout)
+	check(hs.TimeoutMax.Duration >= 0, "hotstuff.timeout_max", "must not be negative, got %s", hs.TimeoutMax)
+	check(hs.BlockSize > 0, "hotstuff.block_size", "must be positive, got %d", hs.BlockSize)
+	check(hs.BufferSize >= 0, "hotstuff.buffer_size", "must not be negative, got %d", hs.BufferSize)
+
+	pb := c.PBFT
+	check(pb.BatchSize > 0, "pbft.batch_size", "must be positive, got %d", pb.BatchSize)
+	check(pb.BatchInterval.Duration > 0, "pbft.batch_interval", "must be positive, got %s", pb.BatchInterval)
+	check(pb.CheckpointInterval > 0, "pbft.checkpoint_interval", "must be positive, got %d", pb.CheckpointInterval)
+	check(pb.WindowSize >= pb.CheckpointInterval, "pbft.window_size", "must be at least checkpoint_interval (%d), got %d", pb.CheckpointInterval, pb.WindowSize)
+	check(pb.ViewChangeTimeout.Duration > 0, "pbft.view_change_timeout", "must be positive, got %s", pb.ViewChangeTimeout)
+	check(pb.TimeoutMax.Duration >= 0, "pbft.timeout_max", "must not be negative, got %s", pb.TimeoutMax)
+
+	return errors.Join(errs...)
+}
+
+// checkLink validates an emulated link whose fields are under prefix. A missing
+// distribution means a constant delay.
+func checkLink(prefix string, link LinkConfig, check func(ok bool, field, format string, args ...interface{})) {
+	switch link.Distribution {
+	case "", "constant", "normal":
+	case "uniform":
+		check(link.Jitter.Duration <= link.Delay.Duration, prefix+".jitter", "must not exceed delay (%s) for a uniform delay, got %s", link.Delay, link.Jitter)
+	case "pareto":
+		check(link.ParetoShape > 0, prefix+".pareto_shape", "must be positive for a pareto delay, got %g", link.ParetoShape)
+	default:
+		check(false, prefix+".distribution", "must be \"constant\", \"uniform\", \"normal\" or \"pareto\", got %q", link.Distribution)
+	}
+	check(link.Delay.Duration >= 0, prefix+".delay", "must not be negative, got %s", link.Delay)
+	check(link.Jitter.Duration >= 0, prefix+".jitter", "must not be negative, got %s", link.Jitter)
+	check(link.Loss >= 0 && link.Loss <= 1, prefix+".loss", "must be between 0 and 1, got %g", link.Loss)
+	check(link.Duplication >= 0 && link.Duplication <= 1, prefix+".duplication", "must be between 0 and 1, got %g", link.Duplication)
+	check(link.Reordering >= 0 && link.Reordering <= 1, prefix+".reordering", "must be between 0 and 1, got %g", link.Reordering)
+	check(link.BandwidthMbps >= 0, prefix+".bandwidth_mbps", "must not be negative, got %g", link.BandwidthMbps)
+	check(link.QueueSize >= 0, prefix+".queue_size", "must not be negative, got %d", link.QueueSize)
+}
+
+// Duration is a time.Duration that is written as a string such as "1.5s" in config files.
+type Duration struct {
+	time.Duration
+}
+
+// MarshalJSON encodes the duration in its string form.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// Backoff returns base doubled n times, capped by ceiling if it is set. Without a
+// ceiling the doubling stops before it overflows a time.Duration, so that a long run of
+// failures makes the timeout very long rather than negative.
+func Backoff(base time.Duration, n int, ceiling time.Duration) time.Duration {
+	if ceiling <= 0 {
+		ceiling = math.MaxInt64
+	}
+	timeout := base
+	for i := 0; i < n; i++ {
+		if timeout > ceiling/2 {
+			return ceiling
+		}
+		timeout *= 2
+	}
+	return min(timeout, ceiling)
+}
+
+// UnmarshalJSON accepts either a duration string ("500ms") or a number of nanoseconds.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	switch value := v.(type) {
+	case float64:
+		d.Duration = time.Duration(value)
+	case string:
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		d.Duration = parsed
+	default:
+		return fmt.Errorf("invalid duration %s", string(data))
+	}
+	return nil
+}
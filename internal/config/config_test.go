@@ -0,0 +1,283 @@
+package config
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		// Substring of the expected error, or empty if loading succeeds
+		wantErr string
+		check   func(*Config) bool
+	}{
+		{
+			name:    "empty JSON object keeps the defaults",
+			file:    "config.json",
+			content: `{}`,
+			check:   func(c *Config) bool { return reflect.DeepEqual(c, Default()) },
+		},
+		{
+			name:    "JSON overrides",
+			file:    "config.json",
+			content: `{"hotstuff": {"mode": "basic", "view_timeout": "500ms"}, "pbft": {"batch_size": 7}}`,
+			check: func(c *Config) bool {
+				return c.HotStuff.Mode == "basic" && c.HotStuff.ViewTimeout.Duration == 500*time.Millisecond &&
+					c.PBFT.BatchSize == 7 && c.PBFT.WindowSize == Default().PBFT.WindowSize
+			},
+		},
+		{
+			name:    "YAML overrides",
+			file:    "config.yaml",
+			content: "tendermint:\n  timeout_backoff: exponential\n  timeout_propose: 2s\nnode:\n  mempool_size: 50\n",
+			check: func(c *Config) bool {
+				return c.Tendermint.TimeoutBackoff == "exponential" && c.Tendermint.TimeoutPropose.Duration == 2*time.Second &&
+					c.Node.MempoolSize == 50
+			},
+		},
+		{
+			name:    "YAML with the .yml extension",
+			file:    "config.yml",
+			content: "client:\n  count: 3\n",
+			check:   func(c *Config) bool { return c.Client.Count == 3 },
+		},
+		{
+			name:    "empty YAML document keeps the defaults",
+			file:    "config.yaml",
+			content: "",
+			check:   func(c *Config) bool { return reflect.DeepEqual(c, Default()) },
+		},
+		{
+			name:    "unknown JSON field",
+			file:    "config.json",
+			content: `{"hotstuff": {"view_timout": "1s"}}`,
+			wantErr: `unknown field "view_timout"`,
+		},
+		{
+			name:    "unknown YAML field",
+			file:    "config.yaml",
+			content: "pbft:\n  batchsize: 10\n",
+			wantErr: `unknown field "batchsize"`,
+		},
+		{
+			name:    "malformed JSON",
+			file:    "config.json",
+			content: `{"node": `,
+			wantErr: "parsing config",
+		},
+		{
+			name:    "malformed YAML",
+			file:    "config.yaml",
+			content: "node: [mempool_size\n",
+			wantErr: "parsing config",
+		},
+		{
+			name:    "invalid duration",
+			file:    "config.json",
+			content: `{"client": {"interval": "soon"}}`,
+			wantErr: "parsing config",
+		},
+		{
+			name:    "invalid value",
+			file:    "config.json",
+			content: `{"hotstuff": {"mode": "pipelined"}}`,
+			wantErr: "hotstuff.mode",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			cfg, err := Load(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if !tt.check(cfg) {
+				t.Errorf("Load returned %+v", cfg)
+			}
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		if _, err := Load(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+			t.Error("Load succeeded on a missing file")
+		}
+	})
+}
+
+func TestDuration(t *testing.T) {
+	tests := []struct {
+		json    string
+		want    time.Duration
+		wantErr bool
+	}{
+		{`"1.5s"`, 1500 * time.Millisecond, false},
+		{`"250ms"`, 250 * time.Millisecond, false},
+		{`"1m30s"`, 90 * time.Second, false},
+		{`1000000`, time.Millisecond, false},
+		{`"1.5"`, 0, true},
+		{`"soon"`, 0, true},
+		{`true`, 0, true},
+		{`[1]`, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.json, func(t *testing.T) {
+			var d Duration
+			err := d.UnmarshalJSON([]byte(tt.json))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("UnmarshalJSON error = %v, want error: %v", err, tt.wantErr)
+			}
+			if err == nil && d.Duration != tt.want {
+				t.Errorf("UnmarshalJSON = %s, want %s", d.Duration, tt.want)
+			}
+		})
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		d := Duration{1500 * time.Millisecond}
+		data, err := d.MarshalJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != `"1.5s"` {
+			t.Errorf("MarshalJSON = %s, want \"1.5s\"", data)
+		}
+		var back Duration
+		if err := back.UnmarshalJSON(data); err != nil || back != d {
+			t.Errorf("UnmarshalJSON(%s) = %s, %v", data, back.Duration, err)
+		}
+	})
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		base    time.Duration
+		n       int
+		ceiling time.Duration
+		want    time.Duration
+	}{
+		{"no failure", time.Second, 0, time.Minute, time.Second},
+		{"doubled", time.Second, 3, time.Minute, 8 * time.Second},
+		{"capped", time.Second, 6, time.Minute, time.Minute},
+		{"base above the ceiling", 2 * time.Minute, 0, time.Minute, time.Minute},
+		{"no ceiling", time.Second, 10, 0, 1024 * time.Second},
+		{"no ceiling after many failures", time.Second, 40, 0, math.MaxInt64},
+		{"no ceiling after a huge number of failures", time.Second, 1 << 30, 0, math.MaxInt64},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Backoff(tt.base, tt.n, tt.ceiling); got != tt.want {
+				t.Errorf("Backoff(%s, %d, %s) = %s, want %s", tt.base, tt.n, tt.ceiling, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Config)
+		// Fields expected in the error, in order; none if the configuration is valid
+		want []string
+	}{
+		{"defaults", func(c *Config) {}, nil},
+		{"zero mempool", func(c *Config) { c.Node.MempoolSize = 0 }, []string{"node.mempool_size"}},
+		{"negative fault tolerance", func(c *Config) { c.Quorum.FaultTolerance = -1 }, []string{"quorum.fault_tolerance"}},
+		{"unknown backoff", func(c *Config) { c.Tendermint.TimeoutBackoff = "quadratic" }, []string{"tendermint.timeout_backoff"}},
+		{"window below checkpoint interval", func(c *Config) { c.PBFT.WindowSize = c.PBFT.CheckpointInterval - 1 }, []string{"pbft.window_size"}},
+		{
+			name: "threshold signatures with weighted validators",
+			modify: func(c *Config) {
+				c.Crypto.Protocols = map[string]string{"hotstuff": "threshold"}
+				c.Validators.VotingPower = []int64{1, 2}
+				c.Reconfiguration.SpareNodes = 1
+			},
+			want: []string{"validators.voting_power[1]", "reconfiguration.spare_nodes"},
+		},
+		{"emulated loss above 1", func(c *Config) { c.Network.Emulation.Link.Loss = 1.5 }, []string{"network.emulation.link.loss"}},
+		{
+			name: "emulated link rule",
+			modify: func(c *Config) {
+				c.Network.Emulation.Links = []LinkRule{{LinkConfig: LinkConfig{Distribution: "uniform", Delay: Duration{time.Millisecond}, Jitter: Duration{time.Second}}}}
+			},
+			want: []string{"network.emulation.links[0].jitter"},
+		},
+		{
+			name: "every problem is reported",
+			modify: func(c *Config) {
+				c.Client.Interval = Duration{}
+				c.Tendermint.BlockSize = 0
+				c.HotStuff.Mode = ""
+				c.PBFT.ViewChangeTimeout = Duration{-time.Second}
+			},
+			want: []string{"client.interval", "tendermint.block_size", "hotstuff.mode", "pbft.view_change_timeout"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			tt.modify(cfg)
+			err := cfg.Validate()
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Errorf("Validate: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("Validate succeeded")
+			}
+			lines := strings.Split(err.Error(), "\n")
+			if len(lines) != len(tt.want) {
+				t.Fatalf("Validate reported %d problems, want %d:\n%v", len(lines), len(tt.want), err)
+			}
+			for i, field := range tt.want {
+				if !strings.HasPrefix(lines[i], field+": ") {
+					t.Errorf("problem %d is %q, want one about %s", i, lines[i], field)
+				}
+			}
+		})
+	}
+}
+
+func TestLinkFor(t *testing.T) {
+	emulation := NetworkEmulationConfig{
+		Link: LinkConfig{Loss: 0.1},
+		Links: []LinkRule{
+			{From: []uint{0}, To: []uint{1, 2}, LinkConfig: LinkConfig{Loss: 0.2}},
+			{To: []uint{2}, LinkConfig: LinkConfig{Loss: 0.3}},
+		},
+	}
+	tests := []struct {
+		from, to uint
+		want     float64
+	}{
+		{0, 1, 0.2},
+		{0, 2, 0.2}, // The first matching rule wins
+		{1, 2, 0.3},
+		{1, 0, 0.1},
+		{0, 3, 0.1},
+	}
+	for _, tt := range tests {
+		if got := emulation.LinkFor(tt.from, tt.to).Loss; got != tt.want {
+			t.Errorf("LinkFor(%d, %d) has loss %g, want %g", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
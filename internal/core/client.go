@@ -1,39 +1,129 @@
 package core
 
 import (
-	"babel-bft/internal/types"
+	"fmt"
+	"log"
+	"sync"
 	"time"
+
+	"babel-bft/internal/network"
+	"babel-bft/internal/types"
 )
 
+// Client generates a steady stream of transactions and submits them to the replicas.
 type Client struct {
-	nodes    []*core.Node
-	interval time.Duration
-}
-
-func NewClient(nodes []*core.Node, interval time.Duration) *Client {
-	return &Client{nodes: nodes, interval: interval}
-}
-
-func (c *Client) Run() chan<- struct{} {
-	stop := make(chan struct{})
-	go func() {
-		ticker := time.NewTicker(c.interval)
-		defer ticker.Stop()
-		for {
-			select {
-			case <-ticker.C:
-				tx := &types.Transaction{
-					ID:        time.Now().String(),
-					Payload:   []byte("dados da transacao"),
-					Timestamp: time.Now(),
-				}
-				// Envia a transação para um nó aleatório (simulando um ponto de entrada)
-				node := c.nodes[0]
-				node.SubmitEvent(&types.TransactionEvent{Tx: tx})
-			case <-stop:
-				return
+	id        uint
+	transport network.Transport
+	interval  time.Duration
+	stopChan  chan struct{}
+
+	mu        sync.Mutex
+	pending   map[string]*types.Transaction // Submitted transactions not proven committed yet, by hash
+	confirmed int
+}
+
+// NewClient creates a client that submits a transaction through the given transport
+// every interval.
+func NewClient(id uint, transport network.Transport, interval time.Duration) *Client {
+	return &Client{
+		id:        id,
+		transport: transport,
+		interval:  interval,
+		stopChan:  make(chan struct{}),
+		pending:   make(map[string]*types.Transaction),
+	}
+}
+
+// ID returns the client's identifier.
+func (c *Client) ID() uint {
+	return c.id
+}
+
+// Start begins submitting transactions in a separate goroutine.
+func (c *Client) Start() {
+	log.Printf("Client %d starting...", c.id)
+	go c.run()
+}
+
+// Stop terminates the client's submission loop.
+func (c *Client) Stop() {
+	close(c.stopChan)
+}
+
+// SubmitValidatorUpdate sends a special transaction that changes the validator set
+// once committed.
+func (c *Client) SubmitValidatorUpdate(update types.ValidatorUpdate) {
+	tx := &types.Transaction{
+		ClientID:        c.id,
+		Timestamp:       time.Now().UnixNano(),
+		Payload:         []byte(fmt.Sprintf("validator %d power %d", update.ID, update.VotingPower)),
+		ValidatorUpdate: &update,
+	}
+	log.Printf("Client %d: Submitting validator update for %d (power %d)", c.id, update.ID, update.VotingPower)
+	c.submit(tx)
+}
+
+// submit sends a transaction to every replica, so that whichever node proposes next
+// can include it, and keeps it until it is proven committed.
+func (c *Client) submit(tx *types.Transaction) {
+	c.mu.Lock()
+	c.pending[string(tx.Hash())] = tx
+	c.mu.Unlock()
+	c.transport.Broadcast(&types.Message{Type: types.TxMsg, From: c.id, Payload: tx})
+}
+
+// Pending returns the hashes of the submitted transactions not proven committed yet.
+func (c *Client) Pending() [][]byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	hashes := make([][]byte, 0, len(c.pending))
+	for hash := range c.pending {
+		hashes = append(hashes, []byte(hash))
+	}
+	return hashes
+}
+
+// Confirm checks that a proof shows one of the client's transactions to be part of the
+// committed block with the given hash, and marks the transaction as committed.
+func (c *Client) Confirm(proof *types.TxProof, blockHash []byte) error {
+	if err := proof.Verify(blockHash); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	hash := string(proof.Tx.Hash())
+	if _, ok := c.pending[hash]; !ok {
+		return fmt.Errorf("transaction %x is not pending at client %d", hash, c.id)
+	}
+	delete(c.pending, hash)
+	c.confirmed++
+	return nil
+}
+
+// Confirmed returns the number of transactions proven committed.
+func (c *Client) Confirmed() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.confirmed
+}
+
+func (c *Client) run() {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	seq := 0
+	for {
+		select {
+		case <-ticker.C:
+			seq++
+			tx := &types.Transaction{
+				ClientID:  c.id,
+				Timestamp: time.Now().UnixNano(),
+				Payload:   []byte(fmt.Sprintf("client %d tx %d", c.id, seq)),
 			}
+			c.submit(tx)
+		case <-c.stopChan:
+			return
 		}
-	}()
-	return stop
+	}
 }
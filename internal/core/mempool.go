@@ -0,0 +1,93 @@
+package core
+
+import (
+	"sync"
+
+	"babel-bft/internal/types"
+)
+
+// txKey identifies a transaction in the mempool.
+type txKey struct {
+	clientID  uint
+	timestamp int64
+	payload   string
+}
+
+func keyOf(tx *types.Transaction) txKey {
+	return txKey{clientID: tx.ClientID, timestamp: tx.Timestamp, payload: string(tx.Payload)}
+}
+
+// Mempool holds the transactions received from clients that have not been committed yet.
+// Transactions are kept in arrival order so proposals are roughly FIFO.
+type Mempool struct {
+	mu       sync.Mutex
+	txs      []*types.Transaction
+	pending  map[txKey]struct{}
+	capacity int
+}
+
+// NewMempool creates a mempool that holds at most capacity transactions.
+func NewMempool(capacity int) *Mempool {
+	return &Mempool{
+		pending:  make(map[txKey]struct{}),
+		capacity: capacity,
+	}
+}
+
+// Add inserts a transaction. It returns false if the transaction is already
+// pending or the mempool is full.
+func (m *Mempool) Add(tx *types.Transaction) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := keyOf(tx)
+	if _, ok := m.pending[key]; ok || len(m.txs) >= m.capacity {
+		return false
+	}
+	m.pending[key] = struct{}{}
+	m.txs = append(m.txs, tx)
+	return true
+}
+
+// Reap returns up to max of the oldest pending transactions without removing them.
+func (m *Mempool) Reap(max int) []*types.Transaction {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if max > len(m.txs) {
+		max = len(m.txs)
+	}
+	return append([]*types.Transaction(nil), m.txs[:max]...)
+}
+
+// Remove drops the given transactions, typically because they were committed.
+func (m *Mempool) Remove(txs []*types.Transaction) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	removed := make(map[txKey]struct{}, len(txs))
+	for _, tx := range txs {
+		key := keyOf(tx)
+		if _, ok := m.pending[key]; ok {
+			removed[key] = struct{}{}
+			delete(m.pending, key)
+		}
+	}
+	if len(removed) == 0 {
+		return
+	}
+	kept := m.txs[:0]
+	for _, tx := range m.txs {
+		if _, ok := removed[keyOf(tx)]; !ok {
+			kept = append(kept, tx)
+		}
+	}
+	m.txs = kept
+}
+
+// Size returns the number of pending transactions.
+func (m *Mempool) Size() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.txs)
+}
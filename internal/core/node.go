@@ -1,9 +1,14 @@
 package core
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
 	"log"
-	"time"
+	"sync"
 
+	"babel-bft/internal/config"
+	"babel-bft/internal/crypto"
 	"babel-bft/internal/network"
 	"babel-bft/internal/protocols"
 	"babel-bft/internal/types"
@@ -17,45 +22,89 @@ type Node struct {
 	Engine     protocols.Consensus
 	msgChan    chan *types.Message
 	stopChan   chan struct{}
-	quorumSize int
+	stopOnce   sync.Once
+	validators []epoch // Validator sets by the height they take effect at, in height order
+	mempool    *Mempool
+	crypto     crypto.Provider
+
+	mu          sync.RWMutex
+	ledger      []*types.Block        // Committed blocks, indexed by height-1
+	appHash     []byte                // Application state after the last committed block
+	txIndex     map[string]txLocation // Where each committed transaction is, by hash
+	updateDelay int                   // Heights between committing a validator update and applying it
+	err         error                 // Why the node halted, if it did
+}
+
+// txLocation is the position of a committed transaction in the ledger.
+type txLocation struct {
+	height int
+	index  int
+}
+
+// epoch is a validator set together with the first height it is in effect at.
+type epoch struct {
+	from int
+	set  *types.ValidatorSet
 }
 
 // NewNode creates and initializes a new consensus node.
-func NewNode(id uint, transport network.Transport, engine protocols.Consensus, quorum int) *Node {
-	return &Node{
-		id:         id,
-		Transport:  transport,
-		Engine:     engine,
-		msgChan:    make(chan *types.Message, 100), // Buffered channel
-		stopChan:   make(chan struct{}),
-		quorumSize: quorum,
+// The node registers with the transport right away, so messages sent to it before
+// Start is called are queued rather than lost. validators is the set at the first
+// height and provider signs the node's messages; cfg sizes the node's mempool and
+// inbox and sets the validator update delay.
+func NewNode(id uint, transport network.Transport, engine protocols.Consensus, validators *types.ValidatorSet, provider crypto.Provider, cfg config.NodeConfig) *Node {
+	n := &Node{
+		id:          id,
+		Transport:   transport,
+		Engine:      engine,
+		msgChan:     make(chan *types.Message, cfg.InboxSize), // Buffered channel
+		stopChan:    make(chan struct{}),
+		validators:  []epoch{{from: 1, set: validators}},
+		mempool:     NewMempool(cfg.MempoolSize),
+		txIndex:     make(map[string]txLocation),
+		appHash:     genesisAppHash(),
+		updateDelay: cfg.ValidatorUpdateDelay,
+		crypto:      provider,
 	}
+	transport.RegisterNodeChan(id, n.msgChan)
+	return n
 }
 
 // Start initiates the node's main event loop in a separate goroutine.
 func (n *Node) Start() {
-	log.Printf("Node %d starting...", n.ID)
-	n.Transport.RegisterNodeChan(n.id, n.msgChan)
+	log.Printf("Node %d starting...", n.id)
 	n.Engine.SetNode(n) // Provide the consensus engine with access to the node's interface
 	go n.run()
+	n.Engine.Start()
 }
 
-// Stop terminates the node's event loop.
+// Stop terminates the node's event loop, and the engine's own goroutines if it has any.
+// It may be called again once the node halted on its own.
 func (n *Node) Stop() {
-	close(n.stopChan)
+	n.stopOnce.Do(func() {
+		close(n.stopChan)
+		if engine, ok := n.Engine.(protocols.Stoppable); ok {
+			engine.Stop()
+		}
+	})
 }
 
 // The main event loop of the node. It listens for incoming messages
 // and passes them to the consensus engine for processing.
 func (n *Node) run() {
-	log.Printf("Node %d is running.", n.ID)
+	log.Printf("Node %d is running.", n.id)
 	for {
 		select {
 		case msg := <-n.msgChan:
+			// Client transactions wait in the mempool until a proposer picks them up
+			if tx, ok := msg.Payload.(*types.Transaction); ok {
+				n.mempool.Add(tx)
+				continue
+			}
 			// Forward the message to the consensus engine
 			n.Engine.HandleMessage(msg.From, msg)
 		case <-n.stopChan:
-			log.Printf("Node %d stopping.", n.ID)
+			log.Printf("Node %d stopping.", n.id)
 			return
 		}
 	}
@@ -64,25 +113,217 @@ func (n *Node) run() {
 // Broadcast sends a message to all other nodes in the network.
 // This method implements the types.NodeInterface.
 func (n *Node) Broadcast(msg *types.Message) {
-	msg.From = n.ID
+	msg.From = n.id
+	if !n.sign(msg) {
+		return
+	}
 	n.Transport.Broadcast(msg)
 }
 
 // Send directs a message to a specific recipient node.
 // This method implements the types.NodeInterface.
 func (n *Node) Send(recipientID uint, msg *types.Message) {
-	msg.From = n.ID
+	msg.From = n.id
+	if !n.sign(msg) {
+		return
+	}
 	n.Transport.Send(recipientID, msg)
 }
 
+// sign attaches the node's signature to messages with a Signable payload, unless the
+// protocol already signed it, for instance to keep its own vote for a certificate.
+// It returns false if signing failed and the message must not be sent.
+func (n *Node) sign(msg *types.Message) bool {
+	payload, ok := msg.Payload.(types.Signable)
+	if !ok || msg.Signature != nil {
+		return true
+	}
+	sig, err := n.crypto.Sign(payload.SignBytes())
+	if err != nil {
+		log.Printf("Node %d: Failed to sign message of type %d: %v", n.id, msg.Type, err)
+		return false
+	}
+	msg.Signature = sig
+	return true
+}
+
+// Crypto returns the node's signature provider.
+// This method implements the types.NodeInterface.
+func (n *Node) Crypto() crypto.Provider {
+	return n.crypto
+}
+
 // id returns the node's unique identifier.
 // This method implements the types.NodeInterface.
 func (n *Node) ID() uint {
 	return n.id
 }
 
-// QuorumSize returns the number of replicas in the system.
+// Validators returns the validator set for the next height to be committed.
+// This method implements the types.NodeInterface.
+func (n *Node) Validators() *types.ValidatorSet {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.validatorsAt(len(n.ledger) + 1)
+}
+
+// ValidatorsAt returns the validator set in effect at the given height.
+// This method implements the types.NodeInterface.
+func (n *Node) ValidatorsAt(height int) *types.ValidatorSet {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.validatorsAt(height)
+}
+
+func (n *Node) validatorsAt(height int) *types.ValidatorSet {
+	i := len(n.validators) - 1
+	for i > 0 && n.validators[i].from > height {
+		i--
+	}
+	return n.validators[i].set
+}
+
+// ReapTransactions returns up to max pending client transactions for a new proposal.
+// This method implements the types.NodeInterface.
+func (n *Node) ReapTransactions(max int) []*types.Transaction {
+	return n.mempool.Reap(max)
+}
+
+// Commit executes a block decided by the consensus engine and appends it to the ledger.
+// A decided block that does not extend the ledger means the replicas no longer agree on
+// the chain, so the node halts rather than execute anything else.
+// This method implements the types.NodeInterface.
+func (n *Node) Commit(height int, block *types.Block) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.err != nil {
+		return
+	}
+
+	if height != len(n.ledger)+1 {
+		log.Printf("Node %d: Ignoring commit for height %d, expected height %d", n.id, height, len(n.ledger)+1)
+		return
+	}
+	if err := n.validateChain(height, block); err != nil {
+		n.err = fmt.Errorf("decided %s at height %d: %w", block, height, err)
+		log.Printf("Node %d: Halting: %v", n.id, n.err)
+		// Stopping does not wait for the engine, which calls Commit with its lock held.
+		n.Stop()
+		return
+	}
+	n.ledger = append(n.ledger, block)
+	n.appHash = nextAppHash(n.appHash, block)
+	for i, tx := range block.Transactions {
+		n.txIndex[string(tx.Hash())] = txLocation{height: height, index: i}
+	}
+	n.mempool.Remove(block.Transactions)
+	log.Printf("Node %d: Executed block at height %d with %d transactions", n.id, height, len(block.Transactions))
+	n.applyValidatorUpdates(height, block)
+}
+
+// validateChain checks that a chained block extends the last committed block and was
+// proposed on top of the current application state.
+func (n *Node) validateChain(height int, block *types.Block) error {
+	if block.Height == 0 {
+		return nil // Unchained
+	}
+	if block.Height != height {
+		return fmt.Errorf("block is for height %d", block.Height)
+	}
+	var parent *types.Block
+	if height > 1 {
+		parent = n.ledger[height-2]
+	}
+	if err := block.ValidateParent(parent); err != nil {
+		return err
+	}
+	if block.AppHash != nil && !bytes.Equal(block.AppHash, n.appHash) {
+		return fmt.Errorf("app hash %x does not match the state %x", block.AppHash, n.appHash)
+	}
+	return nil
+}
+
+// genesisAppHash returns the hash of the initial, empty application state.
+func genesisAppHash() []byte {
+	hash := sha256.Sum256(nil)
+	return hash[:]
+}
+
+// nextAppHash returns the application state after executing block on the state with
+// the given hash. The application only records the history of blocks it executed.
+func nextAppHash(appHash []byte, block *types.Block) []byte {
+	h := sha256.New()
+	h.Write(appHash)
+	h.Write(block.Hash())
+	return h.Sum(nil)
+}
+
+// AppHash returns the hash of the application state after the last committed block.
 // This method implements the types.NodeInterface.
-func (n *Node) QuorumSize() int {
-	return n.quorumSize
+func (n *Node) AppHash() []byte {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.appHash
+}
+
+// applyValidatorUpdates schedules the validator set resulting from the updates in a
+// block committed at height, to take effect updateDelay heights later. Updates that
+// would leave an invalid set are dropped; every replica drops the same ones.
+func (n *Node) applyValidatorUpdates(height int, block *types.Block) {
+	var updates []types.ValidatorUpdate
+	for _, tx := range block.Transactions {
+		if tx.ValidatorUpdate != nil {
+			updates = append(updates, *tx.ValidatorUpdate)
+		}
+	}
+	if len(updates) == 0 {
+		return
+	}
+	// Updates are scheduled in height order, so the latest set is the one to build on.
+	latest := n.validators[len(n.validators)-1].set
+	next, err := latest.Apply(updates)
+	if err != nil {
+		log.Printf("Node %d: Dropping validator updates committed at height %d: %v", n.id, height, err)
+		return
+	}
+	from := height + n.updateDelay
+	n.validators = append(n.validators, epoch{from: from, set: next})
+	log.Printf("Node %d: Validator set changes at height %d: n=%d, total power=%d, f=%d", n.id, from, next.N(), next.TotalPower(), next.F())
+}
+
+// Err returns why the node halted, or nil if it did not.
+func (n *Node) Err() error {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.err
+}
+
+// Height returns the height of the last committed block.
+func (n *Node) Height() int {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return len(n.ledger)
+}
+
+// TxProof returns the height of the block that committed the transaction with the
+// given hash, and the proof of its inclusion in that block.
+func (n *Node) TxProof(txHash []byte) (int, *types.TxProof, error) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	loc, ok := n.txIndex[string(txHash)]
+	if !ok {
+		return 0, nil, fmt.Errorf("transaction %x is not committed", txHash)
+	}
+	proof, err := n.ledger[loc.height-1].TxProof(loc.index)
+	return loc.height, proof, err
+}
+
+// Block returns the committed block at the given height, or nil if it is not committed yet.
+func (n *Node) Block(height int) *types.Block {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if height < 1 || height > len(n.ledger) {
+		return nil
+	}
+	return n.ledger[height-1]
 }
@@ -0,0 +1,65 @@
+package core
+
+import (
+	"io"
+	"log"
+	"os"
+	"testing"
+
+	"babel-bft/internal/config"
+	"babel-bft/internal/network"
+	"babel-bft/internal/types"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// stoppableEngine is an engine that does nothing but record that it was stopped.
+type stoppableEngine struct {
+	stopped int
+}
+
+func (e *stoppableEngine) HandleMessage(senderID uint, msg *types.Message) bool { return false }
+func (e *stoppableEngine) CurrentState() interface{}                            { return nil }
+func (e *stoppableEngine) SetNode(node types.NodeInterface)                     {}
+func (e *stoppableEngine) Start()                                               {}
+func (e *stoppableEngine) Stop()                                                { e.stopped++ }
+
+func TestCommitHalts(t *testing.T) {
+	validators, err := types.NewUniformValidatorSet([]uint{0, 1, 2, 3}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := &stoppableEngine{}
+	n := NewNode(0, network.NewLocalTransport(4, nil), engine, validators, nil, config.Default().Node)
+	n.Start()
+
+	first := types.NewBlock(types.Header{Height: 1, AppHash: n.AppHash()}, nil, nil)
+	n.Commit(1, first)
+	if h := n.Height(); h != 1 || n.Err() != nil {
+		t.Fatalf("height %d (halted: %v) after committing the first block, want 1", h, n.Err())
+	}
+
+	// A block that does not extend the ledger halts the node.
+	n.Commit(2, types.NewBlock(types.Header{Height: 2, ParentHash: []byte("another parent")}, nil, nil))
+	if n.Err() == nil {
+		t.Fatal("committing a block with another parent did not halt the node")
+	}
+	if engine.stopped != 1 {
+		t.Errorf("engine stopped %d times, want once", engine.stopped)
+	}
+
+	// Nothing is committed after the node halted, even a block that extends the ledger.
+	n.Commit(2, types.NewBlock(types.Header{Height: 2, ParentHash: first.Hash(), AppHash: n.AppHash()}, nil, nil))
+	if h := n.Height(); h != 1 {
+		t.Errorf("halted node reached height %d, want 1", h)
+	}
+
+	// Stopping the halted node at the end of the run is harmless.
+	n.Stop()
+	if engine.stopped != 1 {
+		t.Errorf("engine stopped %d times, want once", engine.stopped)
+	}
+}
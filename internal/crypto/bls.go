@@ -0,0 +1,110 @@
+// File: internal/crypto/bls.go
+package crypto
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/cloudflare/circl/ecc/bls12381"
+	"github.com/cloudflare/circl/sign/bls"
+)
+
+// blsKeys places public keys in G2 and signatures in G1, which keeps signatures,
+// and therefore certificates, at 48 bytes.
+type blsKeys = bls.KeyG2SigG1
+
+// BLSProvider signs with BLS over the BLS12-381 curve. Signatures over the same data
+// aggregate into a single signature, so its certificates have a constant size no
+// matter how many replicas signed. Keys come from a trusted setup, which rules out
+// rogue-key attacks on the aggregates without proofs of possession.
+type BLSProvider struct {
+	privateKey *bls.PrivateKey[blsKeys]
+	publicKeys map[uint]*bls.PublicKey[blsKeys]
+}
+
+// NewBLSProvider creates a provider that signs with privateKey and verifies
+// signatures of the replicas listed in publicKeys.
+func NewBLSProvider(privateKey *bls.PrivateKey[blsKeys], publicKeys map[uint]*bls.PublicKey[blsKeys]) *BLSProvider {
+	return &BLSProvider{privateKey: privateKey, publicKeys: publicKeys}
+}
+
+// GenerateBLSKeys generates a fresh key pair for each of the given replicas, in order,
+// from the random bytes read from random.
+func GenerateBLSKeys(ids []uint, random io.Reader) (map[uint]*bls.PrivateKey[blsKeys], map[uint]*bls.PublicKey[blsKeys], error) {
+	privateKeys := make(map[uint]*bls.PrivateKey[blsKeys], len(ids))
+	publicKeys := make(map[uint]*bls.PublicKey[blsKeys], len(ids))
+	for _, id := range ids {
+		ikm := make([]byte, 32)
+		if _, err := io.ReadFull(random, ikm); err != nil {
+			return nil, nil, fmt.Errorf("generating key of replica %d: %w", id, err)
+		}
+		priv, err := bls.KeyGen[blsKeys](ikm, nil, nil)
+		if err != nil {
+			return nil, nil, fmt.Errorf("generating key of replica %d: %w", id, err)
+		}
+		privateKeys[id] = priv
+		publicKeys[id] = priv.PublicKey()
+	}
+	return privateKeys, publicKeys, nil
+}
+
+// Sign returns the BLS signature of data.
+func (p *BLSProvider) Sign(data []byte) ([]byte, error) {
+	return bls.Sign(p.privateKey, data), nil
+}
+
+// Verify checks sig against the public key of signer. Unknown signers never verify.
+func (p *BLSProvider) Verify(signer uint, data, sig []byte) bool {
+	pub, ok := p.publicKeys[signer]
+	if !ok {
+		return false
+	}
+	return bls.Verify(pub, data, sig)
+}
+
+// Aggregate adds up the signatures into a single one.
+func (p *BLSProvider) Aggregate(data []byte, sigs map[uint][]byte) (*Certificate, error) {
+	if len(sigs) == 0 {
+		return nil, fmt.Errorf("no signatures to aggregate")
+	}
+	cert := &Certificate{Signers: sortedSigners(sigs)}
+	list := make([]bls.Signature, len(cert.Signers))
+	for i, id := range cert.Signers {
+		list[i] = sigs[id]
+	}
+	aggregate, err := bls.Aggregate(blsKeys{}, list)
+	if err != nil {
+		return nil, err
+	}
+	cert.Signature = aggregate
+	return cert, nil
+}
+
+// VerifyCertificate checks the aggregate signature against the sum of the signers'
+// public keys, which takes two pairings however many replicas signed.
+func (p *BLSProvider) VerifyCertificate(data []byte, cert *Certificate) bool {
+	if cert == nil || len(cert.Signers) == 0 {
+		return false
+	}
+	var sum, point bls12381.G2
+	sum.SetIdentity()
+	for i, id := range cert.Signers {
+		if i > 0 && id <= cert.Signers[i-1] {
+			return false // Signers must be sorted and distinct
+		}
+		pub, ok := p.publicKeys[id]
+		if !ok {
+			return false
+		}
+		raw, err := pub.MarshalBinary()
+		if err != nil || point.SetBytes(raw) != nil {
+			return false
+		}
+		sum.Add(&sum, &point)
+	}
+	var aggregate bls.PublicKey[blsKeys]
+	if aggregate.UnmarshalBinary(sum.BytesCompressed()) != nil {
+		return false
+	}
+	return bls.Verify(&aggregate, data, cert.Signature)
+}
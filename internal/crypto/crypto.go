@@ -0,0 +1,162 @@
+// File: internal/crypto/crypto.go
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	mathrand "math/rand/v2"
+	"sort"
+)
+
+// Provider signs data on behalf of the local replica and verifies signatures made
+// by any replica. It also combines signatures over the same data into certificates.
+// Protocols only see this interface, so signature schemes can be swapped through
+// the configuration.
+type Provider interface {
+	// Sign returns the local replica's signature over data.
+	Sign(data []byte) ([]byte, error)
+
+	// Verify reports whether sig is a valid signature by signer over data.
+	Verify(signer uint, data, sig []byte) bool
+
+	// Aggregate combines signatures over data, keyed by signer, into a certificate.
+	// The signatures are expected to have been verified already.
+	Aggregate(data []byte, sigs map[uint][]byte) (*Certificate, error)
+
+	// VerifyCertificate reports whether cert proves that each of its signers signed data.
+	VerifyCertificate(data []byte, cert *Certificate) bool
+}
+
+// Certificate proves that a group of replicas signed the same data, such as the votes
+// of a quorum. Depending on the scheme, Signature is the concatenation of the
+// individual signatures, in Signers order, or a single aggregate signature.
+type Certificate struct {
+	Signers   []uint // Sorted
+	Signature []byte
+}
+
+// Size returns the number of bytes the certificate takes on the wire: its signature
+// plus a bitmap of the signers.
+func (c *Certificate) Size() int {
+	if c == nil {
+		return 0
+	}
+	size := len(c.Signature)
+	if n := len(c.Signers); n > 0 {
+		size += int(c.Signers[n-1]/8) + 1
+	}
+	return size
+}
+
+// sortedSigners returns the signers of sigs in ascending order.
+func sortedSigners(sigs map[uint][]byte) []uint {
+	signers := make([]uint, 0, len(sigs))
+	for id := range sigs {
+		signers = append(signers, id)
+	}
+	sort.Slice(signers, func(i, j int) bool { return signers[i] < signers[j] })
+	return signers
+}
+
+// Signature schemes, selected by the "scheme" field of the crypto config.
+const (
+	SchemeEd25519 = "ed25519"
+	SchemeBLS     = "bls"
+	SchemeMAC     = "mac"
+	SchemeNone    = "none"
+)
+
+// Schemes lists the available signature schemes.
+func Schemes() []string {
+	return []string{SchemeEd25519, SchemeBLS, SchemeMAC, SchemeNone}
+}
+
+// KeySource returns the source of random bytes that keys are generated from. An empty
+// seed gives fresh keys from the system's secure generator. Any other seed gives a
+// deterministic stream, so that replicas running as separate processes can each
+// generate the keys of the whole group and obtain the same ones. Anyone who knows the
+// seed knows every key, which is only acceptable for experiments.
+func KeySource(seed string) io.Reader {
+	if seed == "" {
+		return rand.Reader
+	}
+	return mathrand.NewChaCha8(sha256.Sum256([]byte(seed)))
+}
+
+// Setup generates the keys of a group of replicas in one place, from the random bytes
+// read from random, and returns the provider of each replica along with the public keys
+// that identify them. Schemes without keys return nil public keys.
+func Setup(scheme string, ids []uint, random io.Reader) (map[uint]Provider, map[uint][]byte, error) {
+	ids = append([]uint(nil), ids...)
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	providers := make(map[uint]Provider, len(ids))
+	switch scheme {
+	case SchemeEd25519:
+		privateKeys, publicKeys, err := GenerateEd25519Keys(ids, random)
+		if err != nil {
+			return nil, nil, err
+		}
+		pubKeys := make(map[uint][]byte, len(ids))
+		for _, id := range ids {
+			providers[id] = NewEd25519Provider(privateKeys[id], publicKeys)
+			pubKeys[id] = publicKeys[id]
+		}
+		return providers, pubKeys, nil
+	case SchemeBLS:
+		privateKeys, publicKeys, err := GenerateBLSKeys(ids, random)
+		if err != nil {
+			return nil, nil, err
+		}
+		pubKeys := make(map[uint][]byte, len(ids))
+		for _, id := range ids {
+			providers[id] = NewBLSProvider(privateKeys[id], publicKeys)
+			if pubKeys[id], err = publicKeys[id].MarshalBinary(); err != nil {
+				return nil, nil, err
+			}
+		}
+		return providers, pubKeys, nil
+	case SchemeMAC:
+		keys, err := GenerateMACKeys(ids, random)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, id := range ids {
+			providers[id] = NewMACProvider(id, keys[id])
+		}
+		return providers, nil, nil
+	case SchemeNone:
+		for _, id := range ids {
+			providers[id] = NoopProvider{}
+		}
+		return providers, nil, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown signature scheme %q (available: %v)", scheme, Schemes())
+	}
+}
+
+// NoopProvider produces empty signatures and accepts every signature. It disables
+// authentication, for experiments that only model crash faults.
+type NoopProvider struct{}
+
+// Sign returns an empty signature.
+func (NoopProvider) Sign(data []byte) ([]byte, error) {
+	return nil, nil
+}
+
+// Verify accepts any signature.
+func (NoopProvider) Verify(signer uint, data, sig []byte) bool {
+	return true
+}
+
+// Aggregate returns a certificate with the signers and no signature.
+func (NoopProvider) Aggregate(data []byte, sigs map[uint][]byte) (*Certificate, error) {
+	return &Certificate{Signers: sortedSigners(sigs)}, nil
+}
+
+// VerifyCertificate accepts any certificate.
+func (NoopProvider) VerifyCertificate(data []byte, cert *Certificate) bool {
+	return true
+}
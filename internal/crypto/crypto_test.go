@@ -0,0 +1,375 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEd25519(t *testing.T) {
+	ids := []uint{0, 1, 2, 3}
+	providers, pubKeys, err := Setup(SchemeEd25519, ids, rand.Reader)
+	if err != nil {
+		t.Fatalf("Setup: %v", err)
+	}
+	if len(providers) != len(ids) || len(pubKeys) != len(ids) {
+		t.Fatalf("Setup returned %d providers and %d public keys, want %d", len(providers), len(pubKeys), len(ids))
+	}
+
+	data := []byte("vote for block 1")
+	sig, err := providers[1].Sign(data)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	tampered := append([]byte(nil), sig...)
+	tampered[0] ^= 1
+
+	tests := []struct {
+		name   string
+		signer uint
+		data   []byte
+		sig    []byte
+		want   bool
+	}{
+		{"valid", 1, data, sig, true},
+		{"claimed by another replica", 2, data, sig, false},
+		{"unknown signer", 9, data, sig, false},
+		{"other data", 1, []byte("vote for block 2"), sig, false},
+		{"tampered signature", 1, data, tampered, false},
+		{"truncated signature", 1, data, sig[:len(sig)-1], false},
+		{"missing signature", 1, data, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Every replica reaches the same verdict.
+			for id, p := range providers {
+				if got := p.Verify(tt.signer, tt.data, tt.sig); got != tt.want {
+					t.Errorf("replica %d: Verify = %v, want %v", id, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSetup(t *testing.T) {
+	providers, pubKeys, err := Setup(SchemeNone, []uint{0, 1}, rand.Reader)
+	if err != nil {
+		t.Fatalf("Setup: %v", err)
+	}
+	if pubKeys != nil {
+		t.Errorf("scheme %q returned public keys", SchemeNone)
+	}
+	if !providers[0].Verify(1, []byte("data"), nil) {
+		t.Errorf("scheme %q rejected a signature", SchemeNone)
+	}
+
+	if _, _, err := Setup("rsa", []uint{0, 1}, rand.Reader); err == nil {
+		t.Error("Setup accepted an unknown scheme")
+	}
+}
+
+func TestKeySource(t *testing.T) {
+	ids := []uint{0, 1, 2, 3}
+	for _, scheme := range []string{SchemeEd25519, SchemeBLS, SchemeMAC} {
+		t.Run(scheme, func(t *testing.T) {
+			_, first, err := Setup(scheme, ids, KeySource("experiment"))
+			if err != nil {
+				t.Fatalf("Setup: %v", err)
+			}
+			_, again, err := Setup(scheme, ids, KeySource("experiment"))
+			if err != nil {
+				t.Fatalf("Setup: %v", err)
+			}
+			_, other, err := Setup(scheme, ids, KeySource("other"))
+			if err != nil {
+				t.Fatalf("Setup: %v", err)
+			}
+			if first == nil {
+				return // MAC keys are secret, so the comparison goes through signatures below
+			}
+			if !reflect.DeepEqual(first, again) {
+				t.Error("the same seed gave different keys")
+			}
+			if reflect.DeepEqual(first, other) {
+				t.Error("different seeds gave the same keys")
+			}
+		})
+	}
+
+	// Replicas that generate the group's keys separately sign for each other.
+	mine, _, err := Setup(SchemeMAC, ids, KeySource("experiment"))
+	if err != nil {
+		t.Fatalf("Setup: %v", err)
+	}
+	theirs, _, err := Setup(SchemeMAC, ids, KeySource("experiment"))
+	if err != nil {
+		t.Fatalf("Setup: %v", err)
+	}
+	sig, err := mine[0].Sign([]byte("data"))
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	if !theirs[1].Verify(0, []byte("data"), sig) {
+		t.Error("replica 1 rejects replica 0's signature from separately generated keys")
+	}
+}
+
+func TestCertificate(t *testing.T) {
+	for _, scheme := range []string{SchemeEd25519, SchemeBLS, SchemeMAC} {
+		t.Run(scheme, func(t *testing.T) {
+			ids := []uint{0, 1, 2, 3}
+			providers, _, err := Setup(scheme, ids, rand.Reader)
+			if err != nil {
+				t.Fatalf("Setup: %v", err)
+			}
+			data := []byte("vote for block 1")
+			sign := func(signer uint, data []byte) []byte {
+				sig, err := providers[signer].Sign(data)
+				if err != nil {
+					t.Fatalf("Sign: %v", err)
+				}
+				return sig
+			}
+			aggregate := func(sigs map[uint][]byte) *Certificate {
+				cert, err := providers[0].Aggregate(data, sigs)
+				if err != nil {
+					t.Fatalf("Aggregate: %v", err)
+				}
+				return cert
+			}
+
+			valid := aggregate(map[uint][]byte{3: sign(3, data), 1: sign(1, data), 2: sign(2, data)})
+			if want := []uint{1, 2, 3}; !reflect.DeepEqual(valid.Signers, want) {
+				t.Fatalf("certificate signers = %v, want %v", valid.Signers, want)
+			}
+			// One signature is made by a replica other than the signer it is filed under.
+			impersonated := aggregate(map[uint][]byte{1: sign(1, data), 2: sign(3, data), 3: sign(3, data)})
+			// One replica signed other data.
+			mixed := aggregate(map[uint][]byte{1: sign(1, data), 2: sign(2, []byte("vote for block 2")), 3: sign(3, data)})
+
+			tests := []struct {
+				name string
+				data []byte
+				cert *Certificate
+				want bool
+			}{
+				{"valid", data, valid, true},
+				{"other data", []byte("vote for block 2"), valid, false},
+				{"signer added", data, &Certificate{Signers: []uint{0, 1, 2, 3}, Signature: valid.Signature}, false},
+				{"signer removed", data, &Certificate{Signers: []uint{1, 2}, Signature: valid.Signature}, false},
+				{"signer replaced", data, &Certificate{Signers: []uint{0, 2, 3}, Signature: valid.Signature}, false},
+				{"unsorted signers", data, &Certificate{Signers: []uint{2, 1, 3}, Signature: valid.Signature}, false},
+				{"unknown signer", data, &Certificate{Signers: []uint{1, 2, 9}, Signature: valid.Signature}, false},
+				{"impersonated signer", data, impersonated, false},
+				{"signature over other data", data, mixed, false},
+				{"no signers", data, &Certificate{Signature: valid.Signature}, false},
+				{"missing certificate", data, nil, false},
+			}
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					for id, p := range providers {
+						if got := p.VerifyCertificate(tt.data, tt.cert); got != tt.want {
+							t.Errorf("replica %d: VerifyCertificate = %v, want %v", id, got, tt.want)
+						}
+					}
+				})
+			}
+
+			if _, err := providers[0].Aggregate(data, nil); err == nil {
+				t.Error("Aggregate succeeded without signatures")
+			}
+		})
+	}
+}
+
+func TestCertificateSize(t *testing.T) {
+	data := []byte("vote for block 1")
+	for _, tt := range []struct {
+		scheme string
+		// Size of the signature part of a certificate with n signers
+		signature func(n int) int
+	}{
+		{SchemeEd25519, func(n int) int { return 64 * n }},
+		{SchemeBLS, func(n int) int { return 48 }},
+		{SchemeMAC, func(n int) int { return 20 * MACSize * n }}, // One MAC per replica and signer
+	} {
+		t.Run(tt.scheme, func(t *testing.T) {
+			ids := make([]uint, 20)
+			for i := range ids {
+				ids[i] = uint(i)
+			}
+			providers, _, err := Setup(tt.scheme, ids, rand.Reader)
+			if err != nil {
+				t.Fatalf("Setup: %v", err)
+			}
+			for _, n := range []int{1, 7, 20} {
+				sigs := make(map[uint][]byte, n)
+				for _, id := range ids[:n] {
+					if sigs[id], err = providers[id].Sign(data); err != nil {
+						t.Fatalf("Sign: %v", err)
+					}
+				}
+				m := NewMetered(providers[0])
+				cert, err := m.Aggregate(data, sigs)
+				if err != nil {
+					t.Fatalf("Aggregate: %v", err)
+				}
+				// The signature plus a bitmap covering the highest signer.
+				want := tt.signature(n) + (n-1)/8 + 1
+				if cert.Size() != want {
+					t.Errorf("certificate of %d signers takes %d bytes, want %d", n, cert.Size(), want)
+				}
+				if !m.VerifyCertificate(data, cert) {
+					t.Errorf("certificate of %d signers does not verify", n)
+				}
+				stats := m.Stats()
+				if stats.Aggregates != 1 || stats.CertificateChecks != 1 || stats.CertificateBytes != int64(want) {
+					t.Errorf("stats = %+v, want one aggregate of %d bytes and one check", stats, want)
+				}
+			}
+		})
+	}
+}
+
+func TestMAC(t *testing.T) {
+	ids := []uint{0, 1, 2, 3}
+	providers, pubKeys, err := Setup(SchemeMAC, ids, rand.Reader)
+	if err != nil {
+		t.Fatalf("Setup: %v", err)
+	}
+	if pubKeys != nil {
+		t.Errorf("scheme %q returned public keys", SchemeMAC)
+	}
+
+	data := []byte("prepare 1")
+	authenticator, err := providers[1].Sign(data)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	if len(authenticator) != len(ids)*MACSize {
+		t.Fatalf("authenticator takes %d bytes, want %d", len(authenticator), len(ids)*MACSize)
+	}
+	// A faulty sender can corrupt the entry of a single replica.
+	corrupted := append([]byte(nil), authenticator...)
+	corrupted[2*MACSize] ^= 1
+
+	tests := []struct {
+		name   string
+		signer uint
+		data   []byte
+		sig    []byte
+		want   map[uint]bool // Verdict of each replica
+	}{
+		{"valid", 1, data, authenticator, map[uint]bool{0: true, 1: true, 2: true, 3: true}},
+		{"claimed by another replica", 2, data, authenticator, map[uint]bool{}},
+		{"unknown signer", 9, data, authenticator, map[uint]bool{}},
+		{"other data", 1, []byte("prepare 2"), authenticator, map[uint]bool{}},
+		{"one entry corrupted", 1, data, corrupted, map[uint]bool{0: true, 1: true, 3: true}},
+		{"truncated", 1, data, authenticator[:len(authenticator)-1], map[uint]bool{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, id := range ids {
+				if got := providers[id].Verify(tt.signer, tt.data, tt.sig); got != tt.want[id] {
+					t.Errorf("replica %d: Verify = %v, want %v", id, got, tt.want[id])
+				}
+			}
+		})
+	}
+}
+
+func TestEmulated(t *testing.T) {
+	for _, aggregated := range []bool{false, true} {
+		t.Run(fmt.Sprintf("aggregated=%v", aggregated), func(t *testing.T) {
+			ids := []uint{0, 1, 2, 3}
+			providers, err := SetupEmulated(ids, EmulationCosts{SignatureSize: 64, Aggregated: aggregated}, rand.Reader)
+			if err != nil {
+				t.Fatalf("SetupEmulated: %v", err)
+			}
+			data := []byte("vote for block 1")
+			sigs := make(map[uint][]byte)
+			for _, id := range ids[1:] {
+				if sigs[id], err = providers[id].Sign(data); err != nil {
+					t.Fatalf("Sign: %v", err)
+				}
+				if len(sigs[id]) != 64 {
+					t.Fatalf("signature takes %d bytes, want 64", len(sigs[id]))
+				}
+			}
+			if !providers[0].Verify(1, data, sigs[1]) {
+				t.Error("valid signature rejected")
+			}
+			if providers[0].Verify(2, data, sigs[1]) {
+				t.Error("signature accepted as another replica's")
+			}
+			if providers[0].Verify(1, []byte("vote for block 2"), sigs[1]) {
+				t.Error("signature accepted over other data")
+			}
+
+			cert, err := providers[0].Aggregate(data, sigs)
+			if err != nil {
+				t.Fatalf("Aggregate: %v", err)
+			}
+			wantSize := 64 * len(sigs)
+			if aggregated {
+				wantSize = 64
+			}
+			if len(cert.Signature) != wantSize {
+				t.Errorf("certificate signature takes %d bytes, want %d", len(cert.Signature), wantSize)
+			}
+			if !providers[3].VerifyCertificate(data, cert) {
+				t.Error("valid certificate rejected")
+			}
+			if providers[3].VerifyCertificate([]byte("vote for block 2"), cert) {
+				t.Error("certificate accepted over other data")
+			}
+			forged := &Certificate{Signers: []uint{0, 2, 3}, Signature: cert.Signature}
+			if providers[3].VerifyCertificate(data, forged) {
+				t.Error("certificate accepted with a replaced signer")
+			}
+		})
+	}
+
+	if _, err := SetupEmulated([]uint{0}, EmulationCosts{SignatureSize: 8}, rand.Reader); err == nil {
+		t.Error("SetupEmulated accepted 8-byte signatures")
+	}
+}
+
+func TestEmulatedCharge(t *testing.T) {
+	costs := EmulationCosts{Sign: 2 * time.Millisecond, Verify: 300 * time.Microsecond, SignatureSize: 64}
+	providers, err := SetupEmulated([]uint{0}, costs, rand.Reader)
+	if err != nil {
+		t.Fatalf("SetupEmulated: %v", err)
+	}
+	p := providers[0].(*EmulatedProvider)
+
+	// Operations above the granularity delay the caller by their cost, less what an
+	// overslept sleep credited to the last one.
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		p.Sign([]byte("data"))
+	}
+	if elapsed, want := time.Since(start), 5*costs.Sign-chargeGranularity; elapsed < want {
+		t.Errorf("5 signs took %s, want at least %s", elapsed, want)
+	}
+
+	// Cheaper ones add up until they reach it.
+	p.owed = 0
+	for i := 0; i < 3; i++ {
+		p.Verify(0, []byte("data"), nil)
+	}
+	if p.owed != 3*costs.Verify {
+		t.Errorf("3 verifies left %s owed, want %s", p.owed, 3*costs.Verify)
+	}
+	start = time.Now()
+	p.Verify(0, []byte("data"), nil)
+	if elapsed := time.Since(start); elapsed < 4*costs.Verify {
+		t.Errorf("fourth verify took %s, want at least the %s owed", elapsed, 4*costs.Verify)
+	}
+	// Oversleeping is credited against later charges.
+	if p.owed > 0 {
+		t.Errorf("%s still owed after sleeping", p.owed)
+	}
+}
@@ -0,0 +1,84 @@
+// File: internal/crypto/ed25519.go
+package crypto
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"io"
+)
+
+// Ed25519Provider signs with the local replica's ed25519 private key and verifies
+// against the public keys of all replicas. Its certificates are multi-signatures:
+// the plain list of the signers' signatures.
+type Ed25519Provider struct {
+	privateKey ed25519.PrivateKey
+	publicKeys map[uint]ed25519.PublicKey
+}
+
+// NewEd25519Provider creates a provider that signs with privateKey and verifies
+// signatures of the replicas listed in publicKeys.
+func NewEd25519Provider(privateKey ed25519.PrivateKey, publicKeys map[uint]ed25519.PublicKey) *Ed25519Provider {
+	return &Ed25519Provider{privateKey: privateKey, publicKeys: publicKeys}
+}
+
+// GenerateEd25519Keys generates a fresh key pair for each of the given replicas, in
+// order, from the random bytes read from random.
+func GenerateEd25519Keys(ids []uint, random io.Reader) (map[uint]ed25519.PrivateKey, map[uint]ed25519.PublicKey, error) {
+	privateKeys := make(map[uint]ed25519.PrivateKey, len(ids))
+	publicKeys := make(map[uint]ed25519.PublicKey, len(ids))
+	for _, id := range ids {
+		pub, priv, err := ed25519.GenerateKey(random)
+		if err != nil {
+			return nil, nil, fmt.Errorf("generating key of replica %d: %w", id, err)
+		}
+		privateKeys[id] = priv
+		publicKeys[id] = pub
+	}
+	return privateKeys, publicKeys, nil
+}
+
+// Sign returns the ed25519 signature of data.
+func (p *Ed25519Provider) Sign(data []byte) ([]byte, error) {
+	return ed25519.Sign(p.privateKey, data), nil
+}
+
+// Verify checks sig against the public key of signer. Unknown signers never verify.
+func (p *Ed25519Provider) Verify(signer uint, data, sig []byte) bool {
+	pub, ok := p.publicKeys[signer]
+	if !ok || len(sig) != ed25519.SignatureSize {
+		return false
+	}
+	return ed25519.Verify(pub, data, sig)
+}
+
+// Aggregate concatenates the signatures in signer order.
+func (p *Ed25519Provider) Aggregate(data []byte, sigs map[uint][]byte) (*Certificate, error) {
+	if len(sigs) == 0 {
+		return nil, fmt.Errorf("no signatures to aggregate")
+	}
+	cert := &Certificate{Signers: sortedSigners(sigs)}
+	cert.Signature = make([]byte, 0, len(sigs)*ed25519.SignatureSize)
+	for _, id := range cert.Signers {
+		if len(sigs[id]) != ed25519.SignatureSize {
+			return nil, fmt.Errorf("invalid signature of replica %d", id)
+		}
+		cert.Signature = append(cert.Signature, sigs[id]...)
+	}
+	return cert, nil
+}
+
+// VerifyCertificate checks each signature of the certificate against its signer's key.
+func (p *Ed25519Provider) VerifyCertificate(data []byte, cert *Certificate) bool {
+	if cert == nil || len(cert.Signers) == 0 || len(cert.Signature) != len(cert.Signers)*ed25519.SignatureSize {
+		return false
+	}
+	for i, id := range cert.Signers {
+		if i > 0 && id <= cert.Signers[i-1] {
+			return false // Signers must be sorted and distinct
+		}
+		if !p.Verify(id, data, cert.Signature[i*ed25519.SignatureSize:(i+1)*ed25519.SignatureSize]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,167 @@
+// File: internal/crypto/emulated.go
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// SchemeEmulated is the scheme of EmulatedProvider. It is set up with SetupEmulated,
+// since it takes its costs from the configuration.
+const SchemeEmulated = "emulated"
+
+// chargeGranularity is the smallest delay the emulated provider sleeps for. Smaller
+// costs add up until they reach it, since sleeps that short are not precise.
+const chargeGranularity = time.Millisecond
+
+// EmulationCosts describes the scheme an EmulatedProvider stands in for: the time each
+// operation takes, the size of its signatures, and whether its certificates aggregate
+// into a single signature or list the signatures of all signers.
+type EmulationCosts struct {
+	Sign          time.Duration
+	Verify        time.Duration
+	Aggregate     time.Duration // Per signature combined into a certificate
+	SignatureSize int
+	Aggregated    bool
+}
+
+// EmulatedProvider skips real cryptography for large simulations, but charges the cost
+// of the scheme it emulates by delaying the caller, that is the node's message handling.
+// Its signatures are keyed hashes under a secret shared by the whole simulation, padded
+// to the emulated size, so they cannot be forged by replicas that go through the
+// Provider interface and protocols behave as with the real scheme.
+type EmulatedProvider struct {
+	id     uint
+	secret []byte
+	costs  EmulationCosts
+
+	mu   sync.Mutex
+	owed time.Duration // Charged cost not slept yet
+}
+
+// SetupEmulated creates the emulated providers of a group of replicas, with a shared
+// secret read from random.
+func SetupEmulated(ids []uint, costs EmulationCosts, random io.Reader) (map[uint]Provider, error) {
+	if costs.SignatureSize < sha256.Size/2 {
+		return nil, fmt.Errorf("emulated signatures must have at least %d bytes, got %d", sha256.Size/2, costs.SignatureSize)
+	}
+	secret := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(random, secret); err != nil {
+		return nil, fmt.Errorf("generating the emulation secret: %w", err)
+	}
+	providers := make(map[uint]Provider, len(ids))
+	for _, id := range ids {
+		providers[id] = &EmulatedProvider{id: id, secret: secret, costs: costs}
+	}
+	return providers, nil
+}
+
+// charge delays the caller by d, once the costs charged so far add up to the
+// granularity. Oversleeping is credited against the next charges.
+func (p *EmulatedProvider) charge(d time.Duration) {
+	p.mu.Lock()
+	p.owed += d
+	owed := p.owed
+	if owed < chargeGranularity {
+		p.mu.Unlock()
+		return
+	}
+	p.owed = 0
+	p.mu.Unlock()
+
+	start := time.Now()
+	time.Sleep(owed)
+	overslept := time.Since(start) - owed
+	p.mu.Lock()
+	p.owed -= overslept
+	p.mu.Unlock()
+}
+
+// tag returns the emulated signature of signer over data.
+func (p *EmulatedProvider) tag(signer uint, data []byte) []byte {
+	h := hmac.New(sha256.New, p.secret)
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(signer))
+	h.Write(buf[:])
+	h.Write(data)
+	sig := make([]byte, p.costs.SignatureSize)
+	copy(sig, h.Sum(nil))
+	return sig
+}
+
+// aggregateTag returns the emulated aggregate signature of signers over data.
+func (p *EmulatedProvider) aggregateTag(signers []uint, data []byte) []byte {
+	h := hmac.New(sha256.New, p.secret)
+	var buf [8]byte
+	for _, id := range signers {
+		binary.BigEndian.PutUint64(buf[:], uint64(id))
+		h.Write(buf[:])
+	}
+	h.Write(data)
+	sig := make([]byte, p.costs.SignatureSize)
+	copy(sig, h.Sum(nil))
+	return sig
+}
+
+// Sign returns the emulated signature of data, charging the cost of signing.
+func (p *EmulatedProvider) Sign(data []byte) ([]byte, error) {
+	p.charge(p.costs.Sign)
+	return p.tag(p.id, data), nil
+}
+
+// Verify checks an emulated signature, charging the cost of verifying.
+func (p *EmulatedProvider) Verify(signer uint, data, sig []byte) bool {
+	p.charge(p.costs.Verify)
+	return hmac.Equal(sig, p.tag(signer, data))
+}
+
+// Aggregate builds a certificate shaped like the emulated scheme's, charging the cost
+// of aggregating each signature.
+func (p *EmulatedProvider) Aggregate(data []byte, sigs map[uint][]byte) (*Certificate, error) {
+	if len(sigs) == 0 {
+		return nil, fmt.Errorf("no signatures to aggregate")
+	}
+	p.charge(time.Duration(len(sigs)) * p.costs.Aggregate)
+	cert := &Certificate{Signers: sortedSigners(sigs)}
+	if p.costs.Aggregated {
+		cert.Signature = p.aggregateTag(cert.Signers, data)
+		return cert, nil
+	}
+	for _, id := range cert.Signers {
+		cert.Signature = append(cert.Signature, sigs[id]...)
+	}
+	return cert, nil
+}
+
+// VerifyCertificate checks an emulated certificate. It charges one verification and
+// the aggregation of the signers' keys for aggregated certificates, and one
+// verification per signer otherwise.
+func (p *EmulatedProvider) VerifyCertificate(data []byte, cert *Certificate) bool {
+	if cert == nil || len(cert.Signers) == 0 {
+		return false
+	}
+	for i, id := range cert.Signers {
+		if i > 0 && id <= cert.Signers[i-1] {
+			return false // Signers must be sorted and distinct
+		}
+	}
+	if p.costs.Aggregated {
+		p.charge(p.costs.Verify + time.Duration(len(cert.Signers))*p.costs.Aggregate)
+		return hmac.Equal(cert.Signature, p.aggregateTag(cert.Signers, data))
+	}
+	size := p.costs.SignatureSize
+	if len(cert.Signature) != len(cert.Signers)*size {
+		return false
+	}
+	for i, id := range cert.Signers {
+		if !p.Verify(id, data, cert.Signature[i*size:(i+1)*size]) {
+			return false
+		}
+	}
+	return true
+}
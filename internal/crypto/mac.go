@@ -0,0 +1,117 @@
+// File: internal/crypto/mac.go
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// MACSize is the length of each MAC of an authenticator: HMAC-SHA256 truncated to
+// 128 bits.
+const MACSize = 16
+
+// MACProvider authenticates messages with authenticators, as in PBFT: a vector holding
+// one MAC per replica, each computed with the key the sender shares with that replica.
+// MACs are far cheaper to compute than signatures, but a replica can only check its own
+// entry, so authenticators do not convince third parties the way signatures do: a
+// faulty sender can make an authenticator that some replicas accept and others reject.
+type MACProvider struct {
+	id   uint
+	ids  []uint          // Every replica, in ascending order: the layout of the vector
+	keys map[uint][]byte // Key shared with each replica
+}
+
+// NewMACProvider creates a provider for replica id holding the given pairwise keys,
+// one for each replica, including a key with itself.
+func NewMACProvider(id uint, keys map[uint][]byte) *MACProvider {
+	ids := make([]uint, 0, len(keys))
+	for peer := range keys {
+		ids = append(ids, peer)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return &MACProvider{id: id, ids: ids, keys: keys}
+}
+
+// GenerateMACKeys generates a key for each pair of the given replicas, in order, from
+// the random bytes read from random, and returns the keys of each replica by peer.
+func GenerateMACKeys(ids []uint, random io.Reader) (map[uint]map[uint][]byte, error) {
+	keys := make(map[uint]map[uint][]byte, len(ids))
+	for _, id := range ids {
+		keys[id] = make(map[uint][]byte, len(ids))
+	}
+	for i, a := range ids {
+		for _, b := range ids[i:] {
+			key := make([]byte, sha256.Size)
+			if _, err := io.ReadFull(random, key); err != nil {
+				return nil, fmt.Errorf("generating key of replicas %d and %d: %w", a, b, err)
+			}
+			keys[a][b] = key
+			keys[b][a] = key
+		}
+	}
+	return keys, nil
+}
+
+// mac returns the truncated HMAC of data under key.
+func mac(key, data []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(data)
+	return h.Sum(nil)[:MACSize]
+}
+
+// Sign returns the authenticator of data: the MAC for each replica, in ID order.
+func (p *MACProvider) Sign(data []byte) ([]byte, error) {
+	authenticator := make([]byte, 0, len(p.ids)*MACSize)
+	for _, id := range p.ids {
+		authenticator = append(authenticator, mac(p.keys[id], data)...)
+	}
+	return authenticator, nil
+}
+
+// Verify checks the local replica's entry of an authenticator made by signer.
+func (p *MACProvider) Verify(signer uint, data, sig []byte) bool {
+	key, ok := p.keys[signer]
+	if !ok || len(sig) != len(p.ids)*MACSize {
+		return false
+	}
+	i := sort.Search(len(p.ids), func(i int) bool { return p.ids[i] >= p.id })
+	return hmac.Equal(sig[i*MACSize:(i+1)*MACSize], mac(key, data))
+}
+
+// Aggregate concatenates the authenticators in signer order. The result is only as
+// convincing as the authenticators it holds; see MACProvider.
+func (p *MACProvider) Aggregate(data []byte, sigs map[uint][]byte) (*Certificate, error) {
+	if len(sigs) == 0 {
+		return nil, fmt.Errorf("no authenticators to aggregate")
+	}
+	size := len(p.ids) * MACSize
+	cert := &Certificate{Signers: sortedSigners(sigs)}
+	cert.Signature = make([]byte, 0, len(sigs)*size)
+	for _, id := range cert.Signers {
+		if len(sigs[id]) != size {
+			return nil, fmt.Errorf("invalid authenticator of replica %d", id)
+		}
+		cert.Signature = append(cert.Signature, sigs[id]...)
+	}
+	return cert, nil
+}
+
+// VerifyCertificate checks the local replica's entry of each authenticator.
+func (p *MACProvider) VerifyCertificate(data []byte, cert *Certificate) bool {
+	size := len(p.ids) * MACSize
+	if cert == nil || len(cert.Signers) == 0 || len(cert.Signature) != len(cert.Signers)*size {
+		return false
+	}
+	for i, id := range cert.Signers {
+		if i > 0 && id <= cert.Signers[i-1] {
+			return false // Signers must be sorted and distinct
+		}
+		if !p.Verify(id, data, cert.Signature[i*size:(i+1)*size]) {
+			return false
+		}
+	}
+	return true
+}
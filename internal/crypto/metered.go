@@ -0,0 +1,134 @@
+// File: internal/crypto/metered.go
+package crypto
+
+import (
+	"sync"
+	"time"
+)
+
+// Stats counts the operations of a provider, the CPU time spent in each kind, and
+// the size of the certificates it produced. It is what lets experiments compare the
+// CPU cost of a scheme against the bandwidth its certificates take.
+type Stats struct {
+	Signs             int64
+	Verifies          int64
+	Aggregates        int64
+	CertificateChecks int64
+	CertificateBytes  int64 // Total size of the aggregated certificates
+
+	SignTime             time.Duration
+	VerifyTime           time.Duration
+	AggregateTime        time.Duration
+	CertificateCheckTime time.Duration
+}
+
+// Add returns the sum of two sets of statistics.
+func (s Stats) Add(other Stats) Stats {
+	return Stats{
+		Signs:                s.Signs + other.Signs,
+		Verifies:             s.Verifies + other.Verifies,
+		Aggregates:           s.Aggregates + other.Aggregates,
+		CertificateChecks:    s.CertificateChecks + other.CertificateChecks,
+		CertificateBytes:     s.CertificateBytes + other.CertificateBytes,
+		SignTime:             s.SignTime + other.SignTime,
+		VerifyTime:           s.VerifyTime + other.VerifyTime,
+		AggregateTime:        s.AggregateTime + other.AggregateTime,
+		CertificateCheckTime: s.CertificateCheckTime + other.CertificateCheckTime,
+	}
+}
+
+// Time returns the total time spent in the provider.
+func (s Stats) Time() time.Duration {
+	return s.SignTime + s.VerifyTime + s.AggregateTime + s.CertificateCheckTime
+}
+
+// MeanSignTime returns the average cost of producing a signature.
+func (s Stats) MeanSignTime() time.Duration {
+	return mean(s.SignTime, s.Signs)
+}
+
+// MeanVerifyTime returns the average cost of verifying a signature.
+func (s Stats) MeanVerifyTime() time.Duration {
+	return mean(s.VerifyTime, s.Verifies)
+}
+
+// MeanCertificateSize returns the average size of the aggregated certificates in bytes.
+func (s Stats) MeanCertificateSize() float64 {
+	if s.Aggregates == 0 {
+		return 0
+	}
+	return float64(s.CertificateBytes) / float64(s.Aggregates)
+}
+
+func mean(total time.Duration, count int64) time.Duration {
+	if count == 0 {
+		return 0
+	}
+	return total / time.Duration(count)
+}
+
+// Metered wraps a provider and records Stats about its use.
+type Metered struct {
+	Provider
+
+	mu    sync.Mutex
+	stats Stats
+}
+
+// NewMetered returns a provider that records the operations of p.
+func NewMetered(p Provider) *Metered {
+	return &Metered{Provider: p}
+}
+
+// Stats returns the statistics recorded so far.
+func (m *Metered) Stats() Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.stats
+}
+
+// record adds the outcome of one operation, which took the given time, to the statistics.
+func (m *Metered) record(start time.Time, update func(*Stats, time.Duration)) {
+	elapsed := time.Since(start)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	update(&m.stats, elapsed)
+}
+
+// Sign signs data with the wrapped provider.
+func (m *Metered) Sign(data []byte) ([]byte, error) {
+	start := time.Now()
+	sig, err := m.Provider.Sign(data)
+	m.record(start, func(s *Stats, d time.Duration) { s.Signs++; s.SignTime += d })
+	return sig, err
+}
+
+// Verify verifies sig with the wrapped provider.
+func (m *Metered) Verify(signer uint, data, sig []byte) bool {
+	start := time.Now()
+	ok := m.Provider.Verify(signer, data, sig)
+	m.record(start, func(s *Stats, d time.Duration) { s.Verifies++; s.VerifyTime += d })
+	return ok
+}
+
+// Aggregate builds a certificate with the wrapped provider.
+func (m *Metered) Aggregate(data []byte, sigs map[uint][]byte) (*Certificate, error) {
+	start := time.Now()
+	cert, err := m.Provider.Aggregate(data, sigs)
+	m.record(start, func(s *Stats, d time.Duration) {
+		s.AggregateTime += d
+		if err == nil {
+			s.Aggregates++
+			s.CertificateBytes += int64(cert.Size())
+		}
+	})
+	return cert, err
+}
+
+// VerifyCertificate verifies cert with the wrapped provider.
+func (m *Metered) VerifyCertificate(data []byte, cert *Certificate) bool {
+	start := time.Now()
+	ok := m.Provider.VerifyCertificate(data, cert)
+	m.record(start, func(s *Stats, d time.Duration) { s.CertificateChecks++; s.CertificateCheckTime += d })
+	return ok
+}
@@ -0,0 +1,181 @@
+// File: internal/crypto/threshold/dkg.go
+package threshold
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"babel-bft/internal/codec"
+	"babel-bft/internal/network"
+	"babel-bft/internal/types"
+
+	"github.com/cloudflare/circl/ecc/bls12381"
+	"github.com/cloudflare/circl/sign/bls"
+)
+
+// DealType is the message type of the DKG deals.
+const DealType = 0
+
+func init() {
+	codec.Register(0x40, &DealMessage{})
+}
+
+// DealMessage is what a participant of the DKG sends each other participant: the
+// Feldman commitments to its random polynomial and the recipient's share of it.
+type DealMessage struct {
+	Commitments [][]byte // Compressed points of G2, lowest coefficient first
+	Share       []byte
+}
+
+// RunDKG runs a simple joint-Feldman distributed key generation among the given
+// replicas over transport, so that no party ever learns the group's secret key.
+// Every participant deals a random secret to all the others; a replica's share is
+// the sum of the shares it was dealt, and the group key the sum of the secrets.
+// It registers each participant with the transport, so it must run before the nodes
+// are created, and it fails if any deal is invalid or missing after timeout. There
+// is no complaint round: every participant must take part, and the deals travel
+// unencrypted, which is only fine within a simulation.
+func RunDKG(transport network.Transport, ids []uint, t int, timeout time.Duration) (map[uint]*Provider, *PublicKeys, error) {
+	if t < 1 || t > len(ids) {
+		return nil, nil, fmt.Errorf("threshold must be between 1 and %d, got %d", len(ids), t)
+	}
+	participants := make(map[uint]*participant, len(ids))
+	for _, id := range ids {
+		participants[id] = &participant{id: id, inbox: make(chan *types.Message, len(ids))}
+		transport.RegisterNodeChan(id, participants[id].inbox)
+	}
+
+	var wg sync.WaitGroup
+	for _, p := range participants {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.err = p.run(transport, ids, t, timeout)
+		}()
+	}
+	wg.Wait()
+
+	var public *PublicKeys
+	providers := make(map[uint]*Provider, len(ids))
+	for _, id := range ids {
+		p := participants[id]
+		if p.err != nil {
+			return nil, nil, fmt.Errorf("DKG participant %d: %w", id, p.err)
+		}
+		if public == nil {
+			public = p.public
+		} else if !public.Group.Equal(p.public.Group) {
+			return nil, nil, fmt.Errorf("DKG participants %d and %d derived different group keys", ids[0], id)
+		}
+		providers[id] = NewProvider(p.share, public)
+	}
+	return providers, public, nil
+}
+
+// participant is one replica's side of the DKG.
+type participant struct {
+	id    uint
+	inbox chan *types.Message
+
+	share  *bls.PrivateKey[keys]
+	public *PublicKeys
+	err    error
+}
+
+// run deals the participant's secret, collects the deals of the others, and derives
+// the participant's share and the public keys from them.
+func (p *participant) run(transport network.Transport, ids []uint, t int, timeout time.Duration) error {
+	poly, err := randomPolynomial(t - 1)
+	if err != nil {
+		return err
+	}
+	commitments := poly.commit()
+	encoded := make([][]byte, len(commitments))
+	for i := range commitments {
+		encoded[i] = commitments[i].BytesCompressed()
+	}
+
+	var own *DealMessage
+	for _, id := range ids {
+		x := point(id)
+		y := poly.eval(&x)
+		share, err := y.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		deal := &DealMessage{Commitments: encoded, Share: share}
+		if id == p.id {
+			own = deal
+			continue
+		}
+		transport.Send(id, &types.Message{Type: DealType, From: p.id, Payload: deal})
+	}
+
+	deals := map[uint]*DealMessage{p.id: own}
+	deadline := time.After(timeout)
+	for len(deals) < len(ids) {
+		select {
+		case msg := <-p.inbox:
+			deal, ok := msg.Payload.(*DealMessage)
+			if !ok || !slices.Contains(ids, msg.From) {
+				continue
+			}
+			deals[msg.From] = deal
+		case <-deadline:
+			return fmt.Errorf("received %d of %d deals before the timeout", len(deals), len(ids))
+		}
+	}
+	return p.combine(ids, t, deals)
+}
+
+// combine checks each deal against its commitments and sums them up.
+func (p *participant) combine(ids []uint, t int, deals map[uint]*DealMessage) error {
+	var secret bls12381.Scalar
+	combined := make([]bls12381.G2, t) // Commitments to the sum of all polynomials
+	for i := range combined {
+		combined[i].SetIdentity()
+	}
+	x := point(p.id)
+	for dealer, deal := range deals {
+		if len(deal.Commitments) != t {
+			return fmt.Errorf("deal of %d commits to %d coefficients, expected %d", dealer, len(deal.Commitments), t)
+		}
+		commitments := make([]bls12381.G2, t)
+		for i, raw := range deal.Commitments {
+			if err := commitments[i].SetBytes(raw); err != nil {
+				return fmt.Errorf("deal of %d has an invalid commitment: %w", dealer, err)
+			}
+			combined[i].Add(&combined[i], &commitments[i])
+		}
+		var share bls12381.Scalar
+		if err := share.UnmarshalBinary(deal.Share); err != nil {
+			return fmt.Errorf("deal of %d has an invalid share: %w", dealer, err)
+		}
+		var actual bls12381.G2
+		actual.ScalarMult(&share, bls12381.G2Generator())
+		expected := evalCommitments(commitments, &x)
+		if !actual.IsEqual(&expected) {
+			return fmt.Errorf("share dealt by %d does not match its commitments", dealer)
+		}
+		secret.Add(&secret, &share)
+	}
+
+	var err error
+	if p.share, err = privateKey(&secret); err != nil {
+		return err
+	}
+	p.public = &PublicKeys{Threshold: t, Shares: make(map[uint]*bls.PublicKey[keys], len(ids))}
+	if p.public.Group, err = publicKey(&combined[0]); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		x := point(id)
+		y := evalCommitments(combined, &x)
+		if p.public.Shares[id], err = publicKey(&y); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+// File: internal/crypto/threshold/polynomial.go
+package threshold
+
+import (
+	"crypto/rand"
+	"fmt"
+
+	"github.com/cloudflare/circl/ecc/bls12381"
+)
+
+// polynomial is a polynomial over the scalar field of BLS12-381, lowest coefficient
+// first. Its constant term is the secret it shares.
+type polynomial []bls12381.Scalar
+
+// randomPolynomial returns a polynomial of the given degree with random coefficients.
+func randomPolynomial(degree int) (polynomial, error) {
+	p := make(polynomial, degree+1)
+	for i := range p {
+		if err := p[i].Random(rand.Reader); err != nil {
+			return nil, fmt.Errorf("generating polynomial: %w", err)
+		}
+	}
+	return p, nil
+}
+
+// eval returns p(x), by Horner's rule.
+func (p polynomial) eval(x *bls12381.Scalar) bls12381.Scalar {
+	var y bls12381.Scalar
+	for i := len(p) - 1; i >= 0; i-- {
+		y.Mul(&y, x)
+		y.Add(&y, &p[i])
+	}
+	return y
+}
+
+// commit returns the Feldman commitments to the coefficients, g2^a_i, which let
+// anyone check a share against the polynomial without learning it.
+func (p polynomial) commit() []bls12381.G2 {
+	commitments := make([]bls12381.G2, len(p))
+	for i := range p {
+		commitments[i].ScalarMult(&p[i], bls12381.G2Generator())
+	}
+	return commitments
+}
+
+// evalCommitments returns g2^p(x) from the commitments to the coefficients of p.
+func evalCommitments(commitments []bls12381.G2, x *bls12381.Scalar) bls12381.G2 {
+	var y bls12381.G2
+	y.SetIdentity()
+	for i := len(commitments) - 1; i >= 0; i-- {
+		y.ScalarMult(x, &y)
+		y.Add(&y, &commitments[i])
+	}
+	return y
+}
+
+// point returns the evaluation point of a replica's share. Replica IDs start at 0,
+// which is where the secret sits, so they are shifted by one.
+func point(id uint) bls12381.Scalar {
+	var x bls12381.Scalar
+	x.SetUint64(uint64(id) + 1)
+	return x
+}
+
+// lagrange returns the coefficient of the share of ids[i] when interpolating the
+// polynomial at 0 from the shares of ids.
+func lagrange(ids []uint, i int) bls12381.Scalar {
+	var num, den, diff bls12381.Scalar
+	num.SetOne()
+	den.SetOne()
+	xi := point(ids[i])
+	for j, id := range ids {
+		if j == i {
+			continue
+		}
+		xj := point(id)
+		num.Mul(&num, &xj)
+		diff.Sub(&xj, &xi)
+		den.Mul(&den, &diff)
+	}
+	den.Inv(&den)
+	num.Mul(&num, &den)
+	return num
+}
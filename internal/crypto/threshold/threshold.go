@@ -0,0 +1,173 @@
+// File: internal/crypto/threshold/threshold.go
+package threshold
+
+import (
+	"fmt"
+	"slices"
+
+	"babel-bft/internal/crypto"
+
+	"github.com/cloudflare/circl/ecc/bls12381"
+	"github.com/cloudflare/circl/sign/bls"
+)
+
+// Scheme is the name of the threshold signature scheme in the crypto config.
+const Scheme = "threshold"
+
+// Key generation methods, selected by the "key_generation" field of the crypto config.
+const (
+	KeyGenDealer = "dealer"
+	KeyGenDKG    = "dkg"
+)
+
+// keys places public keys in G2 and signatures in G1, like the BLS provider.
+type keys = bls.KeyG2SigG1
+
+// PublicKeys is the public part of a (t,n) threshold key: the group key that
+// threshold signatures verify against, and the public key of each replica's share.
+type PublicKeys struct {
+	Threshold int
+	Group     *bls.PublicKey[keys]
+	Shares    map[uint]*bls.PublicKey[keys]
+}
+
+// Provider signs with a replica's share of a (t,n) threshold BLS key. Its signatures
+// are signature shares, which authenticate messages like ordinary signatures; any t
+// shares over the same data combine into a single signature under the group key. The
+// certificates therefore have a constant size and verify like one plain signature.
+type Provider struct {
+	share *bls.PrivateKey[keys]
+	keys  *PublicKeys
+}
+
+// NewProvider creates a provider that signs with share and verifies against keys.
+func NewProvider(share *bls.PrivateKey[keys], keys *PublicKeys) *Provider {
+	return &Provider{share: share, keys: keys}
+}
+
+// Sign returns the replica's signature share of data.
+func (p *Provider) Sign(data []byte) ([]byte, error) {
+	return bls.Sign(p.share, data), nil
+}
+
+// Verify checks a signature share against the public key of signer's share.
+func (p *Provider) Verify(signer uint, data, sig []byte) bool {
+	pub, ok := p.keys.Shares[signer]
+	if !ok {
+		return false
+	}
+	return bls.Verify(pub, data, sig)
+}
+
+// Aggregate combines the shares of the first t signers, in ID order, into a signature
+// under the group key, by Lagrange interpolation in the exponent. It fails if there
+// are fewer than t shares.
+func (p *Provider) Aggregate(data []byte, sigs map[uint][]byte) (*crypto.Certificate, error) {
+	if len(sigs) < p.keys.Threshold {
+		return nil, fmt.Errorf("need %d signature shares, got %d", p.keys.Threshold, len(sigs))
+	}
+	signers := make([]uint, 0, len(sigs))
+	for id := range sigs {
+		signers = append(signers, id)
+	}
+	slices.Sort(signers)
+	signers = signers[:p.keys.Threshold]
+
+	var sum, share bls12381.G1
+	sum.SetIdentity()
+	for i, id := range signers {
+		if err := share.SetBytes(sigs[id]); err != nil {
+			return nil, fmt.Errorf("invalid signature share of replica %d: %w", id, err)
+		}
+		coefficient := lagrange(signers, i)
+		share.ScalarMult(&coefficient, &share)
+		sum.Add(&sum, &share)
+	}
+	return &crypto.Certificate{Signers: signers, Signature: sum.BytesCompressed()}, nil
+}
+
+// VerifyCertificate checks the combined signature against the group key. A valid one
+// can only have been produced from t shares, but not necessarily those of the signers
+// it lists, which the signature does not cover: the certificate must list t distinct
+// share holders, and only proves a quorum when t shares make one, which the run
+// enforces when it creates the keys.
+func (p *Provider) VerifyCertificate(data []byte, cert *crypto.Certificate) bool {
+	if cert == nil || len(cert.Signers) != p.keys.Threshold {
+		return false
+	}
+	seen := make(map[uint]bool, len(cert.Signers))
+	for _, id := range cert.Signers {
+		if _, ok := p.keys.Shares[id]; !ok || seen[id] {
+			return false
+		}
+		seen[id] = true
+	}
+	return bls.Verify(p.keys.Group, data, cert.Signature)
+}
+
+// Deal has a trusted dealer generate a (t,n) threshold key for the given replicas and
+// hand each its share. It returns the providers by replica ID and the public keys.
+func Deal(ids []uint, t int) (map[uint]*Provider, *PublicKeys, error) {
+	if t < 1 || t > len(ids) {
+		return nil, nil, fmt.Errorf("threshold must be between 1 and %d, got %d", len(ids), t)
+	}
+	poly, err := randomPolynomial(t - 1)
+	if err != nil {
+		return nil, nil, err
+	}
+	commitments := poly.commit()
+	public := &PublicKeys{Threshold: t, Shares: make(map[uint]*bls.PublicKey[keys], len(ids))}
+	if public.Group, err = publicKey(&commitments[0]); err != nil {
+		return nil, nil, err
+	}
+	shares := make(map[uint]*bls.PrivateKey[keys], len(ids))
+	for _, id := range ids {
+		x := point(id)
+		y := poly.eval(&x)
+		if shares[id], err = privateKey(&y); err != nil {
+			return nil, nil, err
+		}
+		public.Shares[id] = shares[id].PublicKey()
+	}
+	providers := make(map[uint]*Provider, len(ids))
+	for _, id := range ids {
+		providers[id] = NewProvider(shares[id], public)
+	}
+	return providers, public, nil
+}
+
+// MarshalShares returns the encoded public key of each replica's share, which is the
+// public key a replica is known by in the validator set.
+func (k *PublicKeys) MarshalShares() (map[uint][]byte, error) {
+	encoded := make(map[uint][]byte, len(k.Shares))
+	for id, pub := range k.Shares {
+		raw, err := pub.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		encoded[id] = raw
+	}
+	return encoded, nil
+}
+
+// privateKey turns a scalar into a BLS private key.
+func privateKey(s *bls12381.Scalar) (*bls.PrivateKey[keys], error) {
+	raw, err := s.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	var priv bls.PrivateKey[keys]
+	if err := priv.UnmarshalBinary(raw); err != nil {
+		return nil, fmt.Errorf("invalid key share: %w", err)
+	}
+	return &priv, nil
+}
+
+// publicKey turns a point of G2 into a BLS public key.
+func publicKey(g *bls12381.G2) (*bls.PublicKey[keys], error) {
+	var pub bls.PublicKey[keys]
+	if err := pub.UnmarshalBinary(g.BytesCompressed()); err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	return &pub, nil
+}
@@ -0,0 +1,199 @@
+package threshold
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"babel-bft/internal/network"
+	"babel-bft/internal/types"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+func TestThreshold(t *testing.T) {
+	ids := []uint{0, 1, 2, 3}
+	providers, public, err := Deal(ids, 3)
+	if err != nil {
+		t.Fatalf("Deal: %v", err)
+	}
+	checkKeys(t, ids, providers, public)
+}
+
+func TestDKG(t *testing.T) {
+	ids := []uint{0, 1, 2, 3}
+	transport := network.NewLocalTransport(uint(len(ids)), nil)
+	providers, public, err := RunDKG(transport, ids, 3, 5*time.Second)
+	if err != nil {
+		t.Fatalf("RunDKG: %v", err)
+	}
+	checkKeys(t, ids, providers, public)
+}
+
+// checkKeys checks that the shares of a (3,4) threshold key sign, combine and verify
+// as they should.
+func checkKeys(t *testing.T, ids []uint, providers map[uint]*Provider, public *PublicKeys) {
+	t.Helper()
+	data := []byte("vote for block 1")
+	shares := make(map[uint][]byte, len(ids))
+	for _, id := range ids {
+		sig, err := providers[id].Sign(data)
+		if err != nil {
+			t.Fatalf("Sign: %v", err)
+		}
+		shares[id] = sig
+	}
+
+	for _, id := range ids {
+		if !providers[0].Verify(id, data, shares[id]) {
+			t.Errorf("share of replica %d does not verify", id)
+		}
+		if other := (id + 1) % uint(len(ids)); providers[0].Verify(other, data, shares[id]) {
+			t.Errorf("share of replica %d verifies as replica %d's", id, other)
+		}
+	}
+
+	// Any t shares combine into the same signature under the group key.
+	var first []byte
+	for _, subset := range [][]uint{{0, 1, 2}, {1, 2, 3}, {0, 2, 3}, {0, 1, 2, 3}} {
+		sigs := make(map[uint][]byte)
+		for _, id := range subset {
+			sigs[id] = shares[id]
+		}
+		cert, err := providers[1].Aggregate(data, sigs)
+		if err != nil {
+			t.Fatalf("Aggregate(%v): %v", subset, err)
+		}
+		if len(cert.Signers) != public.Threshold {
+			t.Errorf("certificate from %v lists %d signers, want %d", subset, len(cert.Signers), public.Threshold)
+		}
+		for _, id := range ids {
+			if !providers[id].VerifyCertificate(data, cert) {
+				t.Errorf("replica %d rejects the certificate from %v", id, subset)
+			}
+		}
+		if providers[0].VerifyCertificate([]byte("vote for block 2"), cert) {
+			t.Errorf("certificate from %v verifies for other data", subset)
+		}
+		if first == nil {
+			first = cert.Signature
+		} else if !bytes.Equal(cert.Signature, first) {
+			t.Errorf("shares %v combine into a different signature", subset)
+		}
+	}
+
+	t.Run("t-1 shares", func(t *testing.T) {
+		if _, err := providers[0].Aggregate(data, map[uint][]byte{0: shares[0], 1: shares[1]}); err == nil {
+			t.Error("Aggregate succeeded with 2 of 3 shares")
+		}
+	})
+
+	t.Run("invalid shares", func(t *testing.T) {
+		other, err := providers[2].Sign([]byte("vote for block 2"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tests := []struct {
+			name string
+			sigs map[uint][]byte
+		}{
+			{"share over other data", map[uint][]byte{0: shares[0], 1: shares[1], 2: other}},
+			{"share filed under another replica", map[uint][]byte{0: shares[0], 1: shares[1], 2: shares[3]}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				cert, err := providers[0].Aggregate(data, tt.sigs)
+				if err == nil && providers[0].VerifyCertificate(data, cert) {
+					t.Error("certificate from an invalid share verifies")
+				}
+			})
+		}
+
+		if _, err := providers[0].Aggregate(data, map[uint][]byte{0: shares[0], 1: shares[1], 2: []byte("garbage")}); err == nil {
+			t.Error("Aggregate accepted a malformed share")
+		}
+	})
+
+	t.Run("missing signers", func(t *testing.T) {
+		cert, err := providers[0].Aggregate(data, shares)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signers := cert.Signers
+		tests := []struct {
+			name    string
+			signers []uint
+		}{
+			{"2 signers", signers[:2]},
+			{"all 4 replicas", ids},
+			{"duplicate signer", []uint{signers[0], signers[1], signers[1]}},
+			{"unknown signer", []uint{signers[0], signers[1], 9}},
+		}
+		for _, tt := range tests {
+			cert.Signers = tt.signers
+			if providers[0].VerifyCertificate(data, cert) {
+				t.Errorf("certificate listing %s verifies", tt.name)
+			}
+		}
+		if providers[0].VerifyCertificate(data, nil) {
+			t.Error("missing certificate verifies")
+		}
+	})
+}
+
+func TestDealErrors(t *testing.T) {
+	for _, threshold := range []int{0, 5} {
+		if _, _, err := Deal([]uint{0, 1, 2, 3}, threshold); err == nil {
+			t.Errorf("Deal succeeded with threshold %d of 4", threshold)
+		}
+	}
+}
+
+// tamperingTransport alters or drops the deals that one dealer sends.
+type tamperingTransport struct {
+	network.Transport
+	dealer uint
+	drop   bool
+}
+
+func (tt *tamperingTransport) Send(recipientID uint, msg *types.Message) {
+	if msg.From == tt.dealer {
+		if tt.drop {
+			return
+		}
+		deal := *msg.Payload.(*DealMessage)
+		deal.Share = append([]byte(nil), deal.Share...)
+		deal.Share[len(deal.Share)-1] ^= 1
+		msg = &types.Message{Type: msg.Type, From: msg.From, Payload: &deal}
+	}
+	tt.Transport.Send(recipientID, msg)
+}
+
+func TestDKGComplaint(t *testing.T) {
+	tests := []struct {
+		name    string
+		drop    bool
+		timeout time.Duration
+		wantErr string
+	}{
+		{"share not matching its commitments", false, 5 * time.Second, "share dealt by 2 does not match its commitments"},
+		{"missing deal", true, 200 * time.Millisecond, "deals before the timeout"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids := []uint{0, 1, 2, 3}
+			transport := &tamperingTransport{Transport: network.NewLocalTransport(uint(len(ids)), nil), dealer: 2, drop: tt.drop}
+			_, _, err := RunDKG(transport, ids, 3, tt.timeout)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("RunDKG error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+// File: internal/network/addressbook.go
+package network
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultPort is the port replicas listen on when their hosts-file entry has none.
+const DefaultPort = 7000
+
+// AddressBook maps each replica to the address its TCP transport listens on.
+type AddressBook map[uint]string
+
+// LoadAddressBook reads a hosts file, which lists one replica per line in ID order:
+// the first entry is replica 0, the next replica 1, and so on. An entry is a host with
+// an optional port, and may carry the user@ prefix used to reach the host over SSH.
+// Empty lines and lines starting with # are skipped.
+func LoadAddressBook(path string) (AddressBook, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading hosts file %s: %w", path, err)
+	}
+	defer file.Close()
+
+	book := make(AddressBook)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		entry := strings.TrimSpace(scanner.Text())
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		addr, err := parseHostsEntry(entry)
+		if err != nil {
+			return nil, fmt.Errorf("hosts file %s, line %d: %w", path, line, err)
+		}
+		book[uint(len(book))] = addr
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading hosts file %s: %w", path, err)
+	}
+	if len(book) == 0 {
+		return nil, fmt.Errorf("hosts file %s lists no replicas", path)
+	}
+	return book, nil
+}
+
+// parseHostsEntry returns the host:port address of a hosts-file entry.
+func parseHostsEntry(entry string) (string, error) {
+	if i := strings.LastIndex(entry, "@"); i >= 0 {
+		entry = entry[i+1:]
+	}
+	host, port, err := net.SplitHostPort(entry)
+	if err != nil {
+		// No port: the whole entry is the host
+		return net.JoinHostPort(strings.Trim(entry, "[]"), strconv.Itoa(DefaultPort)), nil
+	}
+	if host == "" {
+		return "", fmt.Errorf("entry %q has no host", entry)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return "", fmt.Errorf("entry %q has an invalid port", entry)
+	}
+	return entry, nil
+}
+
+// IDs returns the replicas in the address book, in ascending order.
+func (b AddressBook) IDs() []uint {
+	ids := make([]uint, 0, len(b))
+	for id := range b {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// ListenAddr returns the address replica id listens on: the port of its entry, on
+// every interface, since the host name others reach it by may not be a local address.
+func (b AddressBook) ListenAddr(id uint) (string, error) {
+	addr, ok := b[id]
+	if !ok {
+		return "", fmt.Errorf("replica %d is not in the address book (%d replicas)", id, len(b))
+	}
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort("", port), nil
+}
@@ -0,0 +1,60 @@
+// File: internal/network/class.go
+package network
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Class groups messages by their role in the protocol, so that transports can keep
+// the classes apart: the QUIC transport sends each class on a stream of its own, so
+// that small votes are not held up behind large proposals.
+type Class int
+
+const (
+	// Sync is everything that is neither a proposal nor a vote: view changes,
+	// checkpoints, certificates forwarded to catch up, transactions and key
+	// distribution. It is the class of payloads that were not given one.
+	Sync Class = iota
+	// Proposals carry the blocks leaders propose
+	Proposals
+	// Votes are the replicas' votes on proposals
+	Votes
+
+	numClasses = iota
+)
+
+// String returns the name of the class.
+func (c Class) String() string {
+	switch c {
+	case Sync:
+		return "sync"
+	case Proposals:
+		return "proposals"
+	case Votes:
+		return "votes"
+	default:
+		return fmt.Sprintf("Class(%d)", int(c))
+	}
+}
+
+var (
+	classesMu sync.RWMutex
+	classes   = make(map[reflect.Type]Class) // By payload type
+)
+
+// RegisterClass sets the class of the payloads of prototype's type. Protocols register
+// their proposal and vote payloads in init, next to their codec registration.
+func RegisterClass(prototype interface{}, class Class) {
+	classesMu.Lock()
+	defer classesMu.Unlock()
+	classes[reflect.TypeOf(prototype)] = class
+}
+
+// ClassOf returns the class of a message payload.
+func ClassOf(payload interface{}) Class {
+	classesMu.RLock()
+	defer classesMu.RUnlock()
+	return classes[reflect.TypeOf(payload)]
+}
@@ -0,0 +1,286 @@
+// File: internal/network/emulation.go
+package network
+
+import (
+	"container/heap"
+	"log"
+	"math"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"babel-bft/internal/codec"
+	"babel-bft/internal/config"
+	"babel-bft/internal/types"
+)
+
+// maxEmulatedDelay caps the delays drawn from heavy-tailed distributions, well beyond
+// the length of any experiment, so that they cannot overflow.
+const maxEmulatedDelay = time.Hour
+
+// EmulationStats counts what the emulated links did to the messages they carried.
+type EmulationStats struct {
+	Delivered  int64 `json:"delivered"`
+	Lost       int64 `json:"lost"`
+	Overflowed int64 `json:"overflowed"` // Dropped because the link's queue was full
+	Duplicated int64 `json:"duplicated"`
+	Reordered  int64 `json:"reordered"`
+}
+
+// EmulatedTransport wraps a transport to make it behave like a real network, as set
+// by a network emulation config. It stands between the wrapped transport and the nodes
+// registered with it: every message the wrapped transport delivers goes through the
+// emulated link from its sender to its recipient first, which delays, loses, duplicates
+// or reorders it, and queues it behind the messages sent before it when the link's
+// bandwidth is capped. Each directed link has its own queue, and a message broadcast
+// to several nodes crosses each of their links independently.
+//
+// Since links are emulated where messages are received, any transport can be wrapped:
+// the local one, to emulate a network in a single process, and the TCP and QUIC ones,
+// to add the properties of a wide-area network to a local one.
+type EmulatedTransport struct {
+	Transport
+	cfg      config.NetworkEmulationConfig
+	codec    codec.Codec
+	stopChan chan struct{}
+	stopOnce sync.Once
+
+	mu    sync.Mutex
+	links map[[2]uint]*link // By sender and recipient
+
+	delivered, lost, overflowed, duplicated, reordered atomic.Int64
+}
+
+// NewEmulatedTransport wraps inner with the links described by cfg. c measures the
+// size of the messages on links whose bandwidth is capped.
+func NewEmulatedTransport(inner Transport, cfg config.NetworkEmulationConfig, c codec.Codec) *EmulatedTransport {
+	return &EmulatedTransport{
+		Transport: inner,
+		cfg:       cfg,
+		codec:     c,
+		stopChan:  make(chan struct{}),
+		links:     make(map[[2]uint]*link),
+	}
+}
+
+// RegisterNodeChan registers a node with the wrapped transport, behind the emulated
+// links to it.
+func (e *EmulatedTransport) RegisterNodeChan(nodeID uint, ch chan<- *types.Message) {
+	in := make(chan *types.Message)
+	e.Transport.RegisterNodeChan(nodeID, in)
+	go e.receive(nodeID, in, ch)
+}
+
+// Stop stops delivering messages. The messages still in flight are discarded.
+func (e *EmulatedTransport) Stop() {
+	e.stopOnce.Do(func() {
+		close(e.stopChan)
+	})
+}
+
+// Stats returns what the links did to the messages so far.
+func (e *EmulatedTransport) Stats() EmulationStats {
+	return EmulationStats{
+		Delivered:  e.delivered.Load(),
+		Lost:       e.lost.Load(),
+		Overflowed: e.overflowed.Load(),
+		Duplicated: e.duplicated.Load(),
+		Reordered:  e.reordered.Load(),
+	}
+}
+
+// receive hands the messages the wrapped transport delivers to node to the links they
+// come through.
+func (e *EmulatedTransport) receive(to uint, in <-chan *types.Message, out chan<- *types.Message) {
+	for {
+		select {
+		case msg := <-in:
+			e.carry(e.link(msg.From, to, out), msg)
+		case <-e.stopChan:
+			return
+		}
+	}
+}
+
+// link returns the link from one node to another, starting it on first use.
+func (e *EmulatedTransport) link(from, to uint, out chan<- *types.Message) *link {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	key := [2]uint{from, to}
+	l, ok := e.links[key]
+	if !ok {
+		cfg := e.cfg.LinkFor(from, to)
+		l = &link{
+			cfg:            cfg,
+			bytesPerSecond: cfg.BandwidthMbps * 1e6 / 8,
+			out:            out,
+			wake:           make(chan struct{}, 1),
+		}
+		e.links[key] = l
+		go e.deliver(l)
+	}
+	return l
+}
+
+// carry puts a message on a link, applying its loss, duplication, bandwidth, delay
+// and reordering.
+func (e *EmulatedTransport) carry(l *link, msg *types.Message) {
+	if rand.Float64() < l.cfg.Loss {
+		e.lost.Add(1)
+		return
+	}
+	copies := 1
+	if rand.Float64() < l.cfg.Duplication {
+		copies = 2
+		e.duplicated.Add(1)
+	}
+	size := 0
+	if l.bytesPerSecond > 0 {
+		size = e.size(msg)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	for range copies {
+		sent := now
+		if l.bytesPerSecond > 0 {
+			// Forget the messages the link finished sending
+			for len(l.sending) > 0 && !l.sending[0].After(now) {
+				l.sending = l.sending[1:]
+			}
+			if l.cfg.QueueSize > 0 && len(l.sending) >= l.cfg.QueueSize {
+				e.overflowed.Add(1)
+				continue
+			}
+			start := now
+			if l.busyUntil.After(start) {
+				start = l.busyUntil
+			}
+			l.busyUntil = start.Add(time.Duration(float64(size) / l.bytesPerSecond * float64(time.Second)))
+			l.sending = append(l.sending, l.busyUntil)
+			sent = l.busyUntil
+		}
+		at := sent
+		if rand.Float64() < l.cfg.Reordering {
+			e.reordered.Add(1)
+		} else {
+			at = sent.Add(l.delay())
+		}
+		heap.Push(&l.inFlight, delivery{at: at, seq: l.seq, msg: msg})
+		l.seq++
+	}
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+}
+
+// size returns the encoded size of a message, or zero if it cannot be encoded.
+func (e *EmulatedTransport) size(msg *types.Message) int {
+	data, err := e.codec.Marshal(msg)
+	if err != nil {
+		log.Printf("Error: Cannot encode message of type %d from node %d: %v", msg.Type, msg.From, err)
+		return 0
+	}
+	return len(data)
+}
+
+// deliver hands the messages in flight on a link to its recipient once they arrive,
+// in order of arrival, until the transport stops. A recipient whose inbox is full holds
+// up the link.
+func (e *EmulatedTransport) deliver(l *link) {
+	timer := time.NewTimer(maxEmulatedDelay)
+	defer timer.Stop()
+	for {
+		l.mu.Lock()
+		if len(l.inFlight) == 0 {
+			l.mu.Unlock()
+			select {
+			case <-l.wake:
+				continue
+			case <-e.stopChan:
+				return
+			}
+		}
+		next := l.inFlight[0]
+		wait := time.Until(next.at)
+		if wait <= 0 {
+			heap.Pop(&l.inFlight)
+			l.mu.Unlock()
+			select {
+			case l.out <- next.msg:
+				e.delivered.Add(1)
+			case <-e.stopChan:
+				return
+			}
+			continue
+		}
+		l.mu.Unlock()
+		timer.Reset(wait)
+		select {
+		case <-timer.C:
+		case <-l.wake: // An earlier message may have arrived
+		case <-e.stopChan:
+			return
+		}
+	}
+}
+
+// link is an emulated link from one node to another.
+type link struct {
+	cfg            config.LinkConfig
+	bytesPerSecond float64 // Zero if the bandwidth is not capped
+	out            chan<- *types.Message
+	wake           chan struct{} // Signals a new message in flight
+
+	mu        sync.Mutex
+	busyUntil time.Time   // When the link finishes sending the messages queued so far
+	sending   []time.Time // When each message queued or being sent leaves the link, in order
+	inFlight  deliveries
+	seq       uint64 // Orders the messages that arrive at the same time
+}
+
+// delay draws the delay of a message from the link's distribution.
+func (l *link) delay() time.Duration {
+	base, jitter := float64(l.cfg.Delay.Duration), float64(l.cfg.Jitter.Duration)
+	var d float64
+	switch l.cfg.Distribution {
+	case "uniform":
+		d = base - jitter + 2*jitter*rand.Float64()
+	case "normal":
+		d = base + jitter*rand.NormFloat64()
+	case "pareto":
+		d = base / math.Pow(1-rand.Float64(), 1/l.cfg.ParetoShape)
+	default:
+		d = base
+	}
+	return time.Duration(max(0, min(d, float64(maxEmulatedDelay))))
+}
+
+// delivery is a message in flight on a link, which arrives at a given time.
+type delivery struct {
+	at  time.Time
+	seq uint64
+	msg *types.Message
+}
+
+// deliveries is a heap of messages in flight, earliest arrival first.
+type deliveries []delivery
+
+func (d deliveries) Len() int { return len(d) }
+func (d deliveries) Less(i, j int) bool {
+	if d[i].at.Equal(d[j].at) {
+		return d[i].seq < d[j].seq
+	}
+	return d[i].at.Before(d[j].at)
+}
+func (d deliveries) Swap(i, j int)       { d[i], d[j] = d[j], d[i] }
+func (d *deliveries) Push(x interface{}) { *d = append(*d, x.(delivery)) }
+func (d *deliveries) Pop() interface{} {
+	old := *d
+	last := old[len(old)-1]
+	*d = old[:len(old)-1]
+	return last
+}
@@ -0,0 +1,197 @@
+package network
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"babel-bft/internal/codec"
+	"babel-bft/internal/config"
+	"babel-bft/internal/types"
+)
+
+// directTransport hands each message to its recipient before returning, so that the
+// emulated links receive the messages in the order they were sent.
+type directTransport struct {
+	mu      sync.Mutex
+	nodeChs map[uint]chan<- *types.Message
+}
+
+func (d *directTransport) RegisterNodeChan(nodeID uint, ch chan<- *types.Message) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.nodeChs[nodeID] = ch
+}
+
+func (d *directTransport) Broadcast(msg *types.Message) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for id, ch := range d.nodeChs {
+		if id != msg.From {
+			ch <- msg
+		}
+	}
+}
+
+func (d *directTransport) Send(recipientID uint, msg *types.Message) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.nodeChs[recipientID] <- msg
+}
+
+func (d *directTransport) Start() {}
+
+// newEmulated wraps a direct transport between n nodes with the emulated links of cfg,
+// and returns the inbox of each node.
+func newEmulated(t *testing.T, n int, cfg config.NetworkEmulationConfig) (*EmulatedTransport, []chan *types.Message) {
+	t.Helper()
+	c, err := codec.New(codec.Binary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewEmulatedTransport(&directTransport{nodeChs: make(map[uint]chan<- *types.Message)}, cfg, c)
+	t.Cleanup(e.Stop)
+	inboxes := make([]chan *types.Message, n)
+	for i := range inboxes {
+		inboxes[i] = make(chan *types.Message, 1000)
+		e.RegisterNodeChan(uint(i), inboxes[i])
+	}
+	return e, inboxes
+}
+
+// collect receives the sequence numbers of the messages arriving in inbox until none
+// arrives for quiet.
+func collect(inbox <-chan *types.Message, quiet time.Duration) []int {
+	var seqs []int
+	for {
+		select {
+		case msg := <-inbox:
+			seq, _ := strconv.Atoi(string(msg.Payload.(*types.Transaction).Payload))
+			seqs = append(seqs, seq)
+		case <-time.After(quiet):
+			return seqs
+		}
+	}
+}
+
+func TestEmulatedDelay(t *testing.T) {
+	e, inboxes := newEmulated(t, 2, config.NetworkEmulationConfig{
+		Link: config.LinkConfig{Delay: config.Duration{Duration: 100 * time.Millisecond}},
+	})
+	start := time.Now()
+	e.Send(1, txMessage(0, "0"))
+	<-inboxes[1]
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("message arrived after %s, before the link's delay of 100ms", elapsed)
+	}
+}
+
+func TestEmulatedLoss(t *testing.T) {
+	// Only the link from 0 to 1 loses messages.
+	e, inboxes := newEmulated(t, 3, config.NetworkEmulationConfig{
+		Links: []config.LinkRule{{From: []uint{0}, To: []uint{1}, LinkConfig: config.LinkConfig{Loss: 1}}},
+	})
+	for seq := 0; seq < 20; seq++ {
+		e.Broadcast(txMessage(0, strconv.Itoa(seq)))
+	}
+	if got := collect(inboxes[1], 100*time.Millisecond); len(got) != 0 {
+		t.Errorf("node 1 received %d messages over a link that loses them all", len(got))
+	}
+	if got := collect(inboxes[2], 100*time.Millisecond); len(got) != 20 {
+		t.Errorf("node 2 received %d of 20 messages over a lossless link", len(got))
+	}
+	if stats := e.Stats(); stats.Lost != 20 || stats.Delivered != 20 {
+		t.Errorf("stats = %+v, want 20 lost and 20 delivered", stats)
+	}
+}
+
+func TestEmulatedDuplication(t *testing.T) {
+	e, inboxes := newEmulated(t, 2, config.NetworkEmulationConfig{
+		Link: config.LinkConfig{Duplication: 1},
+	})
+	for seq := 0; seq < 10; seq++ {
+		e.Send(1, txMessage(0, strconv.Itoa(seq)))
+	}
+	got := collect(inboxes[1], 100*time.Millisecond)
+	if len(got) != 20 {
+		t.Fatalf("received %d messages, want each of the 10 twice", len(got))
+	}
+	for i, seq := range got {
+		if seq != i/2 {
+			t.Fatalf("received %v, want each message twice in a row", got)
+		}
+	}
+	if stats := e.Stats(); stats.Duplicated != 10 {
+		t.Errorf("stats = %+v, want 10 duplicated", stats)
+	}
+}
+
+func TestEmulatedReordering(t *testing.T) {
+	e, inboxes := newEmulated(t, 2, config.NetworkEmulationConfig{
+		Link: config.LinkConfig{Delay: config.Duration{Duration: 50 * time.Millisecond}, Reordering: 0.5},
+	})
+	const count = 100
+	for seq := 0; seq < count; seq++ {
+		e.Send(1, txMessage(0, strconv.Itoa(seq)))
+	}
+	got := collect(inboxes[1], 200*time.Millisecond)
+	if len(got) != count {
+		t.Fatalf("received %d of %d messages", len(got), count)
+	}
+	overtaken := 0
+	for i := 1; i < len(got); i++ {
+		if got[i] < got[i-1] {
+			overtaken++
+		}
+	}
+	reordered := e.Stats().Reordered
+	if reordered == 0 || reordered == count || overtaken == 0 {
+		t.Errorf("%d of %d messages skipped the delay and %d overtook others: %v", reordered, count, overtaken, got)
+	}
+}
+
+func TestEmulatedBandwidth(t *testing.T) {
+	// 8 Mbit/s carry a message of about 10 kB in about 10ms.
+	e, inboxes := newEmulated(t, 2, config.NetworkEmulationConfig{
+		Link: config.LinkConfig{BandwidthMbps: 8},
+	})
+	payload := strings.Repeat("x", 10000)
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		e.Send(1, txMessage(0, payload))
+	}
+	for i := 0; i < 5; i++ {
+		<-inboxes[1]
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("5 messages of 10 kB crossed an 8 Mbit/s link in %s", elapsed)
+	}
+}
+
+func TestEmulatedQueueSize(t *testing.T) {
+	// At 0.08 Mbit/s a message of about 1 kB takes about 100ms to send, so the messages
+	// sent at once wait in the queue, which holds 2 of them.
+	e, inboxes := newEmulated(t, 2, config.NetworkEmulationConfig{
+		Link: config.LinkConfig{BandwidthMbps: 0.08, QueueSize: 2},
+	})
+	payload := strings.Repeat("x", 1000)
+	for i := 0; i < 5; i++ {
+		e.Send(1, txMessage(0, payload))
+	}
+	deadline := time.After(5 * time.Second)
+	for i := 0; i < 2; i++ {
+		select {
+		case <-inboxes[1]:
+		case <-deadline:
+			t.Fatalf("received %d of the 2 queued messages", i)
+		}
+	}
+	if got := collect(inboxes[1], 300*time.Millisecond); len(got) != 0 {
+		t.Errorf("received %d messages beyond the queue size", len(got))
+	}
+	if stats := e.Stats(); stats.Overflowed != 3 || stats.Delivered != 2 {
+		t.Errorf("stats = %+v, want 3 overflowed and 2 delivered", stats)
+	}
+}
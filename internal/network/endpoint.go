@@ -0,0 +1,370 @@
+// File: internal/network/endpoint.go
+package network
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"babel-bft/internal/codec"
+	"babel-bft/internal/config"
+	"babel-bft/internal/types"
+)
+
+// MaxFrameSize bounds the frames a transport accepts, so that a corrupt length prefix
+// cannot make it allocate without limit.
+const MaxFrameSize = 64 << 20
+
+// Routing byte at the start of each frame, telling the receiver which of its nodes the
+// message is for. A direct message follows it with the recipient's ID as a varint.
+const (
+	routeDirect    = 0
+	routeBroadcast = 1
+)
+
+// endpoint is what the transports connecting replicas in separate processes share:
+// the local nodes, the codec, the optional TLS settings, and the routing of frames to
+// and from the peers. The transports differ in how frames reach the peers.
+type endpoint struct {
+	name     string // For logs, such as "TCP transport"
+	id       uint
+	book     AddressBook
+	cfg      config.NetworkConfig
+	codec    codec.Codec
+	tls      *tls.Config // Nil without TLS
+	traffic  *Traffic
+	stopChan chan struct{}
+
+	mu      sync.RWMutex // Also guards the transport's own state
+	nodeChs map[uint]chan<- *types.Message
+}
+
+// newEndpoint creates the endpoint of replica id, with the codec named in cfg and the
+// certificates of cfg.TLSDir if set.
+func newEndpoint(name string, id uint, book AddressBook, cfg config.NetworkConfig) (*endpoint, error) {
+	c, err := codec.New(cfg.Codec)
+	if err != nil {
+		return nil, err
+	}
+	var tlsConfig *tls.Config
+	if cfg.TLSDir != "" {
+		if tlsConfig, err = LoadTLSConfig(cfg.TLSDir, id); err != nil {
+			return nil, err
+		}
+	}
+	return &endpoint{
+		name:     name,
+		id:       id,
+		book:     book,
+		cfg:      cfg,
+		codec:    c,
+		tls:      tlsConfig,
+		traffic:  NewTraffic(),
+		stopChan: make(chan struct{}),
+		nodeChs:  make(map[uint]chan<- *types.Message),
+	}, nil
+}
+
+// Traffic returns the traffic the transport sent to its peers.
+func (e *endpoint) Traffic() *Traffic {
+	return e.traffic
+}
+
+// RegisterNodeChan registers a channel for a node running in this process.
+func (e *endpoint) RegisterNodeChan(nodeID uint, ch chan<- *types.Message) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.nodeChs[nodeID] = ch
+}
+
+// peerTLS returns the TLS settings for connecting to replica id, which only accept
+// the certificate issued to it, or nil without TLS.
+func (e *endpoint) peerTLS(id uint) *tls.Config {
+	if e.tls == nil {
+		return nil
+	}
+	config := e.tls.Clone()
+	config.ServerName = ReplicaName(id)
+	return config
+}
+
+// broadcast sends the message to every node except the sender: the local ones, and
+// all the peers, whose frames are handed to enqueue. The frame is encoded once and
+// shared by the peers.
+func (e *endpoint) broadcast(msg *types.Message, enqueue func(id uint, frame []byte) bool) {
+	e.mu.RLock()
+	for id, ch := range e.nodeChs {
+		if id != msg.From {
+			go func(c chan<- *types.Message) {
+				c <- msg
+			}(ch)
+		}
+	}
+	e.mu.RUnlock()
+
+	var frame []byte
+	copies := 0
+	for id := range e.book {
+		if id == msg.From || e.isLocal(id) {
+			continue
+		}
+		if frame == nil {
+			var err error
+			if frame, err = e.frame(msg, []byte{routeBroadcast}); err != nil {
+				return
+			}
+		}
+		if enqueue(id, frame) {
+			copies++
+		}
+	}
+	e.traffic.Record(msg, len(frame)-1, copies)
+}
+
+// send delivers a message to a specific recipient: directly if it is local, and
+// through enqueue if it is a peer.
+func (e *endpoint) send(recipientID uint, msg *types.Message, enqueue func(id uint, frame []byte) bool) {
+	e.mu.RLock()
+	ch, local := e.nodeChs[recipientID]
+	e.mu.RUnlock()
+	if local {
+		go func() {
+			ch <- msg
+		}()
+		return
+	}
+	if _, ok := e.book[recipientID]; !ok {
+		log.Printf("Error: Attempted to send message to node %d, which is not in the address book", recipientID)
+		return
+	}
+	route := binary.AppendUvarint([]byte{routeDirect}, uint64(recipientID))
+	frame, err := e.frame(msg, route)
+	if err != nil {
+		return
+	}
+	if enqueue(recipientID, frame) {
+		e.traffic.Record(msg, len(frame)-len(route), 1)
+	}
+}
+
+// frame encodes msg after the routing bytes. Messages that cannot be encoded are
+// logged and dropped.
+func (e *endpoint) frame(msg *types.Message, route []byte) ([]byte, error) {
+	frame, err := e.codec.Marshal(msg)
+	if err != nil {
+		log.Printf("Error: Cannot encode message of type %d from node %d: %v", msg.Type, msg.From, err)
+		return nil, err
+	}
+	return append(route, frame...), nil
+}
+
+func (e *endpoint) isLocal(id uint) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	_, ok := e.nodeChs[id]
+	return ok
+}
+
+// authenticate returns the ID of the replica a peer's verified certificate was issued
+// to, which must be in the address book.
+func (e *endpoint) authenticate(certs []*x509.Certificate) (uint, error) {
+	if len(certs) == 0 {
+		return 0, fmt.Errorf("no certificate")
+	}
+	peerID, err := replicaID(certs[0])
+	if err != nil {
+		return 0, err
+	}
+	if _, ok := e.book[peerID]; !ok {
+		return 0, fmt.Errorf("node %d is not in the address book", peerID)
+	}
+	return peerID, nil
+}
+
+// checkSender verifies that a message received from the authenticated replica peerID
+// was sent by it, or is a transaction of one of the clients it may run.
+func (e *endpoint) checkSender(msg *types.Message, peerID uint) error {
+	if msg.From == peerID {
+		return nil
+	}
+	if _, replica := e.book[msg.From]; !replica {
+		if _, ok := msg.Payload.(*types.Transaction); ok {
+			return nil
+		}
+	}
+	return fmt.Errorf("message of type %d claims to be from node %d but was sent by node %d", msg.Type, msg.From, peerID)
+}
+
+// deliver decodes a received frame, checks its sender with checkSender, and hands its
+// message to the local nodes it is for. Delivery blocks while a recipient's inbox is
+// full, which slows the sender down through flow control.
+func (e *endpoint) deliver(frame []byte, checkSender func(*types.Message) error) error {
+	if len(frame) == 0 {
+		return fmt.Errorf("invalid frame: empty")
+	}
+	broadcast := frame[0] == routeBroadcast
+	var to uint64
+	n := 1
+	switch frame[0] {
+	case routeBroadcast:
+	case routeDirect:
+		var m int
+		if to, m = binary.Uvarint(frame[1:]); m <= 0 {
+			return fmt.Errorf("invalid frame: bad recipient")
+		}
+		n += m
+	default:
+		return fmt.Errorf("invalid frame: bad routing byte %d", frame[0])
+	}
+	msg, err := e.codec.Unmarshal(frame[n:])
+	if err != nil {
+		return fmt.Errorf("invalid frame: %w", err)
+	}
+	if err := checkSender(msg); err != nil {
+		return err
+	}
+
+	e.mu.RLock()
+	var targets []chan<- *types.Message
+	if broadcast {
+		for id, ch := range e.nodeChs {
+			if id != msg.From {
+				targets = append(targets, ch)
+			}
+		}
+	} else if ch, ok := e.nodeChs[uint(to)]; ok {
+		targets = append(targets, ch)
+	}
+	e.mu.RUnlock()
+
+	for _, ch := range targets {
+		select {
+		case ch <- msg:
+		case <-e.stopChan:
+			return nil
+		}
+	}
+	return nil
+}
+
+// keepConnected keeps a connection to peer id open until the transport stops. dial
+// opens the connection and returns the function that uses it, which returns when the
+// connection fails. Connections that cannot be opened or fail are reopened after a
+// backoff that doubles on each failed attempt.
+func (e *endpoint) keepConnected(id uint, addr string, dial func() (func() error, error)) {
+	backoff := e.cfg.ReconnectBackoff.Duration
+	failures := 0
+	for {
+		use, err := dial()
+		if err != nil {
+			failures++
+			if failures == 1 {
+				log.Printf("%s: cannot reach node %d at %s, retrying: %v", e.name, id, addr, err)
+			}
+			select {
+			case <-time.After(backoff):
+			case <-e.stopChan:
+				return
+			}
+			backoff = min(2*backoff, e.cfg.MaxReconnectBackoff.Duration)
+			continue
+		}
+		log.Printf("%s: connected to node %d at %s.", e.name, id, addr)
+		backoff = e.cfg.ReconnectBackoff.Duration
+		failures = 0
+
+		err = use()
+		select {
+		case <-e.stopChan:
+			return
+		default:
+		}
+		log.Printf("%s: connection to node %d lost, reconnecting: %v", e.name, id, err)
+	}
+}
+
+// frameQueue holds the frames waiting to be written to a peer, up to a bound.
+type frameQueue struct {
+	label    string // Describes the queue in logs
+	frames   chan []byte
+	dropping atomic.Bool // Whether frames are being dropped since the queue filled up
+}
+
+func newFrameQueue(label string, size int) *frameQueue {
+	return &frameQueue{label: label, frames: make(chan []byte, size)}
+}
+
+// enqueue queues a frame, or drops it if the queue is full. It reports whether the
+// frame was queued.
+func (q *frameQueue) enqueue(frame []byte) bool {
+	select {
+	case q.frames <- frame:
+		q.dropping.Store(false)
+		return true
+	default:
+		if !q.dropping.Swap(true) {
+			log.Printf("%s is full, dropping messages", q.label)
+		}
+		return false
+	}
+}
+
+// write writes the queued frames on w until writing fails, or stop or closed is
+// closed. Frames go through a buffer that is flushed once the queue is empty, so that
+// bursts of small messages share segments.
+func (q *frameQueue) write(w io.Writer, stop, closed <-chan struct{}) error {
+	bw := bufio.NewWriter(w)
+	for {
+		var frame []byte
+		select {
+		case frame = <-q.frames:
+		case <-stop:
+			return nil
+		case <-closed:
+			return nil
+		}
+		if err := writeFrame(bw, frame); err != nil {
+			return err
+		}
+		if len(q.frames) == 0 {
+			if err := bw.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// writeFrame writes data prefixed by its length as a 4-byte big-endian integer.
+func writeFrame(w io.Writer, data []byte) error {
+	var prefix [4]byte
+	binary.BigEndian.PutUint32(prefix[:], uint32(len(data)))
+	if _, err := w.Write(prefix[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// readFrame reads a frame written by writeFrame.
+func readFrame(r io.Reader) ([]byte, error) {
+	var prefix [4]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(prefix[:])
+	if size > MaxFrameSize {
+		return nil, fmt.Errorf("frame of %d bytes exceeds the limit of %d", size, MaxFrameSize)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
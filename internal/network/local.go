@@ -2,6 +2,7 @@
 package network
 
 import (
+	"babel-bft/internal/codec"
 	"babel-bft/internal/types"
 	"log"
 	"sync"
@@ -9,21 +10,46 @@ import (
 
 // LocalTransport provides an in-memory, channel-based transport implementation.
 // It is used for running multiple nodes within a single process for testing and simulation.
+// Messages are handed over as they are, but when the transport has a codec it also
+// encodes each one, to count the traffic a network transport would carry.
 type LocalTransport struct {
 	mu       sync.RWMutex
 	nodeChs  map[uint]chan<- *types.Message
 	numNodes uint
+	codec    codec.Codec
+	traffic  *Traffic
 }
 
 // NewLocalTransport creates a new LocalTransport.
 // numNodes is the total number of nodes that will participate in the network.
-func NewLocalTransport(numNodes uint) *LocalTransport {
+// c measures the size of the messages; nil disables the measurement.
+func NewLocalTransport(numNodes uint, c codec.Codec) *LocalTransport {
 	return &LocalTransport{
 		nodeChs:  make(map[uint]chan<- *types.Message),
 		numNodes: numNodes,
+		codec:    c,
+		traffic:  NewTraffic(),
 	}
 }
 
+// Traffic returns the traffic the transport carried, as encoded by its codec.
+func (lt *LocalTransport) Traffic() *Traffic {
+	return lt.traffic
+}
+
+// record counts copies of msg in the traffic.
+func (lt *LocalTransport) record(msg *types.Message, copies int) {
+	if lt.codec == nil || copies == 0 {
+		return
+	}
+	data, err := lt.codec.Marshal(msg)
+	if err != nil {
+		log.Printf("Error: Cannot encode message of type %d from node %d: %v", msg.Type, msg.From, err)
+		return
+	}
+	lt.traffic.Record(msg, len(data), copies)
+}
+
 // RegisterNodeChan registers a channel for a given node id.
 func (lt *LocalTransport) RegisterNodeChan(nodeID uint, ch chan<- *types.Message) {
 	lt.mu.Lock()
@@ -42,6 +68,11 @@ func (lt *LocalTransport) Broadcast(msg *types.Message) {
 	lt.mu.RLock()
 	defer lt.mu.RUnlock()
 
+	copies := len(lt.nodeChs)
+	if _, ok := lt.nodeChs[msg.From]; ok {
+		copies--
+	}
+	lt.record(msg, copies)
 	for id, ch := range lt.nodeChs {
 		// Avoid sending the message back to the sender
 		if id == msg.From {
@@ -60,6 +91,7 @@ func (lt *LocalTransport) Send(recipientID uint, msg *types.Message) {
 	defer lt.mu.RUnlock()
 
 	if ch, ok := lt.nodeChs[recipientID]; ok {
+		lt.record(msg, 1)
 		// Send message in a non-blocking way
 		go func() {
 			ch <- msg
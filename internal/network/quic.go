@@ -0,0 +1,284 @@
+// File: internal/network/quic.go
+package network
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+
+	"babel-bft/internal/config"
+	"babel-bft/internal/types"
+)
+
+// quicALPN is the application protocol the QUIC transports negotiate.
+const quicALPN = "babel-bft"
+
+// quicKeepAlive is how often an idle QUIC connection is pinged, well within the idle
+// timeout, so that connections between quiet replicas are not closed.
+const quicKeepAlive = 5 * time.Second
+
+// Application error codes a QUIC transport closes connections with.
+const (
+	quicClosed       quic.ApplicationErrorCode = 0 // The transport stopped or the connection failed
+	quicRejected     quic.ApplicationErrorCode = 1 // The peer's certificate names no replica of the book
+	quicInvalidFrame quic.ApplicationErrorCode = 2 // The peer sent an invalid frame or impersonated another
+)
+
+// QUICTransport connects replicas running as separate processes over QUIC. It keeps
+// one connection per peer of its address book, like the TCP transport, but sends each
+// class of messages on a unidirectional stream of its own: proposals, votes and sync
+// traffic. A large proposal then only delays the messages of its own class, instead of
+// every message queued behind it, and a lost packet only stalls the stream it belongs
+// to. Messages of a class arrive in the order they were sent, but not in order with
+// the other classes. Each class has its own bounded queue per peer.
+//
+// QUIC connections are always encrypted, so the transport requires the certificates of
+// network.tls_dir, and checks the senders of the messages it receives as the TCP
+// transport does with TLS.
+type QUICTransport struct {
+	*endpoint
+	listener *quic.Listener
+	stopOnce sync.Once
+
+	// Guarded by the endpoint's mutex
+	peers map[uint]*quicPeer
+	conns map[*quic.Conn]struct{} // Incoming connections, closed on Stop
+}
+
+// NewQUICTransport creates the transport of replica id, which listens on the UDP port
+// of its entry in book and reaches the other replicas of book, with the codec named in
+// cfg and the certificates of cfg.TLSDir, which is required. Incoming connections are
+// only accepted once Start is called.
+func NewQUICTransport(id uint, book AddressBook, cfg config.NetworkConfig) (*QUICTransport, error) {
+	if cfg.TLSDir == "" {
+		return nil, fmt.Errorf("the QUIC transport requires certificates: set network.tls_dir")
+	}
+	e, err := newEndpoint("QUIC transport", id, book, cfg)
+	if err != nil {
+		return nil, err
+	}
+	e.tls.NextProtos = []string{quicALPN}
+	listenAddr, err := book.ListenAddr(id)
+	if err != nil {
+		return nil, err
+	}
+	listener, err := quic.ListenAddr(listenAddr, e.tls, quicConfig())
+	if err != nil {
+		return nil, fmt.Errorf("listening on %s: %w", listenAddr, err)
+	}
+	return &QUICTransport{
+		endpoint: e,
+		listener: listener,
+		peers:    make(map[uint]*quicPeer),
+		conns:    make(map[*quic.Conn]struct{}),
+	}, nil
+}
+
+// quicConfig returns the QUIC settings of the connections between replicas.
+func quicConfig() *quic.Config {
+	return &quic.Config{
+		HandshakeIdleTimeout: dialTimeout,
+		KeepAlivePeriod:      quicKeepAlive,
+	}
+}
+
+// Addr returns the address the transport listens on.
+func (t *QUICTransport) Addr() net.Addr {
+	return t.listener.Addr()
+}
+
+// Start begins accepting connections from the peers.
+func (t *QUICTransport) Start() {
+	log.Printf("QUIC transport listening on %s as %s.", t.listener.Addr(), ReplicaName(t.id))
+	go t.accept()
+}
+
+// Stop closes the listener and every connection, and discards the queued messages.
+func (t *QUICTransport) Stop() {
+	t.stopOnce.Do(func() {
+		close(t.stopChan)
+		t.listener.Close()
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		for conn := range t.conns {
+			conn.CloseWithError(quicClosed, "stopping")
+		}
+	})
+}
+
+// Broadcast sends the message to every node except the sender: the local ones and all
+// the peers.
+func (t *QUICTransport) Broadcast(msg *types.Message) {
+	t.broadcast(msg, t.enqueuer(msg))
+}
+
+// Send delivers a message to a specific recipient, local or remote.
+func (t *QUICTransport) Send(recipientID uint, msg *types.Message) {
+	t.send(recipientID, msg, t.enqueuer(msg))
+}
+
+// enqueuer returns the function that queues the frames of msg for a peer, on the
+// queue of its class.
+func (t *QUICTransport) enqueuer(msg *types.Message) func(id uint, frame []byte) bool {
+	class := ClassOf(msg.Payload)
+	return func(id uint, frame []byte) bool {
+		return t.peer(id).queues[class].enqueue(frame)
+	}
+}
+
+// peer returns the connection manager of a replica of the address book, starting it
+// on first use.
+func (t *QUICTransport) peer(id uint) *quicPeer {
+	t.mu.RLock()
+	p, ok := t.peers[id]
+	t.mu.RUnlock()
+	if ok {
+		return p
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if p, ok := t.peers[id]; ok {
+		return p
+	}
+	addr := t.book[id]
+	p = &quicPeer{}
+	for class := range p.queues {
+		label := fmt.Sprintf("QUIC transport: %s queue to node %d (%s)", Class(class), id, addr)
+		p.queues[class] = newFrameQueue(label, t.cfg.SendQueue)
+	}
+	t.peers[id] = p
+	tlsConfig := t.peerTLS(id)
+	go t.keepConnected(id, addr, func() (func() error, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+		defer cancel()
+		conn, err := quic.DialAddr(ctx, addr, tlsConfig, quicConfig())
+		if err != nil {
+			return nil, err
+		}
+		return func() error {
+			return p.write(conn, t.stopChan)
+		}, nil
+	})
+	return p
+}
+
+// accept serves the incoming connections until the transport stops. The listener only
+// returns connections whose handshake completed, which verified the peer's certificate.
+func (t *QUICTransport) accept() {
+	for {
+		conn, err := t.listener.Accept(context.Background())
+		if err != nil {
+			select {
+			case <-t.stopChan:
+			default:
+				log.Printf("QUIC transport: accepting connections failed: %v", err)
+			}
+			return
+		}
+		t.mu.Lock()
+		t.conns[conn] = struct{}{}
+		t.mu.Unlock()
+		go t.serve(conn)
+	}
+}
+
+// serve accepts the streams of an incoming connection, one per class of messages, and
+// delivers their messages until the connection fails.
+func (t *QUICTransport) serve(conn *quic.Conn) {
+	defer func() {
+		t.mu.Lock()
+		delete(t.conns, conn)
+		t.mu.Unlock()
+	}()
+
+	peerID, err := t.authenticate(conn.ConnectionState().TLS.PeerCertificates)
+	if err != nil {
+		log.Printf("QUIC transport: rejecting connection from %s: %v", conn.RemoteAddr(), err)
+		conn.CloseWithError(quicRejected, err.Error())
+		return
+	}
+	checkSender := func(msg *types.Message) error { return t.checkSender(msg, peerID) }
+	for {
+		stream, err := conn.AcceptUniStream(context.Background())
+		if err != nil {
+			if !quicClosedQuietly(err) {
+				log.Printf("QUIC transport: connection from node %d failed: %v", peerID, err)
+			}
+			return
+		}
+		go t.serveStream(conn, stream, peerID, checkSender)
+	}
+}
+
+// serveStream reads the frames of a stream and delivers their messages, until the
+// stream fails. Delivery blocks while the recipient's inbox is full, which slows down
+// the stream through QUIC flow control, and leaves the other streams flowing.
+func (t *QUICTransport) serveStream(conn *quic.Conn, stream *quic.ReceiveStream, peerID uint, checkSender func(*types.Message) error) {
+	r := bufio.NewReader(stream)
+	for {
+		frame, err := readFrame(r)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !quicClosedQuietly(err) {
+				log.Printf("QUIC transport: stream from node %d failed: %v", peerID, err)
+			}
+			return
+		}
+		if err := t.deliver(frame, checkSender); err != nil {
+			log.Printf("QUIC transport: dropping connection from node %d: %v", peerID, err)
+			conn.CloseWithError(quicInvalidFrame, err.Error())
+			return
+		}
+	}
+}
+
+// quicClosedQuietly reports whether err comes from a connection that needs no further
+// logging: closed by this transport, which logged why, or by the peer without error.
+func quicClosedQuietly(err error) bool {
+	var appErr *quic.ApplicationError
+	return errors.As(err, &appErr) && (!appErr.Remote || appErr.ErrorCode == quicClosed)
+}
+
+// quicPeer keeps the messages queued for one replica, one queue per class.
+type quicPeer struct {
+	queues [numClasses]*frameQueue
+}
+
+// write opens a stream per class on conn and writes the queued frames of each class on
+// its stream, until one of the streams fails or the transport stops. It then closes
+// the connection.
+func (p *quicPeer) write(conn *quic.Conn, stopChan <-chan struct{}) error {
+	var streams [numClasses]*quic.SendStream
+	for class := range streams {
+		stream, err := conn.OpenUniStream()
+		if err != nil {
+			conn.CloseWithError(quicClosed, "")
+			return err
+		}
+		streams[class] = stream
+	}
+
+	errs := make(chan error, numClasses)
+	for class, stream := range streams {
+		go func(q *frameQueue, w io.Writer) {
+			errs <- q.write(w, stopChan, conn.Context().Done())
+		}(p.queues[class], stream)
+	}
+	err := <-errs
+	conn.CloseWithError(quicClosed, "") // Stops the other streams
+	for range numClasses - 1 {
+		<-errs
+	}
+	if err == nil {
+		err = context.Cause(conn.Context())
+	}
+	return err
+}
@@ -0,0 +1,189 @@
+package network
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"babel-bft/internal/codec"
+	"babel-bft/internal/types"
+)
+
+// Payloads standing for the proposals and votes of a protocol.
+type testProposal struct {
+	Seq  int
+	Data []byte
+}
+
+type testVote struct {
+	Seq int
+}
+
+func init() {
+	codec.Register(0xfe00, &testProposal{})
+	codec.Register(0xfe01, &testVote{})
+	RegisterClass(&testProposal{}, Proposals)
+	RegisterClass(&testVote{}, Votes)
+}
+
+func TestClassOf(t *testing.T) {
+	tests := []struct {
+		payload interface{}
+		want    Class
+	}{
+		{&testProposal{}, Proposals},
+		{&testVote{}, Votes},
+		{&types.Transaction{}, Sync},
+		{nil, Sync},
+	}
+	for _, tt := range tests {
+		if got := ClassOf(tt.payload); got != tt.want {
+			t.Errorf("ClassOf(%T) = %s, want %s", tt.payload, got, tt.want)
+		}
+	}
+}
+
+// quicBook returns an address book of n replicas on free loopback UDP ports, with
+// certificates for them, and a function that creates the transport of each replica.
+func quicBook(t *testing.T, n int) (AddressBook, func(id uint) *QUICTransport) {
+	t.Helper()
+	book := make(AddressBook)
+	for id := 0; id < n; id++ {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		book[uint(id)] = conn.LocalAddr().String()
+		conn.Close()
+	}
+	cfg := testNetworkConfig
+	cfg.Transport = "quic"
+	cfg.TLSDir = t.TempDir()
+	if err := GenerateCertificates(cfg.TLSDir, book); err != nil {
+		t.Fatal(err)
+	}
+	return book, func(id uint) *QUICTransport {
+		transport, err := NewQUICTransport(id, book, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(transport.Stop)
+		return transport
+	}
+}
+
+func TestQUICRequiresTLS(t *testing.T) {
+	cfg := testNetworkConfig
+	cfg.Transport = "quic"
+	if _, err := NewQUICTransport(0, loopbackBook(t, 1), cfg); err == nil {
+		t.Error("NewQUICTransport succeeded without certificates")
+	}
+}
+
+func TestQUICTransport(t *testing.T) {
+	_, newTransport := quicBook(t, 3)
+	transports := make([]*QUICTransport, 3)
+	inboxes := make([]chan *types.Message, 3)
+	for i := range transports {
+		transports[i] = newTransport(uint(i))
+		inboxes[i] = make(chan *types.Message, 100)
+		transports[i].RegisterNodeChan(uint(i), inboxes[i])
+		transports[i].Start()
+	}
+
+	// Each class arrives in order, whatever the other classes do.
+	large := []byte(strings.Repeat("x", 200000))
+	for seq := 0; seq < 5; seq++ {
+		transports[0].Send(1, &types.Message{From: 0, Payload: &testProposal{Seq: seq, Data: large}})
+		transports[0].Send(1, &types.Message{From: 0, Payload: &testVote{Seq: seq}})
+		transports[0].Send(1, txMessage(0, fmt.Sprint(seq)))
+	}
+	next := make(map[Class]int)
+	for i := 0; i < 15; i++ {
+		select {
+		case msg := <-inboxes[1]:
+			class := ClassOf(msg.Payload)
+			var seq int
+			switch payload := msg.Payload.(type) {
+			case *testProposal:
+				seq = payload.Seq
+				if len(payload.Data) != len(large) {
+					t.Errorf("proposal %d has %d bytes, want %d", seq, len(payload.Data), len(large))
+				}
+			case *testVote:
+				seq = payload.Seq
+			case *types.Transaction:
+				fmt.Sscan(string(payload.Payload), &seq)
+			}
+			if seq != next[class] {
+				t.Errorf("received %s message %d, want %d", class, seq, next[class])
+			}
+			next[class] = seq + 1
+		case <-time.After(5 * time.Second):
+			t.Fatalf("received %d of 15 messages", i)
+		}
+	}
+
+	transports[2].Broadcast(&types.Message{From: 2, Payload: &testVote{Seq: 7}})
+	for _, id := range []int{0, 1} {
+		select {
+		case msg := <-inboxes[id]:
+			if vote, ok := msg.Payload.(*testVote); !ok || vote.Seq != 7 {
+				t.Errorf("replica %d received %v", id, msg)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("replica %d did not receive the broadcast", id)
+		}
+	}
+
+	// Replica 2 cannot pass a message off as replica 0's.
+	transports[2].Send(1, &types.Message{From: 0, Payload: &testVote{Seq: 8}})
+	select {
+	case msg := <-inboxes[1]:
+		t.Errorf("delivered %v sent by replica 2 as replica 0", msg)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestQUICClassQueues(t *testing.T) {
+	_, newTransport := quicBook(t, 2)
+	sender := newTransport(0)
+	sender.Start()
+
+	// Replica 1 is not running yet. The proposals overflow their queue, which does not
+	// keep the votes from being queued.
+	for seq := 0; seq < 2*testNetworkConfig.SendQueue; seq++ {
+		sender.Send(1, &types.Message{From: 0, Payload: &testProposal{Seq: seq}})
+	}
+	for seq := 0; seq < 3; seq++ {
+		sender.Send(1, &types.Message{From: 0, Payload: &testVote{Seq: seq}})
+	}
+
+	receiver := newTransport(1)
+	inbox := make(chan *types.Message, 4*testNetworkConfig.SendQueue)
+	receiver.RegisterNodeChan(1, inbox)
+	receiver.Start()
+
+	proposals, votes := 0, 0
+	deadline := time.After(10 * time.Second)
+	for votes < 3 || proposals < testNetworkConfig.SendQueue {
+		select {
+		case msg := <-inbox:
+			switch msg.Payload.(type) {
+			case *testProposal:
+				proposals++
+			case *testVote:
+				votes++
+			}
+		case <-deadline:
+			t.Fatalf("received %d proposals and %d votes", proposals, votes)
+		}
+	}
+	select {
+	case msg := <-inbox:
+		t.Errorf("received %v beyond the capacity of the proposal queue", msg)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
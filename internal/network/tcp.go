@@ -0,0 +1,237 @@
+// File: internal/network/tcp.go
+package network
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"babel-bft/internal/config"
+	"babel-bft/internal/types"
+)
+
+// dialTimeout bounds each connection attempt to a peer, including the TLS handshake.
+const dialTimeout = 3 * time.Second
+
+// TCPTransport connects replicas running as separate processes, possibly on different
+// hosts. Each transport listens on one address and keeps one outgoing connection per
+// peer of its address book, over which it writes length-prefixed frames holding the
+// messages encoded by its codec, which must be the same at every replica. Connections
+// are opened on the first message to a peer and reopened whenever they fail, after
+// a backoff that doubles on each failed attempt. Messages for a peer wait in a bounded
+// queue while it is unreachable, so replicas can start in any order. Messages being
+// written when a connection fails are lost, as they would be if the peer crashed.
+//
+// The nodes registered with the transport are local: messages for them are delivered
+// directly. Every other replica of the address book is a peer.
+//
+// With TLS, every connection is mutually authenticated with certificates bound to the
+// replica IDs, and each message received must come from the replica at the other end,
+// so that a replica cannot impersonate another. The only exception is transactions
+// from the clients a replica runs, whose IDs are not in the address book. Without TLS,
+// the sender of a message is whatever it claims.
+type TCPTransport struct {
+	*endpoint
+	listener net.Listener
+	stopOnce sync.Once
+
+	// Guarded by the endpoint's mutex
+	peers map[uint]*tcpPeer
+	conns map[net.Conn]struct{} // Incoming connections, closed on Stop
+}
+
+// NewTCPTransport creates the transport of replica id, which listens on the port of
+// its entry in book and reaches the other replicas of book, with the codec named in
+// cfg, and the certificates of cfg.TLSDir if set. Incoming connections are only
+// accepted once Start is called.
+func NewTCPTransport(id uint, book AddressBook, cfg config.NetworkConfig) (*TCPTransport, error) {
+	e, err := newEndpoint("TCP transport", id, book, cfg)
+	if err != nil {
+		return nil, err
+	}
+	listenAddr, err := book.ListenAddr(id)
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("listening on %s: %w", listenAddr, err)
+	}
+	if e.tls != nil {
+		listener = tls.NewListener(listener, e.tls)
+	}
+	return &TCPTransport{
+		endpoint: e,
+		listener: listener,
+		peers:    make(map[uint]*tcpPeer),
+		conns:    make(map[net.Conn]struct{}),
+	}, nil
+}
+
+// Addr returns the address the transport listens on.
+func (t *TCPTransport) Addr() net.Addr {
+	return t.listener.Addr()
+}
+
+// Start begins accepting connections from the peers.
+func (t *TCPTransport) Start() {
+	if t.tls != nil {
+		log.Printf("TCP transport listening on %s with TLS as %s.", t.listener.Addr(), ReplicaName(t.id))
+	} else {
+		log.Printf("TCP transport listening on %s.", t.listener.Addr())
+	}
+	go t.accept()
+}
+
+// Stop closes the listener and every connection, and discards the queued messages.
+func (t *TCPTransport) Stop() {
+	t.stopOnce.Do(func() {
+		close(t.stopChan)
+		t.listener.Close()
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		for conn := range t.conns {
+			conn.Close()
+		}
+	})
+}
+
+// Broadcast sends the message to every node except the sender: the local ones and all
+// the peers.
+func (t *TCPTransport) Broadcast(msg *types.Message) {
+	t.broadcast(msg, t.enqueue)
+}
+
+// Send delivers a message to a specific recipient, local or remote.
+func (t *TCPTransport) Send(recipientID uint, msg *types.Message) {
+	t.send(recipientID, msg, t.enqueue)
+}
+
+// enqueue queues a frame for peer id.
+func (t *TCPTransport) enqueue(id uint, frame []byte) bool {
+	return t.peer(id).queue.enqueue(frame)
+}
+
+// peer returns the connection manager of a replica of the address book, starting it
+// on first use.
+func (t *TCPTransport) peer(id uint) *tcpPeer {
+	t.mu.RLock()
+	p, ok := t.peers[id]
+	t.mu.RUnlock()
+	if ok {
+		return p
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if p, ok := t.peers[id]; ok {
+		return p
+	}
+	addr := t.book[id]
+	p = &tcpPeer{
+		addr:  addr,
+		tls:   t.peerTLS(id),
+		queue: newFrameQueue(fmt.Sprintf("TCP transport: send queue to node %d (%s)", id, addr), t.cfg.SendQueue),
+	}
+	t.peers[id] = p
+	go t.keepConnected(id, addr, func() (func() error, error) {
+		conn, err := p.dial()
+		if err != nil {
+			return nil, err
+		}
+		return func() error {
+			defer conn.Close()
+			return p.queue.write(conn, t.stopChan, nil)
+		}, nil
+	})
+	return p
+}
+
+// accept serves the incoming connections until the transport stops.
+func (t *TCPTransport) accept() {
+	for {
+		conn, err := t.listener.Accept()
+		if err != nil {
+			select {
+			case <-t.stopChan:
+			default:
+				log.Printf("TCP transport: accepting connections failed: %v", err)
+			}
+			return
+		}
+		t.mu.Lock()
+		t.conns[conn] = struct{}{}
+		t.mu.Unlock()
+		go t.serve(conn)
+	}
+}
+
+// serve reads the frames of an incoming connection and delivers their messages, until
+// the connection fails. Delivery blocks while the recipient's inbox is full, which
+// slows the sender down through TCP flow control.
+func (t *TCPTransport) serve(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		t.mu.Lock()
+		delete(t.conns, conn)
+		t.mu.Unlock()
+	}()
+
+	checkSender := func(*types.Message) error { return nil }
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		peerID, err := t.handshake(tlsConn)
+		if err != nil {
+			log.Printf("TCP transport: rejecting connection from %s: %v", conn.RemoteAddr(), err)
+			return
+		}
+		checkSender = func(msg *types.Message) error { return t.checkSender(msg, peerID) }
+	}
+
+	r := bufio.NewReader(conn)
+	for {
+		frame, err := readFrame(r)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				log.Printf("TCP transport: connection from %s failed: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+		if err := t.deliver(frame, checkSender); err != nil {
+			log.Printf("TCP transport: dropping connection from %s: %v", conn.RemoteAddr(), err)
+			return
+		}
+	}
+}
+
+// handshake completes the TLS handshake of an incoming connection, which verifies the
+// peer's certificate, and returns the ID of the replica it was issued to.
+func (t *TCPTransport) handshake(conn *tls.Conn) (uint, error) {
+	conn.SetDeadline(time.Now().Add(dialTimeout))
+	if err := conn.Handshake(); err != nil {
+		return 0, fmt.Errorf("TLS handshake failed: %w", err)
+	}
+	conn.SetDeadline(time.Time{})
+	return t.authenticate(conn.ConnectionState().PeerCertificates)
+}
+
+// tcpPeer is the outgoing connection to one replica, and the messages queued for it.
+type tcpPeer struct {
+	addr  string
+	tls   *tls.Config // Nil without TLS
+	queue *frameQueue
+}
+
+// dial opens a connection to the peer, authenticated when the transport uses TLS.
+func (p *tcpPeer) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	if p.tls == nil {
+		return dialer.Dial("tcp", p.addr)
+	}
+	return tls.DialWithDialer(dialer, "tcp", p.addr, p.tls)
+}
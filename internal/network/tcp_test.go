@@ -0,0 +1,203 @@
+package network
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"babel-bft/internal/config"
+	"babel-bft/internal/types"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+func TestFrames(t *testing.T) {
+	var buf bytes.Buffer
+	frames := [][]byte{[]byte("first"), {}, bytes.Repeat([]byte{0xab}, 70000)}
+	for _, frame := range frames {
+		if err := writeFrame(&buf, frame); err != nil {
+			t.Fatalf("writeFrame: %v", err)
+		}
+	}
+	for i, want := range frames {
+		got, err := readFrame(&buf)
+		if err != nil {
+			t.Fatalf("readFrame %d: %v", i, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("frame %d has %d bytes, want %d", i, len(got), len(want))
+		}
+	}
+	if _, err := readFrame(&buf); !errors.Is(err, io.EOF) {
+		t.Errorf("readFrame after the last frame = %v, want EOF", err)
+	}
+
+	t.Run("truncated", func(t *testing.T) {
+		var buf bytes.Buffer
+		writeFrame(&buf, []byte("truncated"))
+		buf.Truncate(buf.Len() - 1)
+		if _, err := readFrame(&buf); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("readFrame = %v, want unexpected EOF", err)
+		}
+	})
+
+	t.Run("oversized", func(t *testing.T) {
+		var prefix [4]byte
+		binary.BigEndian.PutUint32(prefix[:], MaxFrameSize+1)
+		if _, err := readFrame(bytes.NewReader(prefix[:])); err == nil || !strings.Contains(err.Error(), "exceeds the limit") {
+			t.Errorf("readFrame = %v, want an error about the size limit", err)
+		}
+	})
+}
+
+// testNetworkConfig reconnects quickly, so that tests do not wait for the backoff.
+var testNetworkConfig = config.NetworkConfig{
+	Codec:               "binary",
+	SendQueue:           100,
+	ReconnectBackoff:    config.Duration{Duration: 10 * time.Millisecond},
+	MaxReconnectBackoff: config.Duration{Duration: 50 * time.Millisecond},
+}
+
+// loopbackBook returns an address book of n replicas on free loopback ports.
+func loopbackBook(t *testing.T, n int) AddressBook {
+	t.Helper()
+	book := make(AddressBook)
+	for id := 0; id < n; id++ {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		book[uint(id)] = listener.Addr().String()
+		listener.Close()
+	}
+	return book
+}
+
+// startTCP starts the transport of replica id and registers an inbox for the replica.
+func startTCP(t *testing.T, id uint, book AddressBook, cfg config.NetworkConfig) (*TCPTransport, chan *types.Message) {
+	t.Helper()
+	transport, err := NewTCPTransport(id, book, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inbox := make(chan *types.Message, 100)
+	transport.RegisterNodeChan(id, inbox)
+	transport.Start()
+	t.Cleanup(transport.Stop)
+	return transport, inbox
+}
+
+func txMessage(from uint, payload string) *types.Message {
+	return &types.Message{Type: types.TxMsg, From: from, Payload: &types.Transaction{ClientID: from, Payload: []byte(payload)}}
+}
+
+// receive returns the payload of the next message in inbox, or fails after a timeout.
+func receive(t *testing.T, inbox <-chan *types.Message) string {
+	t.Helper()
+	select {
+	case msg := <-inbox:
+		return string(msg.Payload.(*types.Transaction).Payload)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+		return ""
+	}
+}
+
+func TestTCPTransport(t *testing.T) {
+	book := loopbackBook(t, 3)
+	transports := make([]*TCPTransport, 3)
+	inboxes := make([]chan *types.Message, 3)
+	for i := range transports {
+		transports[i], inboxes[i] = startTCP(t, uint(i), book, testNetworkConfig)
+	}
+
+	// Messages to one peer arrive in order, whatever their size.
+	large := strings.Repeat("x", 100000)
+	for _, payload := range []string{"a", large, "b"} {
+		transports[0].Send(1, txMessage(0, payload))
+	}
+	for _, want := range []string{"a", large, "b"} {
+		if got := receive(t, inboxes[1]); got != want {
+			t.Fatalf("received a payload of %d bytes, want %d", len(got), len(want))
+		}
+	}
+
+	transports[2].Broadcast(txMessage(2, "to everyone"))
+	for _, id := range []int{0, 1} {
+		if got := receive(t, inboxes[id]); got != "to everyone" {
+			t.Errorf("replica %d received %q", id, got)
+		}
+	}
+	select {
+	case msg := <-inboxes[2]:
+		t.Errorf("the sender received its own broadcast %v", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestTCPReconnect(t *testing.T) {
+	// Replica 1 is not running yet: messages wait in the queue until it starts.
+	book := loopbackBook(t, 2)
+	sender, _ := startTCP(t, 0, book, testNetworkConfig)
+	sender.Send(1, txMessage(0, "early"))
+	time.Sleep(30 * time.Millisecond) // Let a connection attempt fail
+
+	receiver, inbox := startTCP(t, 1, book, testNetworkConfig)
+	if got := receive(t, inbox); got != "early" {
+		t.Fatalf("received %q, want the message sent before the replica started", got)
+	}
+
+	// Replica 1 restarts on the same address; the sender reconnects. Messages written
+	// to the old connection before the sender notices it failed are lost, so the
+	// sender keeps sending until one arrives.
+	receiver.Stop()
+	_, inbox = startTCP(t, 1, book, testNetworkConfig)
+	deadline := time.After(5 * time.Second)
+	for {
+		sender.Send(1, txMessage(0, "after restart"))
+		select {
+		case msg := <-inbox:
+			if got := string(msg.Payload.(*types.Transaction).Payload); got != "after restart" {
+				t.Fatalf("received %q", got)
+			}
+			return
+		case <-time.After(20 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("the sender did not reconnect to the restarted replica")
+		}
+	}
+}
+
+func TestTCPInvalidFrame(t *testing.T) {
+	book := loopbackBook(t, 1)
+	_, inbox := startTCP(t, 0, book, testNetworkConfig)
+
+	conn, err := net.Dial("tcp", book[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := writeFrame(conn, []byte("not a message")); err != nil {
+		t.Fatal(err)
+	}
+	// The transport drops the connection instead of delivering anything.
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Errorf("reading from the connection = %v, want EOF", err)
+	}
+	select {
+	case msg := <-inbox:
+		t.Errorf("delivered %v from an invalid frame", msg)
+	default:
+	}
+}
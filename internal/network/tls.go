@@ -0,0 +1,175 @@
+// File: internal/network/tls.go
+package network
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// certificateValidity is how long generated certificates are valid for.
+const certificateValidity = 10 * 365 * 24 * time.Hour
+
+// ReplicaName returns the name a replica's certificate is issued to, which binds the
+// certificate to the replica's ID. It is both the subject's common name and a DNS
+// name of the certificate, so that a replica dialing a peer can require it as the
+// server name.
+func ReplicaName(id uint) string {
+	return fmt.Sprintf("node-%d", id)
+}
+
+// replicaID returns the ID of the replica a verified certificate was issued to.
+func replicaID(cert *x509.Certificate) (uint, error) {
+	id, err := strconv.ParseUint(strings.TrimPrefix(cert.Subject.CommonName, "node-"), 10, 0)
+	if err != nil || cert.Subject.CommonName != ReplicaName(uint(id)) {
+		return 0, fmt.Errorf("certificate of %q does not name a replica", cert.Subject.CommonName)
+	}
+	return uint(id), nil
+}
+
+// certPaths returns the paths of the certificate and private key of replica id in dir.
+func certPaths(dir string, id uint) (certFile, keyFile string) {
+	name := ReplicaName(id)
+	return filepath.Join(dir, name+".pem"), filepath.Join(dir, name+"-key.pem")
+}
+
+// LoadTLSConfig loads the certificate of replica id and the certificate authority of
+// the group from dir, as written by GenerateCertificates, and returns the TLS settings
+// of the replica's transport. Both ends of a connection present a certificate signed by
+// the authority, so connections are mutually authenticated.
+func LoadTLSConfig(dir string, id uint) (*tls.Config, error) {
+	certFile, keyFile := certPaths(dir, id)
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading the certificate of replica %d: %w", id, err)
+	}
+	caPEM, err := os.ReadFile(filepath.Join(dir, "ca.pem"))
+	if err != nil {
+		return nil, fmt.Errorf("loading the certificate authority: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no certificate in %s", filepath.Join(dir, "ca.pem"))
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS13,
+	}, nil
+}
+
+// GenerateCertificates creates a certificate authority and a certificate for each
+// replica of book in dir: ca.pem and ca-key.pem, and node-<id>.pem and node-<id>-key.pem.
+// Besides its name, each replica's certificate lists the host of its address, so that
+// it is also valid for the host name or IP address it is reached at.
+func GenerateCertificates(dir string, book AddressBook) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	caTemplate, err := certificateTemplate("babel-bft CA")
+	if err != nil {
+		return err
+	}
+	caTemplate.IsCA = true
+	caTemplate.BasicConstraintsValid = true
+	caTemplate.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		return fmt.Errorf("creating the certificate authority: %w", err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return err
+	}
+	if err := writePEM(filepath.Join(dir, "ca.pem"), "CERTIFICATE", caDER, 0644); err != nil {
+		return err
+	}
+	if err := writeKey(filepath.Join(dir, "ca-key.pem"), caKey); err != nil {
+		return err
+	}
+
+	for _, id := range book.IDs() {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return err
+		}
+		template, err := certificateTemplate(ReplicaName(id))
+		if err != nil {
+			return err
+		}
+		template.KeyUsage = x509.KeyUsageDigitalSignature
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+		template.DNSNames = []string{ReplicaName(id)}
+		if host, _, err := net.SplitHostPort(book[id]); err == nil {
+			if ip := net.ParseIP(host); ip != nil {
+				template.IPAddresses = []net.IP{ip}
+			} else {
+				template.DNSNames = append(template.DNSNames, host)
+			}
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+		if err != nil {
+			return fmt.Errorf("creating the certificate of replica %d: %w", id, err)
+		}
+		certFile, keyFile := certPaths(dir, id)
+		if err := writePEM(certFile, "CERTIFICATE", der, 0644); err != nil {
+			return err
+		}
+		if err := writeKey(keyFile, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// certificateTemplate returns a template for a certificate issued to name, valid from
+// now, with a random serial number.
+func certificateTemplate(name string) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    now.Add(-time.Hour), // Tolerates clocks slightly behind
+		NotAfter:     now.Add(certificateValidity),
+	}, nil
+}
+
+// writeKey writes a private key in PKCS #8 form, readable only by its owner.
+func writeKey(path string, key *ecdsa.PrivateKey) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+	return writePEM(path, "PRIVATE KEY", der, 0600)
+}
+
+// writePEM writes a single PEM block.
+func writePEM(path, blockType string, der []byte, perm os.FileMode) error {
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(path, data, perm); err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	return nil
+}
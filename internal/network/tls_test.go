@@ -0,0 +1,134 @@
+package network
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+	"time"
+
+	"babel-bft/internal/types"
+)
+
+func TestReplicaID(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    uint
+		wantErr bool
+	}{
+		{"node-0", 0, false},
+		{"node-12", 12, false},
+		{"node-012", 0, true},
+		{"node-", 0, true},
+		{"node--1", 0, true},
+		{"client-1", 0, true},
+		{"babel-bft CA", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := replicaID(&x509.Certificate{Subject: pkix.Name{CommonName: tt.name}})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("replicaID error = %v, want error: %v", err, tt.wantErr)
+			}
+			if err == nil && id != tt.want {
+				t.Errorf("replicaID = %d, want %d", id, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckSender(t *testing.T) {
+	e := &endpoint{book: AddressBook{0: "a:1", 1: "b:1", 2: "c:1"}}
+	tests := []struct {
+		name string
+		msg  *types.Message
+		ok   bool
+	}{
+		{"own message", txMessage(1, "tx"), true},
+		{"transaction of a client", txMessage(7, "tx"), true},
+		{"transaction of another replica", txMessage(2, "tx"), false},
+		{"other message of a client", &types.Message{Type: types.TxMsg + 1, From: 7}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := e.checkSender(tt.msg, 1); (err == nil) != tt.ok {
+				t.Errorf("checkSender = %v, want accepted: %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestTLS(t *testing.T) {
+	book := loopbackBook(t, 3)
+	cfg := testNetworkConfig
+	cfg.TLSDir = t.TempDir()
+	if err := GenerateCertificates(cfg.TLSDir, book); err != nil {
+		t.Fatalf("GenerateCertificates: %v", err)
+	}
+	transports := make([]*TCPTransport, 3)
+	inboxes := make([]chan *types.Message, 3)
+	for i := range transports {
+		transports[i], inboxes[i] = startTCP(t, uint(i), book, cfg)
+	}
+
+	transports[0].Send(1, txMessage(0, "authenticated"))
+	if got := receive(t, inboxes[1]); got != "authenticated" {
+		t.Fatalf("received %q", got)
+	}
+	transports[0].Send(1, txMessage(9, "from a client"))
+	if got := receive(t, inboxes[1]); got != "from a client" {
+		t.Fatalf("received %q", got)
+	}
+
+	// Replica 2 cannot pass a message off as replica 0's.
+	transports[2].Send(1, txMessage(0, "impersonated"))
+	select {
+	case msg := <-inboxes[1]:
+		t.Errorf("delivered %v sent by replica 2 as replica 0", msg)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestTLSOtherAuthority(t *testing.T) {
+	book := loopbackBook(t, 2)
+	cfg := testNetworkConfig
+	cfg.TLSDir = t.TempDir()
+	if err := GenerateCertificates(cfg.TLSDir, book); err != nil {
+		t.Fatal(err)
+	}
+	outsider := cfg
+	outsider.TLSDir = t.TempDir()
+	if err := GenerateCertificates(outsider.TLSDir, book); err != nil {
+		t.Fatal(err)
+	}
+
+	// Replica 0's certificate is not signed by the authority replica 1 trusts.
+	sender, _ := startTCP(t, 0, book, outsider)
+	_, inbox := startTCP(t, 1, book, cfg)
+	sender.Send(1, txMessage(0, "untrusted"))
+	select {
+	case msg := <-inbox:
+		t.Errorf("delivered %v over a connection with an untrusted certificate", msg)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func TestTLSWrongPeer(t *testing.T) {
+	book := loopbackBook(t, 3)
+	cfg := testNetworkConfig
+	cfg.TLSDir = t.TempDir()
+	if err := GenerateCertificates(cfg.TLSDir, book); err != nil {
+		t.Fatal(err)
+	}
+
+	// Replica 2 listens at replica 1's address, but cannot present replica 1's
+	// certificate, so replica 0 does not send it replica 1's messages.
+	sender, _ := startTCP(t, 0, book, cfg)
+	impostor := AddressBook{0: book[0], 1: book[1], 2: book[1]}
+	_, inbox := startTCP(t, 2, impostor, cfg)
+	sender.Send(1, txMessage(0, "for replica 1"))
+	select {
+	case msg := <-inbox:
+		t.Errorf("replica 2 received %v meant for replica 1", msg)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
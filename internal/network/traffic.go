@@ -0,0 +1,75 @@
+// File: internal/network/traffic.go
+package network
+
+import (
+	"sort"
+	"sync"
+
+	"babel-bft/internal/codec"
+	"babel-bft/internal/types"
+)
+
+// TrafficCount is the number of messages of one payload type a transport sent, and
+// their total encoded size in bytes.
+type TrafficCount struct {
+	Messages int64 `json:"messages"`
+	Bytes    int64 `json:"bytes"`
+}
+
+// Traffic counts the messages a transport sent by payload type, with their size as
+// encoded by the transport's codec. A message sent to several recipients counts once
+// per recipient, as it would on the wire. It is safe for concurrent use.
+type Traffic struct {
+	mu     sync.Mutex
+	counts map[string]TrafficCount
+}
+
+// NewTraffic creates an empty traffic counter.
+func NewTraffic() *Traffic {
+	return &Traffic{counts: make(map[string]TrafficCount)}
+}
+
+// Record counts copies of msg, each taking size bytes.
+func (t *Traffic) Record(msg *types.Message, size, copies int) {
+	if copies == 0 {
+		return
+	}
+	name := codec.PayloadName(msg.Payload)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	count := t.counts[name]
+	count.Messages += int64(copies)
+	count.Bytes += int64(size * copies)
+	t.counts[name] = count
+}
+
+// Counts returns the traffic so far, by payload type.
+func (t *Traffic) Counts() map[string]TrafficCount {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	counts := make(map[string]TrafficCount, len(t.counts))
+	for name, count := range t.counts {
+		counts[name] = count
+	}
+	return counts
+}
+
+// Total returns the traffic so far, over all payload types.
+func (t *Traffic) Total() TrafficCount {
+	var total TrafficCount
+	for _, count := range t.Counts() {
+		total.Messages += count.Messages
+		total.Bytes += count.Bytes
+	}
+	return total
+}
+
+// PayloadNames returns the payload types in counts, sorted.
+func PayloadNames(counts map[string]TrafficCount) []string {
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -1,7 +1,13 @@
 // File: internal/network/transport.go
 package network
 
-import "babel-bft/internal/types"
+import (
+	"fmt"
+	"net"
+
+	"babel-bft/internal/config"
+	"babel-bft/internal/types"
+)
 
 // Transport is an interface for network communication between nodes.
 // It allows broadcasting messages to all nodes or sending a message to a specific node.
@@ -19,3 +25,37 @@ type Transport interface {
 	// Start initializes the transport layer.
 	Start()
 }
+
+// RemoteTransport is a transport to replicas running in other processes.
+type RemoteTransport interface {
+	Transport
+
+	// Addr returns the address the transport listens on.
+	Addr() net.Addr
+
+	// Traffic returns the traffic the transport sent to its peers.
+	Traffic() *Traffic
+
+	// Stop closes the transport's connections.
+	Stop()
+}
+
+// NewRemoteTransport creates the transport of replica id selected by cfg.Transport.
+func NewRemoteTransport(id uint, book AddressBook, cfg config.NetworkConfig) (RemoteTransport, error) {
+	var (
+		t   RemoteTransport
+		err error
+	)
+	switch cfg.Transport {
+	case "tcp":
+		t, err = NewTCPTransport(id, book, cfg)
+	case "quic":
+		t, err = NewQUICTransport(id, book, cfg)
+	default:
+		err = fmt.Errorf("unknown transport %q", cfg.Transport)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
@@ -0,0 +1,9 @@
+// Package all registers every protocol shipped with the framework.
+// Import it for its side effects; new protocols are added to this list.
+package all
+
+import (
+	_ "babel-bft/internal/protocols/hotstuff"
+	_ "babel-bft/internal/protocols/pbft"
+	_ "babel-bft/internal/protocols/tendermint"
+)
@@ -18,4 +18,23 @@ type Consensus interface {
 	// SetNode assigns the core node logic to the consensus protocol.
 	// This allows the protocol to send messages and interact with the node's state.
 	SetNode(node types.NodeInterface)
+
+	// Start begins active participation in the protocol (e.g. proposing and arming timers).
+	// It is called by the node once SetNode has been called and the node is receiving messages.
+	Start()
+}
+
+// Reconfigurable is implemented by engines that follow validator-set changes, running
+// each height with the set returned by NodeInterface.ValidatorsAt. Other engines keep
+// the validator set they start with.
+type Reconfigurable interface {
+	Consensus
+	Reconfigurable()
+}
+
+// Stoppable is implemented by engines that run goroutines of their own, which the node
+// stops when it stops.
+type Stoppable interface {
+	Consensus
+	Stop()
 }
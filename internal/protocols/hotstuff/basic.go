@@ -0,0 +1,137 @@
+// File: internal/protocols/hotstuff/basic.go
+package hotstuff
+
+import (
+	"babel-bft/internal/types"
+	"bytes"
+	"log"
+)
+
+// basicHandleNewView lets the leader start the view once a quorum of replicas entered
+// it, proposing a block that extends the highest prepare certificate they reported.
+func (hs *HotStuff) basicHandleNewView(msg *NewViewMessage) bool {
+	if hs.leader(msg.View) != hs.node.ID() || msg.View < hs.view || hs.lastProposed >= msg.View {
+		return true
+	}
+	if !hs.validators.HasQuorum(keys(hs.newViews[msg.View])) {
+		return true
+	}
+
+	highQC := hs.prepareQC
+	for _, qc := range hs.newViews[msg.View] {
+		if qc.View > highQC.View {
+			highQC = qc
+		}
+	}
+	if msg.View > hs.view {
+		hs.view = msg.View
+		hs.pacemaker.ResetTimer()
+	}
+	hs.propose(msg.View, highQC)
+	return true
+}
+
+// basicOnProposal handles the prepare phase: a replica votes for the leader's block if
+// it extends the certificate it carries and is safe with respect to our lock, i.e. it
+// extends the locked block or is justified by a newer certificate.
+func (hs *HotStuff) basicOnProposal(b *Block) {
+	if b.View < hs.view {
+		return
+	}
+	if b.View > hs.view {
+		// We fell behind: the leader could only propose after a quorum entered this view.
+		hs.view = b.View
+		hs.pacemaker.ResetTimer()
+	}
+	if !bytes.Equal(b.Parent, b.Justify.BlockHash) {
+		log.Printf("Node %d: Rejecting %s, it does not extend its justification", hs.node.ID(), b)
+		return
+	}
+
+	safe := hs.lockedQC == nil || b.Justify.View > hs.lockedQC.View
+	if locked := hs.lockedBlock(); locked != nil && hs.extends(b, locked) {
+		safe = true
+	}
+	if !safe {
+		log.Printf("Node %d: Not voting for %s, locked on view %d", hs.node.ID(), b, hs.lockedQC.View)
+		return
+	}
+	hs.basicVote(PhasePrepare, b.View, b.Hash())
+}
+
+// basicHandleVote collects the votes of the current view's phases as its leader.
+// Each certificate is broadcast to start the next phase; the commit certificate
+// decides the block.
+func (hs *HotStuff) basicHandleVote(sender uint, vote *VoteMessage, sig []byte) bool {
+	if hs.leader(vote.View) != hs.node.ID() || vote.View != hs.view {
+		return false
+	}
+	qc, ok := hs.addVote(sender, vote, sig)
+	if !ok {
+		return true
+	}
+	log.Printf("Node %d: Formed %s QC for view %d (%d bytes)", hs.node.ID(), qc.Phase, qc.View, qc.Cert.Size())
+
+	var next Phase
+	switch qc.Phase {
+	case PhasePrepare:
+		next = PhasePreCommit
+	case PhasePreCommit:
+		next = PhaseCommit
+	case PhaseCommit:
+		next = PhaseDecide
+	default:
+		return false
+	}
+	msg := &QCMessage{Phase: next, View: vote.View, QC: qc}
+	hs.node.Broadcast(&types.Message{Type: QCType, Payload: msg})
+	hs.basicHandleQC(hs.node.ID(), msg)
+	return true
+}
+
+// basicHandleQC moves a replica through the pre-commit, commit and decide phases of
+// the current view, as announced by the leader with the previous phase's certificate.
+func (hs *HotStuff) basicHandleQC(sender uint, msg *QCMessage) bool {
+	log.Printf("Node %d: Handling %s from %d for View %d", hs.node.ID(), msg.Phase, sender, msg.View)
+	qc := msg.QC
+	if sender != hs.leader(msg.View) || msg.View != hs.view || qc == nil || qc.View != msg.View || !hs.validQC(qc) {
+		return false
+	}
+
+	switch {
+	case msg.Phase == PhasePreCommit && qc.Phase == PhasePrepare:
+		hs.prepareQC = qc
+		hs.basicVote(PhasePreCommit, msg.View, qc.BlockHash)
+	case msg.Phase == PhaseCommit && qc.Phase == PhasePreCommit:
+		hs.lockedQC = qc
+		hs.basicVote(PhaseCommit, msg.View, qc.BlockHash)
+	case msg.Phase == PhaseDecide && qc.Phase == PhaseCommit:
+		b := hs.blocks[string(qc.BlockHash)]
+		if b == nil {
+			log.Printf("Node %d: Decided block %x is unknown", hs.node.ID(), qc.BlockHash)
+			return false
+		}
+		hs.commit(b)
+		hs.enterView(msg.View + 1)
+	default:
+		return false
+	}
+	return true
+}
+
+// basicVote sends our vote for a phase of a view to its leader, at most once per phase.
+func (hs *HotStuff) basicVote(phase Phase, view int, hash []byte) {
+	if hs.voted[phase] >= view {
+		return
+	}
+	hs.voted[phase] = view
+	hs.sendTo(hs.leader(view), VoteType, &VoteMessage{Phase: phase, View: view, BlockHash: hash})
+}
+
+// lockedBlock returns the block certified by the locked certificate, if any.
+func (hs *HotStuff) lockedBlock() *Block {
+	if hs.lockedQC == nil {
+		return nil
+	}
+	return hs.blocks[string(hs.lockedQC.BlockHash)]
+}
@@ -0,0 +1,66 @@
+// File: internal/protocols/hotstuff/block.go
+package hotstuff
+
+import (
+	"babel-bft/internal/types"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+)
+
+// Block is a node of the HotStuff block tree. It links to its parent and carries
+// the quorum certificate that justifies extending the tree from that point.
+type Block struct {
+	View    int
+	Parent  []byte
+	Justify *QuorumCert
+	Payload *types.Block
+	hash    []byte // Cached; unexported so that it never comes from the wire
+}
+
+// Hash calculates and returns the SHA-256 hash of the block.
+// The hash is cached for performance.
+func (b *Block) Hash() []byte {
+	if b.hash != nil {
+		return b.hash
+	}
+	h := sha256.New()
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(b.View))
+	h.Write(buf[:])
+	writeBytes(h, b.Parent)
+	if b.Justify != nil {
+		binary.BigEndian.PutUint64(buf[:], uint64(b.Justify.View))
+		h.Write(buf[:])
+		writeBytes(h, b.Justify.BlockHash)
+	}
+	if b.Payload != nil {
+		writeBytes(h, b.Payload.Hash())
+	}
+	b.hash = h.Sum(nil)
+	return b.hash
+}
+
+// String provides a simple string representation of the block.
+func (b *Block) String() string {
+	txs := 0
+	if b.Payload != nil {
+		txs = len(b.Payload.Transactions)
+	}
+	return fmt.Sprintf("Block{View: %d, Txs: %d, Hash: %x}", b.View, txs, b.Hash())
+}
+
+// writeBytes writes a length-prefixed byte slice, so that consecutive fields cannot be confused.
+func writeBytes(h interface{ Write([]byte) (int, error) }, data []byte) {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], uint32(len(data)))
+	h.Write(buf[:])
+	h.Write(data)
+}
+
+// newGenesis returns the root of the block tree, identical on every replica,
+// and the certificate that justifies extending it.
+func newGenesis() (*Block, *QuorumCert) {
+	genesis := &Block{View: 0, Payload: types.NewBlock(types.Header{}, nil, nil)}
+	return genesis, &QuorumCert{Phase: PhaseGeneric, View: 0, BlockHash: genesis.Hash()}
+}
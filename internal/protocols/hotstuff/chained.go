@@ -0,0 +1,102 @@
+// File: internal/protocols/hotstuff/chained.go
+package hotstuff
+
+import "log"
+
+// chainedOnProposal votes for a safe proposal and advances the three-chain it extends.
+// A proposal is safe if it is newer than anything we voted for and either extends
+// our locked block or is justified by a certificate newer than the lock.
+func (hs *HotStuff) chainedOnProposal(b *Block) {
+	justified := hs.blocks[string(b.Justify.BlockHash)]
+	hs.update(b)
+
+	if b.View > hs.vheight && (hs.extends(b, hs.bLock) || justified.View > hs.bLock.View) {
+		hs.vheight = b.View
+		vote := &VoteMessage{Phase: PhaseGeneric, View: b.View, BlockHash: b.Hash()}
+		hs.sendTo(hs.leader(b.View+1), VoteType, vote)
+	} else {
+		log.Printf("Node %d: Not voting for %s (voted up to view %d, locked on view %d)", hs.node.ID(), b, hs.vheight, hs.bLock.View)
+	}
+
+	// Seeing the proposal of a view is progress: move on to the next one.
+	if b.View >= hs.view {
+		hs.view = b.View + 1
+		hs.pacemaker.ResetTimer()
+	}
+}
+
+// update applies the chained HotStuff rules to the chain b <- b2 <- b1 <- b0 formed by
+// following justify links: b2's certificate becomes the highest known, b1 (a two-chain)
+// becomes locked, and b0 is committed if the three blocks are direct descendants.
+func (hs *HotStuff) update(b *Block) {
+	hs.updateHighQC(b.Justify)
+
+	b2 := hs.blocks[string(b.Justify.BlockHash)]
+	if b2 == nil || b2.Justify == nil {
+		return
+	}
+	b1 := hs.blocks[string(b2.Justify.BlockHash)]
+	if b1 == nil {
+		return
+	}
+	if b1.View > hs.bLock.View {
+		hs.bLock = b1
+	}
+	if b1.Justify == nil {
+		return
+	}
+	b0 := hs.blocks[string(b1.Justify.BlockHash)]
+	if b0 == nil {
+		return
+	}
+	if string(b2.Parent) == string(b1.Hash()) && string(b1.Parent) == string(b0.Hash()) {
+		hs.commit(b0)
+	}
+}
+
+// updateHighQC keeps the certificate for the highest block seen so far.
+func (hs *HotStuff) updateHighQC(qc *QuorumCert) {
+	if qc.View > hs.highQC.View {
+		hs.highQC = qc
+	}
+}
+
+// chainedHandleVote collects votes as the leader of the view after the voted block's.
+// Once they form a certificate, the leader extends the certified block right away.
+func (hs *HotStuff) chainedHandleVote(sender uint, vote *VoteMessage, sig []byte) bool {
+	if vote.Phase != PhaseGeneric || hs.leader(vote.View+1) != hs.node.ID() {
+		return false
+	}
+	qc, ok := hs.addVote(sender, vote, sig)
+	if !ok {
+		return true
+	}
+	log.Printf("Node %d: Formed QC for view %d (%d bytes)", hs.node.ID(), qc.View, qc.Cert.Size())
+	hs.updateHighQC(qc)
+
+	next := vote.View + 1
+	if next >= hs.view && hs.lastProposed < next {
+		hs.view = next
+		hs.pacemaker.ResetTimer()
+		hs.propose(next, hs.highQC)
+	}
+	return true
+}
+
+// chainedHandleNewView lets the leader of a view propose after a view change, once a
+// quorum of replicas reported their highest certificates.
+func (hs *HotStuff) chainedHandleNewView(msg *NewViewMessage) bool {
+	hs.updateHighQC(msg.HighQC)
+
+	if hs.leader(msg.View) != hs.node.ID() || msg.View < hs.view || hs.lastProposed >= msg.View {
+		return true
+	}
+	if hs.validators.HasQuorum(keys(hs.newViews[msg.View])) {
+		if msg.View > hs.view {
+			hs.view = msg.View
+			hs.pacemaker.ResetTimer()
+		}
+		hs.propose(msg.View, hs.highQC)
+	}
+	return true
+}
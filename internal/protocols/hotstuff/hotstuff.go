@@ -0,0 +1,471 @@
+// File: internal/protocols/hotstuff/hotstuff.go
+package hotstuff
+
+import (
+	"babel-bft/internal/config"
+	"babel-bft/internal/protocols"
+	"babel-bft/internal/types"
+	"bytes"
+	"log"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Modes of operation, selected by the "mode" field of the HotStuff config.
+const (
+	ModeChained = "chained"
+	ModeBasic   = "basic"
+)
+
+// voteKey identifies the set of votes that can form one quorum certificate.
+type voteKey struct {
+	phase Phase
+	view  int
+	hash  string
+}
+
+// deferredProposal is a view this replica leads and the certificate to extend in it.
+type deferredProposal struct {
+	view int
+	qc   *QuorumCert
+}
+
+// State is a snapshot of the replica's progress, as returned by CurrentState.
+type State struct {
+	View       int
+	Height     int // Number of committed blocks
+	HighQCView int
+	LockedView int
+}
+
+// HotStuff is the implementation of the HotStuff consensus protocol. It runs either
+// chained HotStuff, where every view carries a new block and each vote advances the
+// three-chain of its ancestors, or basic HotStuff, where a view takes a single block
+// through the prepare, pre-commit, commit and decide phases.
+type HotStuff struct {
+	// mtx serializes message handling with the pacemaker's timeouts.
+	mtx        sync.Mutex
+	node       types.NodeInterface
+	config     config.HotStuffConfig
+	pacemaker  *Pacemaker
+	validators *types.ValidatorSet
+
+	blocks       map[string]*Block // From the last executed block on
+	orphans      map[string]*Block // Proposals whose parent or justified block is still unknown
+	genesis      *Block
+	view         int
+	lastProposed int // Last view in which this replica proposed
+	// deferred is a proposal waiting for the block its certificate is for to arrive
+	deferred *deferredProposal
+	height   int // Number of committed blocks
+	bExec    *Block
+
+	// Chained HotStuff state
+	vheight int // Highest view this replica voted in
+	bLock   *Block
+	highQC  *QuorumCert
+
+	// Basic HotStuff state
+	prepareQC *QuorumCert
+	lockedQC  *QuorumCert
+	voted     map[Phase]int // Last view this replica voted in, per phase
+
+	votes    map[voteKey]map[uint][]byte  // Vote signatures by voter
+	newViews map[int]map[uint]*QuorumCert // view -> sender -> highest QC of the sender
+}
+
+// NewHotStuff creates a new instance of the HotStuff protocol engine.
+func NewHotStuff(cfg config.HotStuffConfig) *HotStuff {
+	genesis, genesisQC := newGenesis()
+	hs := &HotStuff{
+		config:    cfg,
+		blocks:    map[string]*Block{string(genesis.Hash()): genesis},
+		orphans:   make(map[string]*Block),
+		genesis:   genesis,
+		bExec:     genesis,
+		bLock:     genesis,
+		highQC:    genesisQC,
+		prepareQC: genesisQC,
+		voted:     make(map[Phase]int),
+		votes:     make(map[voteKey]map[uint][]byte),
+		newViews:  make(map[int]map[uint]*QuorumCert),
+	}
+	hs.pacemaker = NewPacemaker(hs, cfg)
+	return hs
+}
+
+// SetNode assigns the core node logic to the consensus protocol.
+func (hs *HotStuff) SetNode(node types.NodeInterface) {
+	hs.node = node
+	hs.pacemaker.node = node
+	if hs.validators == nil {
+		hs.validators = node.Validators()
+	}
+}
+
+// SetValidators sets the replicas taking part in the protocol, which determine the
+// rotation of the leader role and the quorum size. It must be called before Start;
+// otherwise the node's validator set is used.
+func (hs *HotStuff) SetValidators(validators *types.ValidatorSet) {
+	hs.validators = validators
+}
+
+// Start arms the pacemaker and enters the first view.
+func (hs *HotStuff) Start() {
+	hs.mtx.Lock()
+	defer hs.mtx.Unlock()
+
+	hs.pacemaker.Start()
+	hs.enterView(1)
+}
+
+// HandleMessage processes incoming consensus messages.
+func (hs *HotStuff) HandleMessage(senderID uint, msg *types.Message) bool {
+	// Reject messages whose signature does not match the claimed sender.
+	if !protocols.VerifyMessage(hs.node, senderID, msg) {
+		log.Printf("Node %d: Rejected message of type %d with an invalid signature from %d", hs.node.ID(), msg.Type, senderID)
+		return false
+	}
+
+	hs.mtx.Lock()
+	defer hs.mtx.Unlock()
+
+	log.Printf("Node %d: Received message of type %d from %d", hs.node.ID(), msg.Type, senderID)
+	return hs.dispatch(senderID, msg)
+}
+
+// dispatch hands a message to the handler for its type.
+func (hs *HotStuff) dispatch(senderID uint, msg *types.Message) bool {
+	switch payload := msg.Payload.(type) {
+	case *ProposalMessage:
+		return hs.handleProposal(senderID, payload)
+	case *VoteMessage:
+		return hs.handleVote(senderID, payload, msg.Signature)
+	case *NewViewMessage:
+		return hs.handleNewView(senderID, payload)
+	case *QCMessage:
+		if hs.config.Mode != ModeBasic {
+			return false
+		}
+		return hs.basicHandleQC(senderID, payload)
+	default:
+		log.Printf("Node %d: Received unknown message type", hs.node.ID())
+		return false
+	}
+}
+
+// CurrentState returns a snapshot of the replica's progress.
+func (hs *HotStuff) CurrentState() interface{} {
+	hs.mtx.Lock()
+	defer hs.mtx.Unlock()
+
+	state := State{View: hs.view, Height: hs.height, HighQCView: hs.highQC.View, LockedView: hs.bLock.View}
+	if hs.config.Mode == ModeBasic {
+		state.HighQCView = hs.prepareQC.View
+		state.LockedView = -1
+		if hs.lockedQC != nil {
+			state.LockedView = hs.lockedQC.View
+		}
+	}
+	return state
+}
+
+// handleProposal validates a proposal and stores its block. Blocks whose ancestors
+// have not arrived yet are kept aside and processed once they do.
+func (hs *HotStuff) handleProposal(sender uint, proposal *ProposalMessage) bool {
+	b := proposal.Block
+	if b == nil || b.Justify == nil || b.Payload == nil || b.Payload.ValidateBasic() != nil {
+		log.Printf("Node %d: Rejecting malformed proposal from %d", hs.node.ID(), sender)
+		return false
+	}
+	log.Printf("Node %d: Handling Proposal from %d for View %d (current view: %d)", hs.node.ID(), sender, b.View, hs.view)
+
+	if expected := hs.leader(b.View); sender != expected {
+		log.Printf("Node %d: Rejecting proposal from %d, expected leader for view %d is %d", hs.node.ID(), sender, b.View, expected)
+		return false
+	}
+	if !hs.validQC(b.Justify) || b.View <= b.Justify.View {
+		log.Printf("Node %d: Rejecting proposal for view %d with invalid justification", hs.node.ID(), b.View)
+		return false
+	}
+	hash := string(b.Hash())
+	if _, ok := hs.blocks[hash]; ok {
+		return false
+	}
+	if hs.blocks[string(b.Parent)] == nil || hs.blocks[string(b.Justify.BlockHash)] == nil {
+		if len(hs.orphans) < hs.config.BufferSize {
+			hs.orphans[hash] = b
+		}
+		return true
+	}
+
+	hs.processProposal(b)
+	hs.adoptOrphans()
+	return true
+}
+
+// processProposal runs the mode-specific proposal logic on a block whose ancestors are
+// known, once its payload is checked to extend the payload of its parent.
+func (hs *HotStuff) processProposal(b *Block) {
+	if err := b.Payload.ValidateParent(hs.parentPayload(b)); err != nil {
+		log.Printf("Node %d: Rejecting %s, its payload does not extend its parent: %v", hs.node.ID(), b, err)
+		return
+	}
+	hs.blocks[string(b.Hash())] = b
+	if hs.config.Mode == ModeBasic {
+		hs.basicOnProposal(b)
+	} else {
+		hs.chainedOnProposal(b)
+	}
+
+	if d := hs.deferred; d != nil && bytes.Equal(d.qc.BlockHash, b.Hash()) {
+		hs.deferred = nil
+		if d.view >= hs.view {
+			hs.propose(d.view, d.qc)
+		}
+	}
+}
+
+// adoptOrphans processes the kept-aside proposals whose ancestors have since arrived.
+func (hs *HotStuff) adoptOrphans() {
+	for progress := true; progress; {
+		progress = false
+		for hash, b := range hs.orphans {
+			if hs.blocks[string(b.Parent)] == nil || hs.blocks[string(b.Justify.BlockHash)] == nil {
+				continue
+			}
+			delete(hs.orphans, hash)
+			hs.processProposal(b)
+			progress = true
+		}
+	}
+}
+
+// handleVote collects votes sent to this replica as a leader, along with their
+// signatures, which make up the quorum certificates.
+func (hs *HotStuff) handleVote(sender uint, vote *VoteMessage, sig []byte) bool {
+	log.Printf("Node %d: Handling %s Vote from %d for View %d", hs.node.ID(), vote.Phase, sender, vote.View)
+	if hs.config.Mode == ModeBasic {
+		return hs.basicHandleVote(sender, vote, sig)
+	}
+	return hs.chainedHandleVote(sender, vote, sig)
+}
+
+// handleNewView collects the certificates replicas send when they enter a new view.
+func (hs *HotStuff) handleNewView(sender uint, msg *NewViewMessage) bool {
+	log.Printf("Node %d: Handling NewView from %d for View %d", hs.node.ID(), sender, msg.View)
+	if msg.HighQC == nil || !hs.validQC(msg.HighQC) {
+		return false
+	}
+	if _, ok := hs.newViews[msg.View]; !ok {
+		hs.newViews[msg.View] = make(map[uint]*QuorumCert)
+	}
+	hs.newViews[msg.View][sender] = msg.HighQC
+
+	if hs.config.Mode == ModeBasic {
+		return hs.basicHandleNewView(msg)
+	}
+	return hs.chainedHandleNewView(msg)
+}
+
+// addVote records a vote and its signature and returns the quorum certificate the
+// first time the votes for the same phase, view and block reach a quorum. Votes of
+// replicas outside the validator set are ignored, so they cannot end up in a certificate.
+func (hs *HotStuff) addVote(sender uint, vote *VoteMessage, sig []byte) (*QuorumCert, bool) {
+	if !hs.isValidator(sender) {
+		return nil, false
+	}
+	key := voteKey{phase: vote.Phase, view: vote.View, hash: string(vote.BlockHash)}
+	voters, ok := hs.votes[key]
+	if !ok {
+		voters = make(map[uint][]byte)
+		hs.votes[key] = voters
+	}
+	if _, dup := voters[sender]; dup {
+		return nil, false
+	}
+	reached := hs.validators.HasQuorum(keys(voters))
+	voters[sender] = sig
+	if reached || !hs.validators.HasQuorum(keys(voters)) {
+		return nil, false
+	}
+
+	cert, err := hs.node.Crypto().Aggregate(vote.SignBytes(), voters)
+	if err != nil {
+		log.Printf("Node %d: Failed to aggregate %s votes for view %d: %v", hs.node.ID(), vote.Phase, vote.View, err)
+		return nil, false
+	}
+	return &QuorumCert{Phase: vote.Phase, View: vote.View, BlockHash: vote.BlockHash, Cert: cert}, true
+}
+
+// validQC checks that a certificate is either the genesis certificate or carries
+// the signatures of distinct validators holding a quorum of the voting power.
+func (hs *HotStuff) validQC(qc *QuorumCert) bool {
+	if qc.View == 0 {
+		return bytes.Equal(qc.BlockHash, hs.genesis.Hash())
+	}
+	if qc.Cert == nil {
+		return false
+	}
+	for _, id := range qc.Cert.Signers {
+		if !hs.isValidator(id) {
+			return false
+		}
+	}
+	return hs.validators.HasQuorum(qc.Cert.Signers) && hs.node.Crypto().VerifyCertificate(qc.vote().SignBytes(), qc.Cert)
+}
+
+// propose creates a block for the given view extending the block certified by qc,
+// broadcasts it, and processes it locally. The block's payload links to the payload
+// of the certified block, so if that block has not arrived yet, the proposal waits for it.
+func (hs *HotStuff) propose(view int, qc *QuorumCert) {
+	hs.lastProposed = view
+	if hs.blocks[string(qc.BlockHash)] == nil {
+		log.Printf("Node %d: Deferring proposal for view %d until block %x arrives", hs.node.ID(), view, qc.BlockHash)
+		hs.deferred = &deferredProposal{view: view, qc: qc}
+		return
+	}
+
+	b := &Block{View: view, Parent: qc.BlockHash, Justify: qc}
+	header := types.Header{Height: 1, ProposerID: hs.node.ID(), Timestamp: time.Now().UnixNano()}
+	if parent := hs.parentPayload(b); parent != nil {
+		header.Height = parent.Height + 1
+		header.ParentHash = parent.Hash()
+		// Our clock may be behind the parent's proposer.
+		header.Timestamp = max(header.Timestamp, parent.Timestamp)
+	}
+	b.Payload = types.NewBlock(header, hs.node.ReapTransactions(hs.config.BlockSize), nil)
+	proposal := &ProposalMessage{Block: b}
+	hs.node.Broadcast(&types.Message{Type: ProposalType, Payload: proposal})
+	log.Printf("Node %d: Proposing %s extending view %d", hs.node.ID(), b, qc.View)
+
+	// Process our own proposal, since the transport does not loop it back.
+	hs.handleProposal(hs.node.ID(), proposal)
+}
+
+// parentPayload returns the payload of b's parent, which b's payload extends, or nil if
+// the parent is the genesis block: the payloads of a branch form a chain of their own.
+// The parent must be known.
+func (hs *HotStuff) parentPayload(b *Block) *types.Block {
+	parent := hs.blocks[string(b.Parent)]
+	if parent == hs.genesis {
+		return nil
+	}
+	return parent.Payload
+}
+
+// sendTo delivers a message to the given replica, handling it locally if it is this
+// one. Local messages are signed too, since our own vote goes into the certificate.
+func (hs *HotStuff) sendTo(recipient uint, msgType int, payload interface{}) {
+	if recipient == hs.node.ID() {
+		msg := &types.Message{Type: msgType, From: recipient, Payload: payload}
+		if signable, ok := payload.(types.Signable); ok {
+			sig, err := hs.node.Crypto().Sign(signable.SignBytes())
+			if err != nil {
+				log.Printf("Node %d: Failed to sign message of type %d: %v", hs.node.ID(), msgType, err)
+				return
+			}
+			msg.Signature = sig
+		}
+		hs.dispatch(recipient, msg)
+		return
+	}
+	hs.node.Send(recipient, &types.Message{Type: msgType, Payload: payload})
+}
+
+// extends reports whether b descends from (or is) ancestor.
+func (hs *HotStuff) extends(b, ancestor *Block) bool {
+	target := ancestor.Hash()
+	for b != nil {
+		if bytes.Equal(b.Hash(), target) {
+			return true
+		}
+		if b.View <= ancestor.View {
+			return false
+		}
+		b = hs.blocks[string(b.Parent)]
+	}
+	return false
+}
+
+// commit executes b and all of its not yet executed ancestors, oldest first.
+func (hs *HotStuff) commit(b *Block) {
+	if b.View <= hs.bExec.View {
+		return
+	}
+	var branch []*Block
+	for cur := b; cur != nil && cur.View > hs.bExec.View; cur = hs.blocks[string(cur.Parent)] {
+		branch = append(branch, cur)
+	}
+	for i := len(branch) - 1; i >= 0; i-- {
+		hs.height++
+		log.Printf("Node %d: Committing %s at height %d", hs.node.ID(), branch[i], hs.height)
+		hs.node.Commit(hs.height, branch[i].Payload)
+	}
+	hs.bExec = b
+	hs.prune()
+	hs.pacemaker.Progress()
+}
+
+// prune forgets what the committed block made useless: the blocks and kept-aside
+// proposals older than it, which can no longer be committed or extended by a safe
+// proposal, and the votes and new-view messages of the views before the current one,
+// which can no longer form a certificate anyone would act on.
+func (hs *HotStuff) prune() {
+	for hash, b := range hs.blocks {
+		if b.View < hs.bExec.View {
+			delete(hs.blocks, hash)
+		}
+	}
+	for hash, b := range hs.orphans {
+		if b.View <= hs.bExec.View {
+			delete(hs.orphans, hash)
+		}
+	}
+	// In chained mode, the leader of a view collects the votes of the view before.
+	for key := range hs.votes {
+		if key.view+1 < hs.view && key.view <= hs.bExec.View {
+			delete(hs.votes, key)
+		}
+	}
+	for view := range hs.newViews {
+		if view < hs.view && view <= hs.bExec.View {
+			delete(hs.newViews, view)
+		}
+	}
+}
+
+// enterView moves the replica to a new view and notifies its leader.
+func (hs *HotStuff) enterView(view int) {
+	hs.view = view
+	hs.pacemaker.ResetTimer()
+
+	qc := hs.highQC
+	if hs.config.Mode == ModeBasic {
+		qc = hs.prepareQC
+	}
+	hs.sendTo(hs.leader(view), NewViewType, &NewViewMessage{View: view, HighQC: qc})
+}
+
+// onTimeout is called by the pacemaker when the current view made no progress in time.
+func (hs *HotStuff) onTimeout() {
+	log.Printf("Node %d: View %d timed out", hs.node.ID(), hs.view)
+	hs.enterView(hs.view + 1)
+}
+
+// leader returns the replica that leads the given view.
+func (hs *HotStuff) leader(view int) uint {
+	return hs.validators.At(view)
+}
+
+// isValidator reports whether id belongs to one of the replicas.
+func (hs *HotStuff) isValidator(id uint) bool {
+	return hs.validators.Contains(id)
+}
+
+// keys returns the replica IDs keying a map of messages, so their voting power can be weighed.
+func keys[V any](replicas map[uint]V) []uint {
+	return slices.Collect(maps.Keys(replicas))
+}
@@ -0,0 +1,348 @@
+package hotstuff
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"testing"
+	"time"
+
+	"babel-bft/internal/config"
+	"babel-bft/internal/crypto"
+	"babel-bft/internal/protocols"
+	"babel-bft/internal/protocols/protocoltest"
+	"babel-bft/internal/types"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// testConfig returns a configuration whose view timeout never fires during a test, so
+// that view changes only happen when the test calls timeout.
+func testConfig(mode string) config.HotStuffConfig {
+	return config.HotStuffConfig{Mode: mode, ViewTimeout: config.Duration{Duration: time.Hour}, BlockSize: 10, BufferSize: 100}
+}
+
+// newTestCluster creates n HotStuff replicas running in the given mode.
+func newTestCluster(n int, mode string) (*protocoltest.Cluster, []*HotStuff) {
+	engines := make([]*HotStuff, n)
+	cluster := protocoltest.NewCluster(n, func(id uint) protocols.Consensus {
+		engines[id] = NewHotStuff(testConfig(mode))
+		return engines[id]
+	})
+	return cluster, engines
+}
+
+// timeout makes the current view of a replica time out, as its pacemaker would.
+func timeout(hs *HotStuff) {
+	hs.mtx.Lock()
+	defer hs.mtx.Unlock()
+	hs.pacemaker.failures++
+	hs.onTimeout()
+}
+
+func TestCommit(t *testing.T) {
+	tests := []struct {
+		name string
+		mode string
+		n    int
+		txs  int
+	}{
+		{"chained/4 replicas", ModeChained, 4, 0},
+		{"chained/7 replicas", ModeChained, 7, 0},
+		{"chained/transactions", ModeChained, 4, 20},
+		{"basic/4 replicas", ModeBasic, 4, 0},
+		{"basic/7 replicas", ModeBasic, 7, 0},
+		{"basic/transactions", ModeBasic, 4, 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster, _ := newTestCluster(tt.n, tt.mode)
+			for i := 0; i < tt.txs; i++ {
+				cluster.Submit(&types.Transaction{ClientID: 100, Timestamp: int64(i), Payload: []byte(fmt.Sprintf("tx %d", i))})
+			}
+			cluster.Start()
+			for i := 0; i < 100 && cluster.MinHeight() < 5; i++ {
+				cluster.Deliver(tt.n * tt.n)
+			}
+
+			if err := cluster.Check(); err != nil {
+				t.Fatal(err)
+			}
+			if h := cluster.MinHeight(); h < 5 {
+				t.Fatalf("replicas committed %d blocks, want at least 5", h)
+			}
+
+			// Every transaction is committed. Pipelined blocks may repeat a transaction,
+			// since the mempool only drops it once a block including it commits.
+			seen := make(map[*types.Transaction]bool)
+			for _, block := range cluster.Nodes[0].Committed() {
+				for _, tx := range block.Transactions {
+					seen[tx] = true
+				}
+			}
+			if len(seen) != tt.txs {
+				t.Errorf("%d distinct transactions committed, want %d", len(seen), tt.txs)
+			}
+		})
+	}
+}
+
+func TestSilentLeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		mode   string
+		silent uint
+	}{
+		{"chained/first leader", ModeChained, 1},
+		{"chained/later leader", ModeChained, 3},
+		{"basic/first leader", ModeBasic, 1},
+		{"basic/later leader", ModeBasic, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster, engines := newTestCluster(4, tt.mode)
+			cluster.Drop = func(from, to uint, msg *types.Message) bool {
+				return from == tt.silent || to == tt.silent
+			}
+			cluster.Start()
+
+			// Whenever the correct replicas are stuck, their views time out.
+			for i := 0; i < 20 && liveHeight(cluster, tt.silent) < 5; i++ {
+				cluster.Deliver(10000)
+				for id, hs := range engines {
+					if uint(id) != tt.silent {
+						timeout(hs)
+					}
+				}
+			}
+			if err := cluster.Check(); err != nil {
+				t.Fatal(err)
+			}
+			if h := liveHeight(cluster, tt.silent); h < 5 {
+				t.Fatalf("correct replicas committed %d blocks, want at least 5", h)
+			}
+		})
+	}
+}
+
+// liveHeight returns the number of blocks committed by every replica but the silent one.
+func liveHeight(cluster *protocoltest.Cluster, silent uint) int {
+	min := -1
+	for _, node := range cluster.Nodes {
+		if node.ID() == silent {
+			continue
+		}
+		if h := len(node.Committed()); min == -1 || h < min {
+			min = h
+		}
+	}
+	return min
+}
+
+func TestPrune(t *testing.T) {
+	for _, mode := range []string{ModeChained, ModeBasic} {
+		t.Run(mode, func(t *testing.T) {
+			cluster, engines := newTestCluster(4, mode)
+			cluster.Start()
+			for i := 0; i < 200 && cluster.MinHeight() < 20; i++ {
+				cluster.Deliver(16)
+			}
+			if err := cluster.Check(); err != nil {
+				t.Fatal(err)
+			}
+			if h := cluster.MinHeight(); h < 20 {
+				t.Fatalf("replicas committed %d blocks, want at least 20", h)
+			}
+
+			// What a replica keeps does not grow with the length of the chain.
+			for id, hs := range engines {
+				hs.mtx.Lock()
+				for _, b := range hs.blocks {
+					if b.View < hs.bExec.View {
+						t.Errorf("replica %d keeps a block of view %d, behind the executed view %d", id, b.View, hs.bExec.View)
+					}
+				}
+				if len(hs.blocks) > 10 || len(hs.votes) > 10 || len(hs.newViews) > 10 {
+					t.Errorf("replica %d keeps %d blocks, %d vote sets and %d new-view sets after %d commits",
+						id, len(hs.blocks), len(hs.votes), len(hs.newViews), hs.height)
+				}
+				hs.mtx.Unlock()
+			}
+		})
+	}
+}
+
+func TestViewTimerReset(t *testing.T) {
+	tests := []struct {
+		name string
+		// drop keeps the leader of view 2 from entering it on a proposal.
+		drop func(leader, from, to uint, msg *types.Message) bool
+		// others makes the other replicas leave view 1, if the test needs it.
+		others func(hs *HotStuff)
+	}{
+		{
+			// The leader of view 2 misses the proposal of view 1 but collects its votes.
+			"on votes",
+			func(leader, from, to uint, msg *types.Message) bool { return to == leader && msg.Type == ProposalType },
+			func(hs *HotStuff) {},
+		},
+		{
+			// View 1 times out everywhere but at the leader of view 2, which follows the others.
+			"on new views",
+			func(leader, from, to uint, msg *types.Message) bool { return msg.Type != NewViewType },
+			timeout,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster, engines := newTestCluster(4, ModeChained)
+			leader := engines[0].leader(2)
+			cluster.Drop = func(from, to uint, msg *types.Message) bool { return tt.drop(leader, from, to, msg) }
+			cluster.Start()
+			hs := engines[leader]
+			epoch := hs.pacemaker.epoch
+			for id, other := range engines {
+				if uint(id) != leader {
+					tt.others(other)
+				}
+			}
+			cluster.Deliver(10000)
+			if hs.view < 2 {
+				t.Fatalf("leader of view 2 is in view %d", hs.view)
+			}
+			// Its own proposal may take it on to the next view, which restarts the timer again.
+			if resets, entered := hs.pacemaker.epoch-epoch, uint64(hs.view-1); resets != entered {
+				t.Errorf("leader entered %d views after view 1 but restarted its timer %d times", entered, resets)
+			}
+		})
+	}
+}
+
+func TestViewTimeout(t *testing.T) {
+	tests := []struct {
+		name     string
+		max      time.Duration
+		failures int
+		want     time.Duration
+	}{
+		{"no failure", time.Minute, 0, time.Second},
+		{"doubled", time.Minute, 3, 8 * time.Second},
+		{"capped", time.Minute, 100, time.Minute},
+		{"without a cap", 0, 10, 1024 * time.Second},
+		{"without a cap after many failures", 0, 100, math.MaxInt64},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewPacemaker(nil, config.HotStuffConfig{ViewTimeout: config.Duration{Duration: time.Second}, TimeoutMax: config.Duration{Duration: tt.max}})
+			p.failures = tt.failures
+			if got := p.Timeout(); got != tt.want {
+				t.Errorf("Timeout after %d failures = %s, want %s", tt.failures, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleProposal(t *testing.T) {
+	genesis, genesisQC := newGenesis()
+	block := func(view int, justify *QuorumCert) *Block {
+		return &Block{View: view, Parent: justify.BlockHash, Justify: justify, Payload: types.NewBlock(types.Header{ProposerID: 1}, nil, nil)}
+	}
+	// qc certifies genesis with the signatures of the given voters, in order.
+	qc := func(view int, voters ...uint) *QuorumCert {
+		qc := &QuorumCert{Phase: PhaseGeneric, View: view, BlockHash: genesis.Hash(), Cert: &crypto.Certificate{Signers: voters}}
+		for _, id := range voters {
+			qc.Cert.Signature = append(qc.Cert.Signature, ed25519.Sign(protocoltest.Key(id), qc.vote().SignBytes())...)
+		}
+		return qc
+	}
+	forged := qc(1, 0, 1, 3)
+	forged.Cert.Signers = []uint{0, 1, 2}
+
+	tests := []struct {
+		name   string
+		sender uint
+		block  *Block
+		want   bool
+	}{
+		{"leader extending genesis", 1, block(1, genesisQC), true},
+		{"not the leader", 2, block(1, genesisQC), false},
+		{"missing payload", 1, &Block{View: 1, Parent: genesis.Hash(), Justify: genesisQC}, false},
+		{"missing justification", 1, &Block{View: 1, Parent: genesis.Hash(), Payload: types.NewBlock(types.Header{}, nil, nil)}, false},
+		{"view not above justification", 1, block(0, genesisQC), false},
+		{"certificate below quorum", 2, block(2, qc(1, 0, 1)), false},
+		{"certificate with repeated voter", 2, block(2, qc(1, 0, 1, 1)), false},
+		{"certificate with unknown voter", 2, block(2, qc(1, 0, 1, 9)), false},
+		{"certificate with a forged signature", 2, block(2, forged), false},
+		{"certificate for another block", 2, block(2, &QuorumCert{Phase: PhaseGeneric, View: 1, BlockHash: genesis.Hash(), Cert: qc(2, 0, 1, 2).Cert}), false},
+		{"certificate from quorum", 2, block(2, qc(1, 0, 1, 2)), true},
+		{"fake genesis certificate", 1, block(1, &QuorumCert{View: 0, BlockHash: []byte("fake")}), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster, engines := newTestCluster(4, ModeChained)
+			msg := &types.Message{Type: ProposalType, Payload: &ProposalMessage{Block: tt.block}}
+			cluster.Nodes[tt.sender].Sign(msg)
+			if got := engines[0].HandleMessage(tt.sender, msg); got != tt.want {
+				t.Errorf("HandleMessage = %v, want %v", got, tt.want)
+			}
+			// Only an accepted proposal gets a vote.
+			if voted := cluster.Pending() > 0; voted != tt.want {
+				t.Errorf("voted = %v, want %v", voted, tt.want)
+			}
+		})
+	}
+
+	t.Run("signed by another replica", func(t *testing.T) {
+		cluster, engines := newTestCluster(4, ModeChained)
+		msg := &types.Message{Type: ProposalType, Payload: &ProposalMessage{Block: block(1, genesisQC)}}
+		cluster.Nodes[2].Sign(msg)
+		if engines[0].HandleMessage(1, msg) || cluster.Pending() > 0 {
+			t.Error("accepted a proposal signed by a replica other than the leader")
+		}
+	})
+}
+
+func TestAddVote(t *testing.T) {
+	tests := []struct {
+		name   string
+		voters []uint
+		// Index of the vote that completes the certificate, or -1 if none does
+		want int
+	}{
+		{"quorum", []uint{0, 1, 2}, 2},
+		{"all replicas", []uint{3, 2, 1, 0}, 2},
+		{"below quorum", []uint{0, 1}, -1},
+		{"duplicates do not count", []uint{0, 0, 1, 1}, -1},
+		{"duplicate before quorum", []uint{2, 2, 0, 3}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, engines := newTestCluster(4, ModeChained)
+			hs := engines[0]
+			vote := &VoteMessage{Phase: PhaseGeneric, View: 3, BlockHash: []byte("block")}
+			formed := -1
+			for i, voter := range tt.voters {
+				qc, ok := hs.addVote(voter, vote, ed25519.Sign(protocoltest.Key(voter), vote.SignBytes()))
+				if !ok {
+					continue
+				}
+				if formed != -1 {
+					t.Fatalf("certificate formed twice, by votes %d and %d", formed, i)
+				}
+				formed = i
+				if !hs.validQC(qc) || qc.View != 3 || string(qc.BlockHash) != "block" {
+					t.Errorf("formed an invalid certificate %+v", qc)
+				}
+			}
+			if formed != tt.want {
+				t.Errorf("certificate formed by vote %d, want %d", formed, tt.want)
+			}
+		})
+	}
+}
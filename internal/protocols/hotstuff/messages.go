@@ -0,0 +1,124 @@
+// File: internal/protocols/hotstuff/messages.go
+package hotstuff
+
+import (
+	"babel-bft/internal/crypto"
+	"babel-bft/internal/types"
+)
+
+const (
+	ProposalType = iota
+	VoteType
+	NewViewType
+	QCType
+)
+
+// Phase identifies what a vote or quorum certificate is for. Chained HotStuff only
+// uses the generic phase; basic HotStuff runs the other three one after the other.
+type Phase int
+
+const (
+	PhaseGeneric Phase = iota
+	PhasePrepare
+	PhasePreCommit
+	PhaseCommit
+	PhaseDecide // Only used to announce a commit certificate, never voted on
+)
+
+// String returns the phase name as used in the HotStuff paper.
+func (p Phase) String() string {
+	switch p {
+	case PhaseGeneric:
+		return "generic"
+	case PhasePrepare:
+		return "prepare"
+	case PhasePreCommit:
+		return "pre-commit"
+	case PhaseCommit:
+		return "commit"
+	case PhaseDecide:
+		return "decide"
+	default:
+		return "unknown"
+	}
+}
+
+// QuorumCert certifies that a quorum of replicas voted for a block in a given phase and
+// view. Cert combines their vote signatures; the genesis certificate has none.
+type QuorumCert struct {
+	Phase     Phase
+	View      int
+	BlockHash []byte
+	Cert      *crypto.Certificate
+}
+
+// vote returns the vote the certificate's signers signed.
+func (qc *QuorumCert) vote() *VoteMessage {
+	return &VoteMessage{Phase: qc.Phase, View: qc.View, BlockHash: qc.BlockHash}
+}
+
+// ProposalMessage carries a new block from the leader of the block's view.
+type ProposalMessage struct {
+	Block *Block
+}
+
+// VoteMessage is a replica's vote for a block, sent to the leader that collects it.
+type VoteMessage struct {
+	Phase     Phase
+	View      int
+	BlockHash []byte
+}
+
+// NewViewMessage is sent to the leader of View when a replica enters it,
+// carrying the highest quorum certificate the replica knows of.
+type NewViewMessage struct {
+	View   int
+	HighQC *QuorumCert
+}
+
+// QCMessage is broadcast by the leader in basic HotStuff to move replicas to the
+// next phase of the view, justified by the certificate of the previous phase.
+type QCMessage struct {
+	Phase Phase
+	View  int
+	QC    *QuorumCert
+}
+
+// signFields returns the fields of a certificate as covered by signatures over messages
+// that carry it. A nil certificate has no fields.
+func (qc *QuorumCert) signFields() []interface{} {
+	if qc == nil {
+		return nil
+	}
+	var signers []uint
+	var sig []byte
+	if qc.Cert != nil {
+		signers, sig = qc.Cert.Signers, qc.Cert.Signature
+	}
+	return []interface{}{int(qc.Phase), qc.View, qc.BlockHash, signers, sig}
+}
+
+// SignBytes returns the bytes covered by the leader's signature. The block, including
+// the view and hash of its justification, is covered through its hash.
+func (m *ProposalMessage) SignBytes() []byte {
+	var hash []byte
+	if m.Block != nil {
+		hash = m.Block.Hash()
+	}
+	return types.SignBytes("hotstuff/proposal", hash)
+}
+
+// SignBytes returns the bytes covered by the voter's signature.
+func (m *VoteMessage) SignBytes() []byte {
+	return types.SignBytes("hotstuff/vote", int(m.Phase), m.View, m.BlockHash)
+}
+
+// SignBytes returns the bytes covered by the sender's signature.
+func (m *NewViewMessage) SignBytes() []byte {
+	return types.SignBytes("hotstuff/new-view", append([]interface{}{m.View}, m.HighQC.signFields()...)...)
+}
+
+// SignBytes returns the bytes covered by the leader's signature.
+func (m *QCMessage) SignBytes() []byte {
+	return types.SignBytes("hotstuff/qc", append([]interface{}{int(m.Phase), m.View}, m.QC.signFields()...)...)
+}
@@ -0,0 +1,84 @@
+// File: internal/protocols/hotstuff/pacemaker.go
+package hotstuff
+
+import (
+	"babel-bft/internal/config"
+	"babel-bft/internal/types"
+	"log"
+	"time"
+)
+
+// Pacemaker is responsible for ensuring the liveness of the HotStuff protocol.
+// It runs one timer per view; when a view makes no progress in time the replica moves
+// to the next one. Consecutive timeouts double the view timeout, and any commit
+// brings it back to the configured base value.
+// All of its methods expect the protocol's mutex to be held by the caller.
+type Pacemaker struct {
+	protocol *HotStuff
+	node     types.NodeInterface
+	config   config.HotStuffConfig
+	timer    *time.Timer
+	epoch    uint64 // Incremented on every reset so stale timer callbacks can be ignored
+	failures int    // Consecutive views that timed out
+	active   bool
+}
+
+// NewPacemaker creates a new Pacemaker instance.
+func NewPacemaker(protocol *HotStuff, cfg config.HotStuffConfig) *Pacemaker {
+	return &Pacemaker{
+		protocol: protocol,
+		config:   cfg,
+	}
+}
+
+// Start activates the pacemaker.
+func (p *Pacemaker) Start() {
+	p.active = true
+	log.Printf("Node %d: Pacemaker started", p.node.ID())
+}
+
+// Stop deactivates the pacemaker.
+func (p *Pacemaker) Stop() {
+	p.active = false
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+	log.Printf("Node %d: Pacemaker stopped in view %d", p.node.ID(), p.protocol.view)
+}
+
+// ResetTimer restarts the view timer, typically because a new view was entered.
+func (p *Pacemaker) ResetTimer() {
+	if !p.active {
+		return
+	}
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+	p.epoch++
+	epoch := p.epoch
+	p.timer = time.AfterFunc(p.Timeout(), func() { p.handleTimeout(epoch) })
+}
+
+// Progress records that a block was committed, resetting the timeout backoff.
+func (p *Pacemaker) Progress() {
+	p.failures = 0
+}
+
+// Timeout returns the current view timeout: the base timeout doubled for each
+// consecutive failed view, capped by the configured maximum.
+func (p *Pacemaker) Timeout() time.Duration {
+	return config.Backoff(p.config.ViewTimeout.Duration, p.failures, p.config.TimeoutMax.Duration)
+}
+
+// handleTimeout is called when the timer expires and triggers a view change.
+func (p *Pacemaker) handleTimeout(epoch uint64) {
+	p.protocol.mtx.Lock()
+	defer p.protocol.mtx.Unlock()
+
+	// The timer may have been reset or stopped while this callback was waiting for the lock.
+	if !p.active || epoch != p.epoch {
+		return
+	}
+	p.failures++
+	p.protocol.onTimeout()
+}
@@ -0,0 +1,28 @@
+// File: internal/protocols/hotstuff/register.go
+package hotstuff
+
+import (
+	"babel-bft/internal/codec"
+	"babel-bft/internal/config"
+	"babel-bft/internal/network"
+	"babel-bft/internal/protocols"
+	"babel-bft/internal/types"
+)
+
+func init() {
+	protocols.Register("hotstuff", func(nodeID uint, validators *types.ValidatorSet, cfg *config.Config) (protocols.Consensus, error) {
+		hs := NewHotStuff(cfg.HotStuff)
+		hs.SetValidators(validators)
+		return hs, nil
+	})
+
+	// Payloads the engine sends, so that they can be encoded for the network
+	codec.Register(0x20, &ProposalMessage{})
+	codec.Register(0x21, &VoteMessage{})
+	codec.Register(0x22, &NewViewMessage{})
+	codec.Register(0x23, &QCMessage{})
+
+	// Proposals and votes, which the QUIC transport keeps on streams of their own
+	network.RegisterClass(&ProposalMessage{}, network.Proposals)
+	network.RegisterClass(&VoteMessage{}, network.Votes)
+}
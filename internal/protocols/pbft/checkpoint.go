@@ -0,0 +1,137 @@
+// File: internal/protocols/pbft/checkpoint.go
+package pbft
+
+import (
+	"babel-bft/internal/types"
+	"bytes"
+	"log"
+	"time"
+)
+
+// sendCheckpoint announces our state digest after executing a checkpoint sequence number.
+func (p *PBFT) sendCheckpoint() {
+	own := &CheckpointProof{Sequence: p.lastExecuted, StateDigest: p.stateDigest, Header: p.lastBlock.Header}
+	p.ownCheckpoints[p.lastExecuted] = own
+	checkpoint := own.message()
+	msg := &types.Message{Type: CheckpointType, Payload: checkpoint}
+	p.node.Broadcast(msg)
+	p.handleCheckpoint(p.node.ID(), checkpoint, msg.Signature)
+}
+
+// handleCheckpoint collects checkpoint messages and their signatures. A checkpoint
+// becomes stable once a quorum of replicas, including us, report the same state digest
+// and block for it; their signatures prove it stable in view changes.
+func (p *PBFT) handleCheckpoint(sender uint, checkpoint *CheckpointMessage, sig []byte) bool {
+	log.Printf("Node %d: Handling Checkpoint from %d for Sequence %d", p.node.ID(), sender, checkpoint.Sequence)
+	if checkpoint.Sequence <= p.lowWatermark {
+		return false
+	}
+	if _, ok := p.checkpoints[checkpoint.Sequence]; !ok {
+		p.checkpoints[checkpoint.Sequence] = make(map[uint]signedDigest)
+	}
+	p.checkpoints[checkpoint.Sequence][sender] = signedDigest{digest: checkpoint.digest(), signature: sig}
+
+	own, ok := p.ownCheckpoints[checkpoint.Sequence]
+	if !ok {
+		// We have not executed up to this checkpoint yet; it is re-checked when we do.
+		return true
+	}
+	sigs := matchingSignatures(p.checkpoints[checkpoint.Sequence], own.message().digest())
+	if p.validators.HasQuorum(keys(sigs)) {
+		p.makeStable(&CheckpointProof{Sequence: own.Sequence, StateDigest: own.StateDigest, Header: own.Header, Signatures: sigs})
+	}
+	return true
+}
+
+// makeStable advances the low watermark to a stable checkpoint and discards the log
+// entries and checkpoint messages it makes obsolete.
+func (p *PBFT) makeStable(proof *CheckpointProof) {
+	if proof.Sequence <= p.lowWatermark {
+		return
+	}
+	p.lowWatermark = proof.Sequence
+	p.stableProof = proof
+	log.Printf("Node %d: Checkpoint at sequence %d is stable", p.node.ID(), proof.Sequence)
+
+	for key := range p.log {
+		if key.sequence <= proof.Sequence {
+			delete(p.log, key)
+		}
+	}
+	for sequence := range p.checkpoints {
+		if sequence <= proof.Sequence {
+			delete(p.checkpoints, sequence)
+		}
+	}
+	for sequence := range p.ownCheckpoints {
+		if sequence < proof.Sequence {
+			delete(p.ownCheckpoints, sequence)
+		}
+	}
+}
+
+// requestState asks the replicas that signed the stable checkpoint for the blocks we
+// did not execute up to it, when a view change started from a checkpoint we had not
+// reached. The request is repeated on tick until we catch up.
+func (p *PBFT) requestState() {
+	log.Printf("Node %d: Stable checkpoint %d is ahead of our execution at %d, requesting the blocks in between", p.node.ID(), p.lowWatermark, p.lastExecuted)
+	p.lastStateRequest = time.Now()
+	req := &StateRequestMessage{Sequence: p.lastExecuted, Checkpoint: p.lowWatermark}
+	for _, id := range sortedKeys(p.stableProof.Signatures) {
+		if id != p.node.ID() {
+			p.node.Send(id, &types.Message{Type: StateRequestType, Payload: req})
+		}
+	}
+}
+
+// handleStateRequest sends a replica that fell behind a stable checkpoint the blocks it
+// asks for, if we executed them. Each replica is answered at most once per view-change
+// timeout, the interval at which it repeats its request.
+func (p *PBFT) handleStateRequest(sender uint, req *StateRequestMessage) bool {
+	log.Printf("Node %d: Handling State-request from %d for Sequences %d to %d", p.node.ID(), sender, req.Sequence+1, req.Checkpoint)
+	if !p.isValidator(sender) || req.Sequence < 0 || req.Sequence >= req.Checkpoint || req.Checkpoint > p.lastExecuted {
+		return false
+	}
+	if last, ok := p.stateReplies[sender]; ok && time.Since(last) < p.config.ViewChangeTimeout.Duration {
+		return false
+	}
+	blocks := make([]*types.Block, 0, req.Checkpoint-req.Sequence)
+	for height := req.Sequence + 1; height <= req.Checkpoint; height++ {
+		block := p.node.Block(height)
+		if block == nil {
+			return false
+		}
+		blocks = append(blocks, block)
+	}
+	p.stateReplies[sender] = time.Now()
+	p.node.Send(sender, &types.Message{Type: StateType, Payload: &StateMessage{Sequence: req.Sequence, Blocks: blocks}})
+	return true
+}
+
+// handleState executes the blocks another replica sent in answer to our state request,
+// once they are shown to lead from our last executed block to the state and block of
+// the stable checkpoint.
+func (p *PBFT) handleState(sender uint, state *StateMessage) bool {
+	log.Printf("Node %d: Handling State from %d with %d blocks after Sequence %d", p.node.ID(), sender, len(state.Blocks), state.Sequence)
+	if state.Sequence != p.lastExecuted || len(state.Blocks) == 0 || len(state.Blocks) != p.lowWatermark-p.lastExecuted {
+		return false
+	}
+	digest, parent := p.stateDigest, p.lastBlock
+	for _, block := range state.Blocks {
+		if block == nil || block.ValidateBasic() != nil || block.ValidateParent(parent) != nil {
+			return false
+		}
+		digest, parent = nextStateDigest(digest, block), block
+	}
+	if !bytes.Equal(digest, p.stableProof.StateDigest) || !bytes.Equal(parent.Hash(), p.stableProof.Header.Hash()) {
+		log.Printf("Node %d: Rejecting State from %d that does not lead to the stable checkpoint %d", p.node.ID(), sender, p.lowWatermark)
+		return false
+	}
+
+	log.Printf("Node %d: Catching up to the stable checkpoint %d", p.node.ID(), p.lowWatermark)
+	for i, block := range state.Blocks {
+		p.committed[state.Sequence+i+1] = block
+	}
+	p.execute()
+	return true
+}
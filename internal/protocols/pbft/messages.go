@@ -0,0 +1,189 @@
+// File: internal/protocols/pbft/messages.go
+package pbft
+
+import (
+	"babel-bft/internal/types"
+	"crypto/sha256"
+	"sort"
+)
+
+const (
+	PrePrepareType = iota
+	PrepareType
+	CommitType
+	CheckpointType
+	ViewChangeType
+	NewViewType
+	StateRequestType
+	StateType
+)
+
+// PrePrepareMessage is sent by the primary to assign a sequence number to a batch of requests.
+type PrePrepareMessage struct {
+	View     int
+	Sequence int
+	Digest   []byte // Hash of the block
+	Block    *types.Block
+}
+
+// PrepareMessage is sent by backups that accepted a pre-prepare.
+type PrepareMessage struct {
+	View     int
+	Sequence int
+	Digest   []byte
+}
+
+// CommitMessage is sent by replicas once a request is prepared.
+type CommitMessage struct {
+	View     int
+	Sequence int
+	Digest   []byte
+}
+
+// CheckpointMessage announces the state digest of a replica after executing Sequence,
+// and the hash of the block it executed at Sequence.
+type CheckpointMessage struct {
+	Sequence    int
+	StateDigest []byte
+	BlockHash   []byte
+}
+
+// CheckpointProof shows that a quorum of replicas agreed on the state at a sequence
+// number: the signatures of their matching checkpoint messages. It carries the header
+// of the block executed at Sequence, which the signatures cover through its hash, so
+// that a new view can extend it. The initial state needs no proof.
+type CheckpointProof struct {
+	Sequence    int
+	StateDigest []byte
+	Header      types.Header
+	Signatures  map[uint][]byte // By sender
+}
+
+// PreparedProof shows that a request was prepared at a replica: the pre-prepare it
+// accepted, signed by the primary, and the signatures of the matching prepares it
+// received from backups.
+type PreparedProof struct {
+	PrePrepare *PrePrepareMessage
+	Signature  []byte          // The primary's signature of the pre-prepare
+	Prepares   map[uint][]byte // By backup
+}
+
+// ViewChangeMessage is sent by a replica that wants to move to NewView. It carries the
+// replica's last stable checkpoint and every request prepared after it, so that the
+// new primary can carry them over.
+type ViewChangeMessage struct {
+	NewView    int
+	Checkpoint *CheckpointProof
+	Prepared   []*PreparedProof
+}
+
+// SignedViewChange is a view-change message along with its sender's signature, so that
+// the new primary can pass it on.
+type SignedViewChange struct {
+	ViewChange *ViewChangeMessage
+	Signature  []byte
+}
+
+// StateRequestMessage is sent by a replica whose execution is behind the stable
+// checkpoint at Checkpoint, asking for the blocks executed after Sequence up to it.
+type StateRequestMessage struct {
+	Sequence   int
+	Checkpoint int
+}
+
+// StateMessage answers a state request with the blocks executed after Sequence, in
+// order. The requester checks them against the state digest of its stable checkpoint.
+type StateMessage struct {
+	Sequence int
+	Blocks   []*types.Block
+}
+
+// NewViewMessage is sent by the primary of View to start it. It includes the signed
+// view-change messages that justify it and the pre-prepares re-issued for the requests
+// they carried, each signed by the primary so that it can prove them prepared later.
+type NewViewMessage struct {
+	View           int
+	ViewChanges    map[uint]*SignedViewChange
+	PrePrepares    []*PrePrepareMessage
+	PrePrepareSigs [][]byte // The primary's signature of each pre-prepare, in order
+}
+
+// SignBytes returns the bytes covered by the primary's signature. The batch is covered
+// through the digest, which replicas check against the block.
+func (m *PrePrepareMessage) SignBytes() []byte {
+	return types.SignBytes("pbft/pre-prepare", m.View, m.Sequence, m.Digest)
+}
+
+// SignBytes returns the bytes covered by the backup's signature.
+func (m *PrepareMessage) SignBytes() []byte {
+	return types.SignBytes("pbft/prepare", m.View, m.Sequence, m.Digest)
+}
+
+// SignBytes returns the bytes covered by the replica's signature.
+func (m *CommitMessage) SignBytes() []byte {
+	return types.SignBytes("pbft/commit", m.View, m.Sequence, m.Digest)
+}
+
+// SignBytes returns the bytes covered by the replica's signature.
+func (m *CheckpointMessage) SignBytes() []byte {
+	return types.SignBytes("pbft/checkpoint", m.Sequence, m.StateDigest, m.BlockHash)
+}
+
+// digest identifies the state and block a checkpoint message reports, so that only
+// messages reporting both the same are counted together.
+func (m *CheckpointMessage) digest() []byte {
+	digest := sha256.Sum256(m.SignBytes())
+	return digest[:]
+}
+
+// message returns the checkpoint message that the signatures of the proof sign.
+func (c *CheckpointProof) message() *CheckpointMessage {
+	return &CheckpointMessage{Sequence: c.Sequence, StateDigest: c.StateDigest, BlockHash: c.Header.Hash()}
+}
+
+// SignBytes returns the bytes covered by the replica's signature: the new view, the
+// checkpoint and every prepared request. The signatures in the proofs are checked on
+// their own.
+func (m *ViewChangeMessage) SignBytes() []byte {
+	fields := []interface{}{m.NewView}
+	if m.Checkpoint != nil {
+		fields = append(fields, m.Checkpoint.Sequence, m.Checkpoint.StateDigest, m.Checkpoint.Header.Hash(), sortedKeys(m.Checkpoint.Signatures))
+	}
+	for _, proof := range m.Prepared {
+		if proof == nil {
+			continue
+		}
+		if proof.PrePrepare != nil {
+			fields = append(fields, proof.PrePrepare.View, proof.PrePrepare.Sequence, proof.PrePrepare.Digest)
+		}
+		fields = append(fields, sortedKeys(proof.Prepares))
+	}
+	return types.SignBytes("pbft/view-change", fields...)
+}
+
+// SignBytes returns the bytes covered by the primary's signature: the view, a digest
+// of each view change it includes, in sender order, and the re-issued pre-prepares.
+func (m *NewViewMessage) SignBytes() []byte {
+	senders := sortedKeys(m.ViewChanges)
+
+	fields := []interface{}{m.View}
+	for _, id := range senders {
+		if signed := m.ViewChanges[id]; signed != nil && signed.ViewChange != nil {
+			digest := sha256.Sum256(signed.ViewChange.SignBytes())
+			fields = append(fields, id, digest[:])
+		}
+	}
+	for _, pp := range m.PrePrepares {
+		if pp != nil {
+			fields = append(fields, pp.View, pp.Sequence, pp.Digest)
+		}
+	}
+	return types.SignBytes("pbft/new-view", fields...)
+}
+
+// sortedKeys returns the replica IDs keying a map, in ascending order.
+func sortedKeys[V any](replicas map[uint]V) []uint {
+	ids := keys(replicas)
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
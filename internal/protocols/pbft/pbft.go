@@ -0,0 +1,523 @@
+// File: internal/protocols/pbft/pbft.go
+package pbft
+
+import (
+	"babel-bft/internal/config"
+	"babel-bft/internal/protocols"
+	"babel-bft/internal/types"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// slot identifies a request in the log: a sequence number as assigned in a view.
+type slot struct {
+	view     int
+	sequence int
+}
+
+// signedDigest is the digest a replica sent in a prepare or checkpoint message, along
+// with its signature of the message, which proofs carry.
+type signedDigest struct {
+	digest    []byte
+	signature []byte
+}
+
+// entry is the log record for a slot.
+type entry struct {
+	prePrepare    *PrePrepareMessage
+	prePrepareSig []byte                // The primary's signature of the pre-prepare
+	prepares      map[uint]signedDigest // By sender
+	commits       map[uint][]byte       // sender -> digest
+	prepareSent   bool
+	prepared      bool
+	committed     bool
+}
+
+// State is a snapshot of the replica's progress, as returned by CurrentState.
+type State struct {
+	View           int
+	ViewChanging   bool
+	LastExecuted   int
+	StableSequence int
+	LogSize        int
+}
+
+// PBFT is the implementation of the Practical Byzantine Fault Tolerance protocol
+// (Castro and Liskov). The primary of each view orders batches of client requests with
+// pre-prepare/prepare/commit, replicas agree on periodic checkpoints to garbage-collect
+// the log, and a view change replaces a primary that stops making progress.
+type PBFT struct {
+	// mtx serializes message handling with the periodic tick.
+	mtx        sync.Mutex
+	node       types.NodeInterface
+	config     config.PBFTConfig
+	validators *types.ValidatorSet
+	stopChan   chan struct{}
+
+	view         int
+	viewChanging bool // Set while waiting for the new view after sending a view change
+	targetView   int  // View requested by our last view change
+	nextSequence int  // Next sequence number the primary assigns
+	lastExecuted int
+	lastBlock    *types.Block // Block executed at lastExecuted, which the next one extends
+	stateDigest  []byte       // Hash chain over the executed blocks
+
+	log       map[slot]*entry
+	committed map[int]*types.Block // Committed blocks waiting to be executed in order
+	proposed  map[string]struct{}  // Transactions the primary has ordered but not executed yet
+
+	lowWatermark   int // Sequence number of the last stable checkpoint
+	stableProof    *CheckpointProof
+	checkpoints    map[int]map[uint]signedDigest // sequence -> sender -> checkpoint digest
+	ownCheckpoints map[int]*CheckpointProof      // Our checkpoint at each sequence, before it is signed
+
+	viewChanges  map[int]map[uint]*SignedViewChange // new view -> sender -> message
+	lastProgress time.Time
+	attempts     int // Consecutive view changes without executing anything
+
+	lastStateRequest time.Time          // When we last asked for the blocks up to the stable checkpoint
+	stateReplies     map[uint]time.Time // When we last sent blocks to each replica
+}
+
+// NewPBFT creates a new instance of the PBFT protocol engine.
+func NewPBFT(cfg config.PBFTConfig) *PBFT {
+	return &PBFT{
+		config:         cfg,
+		stopChan:       make(chan struct{}),
+		nextSequence:   1,
+		stateDigest:    make([]byte, sha256.Size),
+		log:            make(map[slot]*entry),
+		committed:      make(map[int]*types.Block),
+		proposed:       make(map[string]struct{}),
+		stableProof:    &CheckpointProof{Sequence: 0, StateDigest: make([]byte, sha256.Size)},
+		checkpoints:    make(map[int]map[uint]signedDigest),
+		ownCheckpoints: make(map[int]*CheckpointProof),
+		viewChanges:    make(map[int]map[uint]*SignedViewChange),
+		stateReplies:   make(map[uint]time.Time),
+	}
+}
+
+// SetNode assigns the core node logic to the consensus protocol.
+func (p *PBFT) SetNode(node types.NodeInterface) {
+	p.node = node
+	if p.validators == nil {
+		p.validators = node.Validators()
+	}
+}
+
+// SetValidators sets the replicas taking part in the protocol, which determine the
+// rotation of the primary role and the quorum size. It must be called before Start;
+// otherwise the node's validator set is used.
+func (p *PBFT) SetValidators(validators *types.ValidatorSet) {
+	p.validators = validators
+}
+
+// Start begins the periodic tick that batches requests at the primary and
+// watches for stalled requests at the backups, until Stop is called.
+func (p *PBFT) Start() {
+	p.mtx.Lock()
+	p.lastProgress = time.Now()
+	p.mtx.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(p.config.BatchInterval.Duration)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.tick()
+			case <-p.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends the periodic tick.
+func (p *PBFT) Stop() {
+	close(p.stopChan)
+}
+
+// HandleMessage processes incoming consensus messages.
+func (p *PBFT) HandleMessage(senderID uint, msg *types.Message) bool {
+	// Reject messages whose signature does not match the claimed sender.
+	if !protocols.VerifyMessage(p.node, senderID, msg) {
+		log.Printf("Node %d: Rejected message of type %d with an invalid signature from %d", p.node.ID(), msg.Type, senderID)
+		return false
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	log.Printf("Node %d: Received message of type %d from %d", p.node.ID(), msg.Type, senderID)
+	return p.dispatch(senderID, msg)
+}
+
+// dispatch hands a message to the handler for its type.
+func (p *PBFT) dispatch(senderID uint, msg *types.Message) bool {
+	switch payload := msg.Payload.(type) {
+	case *PrePrepareMessage:
+		return p.handlePrePrepare(senderID, payload, msg.Signature)
+	case *PrepareMessage:
+		return p.handlePrepare(senderID, payload, msg.Signature)
+	case *CommitMessage:
+		return p.handleCommit(senderID, payload)
+	case *CheckpointMessage:
+		return p.handleCheckpoint(senderID, payload, msg.Signature)
+	case *ViewChangeMessage:
+		return p.handleViewChange(senderID, payload, msg.Signature)
+	case *NewViewMessage:
+		return p.handleNewView(senderID, payload)
+	case *StateRequestMessage:
+		return p.handleStateRequest(senderID, payload)
+	case *StateMessage:
+		return p.handleState(senderID, payload)
+	default:
+		log.Printf("Node %d: Received unknown message type", p.node.ID())
+		return false
+	}
+}
+
+// CurrentState returns a snapshot of the replica's progress.
+func (p *PBFT) CurrentState() interface{} {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	return State{
+		View:           p.view,
+		ViewChanging:   p.viewChanging,
+		LastExecuted:   p.lastExecuted,
+		StableSequence: p.lowWatermark,
+		LogSize:        len(p.log),
+	}
+}
+
+// tick runs periodically: the primary orders a new batch if it can, and every
+// replica checks whether pending requests have been stuck for too long.
+func (p *PBFT) tick() {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if !p.viewChanging && p.primary(p.view) == p.node.ID() {
+		p.proposeBatch()
+	}
+	if p.lastExecuted < p.lowWatermark && time.Since(p.lastStateRequest) >= p.config.ViewChangeTimeout.Duration {
+		p.requestState()
+	}
+
+	if time.Since(p.lastProgress) < p.viewChangeTimeout() {
+		return
+	}
+	waiting := len(p.node.ReapTransactions(1)) > 0 || len(p.committed) > 0 || p.hasPendingSlots()
+	if p.viewChanging || waiting {
+		target := p.view + 1
+		if p.viewChanging {
+			// The view change itself timed out: try the next primary.
+			target = p.pendingView() + 1
+		}
+		log.Printf("Node %d: No progress for %s in view %d, requesting view %d", p.node.ID(), p.viewChangeTimeout(), p.view, target)
+		p.startViewChange(target)
+	}
+}
+
+// proposeBatch assigns the next sequence number to a batch of pending requests,
+// as long as the sequence number stays within the watermark window.
+func (p *PBFT) proposeBatch() {
+	if p.nextSequence > p.lowWatermark+p.config.WindowSize {
+		return
+	}
+
+	// Skip requests already ordered in a slot that has not been executed yet.
+	candidates := p.node.ReapTransactions(p.config.BatchSize + len(p.proposed))
+	var txs []*types.Transaction
+	for _, tx := range candidates {
+		if _, ok := p.proposed[txKey(tx)]; !ok && len(txs) < p.config.BatchSize {
+			txs = append(txs, tx)
+		}
+	}
+	if len(txs) == 0 {
+		return
+	}
+	parent, ok := p.parent(p.view, p.nextSequence)
+	if !ok {
+		// We are behind the stable checkpoint and cannot extend the chain until the
+		// state we requested arrives.
+		log.Printf("Node %d: Not pre-preparing N:%d before catching up from %d to the stable checkpoint %d", p.node.ID(), p.nextSequence, p.lastExecuted, p.lowWatermark)
+		return
+	}
+	for _, tx := range txs {
+		p.proposed[txKey(tx)] = struct{}{}
+	}
+
+	header := types.Header{Height: p.nextSequence, ProposerID: p.node.ID(), Timestamp: time.Now().UnixNano()}
+	if parent != nil {
+		header.ParentHash = parent.Hash()
+		// Our clock may be behind the parent's proposer.
+		header.Timestamp = max(header.Timestamp, parent.Timestamp)
+	}
+	block := types.NewBlock(header, txs, nil)
+	prePrepare := &PrePrepareMessage{
+		View:     p.view,
+		Sequence: p.nextSequence,
+		Digest:   block.Hash(),
+		Block:    block,
+	}
+	p.nextSequence++
+	msg := &types.Message{Type: PrePrepareType, Payload: prePrepare}
+	p.node.Broadcast(msg)
+	log.Printf("Node %d: Pre-preparing %s at V:%d, N:%d", p.node.ID(), block, prePrepare.View, prePrepare.Sequence)
+	p.handlePrePrepare(p.node.ID(), prePrepare, msg.Signature)
+}
+
+// handlePrePrepare accepts the primary's ordering for a slot, unless a different
+// request was already accepted for it, and sends a prepare. sig is the primary's
+// signature of the pre-prepare.
+func (p *PBFT) handlePrePrepare(sender uint, pp *PrePrepareMessage, sig []byte) bool {
+	log.Printf("Node %d: Handling Pre-prepare from %d for View %d, Sequence %d", p.node.ID(), sender, pp.View, pp.Sequence)
+	if p.viewChanging || pp.View != p.view || sender != p.primary(pp.View) {
+		return false
+	}
+	if !p.inWindow(pp.Sequence) || pp.Block == nil || pp.Block.ValidateBasic() != nil || !bytes.Equal(pp.Block.Hash(), pp.Digest) {
+		return false
+	}
+	return p.acceptPrePrepare(pp, sig)
+}
+
+// acceptPrePrepare logs a pre-prepare for the current view and, at the backups, sends
+// the matching prepare. It is shared by the normal case and the new-view processing.
+func (p *PBFT) acceptPrePrepare(pp *PrePrepareMessage, sig []byte) bool {
+	e := p.entry(pp.View, pp.Sequence)
+	if e.prePrepare != nil {
+		return bytes.Equal(e.prePrepare.Digest, pp.Digest)
+	}
+	e.prePrepare = pp
+	e.prePrepareSig = sig
+
+	p.sendPrepare(pp.View, pp.Sequence)
+	p.checkPrepared(pp.View, pp.Sequence)
+	return true
+}
+
+// sendPrepare sends a backup's prepare for a pre-prepared slot once the block extends
+// the block prepared at the previous sequence number in the same view. Preparing the
+// slots of a view in order means that a request prepared by a quorum has its parent
+// prepared by a quorum too, so a view change always carries over a parent for every
+// request it carries over, and the chain of blocks survives view changes.
+func (p *PBFT) sendPrepare(view, sequence int) {
+	e, ok := p.log[slot{view: view, sequence: sequence}]
+	if !ok || e.prePrepare == nil || e.prepareSent || p.primary(view) == p.node.ID() {
+		return
+	}
+	if sequence > p.lastExecuted {
+		parent, ok := p.parent(view, sequence)
+		if !ok {
+			return // Sent once the parent is prepared
+		}
+		if err := e.prePrepare.Block.ValidateParent(parent); err != nil {
+			log.Printf("Node %d: Not preparing %s at V:%d, N:%d: %v", p.node.ID(), e.prePrepare.Block, view, sequence, err)
+			return
+		}
+	}
+	e.prepareSent = true
+
+	prepare := &PrepareMessage{View: view, Sequence: sequence, Digest: e.prePrepare.Digest}
+	msg := &types.Message{Type: PrepareType, Payload: prepare}
+	p.node.Broadcast(msg)
+	p.handlePrepare(p.node.ID(), prepare, msg.Signature)
+}
+
+// parent returns the block that the block at a sequence number of view extends: the
+// last executed block, or the block prepared at the previous sequence number, whose
+// primary pre-prepared it if this replica is the primary. It reports false if that
+// block is not known yet. The first block has no parent.
+func (p *PBFT) parent(view, sequence int) (*types.Block, bool) {
+	if e, ok := p.log[slot{view: view, sequence: sequence - 1}]; ok && e.prePrepare != nil && (e.prepared || p.primary(view) == p.node.ID()) {
+		return e.prePrepare.Block, true
+	}
+	if sequence-1 == p.lastExecuted {
+		return p.lastBlock, true
+	}
+	return nil, false
+}
+
+// handlePrepare records a backup's prepare and its signature. Prepares for a later view
+// are kept in case they arrive before the new-view message.
+func (p *PBFT) handlePrepare(sender uint, prepare *PrepareMessage, sig []byte) bool {
+	log.Printf("Node %d: Handling Prepare from %d for View %d, Sequence %d", p.node.ID(), sender, prepare.View, prepare.Sequence)
+	if prepare.View < p.view || !p.inWindow(prepare.Sequence) || sender == p.primary(prepare.View) {
+		return false
+	}
+	p.entry(prepare.View, prepare.Sequence).prepares[sender] = signedDigest{digest: prepare.Digest, signature: sig}
+	if prepare.View == p.view && !p.viewChanging {
+		p.checkPrepared(prepare.View, prepare.Sequence)
+	}
+	return true
+}
+
+// handleCommit records a commit. Like prepares, commits for a later view are kept.
+func (p *PBFT) handleCommit(sender uint, commit *CommitMessage) bool {
+	log.Printf("Node %d: Handling Commit from %d for View %d, Sequence %d", p.node.ID(), sender, commit.View, commit.Sequence)
+	if commit.View < p.view || !p.inWindow(commit.Sequence) {
+		return false
+	}
+	p.entry(commit.View, commit.Sequence).commits[sender] = commit.Digest
+	if commit.View == p.view && !p.viewChanging {
+		p.checkCommitted(commit.View, commit.Sequence)
+	}
+	return true
+}
+
+// checkPrepared sends a commit once the slot is prepared: the pre-prepare is logged
+// along with matching prepares from backups that, with the primary, hold a quorum.
+func (p *PBFT) checkPrepared(view, sequence int) {
+	e := p.entry(view, sequence)
+	if e.prepared || e.prePrepare == nil || !p.preparedQuorum(view, keys(matchingSignatures(e.prepares, e.prePrepare.Digest))) {
+		return
+	}
+	e.prepared = true
+
+	commit := &CommitMessage{View: view, Sequence: sequence, Digest: e.prePrepare.Digest}
+	p.node.Broadcast(&types.Message{Type: CommitType, Payload: commit})
+	log.Printf("Node %d: Prepared V:%d, N:%d. Broadcasting Commit", p.node.ID(), view, sequence)
+	p.handleCommit(p.node.ID(), commit)
+	p.sendPrepare(view, sequence+1)
+}
+
+// checkCommitted marks the slot committed once it is prepared and a quorum of matching
+// commits was received, then executes whatever became executable.
+func (p *PBFT) checkCommitted(view, sequence int) {
+	e := p.entry(view, sequence)
+	if e.committed || !e.prepared || !p.validators.HasQuorum(p.matching(e.commits, e.prePrepare.Digest)) {
+		return
+	}
+	e.committed = true
+	if sequence > p.lastExecuted {
+		p.committed[sequence] = e.prePrepare.Block
+	}
+	p.execute()
+}
+
+// execute runs committed requests in sequence-number order, without gaps.
+func (p *PBFT) execute() {
+	for {
+		block, ok := p.committed[p.lastExecuted+1]
+		if !ok {
+			return
+		}
+		delete(p.committed, p.lastExecuted+1)
+		p.lastExecuted++
+		p.lastBlock = block
+		p.stateDigest = nextStateDigest(p.stateDigest, block)
+
+		log.Printf("Node %d: Executing %s at sequence %d", p.node.ID(), block, p.lastExecuted)
+		p.node.Commit(p.lastExecuted, block)
+		for _, tx := range block.Transactions {
+			delete(p.proposed, txKey(tx))
+		}
+		p.lastProgress = time.Now()
+		p.attempts = 0
+
+		// Checkpoints up to the stable one are stable already when we catch up to them.
+		if p.lastExecuted%p.config.CheckpointInterval == 0 && p.lastExecuted > p.lowWatermark {
+			p.sendCheckpoint()
+		}
+		p.sendPrepare(p.view, p.lastExecuted+1)
+	}
+}
+
+// nextStateDigest returns the state digest after executing block in the state of digest.
+func nextStateDigest(digest []byte, block *types.Block) []byte {
+	h := sha256.New()
+	h.Write(digest)
+	h.Write(block.Hash())
+	return h.Sum(nil)
+}
+
+// entry returns the log entry of a slot, creating it if needed.
+func (p *PBFT) entry(view, sequence int) *entry {
+	key := slot{view: view, sequence: sequence}
+	e, ok := p.log[key]
+	if !ok {
+		e = &entry{
+			prepares: make(map[uint]signedDigest),
+			commits:  make(map[uint][]byte),
+		}
+		p.log[key] = e
+	}
+	return e
+}
+
+// hasPendingSlots reports whether a request was pre-prepared in the current view but not executed.
+func (p *PBFT) hasPendingSlots() bool {
+	for key, e := range p.log {
+		if key.view == p.view && key.sequence > p.lastExecuted && e.prePrepare != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// matching returns the senders of the messages that carry the given digest.
+func (p *PBFT) matching(digests map[uint][]byte, digest []byte) []uint {
+	var senders []uint
+	for id, d := range digests {
+		if bytes.Equal(d, digest) {
+			senders = append(senders, id)
+		}
+	}
+	return senders
+}
+
+// matchingSignatures returns the signatures of the messages that carry the given
+// digest, by sender.
+func matchingSignatures(messages map[uint]signedDigest, digest []byte) map[uint][]byte {
+	sigs := make(map[uint][]byte)
+	for id, m := range messages {
+		if bytes.Equal(m.digest, digest) {
+			sigs[id] = m.signature
+		}
+	}
+	return sigs
+}
+
+// preparedQuorum reports whether the primary of view, which sends no prepare, and the
+// backups that prepared together hold a quorum of the voting power.
+func (p *PBFT) preparedQuorum(view int, backups []uint) bool {
+	return p.validators.HasQuorum(append([]uint{p.primary(view)}, backups...))
+}
+
+// inWindow reports whether a sequence number lies between the watermarks.
+func (p *PBFT) inWindow(sequence int) bool {
+	return sequence > p.lowWatermark && sequence <= p.lowWatermark+p.config.WindowSize
+}
+
+// primary returns the replica that acts as primary in the given view.
+func (p *PBFT) primary(view int) uint {
+	return p.validators.At(view)
+}
+
+// isValidator reports whether id belongs to one of the replicas.
+func (p *PBFT) isValidator(id uint) bool {
+	return p.validators.Contains(id)
+}
+
+// keys returns the replica IDs keying a map of messages, so their voting power can be weighed.
+func keys[V any](replicas map[uint]V) []uint {
+	return slices.Collect(maps.Keys(replicas))
+}
+
+// viewChangeTimeout returns how long requests may stay pending before a view change.
+// It doubles with every consecutive view change that did not lead to progress.
+func (p *PBFT) viewChangeTimeout() time.Duration {
+	return config.Backoff(p.config.ViewChangeTimeout.Duration, p.attempts, p.config.TimeoutMax.Duration)
+}
+
+// txKey identifies a transaction across batches.
+func txKey(tx *types.Transaction) string {
+	return fmt.Sprintf("%d/%d/%x", tx.ClientID, tx.Timestamp, tx.Payload)
+}
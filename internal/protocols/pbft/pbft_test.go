@@ -0,0 +1,651 @@
+package pbft
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"testing"
+	"time"
+
+	"babel-bft/internal/config"
+	"babel-bft/internal/protocols"
+	"babel-bft/internal/protocols/protocoltest"
+	"babel-bft/internal/types"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// testConfig returns a configuration whose timers never fire during a test, so that
+// batches and view changes only happen when the test asks for them.
+func testConfig() config.PBFTConfig {
+	return config.PBFTConfig{
+		BatchSize:          2,
+		BatchInterval:      config.Duration{Duration: time.Hour},
+		WindowSize:         4,
+		CheckpointInterval: 2,
+		ViewChangeTimeout:  config.Duration{Duration: time.Hour},
+	}
+}
+
+// newTestCluster creates n PBFT replicas.
+func newTestCluster(n int) (*protocoltest.Cluster, []*PBFT) {
+	engines := make([]*PBFT, n)
+	cluster := protocoltest.NewCluster(n, func(id uint) protocols.Consensus {
+		engines[id] = NewPBFT(testConfig())
+		return engines[id]
+	})
+	return cluster, engines
+}
+
+// propose makes a replica order a batch, as its tick would if it is the primary.
+func propose(p *PBFT) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.proposeBatch()
+}
+
+// viewChange makes a replica give up on its view, as its tick would on a timeout.
+func viewChange(p *PBFT, view int) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.startViewChange(view)
+}
+
+// submit makes n new transactions pending at every replica.
+func submit(cluster *protocoltest.Cluster, n int) {
+	for i := 0; i < n; i++ {
+		cluster.Submit(&types.Transaction{ClientID: 100, Timestamp: int64(i), Payload: []byte(fmt.Sprintf("tx %d", i))})
+	}
+}
+
+func TestCommit(t *testing.T) {
+	for _, n := range []int{4, 7} {
+		t.Run(fmt.Sprintf("%d replicas", n), func(t *testing.T) {
+			cluster, engines := newTestCluster(n)
+			submit(cluster, 10)
+			cluster.Start()
+			for i := 0; i < 5; i++ {
+				propose(engines[0])
+				cluster.Deliver(100 * n * n)
+			}
+
+			if err := cluster.Check(); err != nil {
+				t.Fatal(err)
+			}
+			if h := cluster.MinHeight(); h != 5 {
+				t.Fatalf("replicas executed %d batches, want 5", h)
+			}
+			seen := make(map[*types.Transaction]int)
+			for _, block := range cluster.Nodes[0].Committed() {
+				for _, tx := range block.Transactions {
+					seen[tx]++
+				}
+			}
+			if len(seen) != 10 {
+				t.Errorf("%d distinct transactions executed, want 10", len(seen))
+			}
+			for tx, n := range seen {
+				if n != 1 {
+					t.Errorf("transaction %s executed %d times", tx.Payload, n)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckpoint(t *testing.T) {
+	cluster, engines := newTestCluster(4)
+	submit(cluster, 10)
+	cluster.Start()
+
+	// The window holds 4 sequence numbers: the primary cannot get further ahead
+	// of the last stable checkpoint.
+	for i := 0; i < 5; i++ {
+		propose(engines[0])
+	}
+	if got := engines[0].nextSequence; got != 5 {
+		t.Fatalf("primary assigned up to sequence %d beyond the window, want 4", got-1)
+	}
+
+	cluster.Deliver(10000)
+	for _, p := range engines {
+		state := p.CurrentState().(State)
+		if state.LastExecuted != 4 || state.StableSequence != 4 {
+			t.Errorf("node %d executed %d with stable checkpoint %d, want 4 and 4", p.node.ID(), state.LastExecuted, state.StableSequence)
+		}
+		if state.LogSize != 0 {
+			t.Errorf("node %d kept %d log entries below the stable checkpoint", p.node.ID(), state.LogSize)
+		}
+		proof := p.stableProof
+		if !p.validators.HasQuorum(keys(proof.Signatures)) || !p.validSignatures(proof.message().SignBytes(), proof.Signatures) {
+			t.Errorf("node %d has a stable checkpoint signed by %v", p.node.ID(), keys(proof.Signatures))
+		}
+		if !bytes.Equal(proof.Header.Hash(), cluster.Nodes[0].Block(4).Hash()) {
+			t.Errorf("node %d has a stable checkpoint with the header of another block", p.node.ID())
+		}
+	}
+
+	// The window moved with the checkpoint.
+	propose(engines[0])
+	cluster.Deliver(10000)
+	if h := cluster.MinHeight(); h != 5 {
+		t.Errorf("replicas executed %d batches after the checkpoint, want 5", h)
+	}
+}
+
+func TestWatermarks(t *testing.T) {
+	tests := []struct {
+		name     string
+		view     int
+		sender   uint
+		sequence int
+		want     bool
+	}{
+		{"first sequence", 0, 0, 1, true},
+		{"high watermark", 0, 0, 4, true},
+		{"low watermark", 0, 0, 0, false},
+		{"above high watermark", 0, 0, 5, false},
+		{"not the primary", 0, 1, 1, false},
+		{"other view", 1, 1, 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster, engines := newTestCluster(4)
+			block := types.NewBlock(types.Header{ProposerID: tt.sender}, nil, nil)
+			msg := &types.Message{Type: PrePrepareType, Payload: &PrePrepareMessage{View: tt.view, Sequence: tt.sequence, Digest: block.Hash(), Block: block}}
+			cluster.Nodes[tt.sender].Sign(msg)
+			if got := engines[1].HandleMessage(tt.sender, msg); got != tt.want {
+				t.Errorf("HandleMessage = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("digest mismatch", func(t *testing.T) {
+		cluster, engines := newTestCluster(4)
+		msg := &types.Message{Type: PrePrepareType, Payload: &PrePrepareMessage{View: 0, Sequence: 1, Digest: []byte("other"), Block: types.NewBlock(types.Header{}, nil, nil)}}
+		cluster.Nodes[0].Sign(msg)
+		if engines[1].HandleMessage(0, msg) {
+			t.Error("accepted a pre-prepare whose digest does not match its block")
+		}
+	})
+
+	t.Run("signed by another replica", func(t *testing.T) {
+		cluster, engines := newTestCluster(4)
+		block := types.NewBlock(types.Header{}, nil, nil)
+		msg := &types.Message{Type: PrePrepareType, Payload: &PrePrepareMessage{View: 0, Sequence: 1, Digest: block.Hash(), Block: block}}
+		cluster.Nodes[2].Sign(msg)
+		if engines[1].HandleMessage(0, msg) {
+			t.Error("accepted a pre-prepare signed by a replica other than the primary")
+		}
+	})
+}
+
+func TestViewChange(t *testing.T) {
+	cluster, engines := newTestCluster(4)
+	submit(cluster, 2)
+
+	// The batch prepares everywhere, but the commits are lost.
+	dropCommits := true
+	cluster.Drop = func(from, to uint, msg *types.Message) bool {
+		return dropCommits && msg.Type == CommitType
+	}
+	cluster.Start()
+	propose(engines[0])
+	cluster.Deliver(10000)
+	if h := cluster.MinHeight(); h != 0 {
+		t.Fatalf("replicas executed %d batches without commits", h)
+	}
+
+	// The backups give up on the primary; the new one re-issues the prepared batch.
+	dropCommits = false
+	for _, p := range engines[1:] {
+		viewChange(p, 1)
+	}
+	cluster.Deliver(10000)
+
+	if err := cluster.Check(); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range engines {
+		if state := p.CurrentState().(State); state.View != 1 || state.ViewChanging {
+			t.Errorf("node %d is in view %d (changing: %v), want view 1", p.node.ID(), state.View, state.ViewChanging)
+		}
+	}
+	if h := cluster.MinHeight(); h != 1 {
+		t.Fatalf("replicas executed %d batches after the view change, want 1", h)
+	}
+	if txs := cluster.Nodes[0].Committed()[0].Transactions; len(txs) != 2 {
+		t.Errorf("re-issued batch has %d transactions, want the 2 prepared ones", len(txs))
+	}
+
+	// The new primary orders the next requests.
+	submit(cluster, 4)
+	propose(engines[1])
+	cluster.Deliver(10000)
+	if h := cluster.MinHeight(); h != 2 {
+		t.Errorf("replicas executed %d batches in the new view, want 2", h)
+	}
+}
+
+func TestStateTransfer(t *testing.T) {
+	cluster, engines := newTestCluster(4)
+	submit(cluster, 4)
+
+	// Replica 3 misses the first two batches and the checkpoint after them.
+	isolated := true
+	var state *types.Message
+	cluster.Drop = func(from, to uint, msg *types.Message) bool {
+		if msg.Type == StateType && state == nil {
+			state = msg
+		}
+		return msg.Type == StateType || (isolated && (from == 3 || to == 3))
+	}
+	cluster.Start()
+	propose(engines[0])
+	propose(engines[0])
+	cluster.Deliver(10000)
+	if h := len(cluster.Nodes[0].Committed()); h != 2 || engines[0].lowWatermark != 2 {
+		t.Fatalf("replicas executed %d batches with stable checkpoint %d, want 2 and 2", h, engines[0].lowWatermark)
+	}
+
+	// The new view starts from the checkpoint, which replica 3 has to fetch the blocks of.
+	isolated = false
+	for _, p := range engines {
+		viewChange(p, 1)
+	}
+	cluster.Deliver(10000)
+	if state == nil {
+		t.Fatal("nobody sent replica 3 the blocks up to the stable checkpoint")
+	}
+	if p := engines[3]; p.view != 1 || p.lowWatermark != 2 || p.lastExecuted != 0 {
+		t.Fatalf("replica 3 is in view %d with stable checkpoint %d and executed %d, want 1, 2 and 0", p.view, p.lowWatermark, p.lastExecuted)
+	}
+
+	blocks := state.Payload.(*StateMessage).Blocks
+	other := types.NewBlock(types.Header{Height: 2, ParentHash: blocks[0].Hash(), Timestamp: blocks[1].Timestamp}, nil, nil)
+	tests := []struct {
+		name  string
+		state *StateMessage
+	}{
+		{"missing block", &StateMessage{Sequence: 0, Blocks: blocks[:1]}},
+		{"another block", &StateMessage{Sequence: 0, Blocks: []*types.Block{blocks[0], other}}},
+		{"blocks out of order", &StateMessage{Sequence: 0, Blocks: []*types.Block{blocks[1], blocks[0]}}},
+		{"other sequence", &StateMessage{Sequence: 1, Blocks: blocks}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := &types.Message{Type: StateType, Payload: tt.state}
+			cluster.Nodes[1].Sign(msg)
+			if engines[3].HandleMessage(1, msg) {
+				t.Error("accepted the blocks")
+			}
+		})
+	}
+
+	if !engines[3].HandleMessage(state.From, state) {
+		t.Fatal("rejected the blocks up to the stable checkpoint")
+	}
+	if err := cluster.Check(); err != nil {
+		t.Fatal(err)
+	}
+	if h := len(cluster.Nodes[3].Committed()); h != 2 {
+		t.Fatalf("replica 3 executed %d batches, want the 2 up to the checkpoint", h)
+	}
+
+	// Replica 3 is back in step for the requests of the new view.
+	submit(cluster, 2)
+	propose(engines[1])
+	cluster.Deliver(10000)
+	if h := cluster.MinHeight(); h != 3 {
+		t.Errorf("replicas executed %d batches in the new view, want 3", h)
+	}
+
+	t.Run("requests", func(t *testing.T) {
+		p := engines[0]
+		request := func(sender uint, sequence, checkpoint int) bool {
+			msg := &types.Message{Type: StateRequestType, Payload: &StateRequestMessage{Sequence: sequence, Checkpoint: checkpoint}}
+			cluster.Nodes[sender].Sign(msg)
+			return p.HandleMessage(sender, msg)
+		}
+		if request(1, 0, 4) {
+			t.Error("answered a request beyond the executed requests")
+		}
+		if request(1, 2, 2) {
+			t.Error("answered a request for no blocks")
+		}
+		// Replica 3's request was answered during the view change.
+		if request(3, 0, 2) {
+			t.Error("answered a replica again before the view-change timeout")
+		}
+		p.stateReplies = make(map[uint]time.Time)
+		if !request(3, 0, 2) {
+			t.Error("did not answer a replica after the view-change timeout")
+		}
+	})
+}
+
+func TestViewChangeTimeout(t *testing.T) {
+	tests := []struct {
+		name     string
+		max      time.Duration
+		attempts int
+		want     time.Duration
+	}{
+		{"first view change", time.Minute, 0, time.Second},
+		{"doubled", time.Minute, 3, 8 * time.Second},
+		{"capped", time.Minute, 100, time.Minute},
+		{"without a cap", 0, 10, 1024 * time.Second},
+		{"without a cap after many view changes", 0, 100, math.MaxInt64},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.ViewChangeTimeout = config.Duration{Duration: time.Second}
+			cfg.TimeoutMax = config.Duration{Duration: tt.max}
+			p := NewPBFT(cfg)
+			p.attempts = tt.attempts
+			if got := p.viewChangeTimeout(); got != tt.want {
+				t.Errorf("viewChangeTimeout after %d view changes = %s, want %s", tt.attempts, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewView(t *testing.T) {
+	cluster, engines := newTestCluster(4)
+	submit(cluster, 2)
+
+	// The batch prepares everywhere, but the commits are lost, and so is the new-view
+	// message of the next primary.
+	var nv *NewViewMessage
+	cluster.Drop = func(from, to uint, msg *types.Message) bool {
+		if msg.Type == NewViewType {
+			nv = msg.Payload.(*NewViewMessage)
+			return true
+		}
+		return msg.Type == CommitType
+	}
+	cluster.Start()
+	propose(engines[0])
+	cluster.Deliver(10000)
+	for _, p := range engines[1:] {
+		viewChange(p, 1)
+	}
+	cluster.Deliver(10000)
+	if nv == nil || len(nv.PrePrepares) != 1 {
+		t.Fatalf("new primary sent %+v, want a new view re-issuing the prepared batch", nv)
+	}
+
+	// tampered returns a copy of the new view changed by modify.
+	tampered := func(modify func(*NewViewMessage)) *NewViewMessage {
+		c := *nv
+		c.ViewChanges = make(map[uint]*SignedViewChange, len(nv.ViewChanges))
+		for id, vc := range nv.ViewChanges {
+			c.ViewChanges[id] = vc
+		}
+		c.PrePrepareSigs = append([][]byte(nil), nv.PrePrepareSigs...)
+		modify(&c)
+		return &c
+	}
+	var signer uint
+	for id := range nv.ViewChanges {
+		signer = id
+		break
+	}
+	tests := []struct {
+		name string
+		nv   *NewViewMessage
+	}{
+		{"forged view change", tampered(func(nv *NewViewMessage) {
+			vc := *nv.ViewChanges[signer]
+			vc.Signature = sign((signer+1)%4, vc.ViewChange.SignBytes())
+			nv.ViewChanges[signer] = &vc
+		})},
+		{"missing view change", tampered(func(nv *NewViewMessage) { nv.ViewChanges[signer] = nil })},
+		{"view changes below quorum", tampered(func(nv *NewViewMessage) { delete(nv.ViewChanges, signer) })},
+		{"missing pre-prepare signature", tampered(func(nv *NewViewMessage) { nv.PrePrepareSigs = nil })},
+		{"forged pre-prepare signature", tampered(func(nv *NewViewMessage) {
+			nv.PrePrepareSigs[0] = sign(2, nv.PrePrepares[0].SignBytes())
+		})},
+		{"missing pre-prepare", tampered(func(nv *NewViewMessage) { nv.PrePrepares = nil; nv.PrePrepareSigs = nil })},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := &types.Message{Type: NewViewType, Payload: tt.nv}
+			cluster.Nodes[1].Sign(msg)
+			if engines[2].HandleMessage(1, msg) {
+				t.Error("accepted the new view")
+			}
+		})
+	}
+
+	msg := &types.Message{Type: NewViewType, Payload: nv}
+	cluster.Nodes[1].Sign(msg)
+	if !engines[2].HandleMessage(1, msg) {
+		t.Error("rejected the new view of the primary")
+	}
+}
+
+// sign returns replica id's signature of data.
+func sign(id uint, data []byte) []byte {
+	return ed25519.Sign(protocoltest.Key(id), data)
+}
+
+// signatures returns the signatures of data by each of the replicas.
+func signatures(data []byte, ids ...uint) map[uint][]byte {
+	sigs := make(map[uint][]byte, len(ids))
+	for _, id := range ids {
+		sigs[id] = sign(id, data)
+	}
+	return sigs
+}
+
+// preparedProof returns a proof that block was prepared at sequence 1 of view, with
+// the pre-prepare signed by the primary of view and prepares signed by backups.
+func preparedProof(view int, block *types.Block, backups ...uint) *PreparedProof {
+	pp := &PrePrepareMessage{View: view, Sequence: 1, Digest: block.Hash(), Block: block}
+	prepare := &PrepareMessage{View: view, Sequence: 1, Digest: block.Hash()}
+	return &PreparedProof{
+		PrePrepare: pp,
+		Signature:  sign(uint(view%4), pp.SignBytes()),
+		Prepares:   signatures(prepare.SignBytes(), backups...),
+	}
+}
+
+func TestValidViewChange(t *testing.T) {
+	block := types.NewBlock(types.Header{}, nil, nil)
+	genesis := &CheckpointProof{}
+	digest := []byte("state after 2")
+	header := types.Header{Height: 2, ParentHash: []byte("block 1")}
+	checkpoint := (&CheckpointProof{Sequence: 2, StateDigest: digest, Header: header}).message()
+	stable := func(ids ...uint) *CheckpointProof {
+		return &CheckpointProof{Sequence: 2, StateDigest: digest, Header: header, Signatures: signatures(checkpoint.SignBytes(), ids...)}
+	}
+	withProof := func(modify func(*PreparedProof)) []*PreparedProof {
+		proof := preparedProof(0, block, 1, 2)
+		modify(proof)
+		return []*PreparedProof{proof}
+	}
+
+	tests := []struct {
+		name string
+		vc   *ViewChangeMessage
+		want bool
+	}{
+		{"no prepared requests", &ViewChangeMessage{NewView: 1, Checkpoint: genesis}, true},
+		{"prepared request", &ViewChangeMessage{NewView: 1, Checkpoint: genesis, Prepared: []*PreparedProof{preparedProof(0, block, 1, 2)}}, true},
+		{"stable checkpoint", &ViewChangeMessage{NewView: 1, Checkpoint: stable(0, 1, 2)}, true},
+		{"missing checkpoint", &ViewChangeMessage{NewView: 1}, false},
+		{"checkpoint below quorum", &ViewChangeMessage{NewView: 1, Checkpoint: stable(0, 1)}, false},
+		{"checkpoint with a forged signature", &ViewChangeMessage{NewView: 1, Checkpoint: func() *CheckpointProof {
+			cp := stable(0, 1, 2)
+			cp.Signatures[2] = sign(3, checkpoint.SignBytes())
+			return cp
+		}()}, false},
+		{"checkpoint of another state", &ViewChangeMessage{NewView: 1, Checkpoint: func() *CheckpointProof {
+			cp := stable(0, 1, 2)
+			cp.StateDigest = []byte("other state")
+			return cp
+		}()}, false},
+		{"checkpoint of another block", &ViewChangeMessage{NewView: 1, Checkpoint: func() *CheckpointProof {
+			cp := stable(0, 1, 2)
+			cp.Header.ProposerID = 3
+			return cp
+		}()}, false},
+		{"checkpoint signed by a non-validator", &ViewChangeMessage{NewView: 1, Checkpoint: func() *CheckpointProof {
+			cp := stable(0, 1, 2)
+			cp.Signatures[9] = sign(9, checkpoint.SignBytes())
+			return cp
+		}()}, false},
+		{"missing pre-prepare", &ViewChangeMessage{NewView: 1, Checkpoint: genesis, Prepared: withProof(func(p *PreparedProof) { p.PrePrepare = nil })}, false},
+		{"missing proof", &ViewChangeMessage{NewView: 1, Checkpoint: genesis, Prepared: []*PreparedProof{nil}}, false},
+		{"prepares below quorum", &ViewChangeMessage{NewView: 1, Checkpoint: genesis, Prepared: []*PreparedProof{preparedProof(0, block, 1)}}, false},
+		{"prepare of the primary", &ViewChangeMessage{NewView: 1, Checkpoint: genesis, Prepared: []*PreparedProof{preparedProof(0, block, 0, 1)}}, false},
+		{"missing pre-prepare signature", &ViewChangeMessage{NewView: 1, Checkpoint: genesis, Prepared: withProof(func(p *PreparedProof) { p.Signature = nil })}, false},
+		{"pre-prepare signed by a backup", &ViewChangeMessage{NewView: 1, Checkpoint: genesis, Prepared: withProof(func(p *PreparedProof) {
+			p.Signature = sign(1, p.PrePrepare.SignBytes())
+		})}, false},
+		{"forged prepare", &ViewChangeMessage{NewView: 1, Checkpoint: genesis, Prepared: withProof(func(p *PreparedProof) {
+			p.Prepares[2] = sign(1, (&PrepareMessage{View: 0, Sequence: 1, Digest: block.Hash()}).SignBytes())
+		})}, false},
+		{"prepare for another sequence", &ViewChangeMessage{NewView: 1, Checkpoint: genesis, Prepared: withProof(func(p *PreparedProof) {
+			p.Prepares[2] = sign(2, (&PrepareMessage{View: 0, Sequence: 2, Digest: block.Hash()}).SignBytes())
+		})}, false},
+		{"prepared in the new view", &ViewChangeMessage{NewView: 1, Checkpoint: genesis, Prepared: []*PreparedProof{preparedProof(1, block, 2, 3)}}, false},
+		{"digest mismatch", &ViewChangeMessage{NewView: 1, Checkpoint: genesis, Prepared: withProof(func(p *PreparedProof) {
+			p.PrePrepare.Block = types.NewBlock(types.Header{ProposerID: 1}, nil, nil)
+		})}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, engines := newTestCluster(4)
+			if got := engines[0].validViewChange(tt.vc); got != tt.want {
+				t.Errorf("validViewChange = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestComputePrePrepares(t *testing.T) {
+	blocks := make([]*types.Block, 4)
+	for i := range blocks {
+		blocks[i] = types.NewBlock(types.Header{ProposerID: uint(i + 1)}, nil, nil)
+	}
+	// computePrePrepares trusts proofs that validViewChange checked, so they need no
+	// signatures here.
+	prepared := func(view, sequence int, block *types.Block) *PreparedProof {
+		return &PreparedProof{PrePrepare: &PrePrepareMessage{View: view, Sequence: sequence, Digest: block.Hash(), Block: block}}
+	}
+	stable := types.Header{Height: 2, ProposerID: 1, Timestamp: 5}
+	checkpoint := func(sequence int) *CheckpointProof {
+		if sequence == 0 {
+			return &CheckpointProof{}
+		}
+		return &CheckpointProof{Sequence: sequence, Header: stable}
+	}
+	// A null request fills the gap on top of the request before it, or of the block at
+	// the checkpoint.
+	null := types.NewBlock(types.Header{Height: 2, ParentHash: blocks[0].Hash()}, nil, nil)
+	first := types.NewBlock(types.Header{Height: 1}, nil, nil)
+	afterCheckpoint := types.NewBlock(types.Header{Height: 3, ParentHash: stable.Hash(), Timestamp: 5}, nil, nil)
+
+	tests := []struct {
+		name       string
+		vcs        []*ViewChangeMessage
+		checkpoint int
+		want       []*types.Block // Block re-issued at each sequence after the checkpoint
+	}{
+		{
+			name: "nothing prepared",
+			vcs:  []*ViewChangeMessage{{Checkpoint: checkpoint(0)}, {Checkpoint: checkpoint(0)}, {Checkpoint: checkpoint(0)}},
+		},
+		{
+			name: "prepared requests carried over",
+			vcs: []*ViewChangeMessage{
+				{Checkpoint: checkpoint(0), Prepared: []*PreparedProof{prepared(0, 1, blocks[0]), prepared(0, 2, blocks[1])}},
+				{Checkpoint: checkpoint(0)},
+				{Checkpoint: checkpoint(0), Prepared: []*PreparedProof{prepared(0, 1, blocks[0])}},
+			},
+			want: []*types.Block{blocks[0], blocks[1]},
+		},
+		{
+			name: "sequence gap filled with a null request",
+			vcs: []*ViewChangeMessage{
+				{Checkpoint: checkpoint(0), Prepared: []*PreparedProof{prepared(0, 1, blocks[0])}},
+				{Checkpoint: checkpoint(0), Prepared: []*PreparedProof{prepared(0, 3, blocks[2])}},
+				{Checkpoint: checkpoint(0)},
+			},
+			want: []*types.Block{blocks[0], null, blocks[2]},
+		},
+		{
+			name: "first sequence filled with a null request",
+			vcs: []*ViewChangeMessage{
+				{Checkpoint: checkpoint(0), Prepared: []*PreparedProof{prepared(0, 2, blocks[1])}},
+				{Checkpoint: checkpoint(0)},
+				{Checkpoint: checkpoint(0)},
+			},
+			want: []*types.Block{first, blocks[1]},
+		},
+		{
+			name: "null request on top of the checkpoint",
+			vcs: []*ViewChangeMessage{
+				{Checkpoint: checkpoint(2), Prepared: []*PreparedProof{prepared(0, 4, blocks[3])}},
+				{Checkpoint: checkpoint(2)},
+				{Checkpoint: checkpoint(0)},
+			},
+			checkpoint: 2,
+			want:       []*types.Block{afterCheckpoint, blocks[3]},
+		},
+		{
+			name: "highest view wins",
+			vcs: []*ViewChangeMessage{
+				{Checkpoint: checkpoint(0), Prepared: []*PreparedProof{prepared(2, 1, blocks[1])}},
+				{Checkpoint: checkpoint(0), Prepared: []*PreparedProof{prepared(0, 1, blocks[0])}},
+				{Checkpoint: checkpoint(0), Prepared: []*PreparedProof{prepared(1, 1, blocks[2])}},
+			},
+			want: []*types.Block{blocks[1]},
+		},
+		{
+			name: "latest checkpoint wins",
+			vcs: []*ViewChangeMessage{
+				{Checkpoint: checkpoint(2), Prepared: []*PreparedProof{prepared(0, 3, blocks[2])}},
+				{Checkpoint: checkpoint(0), Prepared: []*PreparedProof{prepared(0, 1, blocks[0]), prepared(0, 2, blocks[1])}},
+				{Checkpoint: checkpoint(0)},
+			},
+			checkpoint: 2,
+			want:       []*types.Block{blocks[2]},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, engines := newTestCluster(4)
+			vcs := make(map[uint]*SignedViewChange)
+			for i, vc := range tt.vcs {
+				vc.NewView = 3
+				vcs[uint(i)] = &SignedViewChange{ViewChange: vc}
+			}
+			cp, prePrepares := engines[0].computePrePrepares(3, vcs)
+			if cp.Sequence != tt.checkpoint {
+				t.Errorf("new view starts from checkpoint %d, want %d", cp.Sequence, tt.checkpoint)
+			}
+			if len(prePrepares) != len(tt.want) {
+				t.Fatalf("%d pre-prepares re-issued, want %d", len(prePrepares), len(tt.want))
+			}
+			for i, pp := range prePrepares {
+				if pp.View != 3 || pp.Sequence != tt.checkpoint+i+1 {
+					t.Errorf("pre-prepare %d is for V:%d, N:%d", i, pp.View, pp.Sequence)
+				}
+				if string(pp.Digest) != string(tt.want[i].Hash()) || string(pp.Block.Hash()) != string(pp.Digest) {
+					t.Errorf("pre-prepare for sequence %d re-issues %s, want %s", pp.Sequence, pp.Block, tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+// File: internal/protocols/pbft/register.go
+package pbft
+
+import (
+	"babel-bft/internal/codec"
+	"babel-bft/internal/config"
+	"babel-bft/internal/network"
+	"babel-bft/internal/protocols"
+	"babel-bft/internal/types"
+)
+
+func init() {
+	protocols.Register("pbft", func(nodeID uint, validators *types.ValidatorSet, cfg *config.Config) (protocols.Consensus, error) {
+		p := NewPBFT(cfg.PBFT)
+		p.SetValidators(validators)
+		return p, nil
+	})
+
+	// Payloads the engine sends, so that they can be encoded for the network
+	codec.Register(0x30, &PrePrepareMessage{})
+	codec.Register(0x31, &PrepareMessage{})
+	codec.Register(0x32, &CommitMessage{})
+	codec.Register(0x33, &CheckpointMessage{})
+	codec.Register(0x34, &ViewChangeMessage{})
+	codec.Register(0x35, &NewViewMessage{})
+	codec.Register(0x36, &StateRequestMessage{})
+	codec.Register(0x37, &StateMessage{})
+
+	// Proposals and votes, which the QUIC transport keeps on streams of their own
+	network.RegisterClass(&PrePrepareMessage{}, network.Proposals)
+	network.RegisterClass(&PrepareMessage{}, network.Votes)
+	network.RegisterClass(&CommitMessage{}, network.Votes)
+}
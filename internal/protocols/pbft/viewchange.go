@@ -0,0 +1,289 @@
+// File: internal/protocols/pbft/viewchange.go
+package pbft
+
+import (
+	"babel-bft/internal/types"
+	"bytes"
+	"log"
+	"sort"
+	"time"
+)
+
+// startViewChange stops normal operation in the current view and asks to move to
+// newView, reporting our stable checkpoint and the requests prepared since.
+func (p *PBFT) startViewChange(newView int) {
+	if newView <= p.view || (p.viewChanging && newView <= p.targetView) {
+		return
+	}
+	p.viewChanging = true
+	p.targetView = newView
+	p.attempts++
+	p.lastProgress = time.Now()
+
+	// For each sequence number, report the request prepared in the highest view.
+	prepared := make(map[int]*PreparedProof)
+	for key, e := range p.log {
+		if !e.prepared || key.sequence <= p.lowWatermark {
+			continue
+		}
+		if best, ok := prepared[key.sequence]; ok && best.PrePrepare.View >= key.view {
+			continue
+		}
+		prepared[key.sequence] = &PreparedProof{
+			PrePrepare: e.prePrepare,
+			Signature:  e.prePrepareSig,
+			Prepares:   matchingSignatures(e.prepares, e.prePrepare.Digest),
+		}
+	}
+
+	vc := &ViewChangeMessage{NewView: newView, Checkpoint: p.stableProof}
+	for _, proof := range prepared {
+		vc.Prepared = append(vc.Prepared, proof)
+	}
+	sort.Slice(vc.Prepared, func(i, j int) bool { return vc.Prepared[i].PrePrepare.Sequence < vc.Prepared[j].PrePrepare.Sequence })
+
+	log.Printf("Node %d: Broadcasting View-change to view %d (stable checkpoint %d, %d prepared requests)", p.node.ID(), newView, p.stableProof.Sequence, len(vc.Prepared))
+	msg := &types.Message{Type: ViewChangeType, Payload: vc}
+	p.node.Broadcast(msg)
+	p.handleViewChange(p.node.ID(), vc, msg.Signature)
+}
+
+// handleViewChange collects view-change messages and their signatures. A weak quorum
+// (f+1) of them for later views shows that a correct replica gave up on the current
+// view, so we join the view change; the new primary starts the view once it has a
+// quorum of them.
+func (p *PBFT) handleViewChange(sender uint, vc *ViewChangeMessage, sig []byte) bool {
+	log.Printf("Node %d: Handling View-change from %d for View %d", p.node.ID(), sender, vc.NewView)
+	if vc.NewView <= p.view || !p.validViewChange(vc) {
+		return false
+	}
+	if _, ok := p.viewChanges[vc.NewView]; !ok {
+		p.viewChanges[vc.NewView] = make(map[uint]*SignedViewChange)
+	}
+	p.viewChanges[vc.NewView][sender] = &SignedViewChange{ViewChange: vc, Signature: sig}
+
+	// Join the smallest later view that a weak quorum of replicas is moving to.
+	senders := make(map[uint]struct{})
+	smallest := 0
+	for view, vcs := range p.viewChanges {
+		if view <= p.pendingView() {
+			continue
+		}
+		for id := range vcs {
+			senders[id] = struct{}{}
+		}
+		if smallest == 0 || view < smallest {
+			smallest = view
+		}
+	}
+	if p.validators.HasWeakQuorum(keys(senders)) {
+		p.startViewChange(smallest)
+	}
+
+	view := vc.NewView
+	if p.primary(view) == p.node.ID() && p.viewChanging && p.targetView == view && p.validators.HasQuorum(keys(p.viewChanges[view])) {
+		p.sendNewView(view)
+	}
+	return true
+}
+
+// sendNewView starts a view as its primary, re-issuing pre-prepares for every request
+// that may have committed in an earlier view.
+func (p *PBFT) sendNewView(view int) {
+	vcs := p.viewChanges[view]
+	checkpoint, prePrepares := p.computePrePrepares(view, vcs)
+	sigs := make([][]byte, len(prePrepares))
+	for i, pp := range prePrepares {
+		sig, err := p.node.Crypto().Sign(pp.SignBytes())
+		if err != nil {
+			log.Printf("Node %d: Failed to sign pre-prepare for V:%d, N:%d: %v", p.node.ID(), pp.View, pp.Sequence, err)
+			return
+		}
+		sigs[i] = sig
+	}
+	nv := &NewViewMessage{View: view, ViewChanges: vcs, PrePrepares: prePrepares, PrePrepareSigs: sigs}
+	p.node.Broadcast(&types.Message{Type: NewViewType, Payload: nv})
+	log.Printf("Node %d: Broadcasting New-view for view %d with %d pre-prepares", p.node.ID(), view, len(prePrepares))
+	p.enterView(view, checkpoint, prePrepares, sigs)
+}
+
+// handleNewView checks that the new primary's message is justified by a quorum of
+// signed view changes and that it re-issued and signed exactly the pre-prepares they
+// imply, then enters the view.
+func (p *PBFT) handleNewView(sender uint, nv *NewViewMessage) bool {
+	log.Printf("Node %d: Handling New-view from %d for View %d", p.node.ID(), sender, nv.View)
+	if nv.View <= p.view || sender != p.primary(nv.View) || !p.validators.HasQuorum(keys(nv.ViewChanges)) {
+		return false
+	}
+	for id, signed := range nv.ViewChanges {
+		if signed == nil || signed.ViewChange == nil || signed.ViewChange.NewView != nv.View || !p.isValidator(id) {
+			return false
+		}
+		if !p.node.Crypto().Verify(id, signed.ViewChange.SignBytes(), signed.Signature) || !p.validViewChange(signed.ViewChange) {
+			log.Printf("Node %d: Rejecting New-view for view %d with an invalid view change from %d", p.node.ID(), nv.View, id)
+			return false
+		}
+	}
+	checkpoint, expected := p.computePrePrepares(nv.View, nv.ViewChanges)
+	if len(expected) != len(nv.PrePrepares) || len(nv.PrePrepareSigs) != len(nv.PrePrepares) {
+		log.Printf("Node %d: Rejecting New-view for view %d with wrong pre-prepares", p.node.ID(), nv.View)
+		return false
+	}
+	for i, pp := range nv.PrePrepares {
+		if pp == nil || pp.View != nv.View || pp.Sequence != expected[i].Sequence || !bytes.Equal(pp.Digest, expected[i].Digest) || pp.Block == nil || pp.Block.ValidateBasic() != nil || !bytes.Equal(pp.Block.Hash(), pp.Digest) ||
+			!p.node.Crypto().Verify(sender, pp.SignBytes(), nv.PrePrepareSigs[i]) {
+			log.Printf("Node %d: Rejecting New-view for view %d with wrong pre-prepares", p.node.ID(), nv.View)
+			return false
+		}
+	}
+	p.enterView(nv.View, checkpoint, nv.PrePrepares, nv.PrePrepareSigs)
+	return true
+}
+
+// enterView resumes normal operation in a new view, starting from the latest stable
+// checkpoint reported in the view change and the re-issued pre-prepares, signed by the
+// primary with sigs.
+func (p *PBFT) enterView(view int, checkpoint *CheckpointProof, prePrepares []*PrePrepareMessage, sigs [][]byte) {
+	p.view = view
+	p.viewChanging = false
+	p.targetView = view
+	p.lastProgress = time.Now()
+	for v := range p.viewChanges {
+		if v <= view {
+			delete(p.viewChanges, v)
+		}
+	}
+	log.Printf("Node %d: Entering view %d (primary: %d)", p.node.ID(), view, p.primary(view))
+
+	if checkpoint.Sequence > p.lowWatermark {
+		p.makeStable(checkpoint)
+		if checkpoint.Sequence > p.lastExecuted {
+			p.requestState()
+		}
+	}
+
+	p.nextSequence = p.lowWatermark + 1
+	p.proposed = make(map[string]struct{})
+	for i, pp := range prePrepares {
+		if pp.Sequence >= p.nextSequence {
+			p.nextSequence = pp.Sequence + 1
+		}
+		if pp.Sequence > p.lastExecuted {
+			for _, tx := range pp.Block.Transactions {
+				p.proposed[txKey(tx)] = struct{}{}
+			}
+		}
+		p.acceptPrePrepare(pp, sigs[i])
+	}
+	if p.nextSequence <= p.lastExecuted {
+		p.nextSequence = p.lastExecuted + 1
+	}
+}
+
+// computePrePrepares derives, from a set of view changes, the stable checkpoint the
+// new view starts from and the pre-prepares it must re-issue: for every sequence number
+// after the checkpoint, the request prepared in the highest view, or a null request
+// if none was prepared.
+func (p *PBFT) computePrePrepares(view int, vcs map[uint]*SignedViewChange) (*CheckpointProof, []*PrePrepareMessage) {
+	checkpoint := &CheckpointProof{}
+	for _, signed := range vcs {
+		if signed.ViewChange.Checkpoint.Sequence > checkpoint.Sequence {
+			checkpoint = signed.ViewChange.Checkpoint
+		}
+	}
+
+	best := make(map[int]*PrePrepareMessage)
+	maxSequence := checkpoint.Sequence
+	for _, signed := range vcs {
+		for _, proof := range signed.ViewChange.Prepared {
+			pp := proof.PrePrepare
+			if pp.Sequence <= checkpoint.Sequence {
+				continue
+			}
+			// Prefer the highest view; break ties deterministically on the digest.
+			if cur, ok := best[pp.Sequence]; ok && (cur.View > pp.View || (cur.View == pp.View && bytes.Compare(cur.Digest, pp.Digest) <= 0)) {
+				continue
+			}
+			best[pp.Sequence] = pp
+			if pp.Sequence > maxSequence {
+				maxSequence = pp.Sequence
+			}
+		}
+	}
+
+	// Requests are prepared in order, so the ones carried over follow the checkpoint
+	// without gaps. Null requests are a fallback, which extend the request before them,
+	// or the block at the checkpoint; the first block has no parent.
+	var prePrepares []*PrePrepareMessage
+	var parentHash []byte
+	var timestamp int64
+	if checkpoint.Sequence > 0 {
+		parentHash, timestamp = checkpoint.Header.Hash(), checkpoint.Header.Timestamp
+	}
+	for sequence := checkpoint.Sequence + 1; sequence <= maxSequence; sequence++ {
+		var block *types.Block
+		if pp, ok := best[sequence]; ok {
+			block = pp.Block
+		} else {
+			block = types.NewBlock(types.Header{Height: sequence, ParentHash: parentHash, Timestamp: timestamp}, nil, nil)
+		}
+		parentHash, timestamp = block.Hash(), block.Timestamp
+		prePrepares = append(prePrepares, &PrePrepareMessage{
+			View:     view,
+			Sequence: sequence,
+			Digest:   block.Hash(),
+			Block:    block,
+		})
+	}
+	return checkpoint, prePrepares
+}
+
+// validViewChange checks the proofs carried by a view change: the checkpoint, with the
+// header of its block, must be signed by a quorum of replicas, and each prepared
+// request by the primary of its view and by backups whose prepares, with the primary,
+// form a quorum. A replica can only report what others actually signed.
+func (p *PBFT) validViewChange(vc *ViewChangeMessage) bool {
+	cp := vc.Checkpoint
+	if cp == nil || cp.Sequence < 0 {
+		return false
+	}
+	if cp.Sequence > 0 && (!p.validators.HasQuorum(keys(cp.Signatures)) || !p.validSignatures(cp.message().SignBytes(), cp.Signatures)) {
+		return false
+	}
+	for _, proof := range vc.Prepared {
+		if proof == nil || proof.PrePrepare == nil {
+			return false
+		}
+		pp := proof.PrePrepare
+		if pp.Block == nil || pp.View >= vc.NewView || !bytes.Equal(pp.Block.Hash(), pp.Digest) || pp.Block.ValidateBasic() != nil {
+			return false
+		}
+		if _, ok := proof.Prepares[p.primary(pp.View)]; ok || !p.preparedQuorum(pp.View, keys(proof.Prepares)) {
+			return false
+		}
+		prepare := &PrepareMessage{View: pp.View, Sequence: pp.Sequence, Digest: pp.Digest}
+		if !p.node.Crypto().Verify(p.primary(pp.View), pp.SignBytes(), proof.Signature) || !p.validSignatures(prepare.SignBytes(), proof.Prepares) {
+			return false
+		}
+	}
+	return true
+}
+
+// validSignatures reports whether every signature is a valid signature of data by a
+// validator.
+func (p *PBFT) validSignatures(data []byte, sigs map[uint][]byte) bool {
+	for id, sig := range sigs {
+		if !p.isValidator(id) || !p.node.Crypto().Verify(id, data, sig) {
+			return false
+		}
+	}
+	return true
+}
+
+// pendingView returns the view we are moving to, or the current one.
+func (p *PBFT) pendingView() int {
+	if p.viewChanging {
+		return p.targetView
+	}
+	return p.view
+}
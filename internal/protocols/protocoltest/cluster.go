@@ -0,0 +1,322 @@
+// Package protocoltest runs consensus engines against each other in memory, so that
+// their tests can drive a whole cluster step by step. Messages are queued instead of
+// being sent right away, and are only delivered when the test asks for it, in the order
+// they were sent; timers are left to the engines, which tests configure with timeouts
+// long enough not to fire.
+package protocoltest
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"fmt"
+	"sync"
+
+	"babel-bft/internal/crypto"
+	"babel-bft/internal/protocols"
+	"babel-bft/internal/types"
+)
+
+// Cluster is a group of replicas connected by an in-memory network.
+type Cluster struct {
+	Nodes      []*Node
+	Validators *types.ValidatorSet
+
+	// Drop, if set, decides which messages are lost instead of delivered.
+	Drop func(from, to uint, msg *types.Message) bool
+
+	mu    sync.Mutex
+	queue []envelope
+}
+
+// envelope is a message waiting to be delivered.
+type envelope struct {
+	from, to uint
+	msg      *types.Message
+}
+
+// Node is a replica of a cluster. It implements types.NodeInterface for its engine,
+// and records the blocks the engine commits.
+type Node struct {
+	id      uint
+	cluster *Cluster
+	Engine  protocols.Consensus
+	crypto  crypto.Provider
+
+	mu        sync.Mutex
+	committed []*types.Block
+	appHash   []byte
+	pending   []*types.Transaction
+	err       error
+}
+
+// NewCluster creates n replicas with IDs 0 to n-1, each running the engine returned by
+// newEngine, and connects the engines to them. The replicas tolerate the largest number
+// of faults n allows and sign their messages with ed25519, using the keys of Key.
+func NewCluster(n int, newEngine func(id uint) protocols.Consensus) *Cluster {
+	ids := make([]uint, n)
+	for i := range ids {
+		ids[i] = uint(i)
+	}
+	validators, err := types.NewUniformValidatorSet(ids, 0)
+	if err != nil {
+		panic(err)
+	}
+	publicKeys := make(map[uint]ed25519.PublicKey, n)
+	for _, id := range ids {
+		publicKeys[id] = Key(id).Public().(ed25519.PublicKey)
+	}
+	c := &Cluster{Validators: validators}
+	for i := 0; i < n; i++ {
+		provider := crypto.NewEd25519Provider(Key(uint(i)), publicKeys)
+		genesis := sha256.Sum256(nil)
+		node := &Node{id: uint(i), cluster: c, Engine: newEngine(uint(i)), crypto: provider, appHash: genesis[:]}
+		c.Nodes = append(c.Nodes, node)
+	}
+	for _, node := range c.Nodes {
+		node.Engine.SetNode(node)
+	}
+	return c
+}
+
+// Key returns the private key of replica id. It is derived from the ID, so a replica
+// has the same key in every cluster and tests can sign messages before creating one.
+func Key(id uint) ed25519.PrivateKey {
+	seed := sha256.Sum256([]byte(fmt.Sprintf("protocoltest replica %d", id)))
+	return ed25519.NewKeyFromSeed(seed[:])
+}
+
+// Start starts every engine.
+func (c *Cluster) Start() {
+	for _, node := range c.Nodes {
+		node.Engine.Start()
+	}
+}
+
+// Deliver hands queued messages to their recipients, including the ones sent while
+// handling them, until no message is left or max messages were delivered. It returns
+// the number of messages delivered.
+func (c *Cluster) Deliver(max int) int {
+	delivered := 0
+	for delivered < max {
+		c.mu.Lock()
+		if len(c.queue) == 0 {
+			c.mu.Unlock()
+			break
+		}
+		e := c.queue[0]
+		c.queue = c.queue[1:]
+		c.mu.Unlock()
+
+		if c.Drop != nil && c.Drop(e.from, e.to, e.msg) {
+			continue
+		}
+		c.Nodes[e.to].Engine.HandleMessage(e.from, e.msg)
+		delivered++
+	}
+	return delivered
+}
+
+// Pending returns the number of messages waiting to be delivered.
+func (c *Cluster) Pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.queue)
+}
+
+// Submit makes a transaction pending at every replica.
+func (c *Cluster) Submit(tx *types.Transaction) {
+	for _, node := range c.Nodes {
+		node.mu.Lock()
+		node.pending = append(node.pending, tx)
+		node.mu.Unlock()
+	}
+}
+
+// Check returns an error if a replica was handed a block out of height order, or if two
+// replicas committed different blocks at the same height.
+func (c *Cluster) Check() error {
+	var reference []*types.Block
+	for _, node := range c.Nodes {
+		if err := node.Err(); err != nil {
+			return err
+		}
+		committed := node.Committed()
+		for h, block := range committed {
+			if h < len(reference) {
+				if string(block.Hash()) != string(reference[h].Hash()) {
+					return fmt.Errorf("node %d committed %s at height %d, another replica committed %s", node.id, block, h+1, reference[h])
+				}
+			} else {
+				reference = append(reference, block)
+			}
+		}
+	}
+	return nil
+}
+
+// MinHeight returns the number of blocks committed by the replica that committed the fewest.
+func (c *Cluster) MinHeight() int {
+	min := -1
+	for _, node := range c.Nodes {
+		if h := len(node.Committed()); min == -1 || h < min {
+			min = h
+		}
+	}
+	return min
+}
+
+func (c *Cluster) enqueue(from, to uint, msg *types.Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.queue = append(c.queue, envelope{from: from, to: to, msg: msg})
+}
+
+// ID returns the replica's ID.
+func (n *Node) ID() uint {
+	return n.id
+}
+
+// Validators returns the validator set of the cluster.
+func (n *Node) Validators() *types.ValidatorSet {
+	return n.cluster.Validators
+}
+
+// ValidatorsAt returns the validator set of the cluster, which never changes.
+func (n *Node) ValidatorsAt(height int) *types.ValidatorSet {
+	return n.cluster.Validators
+}
+
+// Broadcast queues the message for every other replica.
+func (n *Node) Broadcast(msg *types.Message) {
+	n.Sign(msg)
+	for _, other := range n.cluster.Nodes {
+		if other.id != n.id {
+			n.cluster.enqueue(n.id, other.id, msg)
+		}
+	}
+}
+
+// Send queues the message for one replica.
+func (n *Node) Send(recipientID uint, msg *types.Message) {
+	n.Sign(msg)
+	n.cluster.enqueue(n.id, recipientID, msg)
+}
+
+// Sign sets the replica as the sender of msg and signs its payload, as the replica
+// does before sending it. Tests use it to hand engines messages of their own making.
+func (n *Node) Sign(msg *types.Message) {
+	msg.From = n.id
+	if payload, ok := msg.Payload.(types.Signable); ok {
+		msg.Signature, _ = n.crypto.Sign(payload.SignBytes())
+	}
+}
+
+// Crypto returns the replica's signature provider.
+func (n *Node) Crypto() crypto.Provider {
+	return n.crypto
+}
+
+// ReapTransactions returns up to max of the pending transactions.
+func (n *Node) ReapTransactions(max int) []*types.Transaction {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if len(n.pending) < max {
+		max = len(n.pending)
+	}
+	return append([]*types.Transaction(nil), n.pending[:max]...)
+}
+
+// AppHash returns the hash of the blocks committed so far, chained as the node's
+// application does.
+func (n *Node) AppHash() []byte {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.appHash
+}
+
+// Commit records a committed block and removes its transactions from the pending ones.
+// A chained block must extend the previous one and carry the state it was proposed on.
+func (n *Node) Commit(height int, block *types.Block) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if height != len(n.committed)+1 {
+		n.fail(fmt.Errorf("node %d: commit for height %d, expected height %d", n.id, height, len(n.committed)+1))
+		return
+	}
+	if err := n.checkChain(height, block); err != nil {
+		n.fail(fmt.Errorf("node %d: commit at height %d: %w", n.id, height, err))
+		return
+	}
+	n.committed = append(n.committed, block)
+	h := sha256.New()
+	h.Write(n.appHash)
+	h.Write(block.Hash())
+	n.appHash = h.Sum(nil)
+
+	included := make(map[*types.Transaction]bool, len(block.Transactions))
+	for _, tx := range block.Transactions {
+		included[tx] = true
+	}
+	kept := n.pending[:0]
+	for _, tx := range n.pending {
+		if !included[tx] {
+			kept = append(kept, tx)
+		}
+	}
+	n.pending = kept
+}
+
+// checkChain checks a chained block against the blocks committed before it.
+func (n *Node) checkChain(height int, block *types.Block) error {
+	if block.Height == 0 {
+		return nil
+	}
+	if block.Height != height {
+		return fmt.Errorf("block is for height %d", block.Height)
+	}
+	var parent *types.Block
+	if height > 1 {
+		parent = n.committed[height-2]
+	}
+	if err := block.ValidateParent(parent); err != nil {
+		return err
+	}
+	if block.AppHash != nil && !bytes.Equal(block.AppHash, n.appHash) {
+		return fmt.Errorf("app hash %x does not match the state %x", block.AppHash, n.appHash)
+	}
+	return nil
+}
+
+// fail records err unless a violation was already recorded. It must be called with
+// n.mu held.
+func (n *Node) fail(err error) {
+	if n.err == nil {
+		n.err = err
+	}
+}
+
+// Committed returns the blocks committed so far, in height order.
+func (n *Node) Committed() []*types.Block {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]*types.Block(nil), n.committed...)
+}
+
+// Block returns the committed block at the given height, or nil if it is not committed yet.
+func (n *Node) Block(height int) *types.Block {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if height < 1 || height > len(n.committed) {
+		return nil
+	}
+	return n.committed[height-1]
+}
+
+// Err returns the first protocol violation the replica noticed, such as a commit out
+// of height order.
+func (n *Node) Err() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.err
+}
@@ -0,0 +1,60 @@
+package protocols
+
+// File: internal/protocols/registry.go
+
+import (
+	"babel-bft/internal/config"
+	"babel-bft/internal/types"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Constructor creates the consensus engine of one replica. It receives the replica's
+// ID, the validator set and the parsed protocol configuration.
+type Constructor func(nodeID uint, validators *types.ValidatorSet, cfg *config.Config) (Consensus, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Constructor)
+)
+
+// Register makes a protocol available under the given name. Protocol packages call it
+// from an init function; registering the same name twice is a programming error and panics.
+func Register(name string, constructor Constructor) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if constructor == nil {
+		panic("protocols: Register constructor is nil for " + name)
+	}
+	if _, dup := registry[name]; dup {
+		panic("protocols: Register called twice for " + name)
+	}
+	registry[name] = constructor
+}
+
+// New creates an engine of the named protocol.
+func New(name string, nodeID uint, validators *types.ValidatorSet, cfg *config.Config) (Consensus, error) {
+	registryMu.RLock()
+	constructor, ok := registry[name]
+	registryMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown protocol %q (registered: %v)", name, List())
+	}
+	return constructor(nodeID, validators, cfg)
+}
+
+// List returns the names of the registered protocols, sorted.
+func List() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,84 @@
+// File: internal/protocols/tendermint/buffer.go
+package tendermint
+
+import "babel-bft/internal/types"
+
+// BufferStats counts what happened to messages that arrived ahead of time.
+type BufferStats struct {
+	Buffered int // Messages stored because they were for a future height
+	Replayed int // Buffered messages handed back to the protocol once their height was reached
+	Evicted  int // Messages dropped because the buffer was full
+}
+
+// bufferedMessage is a message waiting for its height, along with who sent it.
+type bufferedMessage struct {
+	sender uint
+	height int
+	msg    *types.Message
+}
+
+// MessageBuffer keeps consensus messages for heights the node has not reached yet,
+// so they can be replayed instead of lost when the node catches up. Messages for
+// later rounds of the current height do not need it: they are kept in the State.
+// The buffer is bounded; when full, the message for the farthest height is evicted,
+// since it is the least likely to become useful soon.
+type MessageBuffer struct {
+	capacity int
+	messages []bufferedMessage
+	stats    BufferStats
+}
+
+// NewMessageBuffer creates a buffer holding at most capacity messages.
+func NewMessageBuffer(capacity int) *MessageBuffer {
+	return &MessageBuffer{capacity: capacity}
+}
+
+// Add stores a message for a future height, evicting one if the buffer is full.
+func (b *MessageBuffer) Add(sender uint, height int, msg *types.Message) {
+	if b.capacity <= 0 {
+		b.stats.Evicted++
+		return
+	}
+	if len(b.messages) >= b.capacity {
+		farthest := 0
+		for i, m := range b.messages {
+			if m.height > b.messages[farthest].height {
+				farthest = i
+			}
+		}
+		b.stats.Evicted++
+		if b.messages[farthest].height <= height {
+			// The new message is the least useful one.
+			return
+		}
+		b.messages = append(b.messages[:farthest], b.messages[farthest+1:]...)
+	}
+	b.messages = append(b.messages, bufferedMessage{sender: sender, height: height, msg: msg})
+	b.stats.Buffered++
+}
+
+// Drain removes and returns, in arrival order, all messages for heights up to the given one.
+func (b *MessageBuffer) Drain(height int) []bufferedMessage {
+	var ready []bufferedMessage
+	kept := b.messages[:0]
+	for _, m := range b.messages {
+		if m.height <= height {
+			ready = append(ready, m)
+		} else {
+			kept = append(kept, m)
+		}
+	}
+	b.messages = kept
+	b.stats.Replayed += len(ready)
+	return ready
+}
+
+// Len returns the number of buffered messages.
+func (b *MessageBuffer) Len() int {
+	return len(b.messages)
+}
+
+// Stats returns the buffer counters.
+func (b *MessageBuffer) Stats() BufferStats {
+	return b.stats
+}
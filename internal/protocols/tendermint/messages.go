@@ -1,19 +1,27 @@
 // File: internal/protocols/tendermint/message.go
 package tendermint
 
-import "babel-bft/internal/types"
+import (
+	"babel-bft/internal/crypto"
+	"babel-bft/internal/types"
+)
 
 const (
 	ProposeType = iota
 	PrevoteType
 	PrecommitType
+	VoteSetRequestType
+	DecisionType
 )
 
 // ProposeMessage is sent by the proposer for a given height/round.
+// POLRound is -1 for a fresh block. When the proposer re-proposes its valid block,
+// POLRound is the round in which that block gathered +2/3 prevotes (its proof-of-lock).
 type ProposeMessage struct {
-	Height int
-	Round  int
-	Block  *types.Block
+	Height   int
+	Round    int
+	POLRound int
+	Block    *types.Block
 }
 
 // PrevoteMessage is cast by validators after receiving a valid proposal.
@@ -29,3 +37,74 @@ type PrecommitMessage struct {
 	Round  int
 	Hash   []byte // Hash of the proposed block
 }
+
+// VoteSetRequestMessage is sent by a validator whose round timed out, asking the others
+// to repeat what it may have missed at the height: their proposals and votes if they
+// are still at it, or the decided block if they moved past it.
+type VoteSetRequestMessage struct {
+	Height int
+	Round  int
+}
+
+// DecisionMessage carries the block decided at a height along with the commit that
+// decided it, which proves the decision on its own.
+type DecisionMessage struct {
+	Height int
+	Block  *types.Block
+	Commit *types.Commit
+}
+
+// precommitOf returns the precommit the validators behind a commit signed.
+func precommitOf(c *types.Commit) *PrecommitMessage {
+	return &PrecommitMessage{Height: c.Height, Round: c.Round, Hash: c.BlockHash}
+}
+
+// verifyCommit reports whether a commit carries valid precommit signatures of
+// validators holding a quorum of the voting power in validators.
+func verifyCommit(c *types.Commit, provider crypto.Provider, validators *types.ValidatorSet) bool {
+	if c == nil || c.Cert == nil || c.BlockHash == nil {
+		return false
+	}
+	for _, id := range c.Cert.Signers {
+		if !validators.Contains(id) {
+			return false
+		}
+	}
+	return validators.HasQuorum(c.Cert.Signers) && provider.VerifyCertificate(precommitOf(c).SignBytes(), c.Cert)
+}
+
+// SignBytes returns the bytes covered by the proposer's signature. The block is covered
+// through its hash.
+func (m *ProposeMessage) SignBytes() []byte {
+	var hash []byte
+	if m.Block != nil {
+		hash = m.Block.Hash()
+	}
+	return types.SignBytes("tendermint/propose", m.Height, m.Round, m.POLRound, hash)
+}
+
+// SignBytes returns the bytes covered by the validator's signature.
+func (m *PrevoteMessage) SignBytes() []byte {
+	return types.SignBytes("tendermint/prevote", m.Height, m.Round, m.Hash)
+}
+
+// SignBytes returns the bytes covered by the validator's signature.
+func (m *PrecommitMessage) SignBytes() []byte {
+	return types.SignBytes("tendermint/precommit", m.Height, m.Round, m.Hash)
+}
+
+// messageHeight returns the height a consensus message refers to.
+func messageHeight(msg *types.Message) (int, bool) {
+	switch payload := msg.Payload.(type) {
+	case *ProposeMessage:
+		return payload.Height, true
+	case *PrevoteMessage:
+		return payload.Height, true
+	case *PrecommitMessage:
+		return payload.Height, true
+	case *DecisionMessage:
+		return payload.Height, true
+	default:
+		return 0, false
+	}
+}
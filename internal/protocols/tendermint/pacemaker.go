@@ -2,88 +2,129 @@
 package tendermint
 
 import (
+	"babel-bft/internal/config"
 	"babel-bft/internal/types"
 	"log"
 	"time"
 )
 
+// Timeout steps, matching the consensus steps they guard, plus the catch-up timeout
+// that repeats the request for missing votes while a round makes no progress.
+const (
+	TimeoutPropose   = "propose"
+	TimeoutPrevote   = "prevote"
+	TimeoutPrecommit = "precommit"
+	TimeoutCatchUp   = "catchup"
+)
+
+// maxCatchUpBackoff is how many times the delay between two requests for missing votes
+// doubles before it stops growing.
+const maxCatchUpBackoff = 6
+
 // Pacemaker is responsible for ensuring the liveness of the Tendermint protocol.
-// It uses timeouts to trigger round changes when progress is not being made.
+// It schedules the per-step timeouts (propose, prevote and precommit) and hands them
+// back to the protocol when they expire; the protocol decides whether they still apply.
+// All of its methods expect the protocol's mutex to be held by the caller.
 type Pacemaker struct {
-	protocol   *Tendermint
-	node       types.NodeInterface
-	timer      *time.Timer
-	timeout    time.Duration
-	active     bool
-	round      int
-	lastHeard  time.Time
-	isProposer bool
+	protocol *Tendermint
+	node     types.NodeInterface
+	config   config.TendermintConfig
+	timers   map[string]*time.Timer // At most one pending timeout per step
+	active   bool
 }
 
 // NewPacemaker creates a new Pacemaker instance.
-func NewPacemaker(protocol *Tendermint) *Pacemaker {
+func NewPacemaker(protocol *Tendermint, cfg config.TendermintConfig) *Pacemaker {
 	return &Pacemaker{
 		protocol: protocol,
-		// Timeout duration should be configurable
-		timeout: 5 * time.Second,
-		active:  false,
+		config:   cfg,
+		timers:   make(map[string]*time.Timer),
+		active:   false,
 	}
 }
 
-// Start initiates the pacemaker for a given round.
-func (p *Pacemaker) Start(isProposer bool) {
-	p.isProposer = isProposer
+// Start activates the pacemaker. Timeouts scheduled before Start are ignored.
+func (p *Pacemaker) Start() {
 	p.active = true
-	p.resetTimer()
 	log.Printf("Node %d: Pacemaker started for round %d", p.node.ID(), p.protocol.state.Round)
-	go p.run()
 }
 
-// Stop deactivates the pacemaker.
+// Stop deactivates the pacemaker and cancels all pending timeouts.
 func (p *Pacemaker) Stop() {
 	p.active = false
-	if p.timer != nil {
-		p.timer.Stop()
+	for step, timer := range p.timers {
+		timer.Stop()
+		delete(p.timers, step)
 	}
 	log.Printf("Node %d: Pacemaker stopped for round %d", p.node.ID(), p.protocol.state.Round)
 }
 
-// Internal run loop for the pacemaker timer.
-func (p *Pacemaker) run() {
-	for p.active {
-		<-p.timer.C
-		if p.active {
-			p.handleTimeout()
-		}
-	}
+// ScheduleTimeout arms the timeout for the given step of a height and round,
+// replacing any pending timeout for the same step.
+func (p *Pacemaker) ScheduleTimeout(step string, height, round int) {
+	p.schedule(step, height, round, p.Timeout(step, round))
 }
 
-// handleTimeout is called when the timer expires. It triggers a new round.
-func (p *Pacemaker) handleTimeout() {
-	currentHeight, currentRound, _ := p.protocol.state.GetHeightRoundStep()
-	log.Printf("Node %d: Pacemaker timeout! H:%d R:%d. Advancing to next round.", p.node.ID(), currentHeight, currentRound)
+// ScheduleCatchUp arms the catch-up timeout of a height and round, after which the
+// protocol asks again for the votes it is missing. requests is how many requests were
+// already sent in the round.
+func (p *Pacemaker) ScheduleCatchUp(height, round, requests int) {
+	p.schedule(TimeoutCatchUp, height, round, p.CatchUpDelay(round, requests))
+}
 
-	// Advance to the next round in the protocol state
-	p.protocol.state.IncrementRound()
+// CatchUpDelay returns how long to wait before the next request for missing votes,
+// after requests were already sent in a round. The first wait is the propose timeout
+// of the round, and each request doubles it, up to maxCatchUpBackoff times, so that a
+// replica stuck in a round asks less and less often.
+func (p *Pacemaker) CatchUpDelay(round, requests int) time.Duration {
+	return config.Backoff(p.Timeout(TimeoutPropose, round), min(requests, maxCatchUpBackoff), 0)
+}
 
-	// Propose nil and broadcast prevote for nil
-	// This is part of the Tendermint recovery mechanism
-	prevote := &PrevoteMessage{
-		Height: currentHeight,
-		Round:  p.protocol.state.Round,
-		Hash:   nil, // Nil prevote
+func (p *Pacemaker) schedule(step string, height, round int, d time.Duration) {
+	if !p.active {
+		return
+	}
+	if timer, ok := p.timers[step]; ok {
+		timer.Stop()
+	}
+	p.timers[step] = time.AfterFunc(d, func() {
+		p.handleTimeout(step, height, round)
+	})
+}
+
+// Timeout returns how long to wait in the given step of a round. Timeouts grow
+// with the round number so that, after enough rounds, they exceed the actual
+// network delay and correct replicas are able to decide.
+func (p *Pacemaker) Timeout(step string, round int) time.Duration {
+	var base, delta time.Duration
+	switch step {
+	case TimeoutPropose:
+		base, delta = p.config.TimeoutPropose.Duration, p.config.TimeoutProposeDelta.Duration
+	case TimeoutPrevote:
+		base, delta = p.config.TimeoutPrevote.Duration, p.config.TimeoutPrevoteDelta.Duration
+	case TimeoutPrecommit:
+		base, delta = p.config.TimeoutPrecommit.Duration, p.config.TimeoutPrecommitDelta.Duration
 	}
-	p.node.Broadcast(&types.Message{Type: PrevoteType, Payload: prevote})
 
-	// Reset the timer for the new round
-	p.resetTimer()
+	if p.config.TimeoutBackoff == "exponential" {
+		return config.Backoff(base, round, p.config.TimeoutMax.Duration)
+	}
+	timeout := base + time.Duration(round)*delta
+	if p.config.TimeoutMax.Duration > 0 && timeout > p.config.TimeoutMax.Duration {
+		timeout = p.config.TimeoutMax.Duration
+	}
+	return timeout
 }
 
-// resetTimer resets the timeout timer.
-func (p *Pacemaker) resetTimer() {
-	if p.timer != nil {
-		p.timer.Stop()
+// handleTimeout is called when a timer expires and forwards it to the protocol.
+func (p *Pacemaker) handleTimeout(step string, height, round int) {
+	p.protocol.mtx.Lock()
+	defer p.protocol.mtx.Unlock()
+
+	// The pacemaker may have been stopped while this callback was waiting for the lock.
+	if !p.active {
+		return
 	}
-	p.timer = time.NewTimer(p.timeout)
-	p.lastHeard = time.Now()
+	log.Printf("Node %d: Pacemaker %s timeout for H:%d R:%d", p.node.ID(), step, height, round)
+	p.protocol.onTimeout(step, height, round)
 }
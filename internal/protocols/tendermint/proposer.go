@@ -0,0 +1,104 @@
+// File: internal/protocols/tendermint/proposer.go
+package tendermint
+
+import "sort"
+
+// ProposerSelector decides which validator is expected to propose a block
+// for a given height and round. Every correct replica must get the same answer,
+// so implementations have to be deterministic.
+type ProposerSelector interface {
+	Proposer(height, round int) uint
+}
+
+// RoundRobinSelector rotates the proposer role over the validators, giving each
+// of them the same share of rounds regardless of voting power.
+type RoundRobinSelector struct {
+	validators []uint
+}
+
+// NewRoundRobinSelector creates a round-robin selector over the given validator IDs.
+func NewRoundRobinSelector(validators []uint) *RoundRobinSelector {
+	ids := append([]uint(nil), validators...)
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return &RoundRobinSelector{validators: ids}
+}
+
+// Proposer returns the validator at position (height + round) in the rotation.
+func (s *RoundRobinSelector) Proposer(height, round int) uint {
+	return s.validators[(height+round)%len(s.validators)]
+}
+
+// WeightedSelector picks proposers in proportion to their voting power, using the
+// proposer-priority algorithm from Tendermint: on every step each validator's priority
+// grows by its power, the one with the highest priority proposes and pays back the
+// total power. The resulting schedule is periodic and is cached as it is computed.
+type WeightedSelector struct {
+	validators []uint
+	powers     map[uint]int64
+	priorities map[uint]int64
+	schedule   []uint
+	period     int
+}
+
+// NewWeightedSelector creates a selector where each validator proposes
+// proportionally to its voting power. Validators with non-positive power never propose.
+func NewWeightedSelector(powers map[uint]int64) *WeightedSelector {
+	s := &WeightedSelector{
+		powers:     make(map[uint]int64),
+		priorities: make(map[uint]int64),
+	}
+	var total, divisor int64
+	for id, power := range powers {
+		if power <= 0 {
+			continue
+		}
+		s.validators = append(s.validators, id)
+		s.powers[id] = power
+		s.priorities[id] = 0
+		total += power
+		divisor = gcd(divisor, power)
+	}
+	sort.Slice(s.validators, func(i, j int) bool { return s.validators[i] < s.validators[j] })
+	if divisor > 0 {
+		// The priorities return to zero after total/gcd steps, so the schedule repeats.
+		s.period = int(total / divisor)
+	}
+	return s
+}
+
+// Proposer returns the proposer for the (height + round)-th step of the schedule.
+func (s *WeightedSelector) Proposer(height, round int) uint {
+	if s.period == 0 {
+		return 0
+	}
+	step := (height + round) % s.period
+	for len(s.schedule) <= step {
+		s.schedule = append(s.schedule, s.next())
+	}
+	return s.schedule[step]
+}
+
+// next advances the priorities by one step and returns the selected validator.
+func (s *WeightedSelector) next() uint {
+	var total int64
+	for _, id := range s.validators {
+		s.priorities[id] += s.powers[id]
+		total += s.powers[id]
+	}
+	// Ties are broken by the lowest ID, since validators are kept sorted.
+	chosen := s.validators[0]
+	for _, id := range s.validators[1:] {
+		if s.priorities[id] > s.priorities[chosen] {
+			chosen = id
+		}
+	}
+	s.priorities[chosen] -= total
+	return chosen
+}
+
+func gcd(a, b int64) int64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
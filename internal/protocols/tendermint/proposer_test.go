@@ -0,0 +1,112 @@
+package tendermint
+
+import "testing"
+
+func TestRoundRobinSelector(t *testing.T) {
+	s := NewRoundRobinSelector([]uint{3, 1, 2, 0})
+	tests := []struct {
+		height, round int
+		want          uint
+	}{
+		{0, 0, 0},
+		{1, 0, 1},
+		{1, 1, 2},
+		{1, 2, 3},
+		{1, 3, 0},
+		{2, 0, 2},
+		{5, 6, 3},
+	}
+	for _, tt := range tests {
+		if got := s.Proposer(tt.height, tt.round); got != tt.want {
+			t.Errorf("Proposer(%d, %d) = %d, want %d", tt.height, tt.round, got, tt.want)
+		}
+	}
+}
+
+func TestWeightedSelectorShares(t *testing.T) {
+	tests := []struct {
+		name   string
+		powers map[uint]int64
+		// Number of proposals of each validator in one period of the schedule
+		want map[uint]int
+	}{
+		{"uniform", map[uint]int64{0: 1, 1: 1, 2: 1, 3: 1}, map[uint]int{0: 1, 1: 1, 2: 1, 3: 1}},
+		{"uniform scaled", map[uint]int64{0: 5, 1: 5, 2: 5}, map[uint]int{0: 1, 1: 1, 2: 1}},
+		{"weighted", map[uint]int64{0: 1, 1: 2, 2: 3}, map[uint]int{0: 1, 1: 2, 2: 3}},
+		{"common divisor", map[uint]int64{0: 10, 1: 20, 2: 30, 3: 40}, map[uint]int{0: 1, 1: 2, 2: 3, 3: 4}},
+		{"non-positive powers never propose", map[uint]int64{0: 2, 1: 0, 2: -3, 3: 1}, map[uint]int{0: 2, 3: 1}},
+		{"single validator", map[uint]int64{7: 4}, map[uint]int{7: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewWeightedSelector(tt.powers)
+			period := 0
+			for _, n := range tt.want {
+				period += n
+			}
+			if s.period != period {
+				t.Fatalf("period = %d, want %d", s.period, period)
+			}
+
+			// Over several periods, each validator proposes its share in every one of them.
+			for start := 0; start < 3*period; start += period {
+				got := make(map[uint]int)
+				for step := start; step < start+period; step++ {
+					got[s.Proposer(step, 0)]++
+				}
+				if len(got) != len(tt.want) {
+					t.Fatalf("proposals from steps %d-%d = %v, want %v", start, start+period-1, got, tt.want)
+				}
+				for id, n := range tt.want {
+					if got[id] != n {
+						t.Fatalf("proposals from steps %d-%d = %v, want %v", start, start+period-1, got, tt.want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestWeightedSelectorDeterministic(t *testing.T) {
+	powers := map[uint]int64{0: 3, 1: 1, 2: 4, 3: 1, 4: 5}
+	a, b := NewWeightedSelector(powers), NewWeightedSelector(powers)
+
+	// Querying out of order must not change the schedule.
+	for step := 40; step >= 0; step-- {
+		a.Proposer(step, 0)
+	}
+	for height := 0; height < 20; height++ {
+		for round := 0; round < 3; round++ {
+			if pa, pb := a.Proposer(height, round), b.Proposer(height, round); pa != pb {
+				t.Fatalf("Proposer(%d, %d) = %d and %d on two selectors over the same powers", height, round, pa, pb)
+			}
+		}
+	}
+	// The next round of a height is the next step of the schedule.
+	if a.Proposer(2, 1) != a.Proposer(3, 0) {
+		t.Errorf("Proposer(2, 1) = %d differs from Proposer(3, 0) = %d", a.Proposer(2, 1), a.Proposer(3, 0))
+	}
+}
+
+func TestWeightedSelectorMatchesRoundRobinForUniformPower(t *testing.T) {
+	ids := []uint{0, 1, 2, 3, 4, 5, 6}
+	powers := make(map[uint]int64)
+	for _, id := range ids {
+		powers[id] = 1
+	}
+	weighted, roundRobin := NewWeightedSelector(powers), NewRoundRobinSelector(ids)
+	for height := 1; height < 30; height++ {
+		for round := 0; round < 4; round++ {
+			if w, r := weighted.Proposer(height, round), roundRobin.Proposer(height, round); w != r {
+				t.Fatalf("Proposer(%d, %d) = %d, round robin gives %d", height, round, w, r)
+			}
+		}
+	}
+}
+
+func TestWeightedSelectorEmpty(t *testing.T) {
+	s := NewWeightedSelector(map[uint]int64{1: 0})
+	if got := s.Proposer(1, 0); got != 0 {
+		t.Errorf("Proposer without validators = %d, want 0", got)
+	}
+}
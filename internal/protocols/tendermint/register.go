@@ -0,0 +1,29 @@
+// File: internal/protocols/tendermint/register.go
+package tendermint
+
+import (
+	"babel-bft/internal/codec"
+	"babel-bft/internal/config"
+	"babel-bft/internal/network"
+	"babel-bft/internal/protocols"
+	"babel-bft/internal/types"
+)
+
+func init() {
+	protocols.Register("tendermint", func(nodeID uint, validators *types.ValidatorSet, cfg *config.Config) (protocols.Consensus, error) {
+		// The validators of each height come from the node, which tracks validator-set changes.
+		return NewTendermint(cfg.Tendermint), nil
+	})
+
+	// Payloads the engine sends, so that they can be encoded for the network
+	codec.Register(0x10, &ProposeMessage{})
+	codec.Register(0x11, &PrevoteMessage{})
+	codec.Register(0x12, &PrecommitMessage{})
+	codec.Register(0x13, &VoteSetRequestMessage{})
+	codec.Register(0x14, &DecisionMessage{})
+
+	// Proposals and votes, which the QUIC transport keeps on streams of their own
+	network.RegisterClass(&ProposeMessage{}, network.Proposals)
+	network.RegisterClass(&PrevoteMessage{}, network.Votes)
+	network.RegisterClass(&PrecommitMessage{}, network.Votes)
+}
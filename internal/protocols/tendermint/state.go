@@ -17,15 +17,32 @@ type State struct {
 
 	// Locked block hash and round
 	LockedHash  []byte
+	LockedBlock *types.Block
 	LockedRound int
 
 	// Valid block hash and round (the one with +2/3 prevotes)
 	ValidHash  []byte
+	ValidBlock *types.Block
 	ValidRound int
 
 	ProposalBlock *types.Block
+	Proposals     map[int]*ProposeMessage                    // round -> proposal, for the current height
 	Votes         map[int]map[int]map[uint]*PrevoteMessage   // height -> round -> validatorId -> vote
 	Commits       map[int]map[int]map[uint]*PrecommitMessage // height -> round -> validatorId -> commit
+	// Signatures of the precommits, kept to build the commit certificate
+	CommitSignatures map[int]map[int]map[uint][]byte // height -> round -> validatorId -> signature
+
+	// LastBlock is the block committed at the previous height, and LastCommit the
+	// certificate that committed it; the next block links to both
+	LastBlock  *types.Block
+	LastCommit *types.Commit
+
+	// Validators weighs the votes; every count below is in voting power
+	Validators *types.ValidatorSet
+
+	// Whether the prevote/precommit timeouts were already scheduled in the current round
+	prevoteWaitStarted   bool
+	precommitWaitStarted bool
 }
 
 // NewState creates a new state machine for the Tendermint protocol.
@@ -36,8 +53,11 @@ func NewState() *State {
 		Step:        "propose",
 		LockedRound: -1,
 		ValidRound:  -1,
+		Proposals:   make(map[int]*ProposeMessage),
 		Votes:       make(map[int]map[int]map[uint]*PrevoteMessage),
 		Commits:     make(map[int]map[int]map[uint]*PrecommitMessage),
+
+		CommitSignatures: make(map[int]map[int]map[uint][]byte),
 	}
 }
 
@@ -77,19 +97,185 @@ func (s *State) AddVote(senderID uint, vote *PrevoteMessage) {
 	s.Votes[vote.Height][vote.Round][senderID] = vote
 }
 
-// CountVotes returns the number of prevotes for a specific block hash at a given height and round.
-func (s *State) CountVotes(height, round int, hash []byte) int {
+// Prevote returns the prevote of a validator at a given height and round, if any.
+func (s *State) Prevote(height, round int, id uint) *PrevoteMessage {
 	s.mtx.RLock()
 	defer s.mtx.RUnlock()
+	return s.Votes[height][round][id]
+}
 
-	count := 0
+// CountVotes returns the voting power of the prevotes for a specific block hash at a given height and round.
+func (s *State) CountVotes(height, round int, hash []byte) int64 {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	var power int64
 	if roundVotes, ok := s.Votes[height][round]; ok {
-		for _, vote := range roundVotes {
+		for id, vote := range roundVotes {
 			// A simple byte comparison is sufficient here. For production, use a constant-time comparison.
 			if string(vote.Hash) == string(hash) {
-				count++
+				power += s.Validators.Power(id)
+			}
+		}
+	}
+	return power
+}
+
+// AddCommit stores a precommit message and its signature for a given height and round.
+func (s *State) AddCommit(senderID uint, commit *PrecommitMessage, sig []byte) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if _, ok := s.Commits[commit.Height]; !ok {
+		s.Commits[commit.Height] = make(map[int]map[uint]*PrecommitMessage)
+	}
+	if _, ok := s.Commits[commit.Height][commit.Round]; !ok {
+		s.Commits[commit.Height][commit.Round] = make(map[uint]*PrecommitMessage)
+	}
+	s.Commits[commit.Height][commit.Round][senderID] = commit
+
+	if _, ok := s.CommitSignatures[commit.Height]; !ok {
+		s.CommitSignatures[commit.Height] = make(map[int]map[uint][]byte)
+	}
+	if _, ok := s.CommitSignatures[commit.Height][commit.Round]; !ok {
+		s.CommitSignatures[commit.Height][commit.Round] = make(map[uint][]byte)
+	}
+	s.CommitSignatures[commit.Height][commit.Round][senderID] = sig
+}
+
+// Precommit returns the precommit of a validator at a given height and round, if any,
+// along with its signature.
+func (s *State) Precommit(height, round int, id uint) (*PrecommitMessage, []byte) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	return s.Commits[height][round][id], s.CommitSignatures[height][round][id]
+}
+
+// CommitSignaturesFor returns the signatures of the precommits for a specific block
+// hash at a given height and round, keyed by validator.
+func (s *State) CommitSignaturesFor(height, round int, hash []byte) map[uint][]byte {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	sigs := make(map[uint][]byte)
+	for id, commit := range s.Commits[height][round] {
+		if string(commit.Hash) == string(hash) && s.Validators.Contains(id) {
+			sigs[id] = s.CommitSignatures[height][round][id]
+		}
+	}
+	return sigs
+}
+
+// CountCommits returns the voting power of the precommits for a specific block hash at a given height and round.
+func (s *State) CountCommits(height, round int, hash []byte) int64 {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	var power int64
+	if roundCommits, ok := s.Commits[height][round]; ok {
+		for id, commit := range roundCommits {
+			if string(commit.Hash) == string(hash) {
+				power += s.Validators.Power(id)
 			}
 		}
 	}
-	return count
+	return power
+}
+
+// CommitQuorum reports whether a non-nil block hash has gathered precommits with at
+// least quorum voting power in any round of the given height, returning that round and hash.
+func (s *State) CommitQuorum(height int, quorum int64) (int, []byte, bool) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	for round, roundCommits := range s.Commits[height] {
+		counts := make(map[string]int64)
+		for id, commit := range roundCommits {
+			if commit.Hash == nil {
+				continue
+			}
+			counts[string(commit.Hash)] += s.Validators.Power(id)
+			if counts[string(commit.Hash)] >= quorum {
+				return round, commit.Hash, true
+			}
+		}
+	}
+	return 0, nil, false
+}
+
+// AddProposal stores the proposal for its round. It returns false if a proposal
+// for that round was already received.
+func (s *State) AddProposal(proposal *ProposeMessage) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if _, ok := s.Proposals[proposal.Round]; ok {
+		return false
+	}
+	s.Proposals[proposal.Round] = proposal
+	return true
+}
+
+// Proposal returns the proposal received for the given round of the current height, if any.
+func (s *State) Proposal(round int) *ProposeMessage {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	return s.Proposals[round]
+}
+
+// BlockByHash returns a block proposed at the current height with the given hash, if any.
+func (s *State) BlockByHash(hash []byte) *types.Block {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	for _, proposal := range s.Proposals {
+		if string(proposal.Block.Hash()) == string(hash) {
+			return proposal.Block
+		}
+	}
+	return nil
+}
+
+// CountAllVotes returns the voting power of the validators that prevoted, for any value, at a given height and round.
+func (s *State) CountAllVotes(height, round int) int64 {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	var power int64
+	for id := range s.Votes[height][round] {
+		power += s.Validators.Power(id)
+	}
+	return power
+}
+
+// CountAllCommits returns the voting power of the validators that precommitted, for any value, at a given height and round.
+func (s *State) CountAllCommits(height, round int) int64 {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	var power int64
+	for id := range s.Commits[height][round] {
+		power += s.Validators.Power(id)
+	}
+	return power
+}
+
+// Participants returns the validators that prevoted or precommitted,
+// for any value, at a given height and round.
+func (s *State) Participants(height, round int) []uint {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	seen := make(map[uint]struct{})
+	var participants []uint
+	for id := range s.Votes[height][round] {
+		seen[id] = struct{}{}
+		participants = append(participants, id)
+	}
+	for id := range s.Commits[height][round] {
+		if _, ok := seen[id]; !ok {
+			participants = append(participants, id)
+		}
+	}
+	return participants
 }
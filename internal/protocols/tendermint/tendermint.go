@@ -2,26 +2,54 @@
 package tendermint
 
 import (
+	"babel-bft/internal/config"
+	"babel-bft/internal/protocols"
 	"babel-bft/internal/types"
+	"bytes"
 	"log"
+	"sync"
+	"time"
 )
 
 // Tendermint is the implementation of the Tendermint consensus protocol.
 type Tendermint struct {
-	node      types.NodeInterface
-	state     *State
-	pacemaker *Pacemaker
-	// More fields can be added here, like a logger, config, etc.
+	// mtx serializes message handling with the pacemaker's timeouts.
+	mtx        sync.Mutex
+	node       types.NodeInterface
+	state      *State
+	pacemaker  *Pacemaker
+	proposers  ProposerSelector
+	validators *types.ValidatorSet // Validator set of the current height
+	// fixedProposers is set when SetProposerSelector replaced the default selector,
+	// which is otherwise rebuilt whenever the validator set changes.
+	fixedProposers bool
+	buffer         *MessageBuffer
+	blockSize      int // Maximum number of transactions a proposer puts in a block
+	roundWindow    int // How many rounds ahead of the current one messages are kept
+	catchUps       int // Vote set requests sent in the current round
+	// replies records when we last answered a vote set request of each validator, so
+	// that a validator cannot make us resend our votes faster than replyInterval.
+	replies       map[uint]time.Time
+	replyInterval time.Duration
+	// More fields can be added here, like a logger, etc.
 }
 
 // NewTendermint creates a new instance of the Tendermint protocol engine.
-func NewTendermint() *Tendermint {
+// cfg provides the per-step timeouts used by the pacemaker, the block size, the
+// capacity of the future-height message buffer and the window of accepted rounds.
+func NewTendermint(cfg config.TendermintConfig) *Tendermint {
 	tm := &Tendermint{
-		state: NewState(),
+		state:       NewState(),
+		buffer:      NewMessageBuffer(cfg.BufferSize),
+		blockSize:   cfg.BlockSize,
+		roundWindow: cfg.RoundWindow,
+		// A correct validator asks at most once per propose timeout.
+		replies:       make(map[uint]time.Time),
+		replyInterval: cfg.TimeoutPropose.Duration,
 	}
 	// The pacemaker will be initialized and started by the node
 	// since it needs access to the node's messaging capabilities.
-	tm.pacemaker = NewPacemaker(tm)
+	tm.pacemaker = NewPacemaker(tm, cfg)
 	return tm
 }
 
@@ -29,12 +57,79 @@ func NewTendermint() *Tendermint {
 func (t *Tendermint) SetNode(node types.NodeInterface) {
 	t.node = node
 	t.pacemaker.node = node // Pacemaker also needs access to the node
+	t.updateValidators(t.state.Height)
+}
+
+// SetProposerSelector overrides the proposer-selection policy, which by default picks
+// proposers in proportion to the voting power in each height's validator set. It must
+// be called before Start, and every replica must use the same policy. The selector
+// is kept across validator-set changes.
+func (t *Tendermint) SetProposerSelector(selector ProposerSelector) {
+	t.proposers = selector
+	t.fixedProposers = true
+}
+
+// Reconfigurable marks Tendermint as following validator-set changes: each height
+// runs with the validators the node reports for it.
+func (t *Tendermint) Reconfigurable() {}
+
+// updateValidators switches to the validator set of the given height.
+func (t *Tendermint) updateValidators(height int) {
+	validators := t.node.ValidatorsAt(height)
+	if validators == t.validators {
+		return
+	}
+	if t.validators != nil {
+		log.Printf("Node %d: Validator set changed at height %d: n=%d, total power=%d", t.node.ID(), height, validators.N(), validators.TotalPower())
+	}
+	t.validators = validators
+	t.state.Validators = validators
+	if !t.fixedProposers {
+		t.proposers = NewWeightedSelector(validators.Powers())
+	}
+}
+
+// isValidator reports whether this replica votes at the current height. Replicas
+// outside the validator set follow the protocol without voting or proposing.
+func (t *Tendermint) isValidator() bool {
+	return t.validators.Contains(t.node.ID())
+}
+
+// Start arms the pacemaker and begins the first round of the first height.
+func (t *Tendermint) Start() {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	t.pacemaker.Start()
+	_, r, _ := t.state.GetHeightRoundStep()
+	t.startRound(r)
 }
 
 // HandleMessage processes incoming consensus messages.
 func (t *Tendermint) HandleMessage(senderID uint, msg *types.Message) bool {
+	// Reject messages whose signature does not match the claimed sender.
+	if !protocols.VerifyMessage(t.node, senderID, msg) {
+		log.Printf("Node %d: Rejected message of type %d with an invalid signature from %d", t.node.ID(), msg.Type, senderID)
+		return false
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
 	log.Printf("Node %d: Received message of type %d from %d", t.node.ID(), msg.Type, senderID)
 
+	// Messages for a height we have not reached yet are kept until we get there.
+	if height, ok := messageHeight(msg); ok {
+		if h, _, _ := t.state.GetHeightRoundStep(); height > h {
+			t.buffer.Add(senderID, height, msg)
+			return true
+		}
+	}
+	return t.dispatch(senderID, msg)
+}
+
+// dispatch hands a message to the handler for its type.
+func (t *Tendermint) dispatch(senderID uint, msg *types.Message) bool {
 	// Here we will expand the logic based on the message type and current state
 	switch payload := msg.Payload.(type) {
 	case *ProposeMessage:
@@ -42,7 +137,11 @@ func (t *Tendermint) HandleMessage(senderID uint, msg *types.Message) bool {
 	case *PrevoteMessage:
 		return t.handlePrevote(senderID, payload)
 	case *PrecommitMessage:
-		return t.handlePrecommit(senderID, payload)
+		return t.handlePrecommit(senderID, payload, msg.Signature)
+	case *VoteSetRequestMessage:
+		return t.handleVoteSetRequest(senderID, payload)
+	case *DecisionMessage:
+		return t.handleDecision(senderID, payload)
 	default:
 		log.Printf("Node %d: Received unknown message type", t.node.ID())
 		return false
@@ -50,35 +149,54 @@ func (t *Tendermint) HandleMessage(senderID uint, msg *types.Message) bool {
 }
 
 // handlePropose contains the logic for processing a proposal message.
+// Proposals are kept for every round of the current height, since a block proposed
+// in an earlier round may still be decided or re-proposed later.
 func (t *Tendermint) handlePropose(sender uint, proposal *ProposeMessage) bool {
 	h, r, s := t.state.GetHeightRoundStep()
 	log.Printf("Node %d handling Propose from %d for Height %d, Round %d (current state: H:%d, R:%d, S:%s)", t.node.ID(), sender, proposal.Height, proposal.Round, h, r, s)
 
-	// Basic validation: is the proposal timely?
-	if proposal.Height < h || (proposal.Height == h && proposal.Round < r) {
-		log.Printf("Node %d: Discarding old proposal", t.node.ID())
+	// Basic validation: is the proposal for this height?
+	if proposal.Height != h {
+		log.Printf("Node %d: Discarding proposal for another height", t.node.ID())
+		return false
+	}
+	if !t.inRoundWindow(proposal.Round) {
+		log.Printf("Node %d: Discarding proposal for round %d, outside the round window", t.node.ID(), proposal.Round)
 		return false
 	}
 
-	// Further validation (is sender the correct proposer, is block valid?) should be added here.
-
-	// If valid and in the propose or prevote step, we can act on it.
-	if s == "propose" || s == "prevote" {
-		t.state.SetStep("prevote")
-		t.state.ProposalBlock = proposal.Block
+	// Only the designated proposer for the round may propose.
+	if expected := t.proposers.Proposer(proposal.Height, proposal.Round); sender != expected {
+		log.Printf("Node %d: Rejecting proposal from %d, expected proposer for H:%d R:%d is %d", t.node.ID(), sender, proposal.Height, proposal.Round, expected)
+		return false
+	}
+	if proposal.Block == nil {
+		log.Printf("Node %d: Rejecting proposal without a block", t.node.ID())
+		return false
+	}
+	if proposal.POLRound < -1 || proposal.POLRound >= proposal.Round {
+		log.Printf("Node %d: Rejecting proposal with invalid POL round %d", t.node.ID(), proposal.POLRound)
+		return false
+	}
+	if !t.state.AddProposal(proposal) {
+		// Only the first proposal of a round counts.
+		return false
+	}
 
-		// Broadcast a prevote for this proposal
-		prevote := &PrevoteMessage{
-			Height: proposal.Height,
-			Round:  proposal.Round,
-			Hash:   proposal.Block.Hash(), // Assuming the block has a Hash() method
-		}
-		t.node.Broadcast(&types.Message{Type: PrevoteType, Payload: prevote})
-		log.Printf("Node %d: Broadcasted Prevote for H:%d, R:%d", t.node.ID(), proposal.Height, proposal.Round)
+	// Precommits for this block may have arrived before the proposal itself.
+	if t.tryCommit(h) {
 		return true
 	}
 
-	return false
+	switch {
+	case proposal.Round == r:
+		t.state.ProposalBlock = proposal.Block
+		t.checkProposal()
+		t.checkPolka()
+	case proposal.Round > r:
+		t.checkRoundSkip(proposal.Round)
+	}
+	return true
 }
 
 // handlePrevote contains the logic for processing a prevote message.
@@ -86,45 +204,392 @@ func (t *Tendermint) handlePrevote(sender uint, prevote *PrevoteMessage) bool {
 	h, r, _ := t.state.GetHeightRoundStep()
 	log.Printf("Node %d: Handling Prevote from %d for Height %d, Round %d", t.node.ID(), sender, prevote.Height, prevote.Round)
 
-	// Check if the vote is for the current height and round
-	if prevote.Height != h || prevote.Round != r {
+	// Check if the vote is for the current height, and a round we keep
+	if prevote.Height != h || !t.inRoundWindow(prevote.Round) {
 		return false
 	}
 
+	// Prevotes from earlier rounds are kept as well: they may form the proof-of-lock
+	// (POL) that justifies re-proposing a block in the current round.
 	t.state.AddVote(sender, prevote)
 
-	// Check if we have +2/3 prevotes for this block
-	// The quorum size should be configurable or passed in, hardcoding for now.
-	quorum := (2*t.node.QuorumSize())/3 + 1
-	if t.state.CountVotes(h, r, prevote.Hash) >= quorum {
-		// We have a polka! Move to precommit step and broadcast precommit.
-		t.state.SetStep("precommit")
-		t.state.ValidHash = prevote.Hash
-		t.state.ValidRound = r
-
-		precommit := &PrecommitMessage{
-			Height: h,
-			Round:  r,
-			Hash:   prevote.Hash,
-		}
-		t.node.Broadcast(&types.Message{Type: PrecommitType, Payload: precommit})
-		log.Printf("Node %d: Reached Prevote quorum. Broadcasting Precommit for H:%d, R:%d", t.node.ID(), h, r)
+	switch {
+	case prevote.Round == r:
+		t.checkPolka()
+		t.checkTimeouts()
+	case prevote.Round < r:
+		t.checkProposal()
+	default:
+		t.checkRoundSkip(prevote.Round)
 	}
-
 	return true
 }
 
 // handlePrecommit contains the logic for processing a precommit message.
-func (t *Tendermint) handlePrecommit(sender uint, precommit *PrecommitMessage) bool {
-	// Logic for handling a precommit:
-	// 1. Collect precommits.
-	// 2. If +2/3 precommits are received, commit the block, execute it, and start a new height.
-	// This part is crucial for making progress and will be implemented next.
+// Precommits are collected per height and round; once +2/3 of them agree on a
+// block hash, that block is committed and the node moves on to the next height.
+// The signature is kept for the commit certificate.
+func (t *Tendermint) handlePrecommit(sender uint, precommit *PrecommitMessage, sig []byte) bool {
+	h, _, _ := t.state.GetHeightRoundStep()
 	log.Printf("Node %d: Handling Precommit from %d for Height %d, Round %d", t.node.ID(), sender, precommit.Height, precommit.Round)
 
+	if precommit.Height != h || !t.inRoundWindow(precommit.Round) {
+		return false
+	}
+
+	t.state.AddCommit(sender, precommit, sig)
+	if t.tryCommit(h) {
+		return true
+	}
+	if _, r, _ := t.state.GetHeightRoundStep(); precommit.Round > r {
+		t.checkRoundSkip(precommit.Round)
+	} else {
+		t.checkTimeouts()
+	}
+	return true
+}
+
+// handleVoteSetRequest answers a validator that timed out at some height. If we are
+// still at that height, we send it again the proposals and votes we cast in it, since
+// it may have lost them; if we already decided it, we send the decided block along
+// with its commit. Requests for heights we have not reached are ignored, and so are
+// requests of a validator we answered less than replyInterval ago.
+func (t *Tendermint) handleVoteSetRequest(sender uint, req *VoteSetRequestMessage) bool {
+	h, r, _ := t.state.GetHeightRoundStep()
+	log.Printf("Node %d: Handling VoteSetRequest from %d for Height %d, Round %d", t.node.ID(), sender, req.Height, req.Round)
+
+	if !t.validators.Contains(sender) || req.Height > h {
+		return false
+	}
+	if last, ok := t.replies[sender]; ok && time.Since(last) < t.replyInterval {
+		log.Printf("Node %d: Ignoring VoteSetRequest from %d, answered %s ago", t.node.ID(), sender, time.Since(last))
+		return false
+	}
+	t.replies[sender] = time.Now()
+
+	switch {
+	case req.Height < h:
+		block, commit := t.decision(req.Height)
+		if block == nil || commit == nil {
+			return false
+		}
+		t.node.Send(sender, &types.Message{Type: DecisionType, Payload: &DecisionMessage{Height: req.Height, Block: block, Commit: commit}})
+	case req.Height == h:
+		id := t.node.ID()
+		for round := 0; round <= r; round++ {
+			if proposal := t.state.Proposal(round); proposal != nil && t.proposers.Proposer(h, round) == id {
+				t.node.Send(sender, &types.Message{Type: ProposeType, Payload: proposal})
+			}
+			if prevote := t.state.Prevote(h, round, id); prevote != nil {
+				t.node.Send(sender, &types.Message{Type: PrevoteType, Payload: prevote})
+			}
+			if precommit, sig := t.state.Precommit(h, round, id); precommit != nil {
+				t.node.Send(sender, &types.Message{Type: PrecommitType, Payload: precommit, Signature: sig})
+			}
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// decision returns a block we committed along with the commit that decided it. The
+// commit of the last block is kept in the state; older ones are the last commit of the
+// block that follows them in the ledger.
+func (t *Tendermint) decision(height int) (*types.Block, *types.Commit) {
+	h, _, _ := t.state.GetHeightRoundStep()
+	if height == h-1 {
+		return t.state.LastBlock, t.state.LastCommit
+	}
+	block, next := t.node.Block(height), t.node.Block(height+1)
+	if block == nil || next == nil || next.LastCommit == nil || next.LastCommit.Height != height {
+		return nil, nil
+	}
+	return block, next.LastCommit
+}
+
+// handleDecision commits the block decided at the current height, which another
+// validator sent in answer to our request, once its commit is verified against the
+// validators of the height.
+func (t *Tendermint) handleDecision(sender uint, d *DecisionMessage) bool {
+	h, _, _ := t.state.GetHeightRoundStep()
+	if d.Height != h || d.Block == nil || d.Commit == nil {
+		return false
+	}
+	if d.Commit.Height != h || !bytes.Equal(d.Commit.BlockHash, d.Block.Hash()) || !verifyCommit(d.Commit, t.node.Crypto(), t.validators) {
+		log.Printf("Node %d: Rejecting decision from %d for H:%d without a valid commit", t.node.ID(), sender, h)
+		return false
+	}
+	if !t.validBlock(d.Block) {
+		log.Printf("Node %d: Rejecting decision from %d for H:%d with an invalid block", t.node.ID(), sender, h)
+		return false
+	}
+
+	log.Printf("Node %d: Committing %s at height %d, decided in round %d according to %d", t.node.ID(), d.Block, h, d.Commit.Round, sender)
+	t.node.Commit(h, d.Block)
+	t.recordCommit(d.Block, d.Commit)
+	t.StartNewHeight()
 	return true
 }
 
+// requestVotes asks the other validators for the messages of the current round we
+// may have missed, and schedules the next request.
+func (t *Tendermint) requestVotes(height, round int) {
+	log.Printf("Node %d: Requesting the votes of H:%d R:%d", t.node.ID(), height, round)
+	t.node.Broadcast(&types.Message{Type: VoteSetRequestType, Payload: &VoteSetRequestMessage{Height: height, Round: round}})
+	t.pacemaker.ScheduleCatchUp(height, round, t.catchUps)
+	t.catchUps++
+}
+
+// inRoundWindow reports whether messages for the given round of the current height are
+// kept. Earlier rounds may hold the proof-of-lock of a re-proposal; later ones are only
+// accepted up to roundWindow rounds ahead, so that faulty validators cannot make us
+// store messages for any number of rounds.
+func (t *Tendermint) inRoundWindow(round int) bool {
+	_, r, _ := t.state.GetHeightRoundStep()
+	return round >= 0 && round <= r+t.roundWindow
+}
+
+// checkProposal decides how to prevote on the current round's proposal while in the
+// propose step. A fresh proposal (POLRound -1) is accepted unless we are locked on a
+// different block. A re-proposal (POLRound >= 0) must be backed by +2/3 prevotes in
+// its POL round, and is accepted if our lock is not newer than that round.
+func (t *Tendermint) checkProposal() {
+	h, r, s := t.state.GetHeightRoundStep()
+	if s != "propose" {
+		return
+	}
+	proposal := t.state.Proposal(r)
+	if proposal == nil {
+		return
+	}
+	hash := proposal.Block.Hash()
+
+	var accept bool
+	if proposal.POLRound == -1 {
+		accept = t.state.LockedRound == -1 || bytes.Equal(t.state.LockedHash, hash)
+	} else {
+		if t.state.CountVotes(h, proposal.POLRound, hash) < t.quorum() {
+			// The proof-of-lock-change is not complete yet, wait for more prevotes.
+			return
+		}
+		accept = t.state.LockedRound <= proposal.POLRound || bytes.Equal(t.state.LockedHash, hash)
+	}
+
+	if accept && t.validBlock(proposal.Block) {
+		t.broadcastPrevote(h, r, hash)
+	} else {
+		log.Printf("Node %d: Locked on %x since round %d, prevoting nil for H:%d R:%d", t.node.ID(), t.state.LockedHash, t.state.LockedRound, h, r)
+		t.broadcastPrevote(h, r, nil)
+	}
+}
+
+// checkPolka looks for +2/3 prevotes in the current round. A polka for the proposed
+// block locks it and makes it the valid block; a polka for nil makes us precommit nil.
+func (t *Tendermint) checkPolka() {
+	h, r, s := t.state.GetHeightRoundStep()
+	if s == "propose" {
+		return
+	}
+
+	if proposal := t.state.Proposal(r); proposal != nil && t.state.ValidRound < r {
+		hash := proposal.Block.Hash()
+		if t.state.CountVotes(h, r, hash) >= t.quorum() && t.validBlock(proposal.Block) {
+			// We have a polka!
+			if s == "prevote" {
+				t.state.LockedHash = hash
+				t.state.LockedBlock = proposal.Block
+				t.state.LockedRound = r
+				log.Printf("Node %d: Reached Prevote quorum. Locking on %x at H:%d, R:%d", t.node.ID(), hash, h, r)
+				t.broadcastPrecommit(h, r, hash)
+			}
+			t.state.ValidHash = hash
+			t.state.ValidBlock = proposal.Block
+			t.state.ValidRound = r
+			return
+		}
+	}
+
+	if s == "prevote" && t.state.CountVotes(h, r, nil) >= t.quorum() {
+		log.Printf("Node %d: Reached nil Prevote quorum. Precommitting nil for H:%d, R:%d", t.node.ID(), h, r)
+		t.broadcastPrecommit(h, r, nil)
+	}
+}
+
+// checkRoundSkip moves straight to a higher round of the current height once validators
+// holding f+1 voting power have sent messages for it. At least one of them is correct, so the
+// round is genuinely under way and waiting for our own timeouts would only delay us.
+func (t *Tendermint) checkRoundSkip(round int) {
+	h, r, _ := t.state.GetHeightRoundStep()
+	if round <= r {
+		return
+	}
+
+	participants := t.state.Participants(h, round)
+	if t.state.Proposal(round) != nil {
+		participants = append(participants, t.proposers.Proposer(h, round))
+	}
+	if t.validators.HasWeakQuorum(participants) {
+		log.Printf("Node %d: Received messages from %d validators for H:%d R:%d. Skipping from round %d.", t.node.ID(), len(participants), h, round, r)
+		t.startRound(round)
+	}
+}
+
+// checkTimeouts schedules the prevote and precommit timeouts of the current round.
+// They are only armed once +2/3 of the validators have voted in the round, for
+// any value, so that waiting for the missing votes can actually lead to a decision.
+func (t *Tendermint) checkTimeouts() {
+	h, r, s := t.state.GetHeightRoundStep()
+
+	if s == "prevote" && !t.state.prevoteWaitStarted && t.state.CountAllVotes(h, r) >= t.quorum() {
+		t.state.prevoteWaitStarted = true
+		t.pacemaker.ScheduleTimeout(TimeoutPrevote, h, r)
+	}
+	if !t.state.precommitWaitStarted && t.state.CountAllCommits(h, r) >= t.quorum() {
+		t.state.precommitWaitStarted = true
+		t.pacemaker.ScheduleTimeout(TimeoutPrecommit, h, r)
+	}
+}
+
+// onTimeout is called by the pacemaker when a step timeout expires. Timeouts for
+// a height, round or step we have already left are ignored. Any timeout means we
+// may have missed messages, so the first one of a round also asks the other
+// validators for them, and the catch-up timeout keeps asking, less and less often,
+// for as long as we stay in the round.
+func (t *Tendermint) onTimeout(step string, height, round int) {
+	h, r, s := t.state.GetHeightRoundStep()
+	if height != h || round != r {
+		return
+	}
+
+	if step == TimeoutCatchUp || t.catchUps == 0 {
+		t.requestVotes(h, r)
+	}
+
+	switch step {
+	case TimeoutPropose:
+		// No acceptable proposal arrived in time.
+		if s == "propose" {
+			t.broadcastPrevote(h, r, nil)
+		}
+	case TimeoutPrevote:
+		// +2/3 prevoted, but not for the same value.
+		if s == "prevote" {
+			t.broadcastPrecommit(h, r, nil)
+		}
+	case TimeoutPrecommit:
+		// +2/3 precommitted, but not for the same value: try again in the next round.
+		t.startRound(r + 1)
+	}
+}
+
+// broadcastPrevote sends our prevote for the given round and moves to the prevote step.
+func (t *Tendermint) broadcastPrevote(height, round int, hash []byte) {
+	t.state.SetStep("prevote")
+	if !t.isValidator() {
+		return
+	}
+	prevote := &PrevoteMessage{
+		Height: height,
+		Round:  round,
+		Hash:   hash,
+	}
+	t.node.Broadcast(&types.Message{Type: PrevoteType, Payload: prevote})
+	log.Printf("Node %d: Broadcasted Prevote for H:%d, R:%d", t.node.ID(), height, round)
+
+	// The transport does not deliver our own messages back to us, so count our vote locally.
+	t.handlePrevote(t.node.ID(), prevote)
+}
+
+// broadcastPrecommit sends our precommit for the given round and moves to the precommit step.
+func (t *Tendermint) broadcastPrecommit(height, round int, hash []byte) {
+	t.state.SetStep("precommit")
+	if !t.isValidator() {
+		return
+	}
+	precommit := &PrecommitMessage{
+		Height: height,
+		Round:  round,
+		Hash:   hash,
+	}
+	// Sign it ourselves, since our own signature goes into the commit certificate.
+	sig, err := t.node.Crypto().Sign(precommit.SignBytes())
+	if err != nil {
+		log.Printf("Node %d: Failed to sign Precommit for H:%d, R:%d: %v", t.node.ID(), height, round, err)
+		return
+	}
+	t.node.Broadcast(&types.Message{Type: PrecommitType, Payload: precommit, Signature: sig})
+	log.Printf("Node %d: Broadcasted Precommit for H:%d, R:%d", t.node.ID(), height, round)
+	t.handlePrecommit(t.node.ID(), precommit, sig)
+}
+
+// tryCommit commits a block for the given height if it has gathered a precommit
+// quorum in any round. If the quorum is for a block we have not received yet, the
+// commit is retried when the proposal arrives. It reports whether a block was committed.
+func (t *Tendermint) tryCommit(height int) bool {
+	round, hash, ok := t.state.CommitQuorum(height, t.quorum())
+	if !ok {
+		return false
+	}
+
+	block := t.state.BlockByHash(hash)
+	if block == nil {
+		log.Printf("Node %d: Precommit quorum for H:%d on block %x, but the block is unknown. Waiting for proposal.", t.node.ID(), height, hash)
+		return false
+	}
+
+	log.Printf("Node %d: Committing %s at height %d", t.node.ID(), block, height)
+	t.node.Commit(height, block)
+	t.certifyCommit(height, round, block)
+	t.StartNewHeight()
+	return true
+}
+
+// certifyCommit records the committed block as the last block, and aggregates the
+// precommits that committed it into the last commit, which the next block carries.
+func (t *Tendermint) certifyCommit(height, round int, block *types.Block) {
+	commit := &types.Commit{Height: height, Round: round, BlockHash: block.Hash()}
+	cert, err := t.node.Crypto().Aggregate(precommitOf(commit).SignBytes(), t.state.CommitSignaturesFor(height, round, commit.BlockHash))
+	if err != nil {
+		log.Printf("Node %d: Failed to build the commit certificate for H:%d: %v", t.node.ID(), height, err)
+		commit = nil
+	} else {
+		commit.Cert = cert
+		log.Printf("Node %d: Commit certificate for H:%d has %d signers (%d bytes)", t.node.ID(), height, len(cert.Signers), cert.Size())
+	}
+	t.recordCommit(block, commit)
+}
+
+// recordCommit makes a committed block and its commit the ones the next block links to.
+func (t *Tendermint) recordCommit(block *types.Block, commit *types.Commit) {
+	t.state.mtx.Lock()
+	t.state.LastBlock = block
+	t.state.LastCommit = commit
+	t.state.mtx.Unlock()
+}
+
+// validBlock is the application-level validity check for proposed blocks: the block
+// must be well-formed and extend the last committed block, on top of the current
+// application state, with a valid certificate for the commit of that block.
+func (t *Tendermint) validBlock(block *types.Block) bool {
+	if block == nil || block.ValidateBasic() != nil || block.ValidateParent(t.state.LastBlock) != nil {
+		return false
+	}
+	h, _, _ := t.state.GetHeightRoundStep()
+	if block.Height != h || !bytes.Equal(block.AppHash, t.node.AppHash()) {
+		return false
+	}
+	if h == 1 {
+		return block.LastCommit == nil
+	}
+	return verifyCommit(block.LastCommit, t.node.Crypto(), t.node.ValidatorsAt(h-1))
+}
+
+// quorum returns the voting power of matching votes required to make progress (total-f).
+func (t *Tendermint) quorum() int64 {
+	return t.validators.Quorum()
+}
+
 // CurrentState returns the current internal state of the protocol.
 func (t *Tendermint) CurrentState() interface{} {
 	return t.state
@@ -137,14 +602,101 @@ func (t *Tendermint) StartNewHeight() {
 	t.state.Round = 0
 	t.state.Step = "propose"
 	t.state.ProposalBlock = nil
+	// Locks and valid values only apply within a height.
+	t.state.LockedHash = nil
+	t.state.LockedBlock = nil
+	t.state.LockedRound = -1
+	t.state.ValidHash = nil
+	t.state.ValidBlock = nil
+	t.state.ValidRound = -1
 	// Clear old votes and commits to prevent memory leaks
 	// A more sophisticated garbage collection might be needed for a real implementation.
+	t.state.Proposals = make(map[int]*ProposeMessage)
 	t.state.Votes = make(map[int]map[int]map[uint]*PrevoteMessage)
 	t.state.Commits = make(map[int]map[int]map[uint]*PrecommitMessage)
+	t.state.CommitSignatures = make(map[int]map[int]map[uint][]byte)
+	height := t.state.Height
+	t.state.mtx.Unlock()
+
+	log.Printf("Node %d: Starting new height %d", t.node.ID(), height)
+	t.updateValidators(height)
+
+	t.startRound(0)
+	t.replayBuffered()
+}
+
+// replayBuffered processes the buffered messages for the height we just reached.
+func (t *Tendermint) replayBuffered() {
+	h, _, _ := t.state.GetHeightRoundStep()
+	ready := t.buffer.Drain(h)
+	if len(ready) == 0 {
+		return
+	}
+	stats := t.buffer.Stats()
+	log.Printf("Node %d: Replaying %d buffered messages for height %d (buffered: %d, replayed: %d, evicted: %d)", t.node.ID(), len(ready), h, stats.Buffered, stats.Replayed, stats.Evicted)
+	for _, m := range ready {
+		t.dispatch(m.sender, m.msg)
+	}
+}
+
+// BufferStats returns how many future-height messages were buffered, replayed and evicted so far.
+func (t *Tendermint) BufferStats() BufferStats {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return t.buffer.Stats()
+}
+
+// startRound moves the state machine to the given round of the current height.
+// If this node is the round's proposer, it re-proposes the valid block if there is
+// one (together with the round that justifies it), or else builds a block from the
+// node's pending transactions, and broadcasts the proposal.
+func (t *Tendermint) startRound(round int) {
+	t.state.mtx.Lock()
+	t.state.Round = round
+	t.state.Step = "propose"
+	t.state.ProposalBlock = nil
+	t.state.prevoteWaitStarted = false
+	t.state.precommitWaitStarted = false
+	h := t.state.Height
 	t.state.mtx.Unlock()
+	t.catchUps = 0
 
-	log.Printf("Node %d: Starting new height %d", t.node.ID(), t.state.Height)
+	if t.proposers.Proposer(h, round) != t.node.ID() {
+		t.pacemaker.ScheduleTimeout(TimeoutPropose, h, round)
+		// A proposal for this round may have arrived while we were still in an earlier one.
+		if proposal := t.state.Proposal(round); proposal != nil {
+			t.state.ProposalBlock = proposal.Block
+			t.checkProposal()
+		}
+		t.checkTimeouts()
+		return
+	}
+
+	proposal := &ProposeMessage{
+		Height:   h,
+		Round:    round,
+		POLRound: -1,
+	}
+	if t.state.ValidBlock != nil {
+		proposal.Block = t.state.ValidBlock
+		proposal.POLRound = t.state.ValidRound
+	} else {
+		header := types.Header{
+			Height:     h,
+			ProposerID: t.node.ID(),
+			Timestamp:  time.Now().UnixNano(),
+			AppHash:    t.node.AppHash(),
+		}
+		if parent := t.state.LastBlock; parent != nil {
+			header.ParentHash = parent.Hash()
+			// Our clock may be behind the parent's proposer.
+			header.Timestamp = max(header.Timestamp, parent.Timestamp)
+		}
+		proposal.Block = types.NewBlock(header, t.node.ReapTransactions(t.blockSize), t.state.LastCommit)
+	}
+	t.node.Broadcast(&types.Message{Type: ProposeType, Payload: proposal})
+	log.Printf("Node %d: Proposing %s for H:%d, R:%d (POL round %d)", t.node.ID(), proposal.Block, h, round, proposal.POLRound)
 
-	// If this node is the proposer for the new height/round, it should propose a block.
-	// The logic to determine the proposer will be added.
+	// Process our own proposal, since the transport does not loop it back.
+	t.handlePropose(t.node.ID(), proposal)
 }
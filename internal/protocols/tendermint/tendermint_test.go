@@ -0,0 +1,211 @@
+package tendermint
+
+import (
+	"io"
+	"log"
+	"math"
+	"os"
+	"testing"
+	"time"
+
+	"babel-bft/internal/config"
+	"babel-bft/internal/protocols"
+	"babel-bft/internal/protocols/protocoltest"
+	"babel-bft/internal/types"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// testConfig returns a configuration whose timeouts never fire during a test, so that
+// rounds only time out when the test calls timeout.
+func testConfig() config.TendermintConfig {
+	hour := config.Duration{Duration: time.Hour}
+	return config.TendermintConfig{
+		TimeoutPropose:   hour,
+		TimeoutPrevote:   hour,
+		TimeoutPrecommit: hour,
+		TimeoutBackoff:   "linear",
+		BlockSize:        10,
+		BufferSize:       100,
+		RoundWindow:      10,
+	}
+}
+
+// newTestCluster creates n Tendermint validators.
+func newTestCluster(n int) (*protocoltest.Cluster, []*Tendermint) {
+	engines := make([]*Tendermint, n)
+	cluster := protocoltest.NewCluster(n, func(id uint) protocols.Consensus {
+		engines[id] = NewTendermint(testConfig())
+		return engines[id]
+	})
+	return cluster, engines
+}
+
+// timeout makes the given step of a validator's current round time out, as its
+// pacemaker would.
+func timeout(tm *Tendermint, step string) {
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+	h, r, _ := tm.state.GetHeightRoundStep()
+	tm.onTimeout(step, h, r)
+}
+
+// voteSetRequest returns a request of sender for the votes of a height.
+func voteSetRequest(cluster *protocoltest.Cluster, sender uint, height int) *types.Message {
+	msg := &types.Message{Type: VoteSetRequestType, Payload: &VoteSetRequestMessage{Height: height}}
+	cluster.Nodes[sender].Sign(msg)
+	return msg
+}
+
+func TestCatchUp(t *testing.T) {
+	cluster, engines := newTestCluster(4)
+	// Validator 3 misses everything while the others decide the first two heights; the
+	// third is its to propose.
+	isolated := true
+	cluster.Drop = func(from, to uint, msg *types.Message) bool {
+		return isolated && (from == 3 || to == 3)
+	}
+	cluster.Start()
+	cluster.Deliver(10000)
+	if h := len(cluster.Nodes[0].Committed()); h != 2 {
+		t.Fatalf("validators committed %d blocks without validator 3, want 2", h)
+	}
+	if h := len(cluster.Nodes[3].Committed()); h != 0 {
+		t.Fatalf("isolated validator committed %d blocks", h)
+	}
+
+	// Validator 3 times out and asks for the decisions it missed, one height at a
+	// time. The others answer it as often as it asks.
+	isolated = false
+	for _, tm := range engines {
+		tm.replyInterval = 0
+	}
+	for i := 0; i < 10 && cluster.MinHeight() < 3; i++ {
+		timeout(engines[3], TimeoutPropose)
+		cluster.Deliver(1000)
+	}
+	if err := cluster.Check(); err != nil {
+		t.Fatal(err)
+	}
+	// Back at the current height, it proposes the next block.
+	if h := cluster.MinHeight(); h < 3 {
+		t.Errorf("validators committed %d blocks after validator 3 caught up, want at least 3", h)
+	}
+}
+
+func TestVoteSetRequest(t *testing.T) {
+	cluster, engines := newTestCluster(4)
+	cluster.Start()
+	// Validator 1 proposes and prevotes in the first round of height 1.
+	tm := engines[1]
+
+	tests := []struct {
+		name    string
+		sender  uint
+		height  int
+		answers int // Number of messages sent back
+	}{
+		{"current height", 2, 1, 2},
+		{"repeated request", 2, 1, 0},
+		{"another validator", 3, 1, 2},
+		{"height not reached", 0, 5, 0},
+		{"after a request for a height not reached", 0, 1, 2},
+	}
+	for _, tt := range tests {
+		before := cluster.Pending()
+		answered := tm.HandleMessage(tt.sender, voteSetRequest(cluster, tt.sender, tt.height))
+		if answered != (tt.answers > 0) {
+			t.Errorf("%s: HandleMessage = %v", tt.name, answered)
+		}
+		if sent := cluster.Pending() - before; sent != tt.answers {
+			t.Errorf("%s: sent %d messages, want %d", tt.name, sent, tt.answers)
+		}
+	}
+
+	// Once the interval has passed, the validator is answered again.
+	tm.replyInterval = 0
+	if !tm.HandleMessage(2, voteSetRequest(cluster, 2, 1)) {
+		t.Error("repeated request ignored after the reply interval")
+	}
+}
+
+func TestCatchUpRequests(t *testing.T) {
+	cluster, engines := newTestCluster(4)
+	requests := 0
+	cluster.Drop = func(from, to uint, msg *types.Message) bool {
+		if from == 0 && msg.Type == VoteSetRequestType {
+			requests++
+		}
+		return true
+	}
+	cluster.Start()
+	tm := engines[0]
+	count := func() int {
+		requests = 0
+		cluster.Deliver(1000)
+		return requests / 3
+	}
+
+	// The step timeouts of a round ask for the missing votes once.
+	timeout(tm, TimeoutPropose)
+	timeout(tm, TimeoutPrevote)
+	if n := count(); n != 1 {
+		t.Errorf("step timeouts sent %d requests, want 1", n)
+	}
+	// The catch-up timeout asks again.
+	timeout(tm, TimeoutCatchUp)
+	timeout(tm, TimeoutCatchUp)
+	if n := count(); n != 2 {
+		t.Errorf("catch-up timeouts sent %d requests, want 2", n)
+	}
+	// A new round asks again on its first timeout.
+	timeout(tm, TimeoutPrecommit)
+	timeout(tm, TimeoutPropose)
+	if n := count(); n != 1 {
+		t.Errorf("timeouts of a new round sent %d requests, want 1", n)
+	}
+
+	// Each request doubles the wait before the next one, up to a limit.
+	for requests := 0; requests < 10; requests++ {
+		want := time.Hour << uint(min(requests, maxCatchUpBackoff))
+		if got := tm.pacemaker.CatchUpDelay(0, requests); got != want {
+			t.Errorf("CatchUpDelay after %d requests = %s, want %s", requests, got, want)
+		}
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	cfg := testConfig()
+	cfg.TimeoutPropose = config.Duration{Duration: time.Second}
+	cfg.TimeoutProposeDelta = config.Duration{Duration: 500 * time.Millisecond}
+	cfg.TimeoutMax = config.Duration{Duration: time.Minute}
+	uncapped := cfg
+	uncapped.TimeoutMax = config.Duration{}
+
+	tests := []struct {
+		name    string
+		backoff string
+		cfg     config.TendermintConfig
+		round   int
+		want    time.Duration
+	}{
+		{"linear", "linear", cfg, 4, 3 * time.Second},
+		{"linear capped", "linear", cfg, 1000, time.Minute},
+		{"exponential", "exponential", cfg, 4, 16 * time.Second},
+		{"exponential capped", "exponential", cfg, 1000, time.Minute},
+		{"exponential without a cap", "exponential", uncapped, 10, 1024 * time.Second},
+		{"exponential without a cap after many rounds", "exponential", uncapped, 1000, math.MaxInt64},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.TimeoutBackoff = tt.backoff
+			p := NewPacemaker(nil, tt.cfg)
+			if got := p.Timeout(TimeoutPropose, tt.round); got != tt.want {
+				t.Errorf("Timeout(%d) = %s, want %s", tt.round, got, tt.want)
+			}
+		})
+	}
+}
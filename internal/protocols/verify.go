@@ -0,0 +1,17 @@
+package protocols
+
+// File: internal/protocols/verify.go
+
+import "babel-bft/internal/types"
+
+// VerifyMessage reports whether msg carries a valid signature by sender over its
+// payload. Payloads that are not Signable carry no signature and are accepted.
+// Protocols call it on every message before acting on it, so a replica cannot
+// speak for another one by forging the sender ID.
+func VerifyMessage(node types.NodeInterface, sender uint, msg *types.Message) bool {
+	payload, ok := msg.Payload.(types.Signable)
+	if !ok {
+		return true
+	}
+	return node.Crypto().Verify(sender, payload.SignBytes(), msg.Signature)
+}
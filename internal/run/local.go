@@ -1,47 +1,125 @@
 package run
 
 import (
+	"bytes"
+	"fmt"
 	"log"
 	"time"
 
+	"babel-bft/internal/codec"
+	"babel-bft/internal/config"
 	"babel-bft/internal/core"
+	"babel-bft/internal/crypto"
+	"babel-bft/internal/crypto/threshold"
 	"babel-bft/internal/network"
-	"babel-bft/internal/protocols/tendermint"
+	"babel-bft/internal/protocols"
+	_ "babel-bft/internal/protocols/all" // Registers the available protocols
+	"babel-bft/internal/types"
 )
 
+// RunLocal runs a local simulation of the given protocol, configured by the
+// protocol configuration file at configFile. The number of clients comes from
+// the client section of the configuration.
+func RunLocal(numNodes int, protocol string, duration time.Duration, configFile string) error {
+	cfg, err := config.Load(configFile)
+	if err != nil {
+		return err
+	}
+	return LocalSimulation(uint(numNodes), uint(cfg.Client.Count), duration, protocol, cfg)
+}
+
 // LocalSimulation sets up and runs a BFT consensus simulation in-process.
 // It creates a specified number of nodes and clients, connects them via an
 // in-memory transport layer, and runs the simulation for a fixed duration.
-func LocalSimulation(numNodes, numClients uint, duration time.Duration) {
-	log.Printf("Starting local simulation with %d nodes, %d clients for %s.", numNodes, numClients, duration)
+// Each node runs its own engine of the named protocol, taken from the protocol registry.
+// The first numNodes replicas form the initial validator set; the spare replicas of the
+// reconfiguration section follow the protocol without voting until they are added.
+func LocalSimulation(numNodes, numClients uint, duration time.Duration, protocol string, cfg *config.Config) error {
+	spares := uint(cfg.Reconfiguration.SpareNodes)
+	replicas := numNodes + spares
+	for _, event := range cfg.Reconfiguration.Events {
+		if event.Node >= replicas {
+			return fmt.Errorf("reconfiguration event for node %d, but there are only %d replicas", event.Node, replicas)
+		}
+	}
+	log.Printf("Starting local simulation with %d nodes (%d spare), %d clients for %s.", replicas, spares, numClients, duration)
 
-	// 1. Initialize the local network transport
-	transport := network.NewLocalTransport(numNodes + numClients)
+	// 1. Initialize the local network transport, with room for the client submitting
+	// the validator updates after the regular clients
+	c, err := codec.New(cfg.Network.Codec)
+	if err != nil {
+		return err
+	}
+	local := network.NewLocalTransport(replicas+numClients+1, c)
+	var transport network.Transport = local
+	var emulated *network.EmulatedTransport
+	if cfg.Network.Emulation.Enabled {
+		emulated = network.NewEmulatedTransport(local, cfg.Network.Emulation, c)
+		defer emulated.Stop()
+		transport = emulated
+		log.Println("Emulating the network between the nodes.")
+	}
 
 	// 2. Create and start the consensus nodes (replicas)
-	nodes := make([]*core.Node, numNodes)
-	for i := uint(0); i < numNodes; i++ {
+	ids := make([]uint, replicas)
+	for i := range ids {
+		ids[i] = uint(i)
+	}
+	scheme := cfg.Crypto.SchemeFor(protocol)
+	providers, pubKeys, err := setupCrypto(scheme, cfg, numNodes, ids, transport)
+	if err != nil {
+		return err
+	}
+	validators, err := ValidatorSet(numNodes, cfg, pubKeys)
+	if err != nil {
+		return err
+	}
+	log.Printf("Validator set: n=%d, total power=%d, f=%d, quorum=%d.", validators.N(), validators.TotalPower(), validators.F(), validators.Quorum())
+	nodes := make([]*core.Node, replicas)
+	metered := make([]*crypto.Metered, replicas)
+	for i := uint(0); i < replicas; i++ {
 		// Each node gets its own instance of the consensus engine
-		engine := tendermint.NewTendermint()
-		nodes[i] = core.NewNode(i, transport, engine, int(numNodes))
-		nodes[i].Start()
+		engine, err := protocols.New(protocol, i, validators, cfg)
+		if err != nil {
+			return err
+		}
+		if _, ok := engine.(protocols.Reconfigurable); !ok && len(cfg.Reconfiguration.Events) > 0 {
+			return fmt.Errorf("protocol %q does not support validator-set changes", protocol)
+		}
+		metered[i] = crypto.NewMetered(providers[i])
+		nodes[i] = core.NewNode(i, transport, engine, validators, metered[i], cfg.Node)
+	}
+	// Start only once every node is reachable, so the first proposal is not lost.
+	for _, node := range nodes {
+		node.Start()
 	}
 
 	// 3. Create and start the clients
 	clients := make([]*core.Client, numClients)
 	for i := uint(0); i < numClients; i++ {
-		// Client IDs start after the last node ID
-		clientID := numNodes + i
-		clients[i] = core.NewClient(clientID, transport)
+		// Client IDs start after the last replica ID, spares included
+		clientID := replicas + i
+		clients[i] = core.NewClient(clientID, transport, cfg.Client.Interval.Duration)
 		clients[i].Start()
 	}
 
-	// 4. Run the simulation for the specified duration
+	// 4. Schedule the validator-set changes
+	admin := core.NewClient(replicas+numClients, transport, cfg.Client.Interval.Duration)
+	var timers []*time.Timer
+	for _, event := range cfg.Reconfiguration.Events {
+		update := types.ValidatorUpdate{ID: event.Node, PubKey: pubKeys[event.Node], VotingPower: event.VotingPower}
+		timers = append(timers, time.AfterFunc(event.At.Duration, func() { admin.SubmitValidatorUpdate(update) }))
+	}
+
+	// 5. Run the simulation for the specified duration
 	log.Printf("Simulation running for %s...", duration)
 	time.Sleep(duration)
 
-	// 5. Stop all clients and nodes
+	// 6. Stop all clients and nodes
 	log.Println("Simulation duration ended. Stopping all components...")
+	for _, timer := range timers {
+		timer.Stop()
+	}
 	for _, client := range clients {
 		client.Stop()
 	}
@@ -50,5 +128,161 @@ func LocalSimulation(numNodes, numClients uint, duration time.Duration) {
 	}
 
 	log.Println("Simulation finished.")
-	// In a real scenario, we would collect and report metrics here.
+	checkLedgers(nodes)
+	confirmTransactions(clients, nodes[0])
+	reportCrypto(scheme, metered)
+	reportTraffic(c.Name(), local.Traffic().Counts(), duration)
+	if emulated != nil {
+		reportEmulation(emulated.Stats())
+	}
+	return nil
+}
+
+// checkLedgers logs the replicas that halted, then compares the ledgers of all replicas
+// up to the height every one of them reached, and logs whether they agree or where
+// they fork.
+func checkLedgers(nodes []*core.Node) {
+	for _, node := range nodes {
+		if err := node.Err(); err != nil {
+			log.Printf("Replica %d halted: %v", node.ID(), err)
+		}
+	}
+	common := nodes[0].Height()
+	for _, node := range nodes[1:] {
+		common = min(common, node.Height())
+	}
+	for height := 1; height <= common; height++ {
+		want := nodes[0].Block(height).Hash()
+		for _, node := range nodes[1:] {
+			if got := node.Block(height).Hash(); !bytes.Equal(got, want) {
+				log.Printf("Fork at height %d: replica %d committed %x, replica %d committed %x", height, nodes[0].ID(), want, node.ID(), got)
+				return
+			}
+		}
+	}
+	log.Printf("Ledgers of all replicas agree up to height %d", common)
+}
+
+// confirmTransactions has each client check the inclusion proofs of its transactions
+// committed by the given replica, and logs how many it could confirm.
+func confirmTransactions(clients []*core.Client, node *core.Node) {
+	for _, client := range clients {
+		pending := client.Pending()
+		for _, hash := range pending {
+			height, proof, err := node.TxProof(hash)
+			if err != nil {
+				continue // Not committed (yet)
+			}
+			if err := client.Confirm(proof, node.Block(height).Hash()); err != nil {
+				log.Printf("Invalid inclusion proof for transaction %x at height %d: %v", hash, height, err)
+			}
+		}
+		log.Printf("Client %d: %d of %d transactions proven committed", client.ID(), client.Confirmed(), len(pending))
+	}
+}
+
+// reportCrypto logs the signature operations of all replicas, their CPU cost, and the
+// mean size of the certificates they aggregated.
+func reportCrypto(scheme string, providers []*crypto.Metered) {
+	var total crypto.Stats
+	for _, p := range providers {
+		total = total.Add(p.Stats())
+	}
+	log.Printf("Crypto (%s): %d signs (%s each), %d verifies (%s each), %d certificates (mean size %.0f bytes), %d certificate checks, %s spent",
+		scheme, total.Signs, total.MeanSignTime(), total.Verifies, total.MeanVerifyTime(), total.Aggregates, total.MeanCertificateSize(), total.CertificateChecks, total.Time())
+}
+
+// reportTraffic logs the messages sent during a run of the given duration and their
+// size with the named codec, by payload type, and the resulting bandwidth.
+func reportTraffic(codecName string, counts map[string]network.TrafficCount, duration time.Duration) {
+	var total network.TrafficCount
+	for _, name := range network.PayloadNames(counts) {
+		count := counts[name]
+		total.Messages += count.Messages
+		total.Bytes += count.Bytes
+		log.Printf("Traffic of %s: %d messages, %d bytes (mean %.0f bytes)", name, count.Messages, count.Bytes, float64(count.Bytes)/float64(count.Messages))
+	}
+	log.Printf("Traffic (%s codec): %d messages, %d bytes, %.1f KB/s", codecName, total.Messages, total.Bytes, float64(total.Bytes)/1000/duration.Seconds())
+}
+
+// reportEmulation logs what the emulated network did to the messages of a run.
+func reportEmulation(stats network.EmulationStats) {
+	log.Printf("Network emulation: %d messages delivered, %d lost, %d dropped by full queues, %d duplicated, %d reordered",
+		stats.Delivered, stats.Lost, stats.Overflowed, stats.Duplicated, stats.Reordered)
+}
+
+// setupCrypto creates the signature provider of each replica for the given scheme,
+// and returns it along with the replicas' public keys. Threshold keys cover every
+// replica and are dealt or generated over transport, and emulated providers take their
+// costs from the configuration; the other schemes are set up by the crypto package.
+func setupCrypto(scheme string, cfg *config.Config, numNodes uint, ids []uint, transport network.Transport) (map[uint]crypto.Provider, map[uint][]byte, error) {
+	switch scheme {
+	case threshold.Scheme:
+	case crypto.SchemeEmulated:
+		em := cfg.Crypto.Emulation
+		providers, err := crypto.SetupEmulated(ids, crypto.EmulationCosts{
+			Sign:          em.SignDelay.Duration,
+			Verify:        em.VerifyDelay.Duration,
+			Aggregate:     em.AggregateDelay.Duration,
+			SignatureSize: em.SignatureSize,
+			Aggregated:    em.Aggregated,
+		}, crypto.KeySource(cfg.Crypto.KeySeed))
+		return providers, nil, err
+	default:
+		return crypto.Setup(scheme, ids, crypto.KeySource(cfg.Crypto.KeySeed))
+	}
+	if len(cfg.Reconfiguration.Events) > 0 || cfg.Reconfiguration.SpareNodes > 0 {
+		return nil, nil, fmt.Errorf("threshold keys cannot follow validator-set changes")
+	}
+	// A threshold certificate proves that t replicas signed, not which ones, so it only
+	// proves a quorum if every replica has the same power and t shares make a quorum.
+	validators, err := ValidatorSet(numNodes, cfg, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if validators.TotalPower() != int64(validators.N()) {
+		return nil, nil, fmt.Errorf("threshold keys require every validator to have voting power 1")
+	}
+	quorum := int(validators.Quorum())
+	t := cfg.Crypto.Threshold
+	if t == 0 {
+		t = quorum
+	}
+	if t < quorum || t > validators.N() {
+		return nil, nil, fmt.Errorf("crypto.threshold must be between the quorum (%d) and the number of validators (%d), got %d", quorum, validators.N(), t)
+	}
+
+	var shares map[uint]*threshold.Provider
+	var public *threshold.PublicKeys
+	if cfg.Crypto.KeyGeneration == threshold.KeyGenDKG {
+		log.Printf("Running distributed key generation for a (%d,%d) threshold key...", t, len(ids))
+		shares, public, err = threshold.RunDKG(transport, ids, t, cfg.Crypto.DKGTimeout.Duration)
+	} else {
+		shares, public, err = threshold.Deal(ids, t)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	pubKeys, err := public.MarshalShares()
+	if err != nil {
+		return nil, nil, err
+	}
+	providers := make(map[uint]crypto.Provider, len(shares))
+	for id, p := range shares {
+		providers[id] = p
+	}
+	return providers, pubKeys, nil
+}
+
+// ValidatorSet builds the set of replicas 0..numNodes-1, with the voting powers and
+// fault tolerance given in the configuration and the given public keys.
+func ValidatorSet(numNodes uint, cfg *config.Config, pubKeys map[uint][]byte) (*types.ValidatorSet, error) {
+	validators := make([]types.Validator, numNodes)
+	for i := range validators {
+		validators[i] = types.Validator{ID: uint(i), PubKey: pubKeys[uint(i)], VotingPower: 1}
+		if i < len(cfg.Validators.VotingPower) {
+			validators[i].VotingPower = cfg.Validators.VotingPower[i]
+		}
+	}
+	return types.NewValidatorSet(validators, cfg.Quorum.FaultTolerance)
 }
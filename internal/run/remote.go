@@ -0,0 +1,146 @@
+package run
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"babel-bft/internal/codec"
+	"babel-bft/internal/config"
+	"babel-bft/internal/core"
+	"babel-bft/internal/crypto"
+	"babel-bft/internal/crypto/threshold"
+	"babel-bft/internal/network"
+	"babel-bft/internal/protocols"
+)
+
+// ReplicaReport summarizes the run of one replica in a multi-process experiment.
+// Replicas that agree have the same app hash at the same height.
+type ReplicaReport struct {
+	ID           uint         `json:"id"`
+	Protocol     string       `json:"protocol"`
+	Height       int          `json:"height"`
+	AppHash      []byte       `json:"app_hash"`
+	Transactions int          `json:"transactions"` // Committed in the replica's ledger
+	Confirmed    int          `json:"confirmed"`    // Proven committed to the replica's client
+	Pending      int          `json:"pending"`      // Submitted by the replica's client, not proven committed
+	Crypto       crypto.Stats `json:"crypto"`
+	// Traffic is what the replica sent to the others, by payload type
+	Traffic map[string]network.TrafficCount `json:"traffic"`
+	// Emulation is what the emulated links to the replica did, if enabled
+	Emulation *network.EmulationStats `json:"emulation,omitempty"`
+	// Halted is why the replica stopped before the end of the run, if it did
+	Halted string `json:"halted,omitempty"`
+}
+
+// RunReplica runs replica id of the given protocol for duration, as one process of an
+// experiment whose replicas are listed in book, and connected to each other by the
+// transport of network.transport, authenticated with TLS when network.tls_dir is set.
+// The first replicas of the book form the validator set; the spare replicas of the
+// reconfiguration section follow the protocol without voting. Replicas below the
+// client count of the configuration also run a client that submits transactions.
+//
+// Every replica generates the keys of the whole group from crypto.key_seed, so the
+// seed is required, and threshold keys, which need a dealer or a DKG, are not supported.
+// Neither are scheduled validator-set changes, which have no single place to come from.
+func RunReplica(id uint, protocol string, duration time.Duration, cfg *config.Config, book network.AddressBook) (*ReplicaReport, error) {
+	replicas := uint(len(book))
+	spares := uint(cfg.Reconfiguration.SpareNodes)
+	if spares >= replicas {
+		return nil, fmt.Errorf("%d spare replicas leave no validators among the %d replicas of the address book", spares, replicas)
+	}
+	numNodes := replicas - spares
+	if len(cfg.Reconfiguration.Events) > 0 {
+		return nil, fmt.Errorf("reconfiguration events are only supported in local runs")
+	}
+	scheme := cfg.Crypto.SchemeFor(protocol)
+	if scheme == threshold.Scheme {
+		return nil, fmt.Errorf("threshold keys are only supported in local runs")
+	}
+	if cfg.Crypto.KeySeed == "" {
+		return nil, fmt.Errorf("crypto.key_seed must be set, so that the replicas generate the same keys")
+	}
+	providers, pubKeys, err := setupCrypto(scheme, cfg, numNodes, book.IDs(), nil)
+	if err != nil {
+		return nil, err
+	}
+	validators, err := ValidatorSet(numNodes, cfg, pubKeys)
+	if err != nil {
+		return nil, err
+	}
+	engine, err := protocols.New(protocol, id, validators, cfg)
+	if err != nil {
+		return nil, err
+	}
+	remote, err := network.NewRemoteTransport(id, book, cfg.Network)
+	if err != nil {
+		return nil, err
+	}
+	defer remote.Stop()
+	var transport network.Transport = remote
+	var emulated *network.EmulatedTransport
+	if cfg.Network.Emulation.Enabled {
+		c, err := codec.New(cfg.Network.Codec)
+		if err != nil {
+			return nil, err
+		}
+		emulated = network.NewEmulatedTransport(remote, cfg.Network.Emulation, c)
+		defer emulated.Stop()
+		transport = emulated
+		log.Println("Emulating the network links to the replica.")
+	}
+
+	log.Printf("Starting replica %d of %d (%d spare) for %s, listening on %s.", id, replicas, spares, duration, remote.Addr())
+	log.Printf("Validator set: n=%d, total power=%d, f=%d, quorum=%d.", validators.N(), validators.TotalPower(), validators.F(), validators.Quorum())
+	metered := crypto.NewMetered(providers[id])
+	node := core.NewNode(id, transport, engine, validators, metered, cfg.Node)
+	transport.Start()
+	node.Start()
+
+	var clients []*core.Client
+	if id < uint(cfg.Client.Count) {
+		// Client IDs follow the replica IDs
+		client := core.NewClient(replicas+id, transport, cfg.Client.Interval.Duration)
+		client.Start()
+		clients = append(clients, client)
+	}
+
+	log.Printf("Replica running for %s...", duration)
+	time.Sleep(duration)
+
+	log.Println("Run duration ended. Stopping replica...")
+	for _, client := range clients {
+		client.Stop()
+	}
+	node.Stop()
+
+	confirmTransactions(clients, node)
+	reportCrypto(scheme, []*crypto.Metered{metered})
+	reportTraffic(cfg.Network.Codec, remote.Traffic().Counts(), duration)
+	report := &ReplicaReport{
+		ID:       id,
+		Protocol: protocol,
+		Height:   node.Height(),
+		AppHash:  node.AppHash(),
+		Crypto:   metered.Stats(),
+		Traffic:  remote.Traffic().Counts(),
+	}
+	if err := node.Err(); err != nil {
+		report.Halted = err.Error()
+		log.Printf("Replica %d halted: %v", id, err)
+	}
+	for height := 1; height <= report.Height; height++ {
+		report.Transactions += len(node.Block(height).Transactions)
+	}
+	for _, client := range clients {
+		report.Confirmed += client.Confirmed()
+		report.Pending += len(client.Pending())
+	}
+	if emulated != nil {
+		stats := emulated.Stats()
+		reportEmulation(stats)
+		report.Emulation = &stats
+	}
+	log.Printf("Replica %d reached height %d with app hash %x.", id, report.Height, report.AppHash)
+	return report, nil
+}
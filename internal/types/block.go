@@ -0,0 +1,159 @@
+package types
+
+import (
+	"crypto/sha256"
+	"fmt"
+)
+
+// Header summarizes a block and links it to its parent, so that blocks form a chain
+// in which the hash of the last block vouches for all the earlier ones. The block hash
+// is the hash of its header, which commits to the transactions through the root of a
+// Merkle tree, so a transaction can be proven part of a block without the rest of it.
+//
+// Height and ParentHash place the block in the chain; a zero Height marks a block
+// ordered without a parent, which the chain checks skip. AppHash is the application
+// state after executing the parent, when the proposer knows it, and LastCommitHash
+// refers to the certificate that committed the parent, which the block carries.
+type Header struct {
+	Height         int
+	ParentHash     []byte
+	ProposerID     uint
+	Timestamp      int64 // Proposer's clock, in Unix nanoseconds
+	TxRoot         []byte
+	AppHash        []byte
+	LastCommitHash []byte
+}
+
+// Hash returns the SHA-256 hash of the header's canonical encoding.
+func (h *Header) Hash() []byte {
+	hash := sha256.Sum256(SignBytes("block-header", h.Height, h.ParentHash, h.ProposerID, h.Timestamp, h.TxRoot, h.AppHash, h.LastCommitHash))
+	return hash[:]
+}
+
+// Block is a collection of transactions that will be atomically applied to the state
+// machine: a header and a body of transactions, with the commit of the parent.
+type Block struct {
+	Header
+	Transactions []*Transaction
+	LastCommit   *Commit
+	hash         []byte // Cached; unexported so that it never comes from the wire
+}
+
+// NewBlock creates a block with the given header fields, transactions and parent commit.
+// It fills in the header's transaction root and last-commit hash.
+func NewBlock(header Header, txs []*Transaction, lastCommit *Commit) *Block {
+	header.TxRoot = TxRoot(txs)
+	header.LastCommitHash = lastCommit.Hash()
+	return &Block{Header: header, Transactions: txs, LastCommit: lastCommit}
+}
+
+// TxRoot returns the Merkle root of the given transactions.
+func TxRoot(txs []*Transaction) []byte {
+	return MerkleRoot(txLeaves(txs))
+}
+
+func txLeaves(txs []*Transaction) [][]byte {
+	leaves := make([][]byte, len(txs))
+	for i, tx := range txs {
+		leaves[i] = tx.Bytes()
+	}
+	return leaves
+}
+
+// Hash calculates and returns the hash of the block, which is the hash of its header.
+// The hash is cached for performance.
+func (b *Block) Hash() []byte {
+	if b.hash != nil {
+		return b.hash
+	}
+	b.hash = b.Header.Hash()
+	return b.hash
+}
+
+// ValidateBasic checks that the header is well-formed and matches the body, so the block
+// hash commits to the transactions and the commit it carries. Protocols call it on every
+// block they receive.
+func (b *Block) ValidateBasic() error {
+	if b.Height < 0 {
+		return fmt.Errorf("negative height %d", b.Height)
+	}
+	if b.Height == 0 && (b.ParentHash != nil || b.LastCommit != nil) {
+		return fmt.Errorf("unchained block has a parent")
+	}
+	if string(b.LastCommit.Hash()) != string(b.LastCommitHash) {
+		return fmt.Errorf("last-commit hash %x does not match the last commit", b.LastCommitHash)
+	}
+	if c := b.LastCommit; c != nil && (c.Height != b.Height-1 || string(c.BlockHash) != string(b.ParentHash)) {
+		return fmt.Errorf("last commit is for block %x at height %d, not the parent", c.BlockHash, c.Height)
+	}
+	for i, tx := range b.Transactions {
+		if tx == nil {
+			return fmt.Errorf("transaction %d is missing", i)
+		}
+	}
+	if root := TxRoot(b.Transactions); string(root) != string(b.TxRoot) {
+		return fmt.Errorf("transaction root %x does not match the transactions (%x)", b.TxRoot, root)
+	}
+	return nil
+}
+
+// ValidateParent checks that the block extends parent, which is nil for the first block
+// of the chain: it is one height above, links to the parent's hash, and was not proposed
+// earlier than it. Unchained blocks have no parent to check.
+func (b *Block) ValidateParent(parent *Block) error {
+	if b.Height == 0 {
+		return nil
+	}
+	if parent == nil {
+		if b.Height != 1 || b.ParentHash != nil {
+			return fmt.Errorf("block at height %d with parent %x is not the first block", b.Height, b.ParentHash)
+		}
+		return nil
+	}
+	if b.Height != parent.Height+1 {
+		return fmt.Errorf("height %d does not follow the parent's height %d", b.Height, parent.Height)
+	}
+	if string(b.ParentHash) != string(parent.Hash()) {
+		return fmt.Errorf("parent hash %x does not match the parent %x", b.ParentHash, parent.Hash())
+	}
+	if b.Timestamp < parent.Timestamp {
+		return fmt.Errorf("timestamp %d is before the parent's %d", b.Timestamp, parent.Timestamp)
+	}
+	return nil
+}
+
+// String provides a simple string representation of the block.
+func (b *Block) String() string {
+	return fmt.Sprintf("Block{Height: %d, Proposer: %d, Txs: %d, Hash: %x}", b.Height, b.ProposerID, len(b.Transactions), b.Hash())
+}
+
+// TxProof proves that a transaction was included in the block with the given header.
+type TxProof struct {
+	Tx     *Transaction
+	Header Header
+	Proof  *MerkleProof
+}
+
+// TxProof returns the inclusion proof of the transaction at index.
+func (b *Block) TxProof(index int) (*TxProof, error) {
+	proof, err := NewMerkleProof(txLeaves(b.Transactions), index)
+	if err != nil {
+		return nil, err
+	}
+	return &TxProof{Tx: b.Transactions[index], Header: b.Header, Proof: proof}, nil
+}
+
+// Verify checks that the proof shows the transaction to be part of the block with the
+// given hash, as learnt from a source the verifier trusts, such as a commit certificate.
+func (p *TxProof) Verify(blockHash []byte) error {
+	if p.Tx == nil {
+		return fmt.Errorf("proof has no transaction")
+	}
+	if string(p.Header.Hash()) != string(blockHash) {
+		return fmt.Errorf("header does not hash to block %x", blockHash)
+	}
+	if !p.Proof.Verify(p.Header.TxRoot, p.Tx.Bytes()) {
+		return fmt.Errorf("transaction is not included under root %x", p.Header.TxRoot)
+	}
+	return nil
+}
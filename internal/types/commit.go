@@ -0,0 +1,32 @@
+package types
+
+import (
+	"crypto/sha256"
+
+	"babel-bft/internal/crypto"
+)
+
+// Commit certifies that a block was committed at a height: the votes of a quorum for
+// it, combined into a certificate. Round is the round or view the votes were cast in;
+// what exactly the voters signed is up to the protocol, which verifies the certificate.
+type Commit struct {
+	Height    int
+	Round     int
+	BlockHash []byte
+	Cert      *crypto.Certificate
+}
+
+// Hash returns the SHA-256 hash of the commit's canonical encoding. Headers refer to
+// the commit of their parent by this hash. A nil commit hashes to nil.
+func (c *Commit) Hash() []byte {
+	if c == nil {
+		return nil
+	}
+	var signers []uint
+	var sig []byte
+	if c.Cert != nil {
+		signers, sig = c.Cert.Signers, c.Cert.Signature
+	}
+	hash := sha256.Sum256(SignBytes("commit", c.Height, c.Round, c.BlockHash, signers, sig))
+	return hash[:]
+}
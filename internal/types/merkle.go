@@ -0,0 +1,109 @@
+package types
+
+import (
+	"crypto/sha256"
+	"fmt"
+)
+
+// Domain-separation prefixes of the Merkle tree, so that a leaf can never be passed off
+// as an inner node or the other way around (RFC 6962).
+const (
+	leafPrefix  = 0x00
+	innerPrefix = 0x01
+)
+
+// MerkleRoot returns the root of the Merkle tree over the given leaves, in order. The
+// tree splits at the largest power of two below the number of leaves, as in RFC 6962,
+// and the root of no leaves is the hash of the empty string.
+func MerkleRoot(leaves [][]byte) []byte {
+	switch len(leaves) {
+	case 0:
+		empty := sha256.Sum256(nil)
+		return empty[:]
+	case 1:
+		return leafHash(leaves[0])
+	}
+	k := splitPoint(len(leaves))
+	return innerHash(MerkleRoot(leaves[:k]), MerkleRoot(leaves[k:]))
+}
+
+// MerkleProof proves that a leaf is at position Index of a tree with Total leaves.
+// Aunts are the roots of the sibling subtrees on the way from the leaf to the root,
+// lowest first.
+type MerkleProof struct {
+	Index int
+	Total int
+	Aunts [][]byte
+}
+
+// NewMerkleProof returns the proof for the leaf at index.
+func NewMerkleProof(leaves [][]byte, index int) (*MerkleProof, error) {
+	if index < 0 || index >= len(leaves) {
+		return nil, fmt.Errorf("leaf %d out of range, the tree has %d leaves", index, len(leaves))
+	}
+	return &MerkleProof{Index: index, Total: len(leaves), Aunts: aunts(leaves, index)}, nil
+}
+
+// aunts collects the sibling roots from the leaf at index up to the root.
+func aunts(leaves [][]byte, index int) [][]byte {
+	if len(leaves) <= 1 {
+		return nil
+	}
+	k := splitPoint(len(leaves))
+	if index < k {
+		return append(aunts(leaves[:k], index), MerkleRoot(leaves[k:]))
+	}
+	return append(aunts(leaves[k:], index-k), MerkleRoot(leaves[:k]))
+}
+
+// Verify reports whether the proof shows that leaf is part of the tree with the given root.
+func (p *MerkleProof) Verify(root, leaf []byte) bool {
+	if p == nil || p.Index < 0 || p.Index >= p.Total {
+		return false
+	}
+	computed, ok := rootFromAunts(leafHash(leaf), p.Index, p.Total, p.Aunts)
+	return ok && string(computed) == string(root)
+}
+
+// rootFromAunts folds the aunts into the root of a subtree of total leaves, given the
+// hash of the leaf at index. It fails if the number of aunts does not fit the tree's shape.
+func rootFromAunts(hash []byte, index, total int, aunts [][]byte) ([]byte, bool) {
+	if total == 1 {
+		return hash, len(aunts) == 0
+	}
+	if len(aunts) == 0 {
+		return nil, false
+	}
+	last := aunts[len(aunts)-1]
+	k := splitPoint(total)
+	if index < k {
+		left, ok := rootFromAunts(hash, index, k, aunts[:len(aunts)-1])
+		return innerHash(left, last), ok
+	}
+	right, ok := rootFromAunts(hash, index-k, total-k, aunts[:len(aunts)-1])
+	return innerHash(last, right), ok
+}
+
+// splitPoint returns the largest power of two smaller than n, for n >= 2.
+func splitPoint(n int) int {
+	k := 1
+	for k*2 < n {
+		k *= 2
+	}
+	return k
+}
+
+func leafHash(leaf []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{leafPrefix})
+	h.Write(leaf)
+	return h.Sum(nil)
+}
+
+func innerHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{innerPrefix})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
@@ -0,0 +1,123 @@
+package types
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"testing"
+)
+
+func TestMerkleRoot(t *testing.T) {
+	a, b, c := []byte("a"), []byte("b"), []byte("c")
+	empty := sha256.Sum256(nil)
+	tests := []struct {
+		name   string
+		leaves [][]byte
+		want   []byte
+	}{
+		{"no leaves", nil, empty[:]},
+		{"one leaf", [][]byte{a}, leafHash(a)},
+		{"two leaves", [][]byte{a, b}, innerHash(leafHash(a), leafHash(b))},
+		// Three leaves split after the first two, as in RFC 6962.
+		{"three leaves", [][]byte{a, b, c}, innerHash(innerHash(leafHash(a), leafHash(b)), leafHash(c))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MerkleRoot(tt.leaves); !bytes.Equal(got, tt.want) {
+				t.Errorf("MerkleRoot = %x, want %x", got, tt.want)
+			}
+		})
+	}
+
+	// A leaf must not collide with an inner node over the same bytes.
+	inner := append(leafHash(a), leafHash(b)...)
+	if bytes.Equal(MerkleRoot([][]byte{inner}), MerkleRoot([][]byte{a, b})) {
+		t.Errorf("a leaf made of two leaf hashes has the same root as the tree of those leaves")
+	}
+}
+
+func TestMerkleProofVerify(t *testing.T) {
+	for _, n := range []int{1, 2, 3, 4, 5, 7, 8, 9, 16, 33} {
+		leaves := testLeaves(n)
+		root := MerkleRoot(leaves)
+		for i := range leaves {
+			t.Run(fmt.Sprintf("%d leaves/index %d", n, i), func(t *testing.T) {
+				proof, err := NewMerkleProof(leaves, i)
+				if err != nil {
+					t.Fatalf("NewMerkleProof: %v", err)
+				}
+				if !proof.Verify(root, leaves[i]) {
+					t.Errorf("proof of leaf %d does not verify", i)
+				}
+				if proof.Verify(root, []byte("not a leaf")) {
+					t.Errorf("proof of leaf %d verifies another leaf", i)
+				}
+				if n > 1 && proof.Verify(root, leaves[(i+1)%n]) {
+					t.Errorf("proof of leaf %d verifies leaf %d", i, (i+1)%n)
+				}
+			})
+		}
+	}
+}
+
+func TestMerkleProofTampered(t *testing.T) {
+	leaves := testLeaves(6)
+	root := MerkleRoot(leaves)
+	leaf := leaves[3]
+
+	tests := []struct {
+		name   string
+		tamper func(p *MerkleProof)
+		root   []byte
+	}{
+		{"untouched", func(p *MerkleProof) {}, root},
+		{"wrong root", func(p *MerkleProof) {}, MerkleRoot(testLeaves(5))},
+		{"wrong index", func(p *MerkleProof) { p.Index = 2 }, root},
+		{"negative index", func(p *MerkleProof) { p.Index = -1 }, root},
+		{"index past total", func(p *MerkleProof) { p.Index = p.Total }, root},
+		{"wrong total", func(p *MerkleProof) { p.Total = 4 }, root},
+		{"missing aunt", func(p *MerkleProof) { p.Aunts = p.Aunts[1:] }, root},
+		{"extra aunt", func(p *MerkleProof) { p.Aunts = append(p.Aunts, root) }, root},
+		{"modified aunt", func(p *MerkleProof) { p.Aunts[0] = leafHash([]byte("x")) }, root},
+		{"swapped aunts", func(p *MerkleProof) { p.Aunts[0], p.Aunts[1] = p.Aunts[1], p.Aunts[0] }, root},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proof, err := NewMerkleProof(leaves, 3)
+			if err != nil {
+				t.Fatalf("NewMerkleProof: %v", err)
+			}
+			tt.tamper(proof)
+			want := tt.name == "untouched"
+			if got := proof.Verify(tt.root, leaf); got != want {
+				t.Errorf("Verify = %v, want %v", got, want)
+			}
+		})
+	}
+
+	var nilProof *MerkleProof
+	if nilProof.Verify(root, leaf) {
+		t.Errorf("a nil proof verifies")
+	}
+}
+
+func TestNewMerkleProofOutOfRange(t *testing.T) {
+	leaves := testLeaves(3)
+	for _, index := range []int{-1, 3, 10} {
+		if _, err := NewMerkleProof(leaves, index); err == nil {
+			t.Errorf("NewMerkleProof(%d) over %d leaves succeeded, want an error", index, len(leaves))
+		}
+	}
+	if _, err := NewMerkleProof(nil, 0); err == nil {
+		t.Errorf("NewMerkleProof over no leaves succeeded, want an error")
+	}
+}
+
+// testLeaves returns n distinct leaves.
+func testLeaves(n int) [][]byte {
+	leaves := make([][]byte, n)
+	for i := range leaves {
+		leaves[i] = []byte(fmt.Sprintf("leaf %d", i))
+	}
+	return leaves
+}
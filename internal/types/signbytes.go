@@ -0,0 +1,47 @@
+package types
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Signable is implemented by message payloads that are signed by their sender.
+// SignBytes returns the canonical encoding of the payload that the signature covers.
+type Signable interface {
+	SignBytes() []byte
+}
+
+// SignBytes encodes fields into a canonical byte string for signing. The domain names
+// the kind of message, so that a signature over one kind cannot be passed off as
+// another. Integers are encoded as fixed-size big-endian values and byte strings and
+// ID lists are length-prefixed, so different field values never share an encoding.
+func SignBytes(domain string, fields ...interface{}) []byte {
+	buf := appendBytes(nil, []byte(domain))
+	for _, field := range fields {
+		switch v := field.(type) {
+		case int:
+			buf = binary.BigEndian.AppendUint64(buf, uint64(v))
+		case int64:
+			buf = binary.BigEndian.AppendUint64(buf, uint64(v))
+		case uint:
+			buf = binary.BigEndian.AppendUint64(buf, uint64(v))
+		case []byte:
+			buf = appendBytes(buf, v)
+		case string:
+			buf = appendBytes(buf, []byte(v))
+		case []uint:
+			buf = binary.BigEndian.AppendUint32(buf, uint32(len(v)))
+			for _, id := range v {
+				buf = binary.BigEndian.AppendUint64(buf, uint64(id))
+			}
+		default:
+			panic(fmt.Sprintf("types: cannot encode %T for signing", field))
+		}
+	}
+	return buf
+}
+
+func appendBytes(buf, data []byte) []byte {
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(data)))
+	return append(buf, data...)
+}
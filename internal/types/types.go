@@ -1,9 +1,8 @@
 package types
 
 import (
+	"babel-bft/internal/crypto"
 	"crypto/sha256"
-	"fmt"
-	"strconv"
 )
 
 // Constants for message types
@@ -13,53 +12,70 @@ const (
 )
 
 // Message is the generic container for all communications between nodes.
+// When the payload is Signable, Signature is the sender's signature over its SignBytes.
 type Message struct {
-	Type    int
-	From    uint
-	Payload interface{}
+	Type      int
+	From      uint
+	Payload   interface{}
+	Signature []byte
 }
 
 // Transaction represents a client's request to be processed by the state machine.
+// A transaction carrying a ValidatorUpdate is a special transaction that changes the
+// validator set once committed.
 type Transaction struct {
-	ClientID  uint
-	Timestamp int64
-	Payload   []byte
+	ClientID        uint
+	Timestamp       int64
+	Payload         []byte
+	ValidatorUpdate *ValidatorUpdate
 }
 
-// Block is a collection of transactions that will be atomically applied to the state machine.
-type Block struct {
-	ProposerID   uint
-	Transactions []*Transaction
-	HashCache    []byte
-}
-
-// Hash calculates and returns the SHA-256 hash of the block.
-// The hash is cached for performance.
-func (b *Block) Hash() []byte {
-	if b.HashCache != nil {
-		return b.HashCache
+// Bytes returns the canonical encoding of the transaction, the leaf it contributes to
+// its block's Merkle tree.
+func (tx *Transaction) Bytes() []byte {
+	if u := tx.ValidatorUpdate; u != nil {
+		return SignBytes("tx", tx.ClientID, tx.Timestamp, tx.Payload, 1, u.ID, u.VotingPower, u.PubKey)
 	}
-	h := sha256.New()
-	h.Write([]byte(strconv.Itoa(int(b.ProposerID))))
-	for _, tx := range b.Transactions {
-		h.Write([]byte(strconv.Itoa(int(tx.ClientID))))
-		h.Write([]byte(strconv.FormatInt(tx.Timestamp, 10)))
-		h.Write(tx.Payload)
-	}
-	b.HashCache = h.Sum(nil)
-	return b.HashCache
+	return SignBytes("tx", tx.ClientID, tx.Timestamp, tx.Payload, 0)
 }
 
-// String provides a simple string representation of the block.
-func (b *Block) String() string {
-	return fmt.Sprintf("Block{Proposer: %d, Txs: %d, Hash: %x}", b.ProposerID, len(b.Transactions), b.Hash())
+// Hash returns the SHA-256 hash of the transaction's canonical encoding, which
+// identifies it.
+func (tx *Transaction) Hash() []byte {
+	hash := sha256.Sum256(tx.Bytes())
+	return hash[:]
 }
 
 // NodeInterface defines the set of methods that the consensus engine can use
 // to interact with the underlying node, abstracting away the network and core logic.
 type NodeInterface interface {
 	ID() uint
-	QuorumSize() int
+	// Validators returns the validator set for the next height to be committed,
+	// which provides the quorum thresholds.
+	Validators() *ValidatorSet
+	// ValidatorsAt returns the validator set in effect at the given height. Validator
+	// updates committed at height h take effect a fixed number of heights later, so the
+	// set is known for every height up to that distance from the last committed one.
+	ValidatorsAt(height int) *ValidatorSet
 	Broadcast(msg *Message)
 	Send(recipientID uint, msg *Message)
+
+	// Crypto returns the signature provider of the node. The node signs outgoing
+	// Signable payloads with it; protocols use it to verify what they receive.
+	Crypto() crypto.Provider
+
+	// ReapTransactions returns up to max pending transactions to be included in a proposal.
+	// The transactions stay pending until a block containing them is committed.
+	ReapTransactions(max int) []*Transaction
+
+	// AppHash returns the hash of the application state after the last committed
+	// block, which a proposer that knows the parent is committed puts in the header.
+	AppHash() []byte
+
+	// Commit hands a decided block to the node so it can be executed.
+	// Protocols call it exactly once per height, in height order.
+	Commit(height int, block *Block)
+
+	// Block returns the committed block at the given height, or nil if it is not committed yet.
+	Block(height int) *Block
 }
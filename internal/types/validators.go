@@ -0,0 +1,216 @@
+package types
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Validator is a replica taking part in consensus. Its votes count with its voting
+// power, and its public key identifies it to the other replicas.
+type Validator struct {
+	ID          uint
+	PubKey      []byte
+	VotingPower int64
+}
+
+// ValidatorSet is the group of validators that runs consensus at some height, along
+// with the voting power f held by faulty validators that it is meant to tolerate.
+// Protocols take their thresholds from it instead of deriving them from the replica
+// count. All thresholds are expressed in voting power; when every validator has power 1
+// they are plain validator counts. A set is never modified: changes produce a new set.
+type ValidatorSet struct {
+	validators []Validator // Sorted by ID, so that every replica sees the same order
+	index      map[uint]int
+	total      int64
+	f          int64
+	fixedF     int64 // The f requested at creation; 0 means it follows the total power
+}
+
+// ValidatorUpdate changes the voting power of a validator. A validator that is not in
+// the set is added, and a voting power of 0 removes it.
+type ValidatorUpdate struct {
+	ID          uint
+	PubKey      []byte
+	VotingPower int64
+}
+
+// NewValidatorSet creates a set of the given validators tolerating faulty validators
+// with up to f voting power. A zero f selects the largest value the set can tolerate,
+// (total-1)/3. It fails if the set is empty, has duplicate IDs or non-positive powers,
+// or if its total power is too small to tolerate f (total < 3f+1).
+func NewValidatorSet(validators []Validator, f int64) (*ValidatorSet, error) {
+	fixedF := f
+	if len(validators) == 0 {
+		return nil, fmt.Errorf("validator set is empty")
+	}
+	if f < 0 {
+		return nil, fmt.Errorf("fault tolerance must not be negative, got %d", f)
+	}
+	vs := &ValidatorSet{
+		validators: append([]Validator(nil), validators...),
+		index:      make(map[uint]int, len(validators)),
+	}
+	sort.Slice(vs.validators, func(i, j int) bool { return vs.validators[i].ID < vs.validators[j].ID })
+	for i, v := range vs.validators {
+		if _, dup := vs.index[v.ID]; dup {
+			return nil, fmt.Errorf("duplicate validator %d", v.ID)
+		}
+		if v.VotingPower <= 0 {
+			return nil, fmt.Errorf("validator %d: voting power must be positive, got %d", v.ID, v.VotingPower)
+		}
+		vs.index[v.ID] = i
+		vs.total += v.VotingPower
+	}
+	if f == 0 {
+		f = (vs.total - 1) / 3
+	}
+	if vs.total < 3*f+1 {
+		return nil, fmt.Errorf("tolerating %d faulty voting power requires a total of at least %d, got %d", f, 3*f+1, vs.total)
+	}
+	vs.f = f
+	vs.fixedF = fixedF
+	return vs, nil
+}
+
+// NewUniformValidatorSet creates a set where each of the given validators has voting
+// power 1, so f is a number of validators. It has no public keys.
+func NewUniformValidatorSet(ids []uint, f int) (*ValidatorSet, error) {
+	validators := make([]Validator, len(ids))
+	for i, id := range ids {
+		validators[i] = Validator{ID: id, VotingPower: 1}
+	}
+	return NewValidatorSet(validators, int64(f))
+}
+
+// Apply returns a new set with the updates applied in order; the receiver is left
+// unchanged. The new set tolerates the same f, or follows its own total power if f
+// was chosen automatically. It fails if the result is not a valid validator set.
+func (vs *ValidatorSet) Apply(updates []ValidatorUpdate) (*ValidatorSet, error) {
+	validators := vs.Validators()
+	for _, u := range updates {
+		if u.VotingPower < 0 {
+			return nil, fmt.Errorf("validator %d: voting power must not be negative, got %d", u.ID, u.VotingPower)
+		}
+		i := 0
+		for i < len(validators) && validators[i].ID != u.ID {
+			i++
+		}
+		switch {
+		case u.VotingPower == 0 && i == len(validators):
+			return nil, fmt.Errorf("cannot remove validator %d: not in the set", u.ID)
+		case u.VotingPower == 0:
+			validators = append(validators[:i], validators[i+1:]...)
+		case i == len(validators):
+			validators = append(validators, Validator{ID: u.ID, PubKey: u.PubKey, VotingPower: u.VotingPower})
+		default:
+			validators[i].VotingPower = u.VotingPower
+			if u.PubKey != nil {
+				validators[i].PubKey = u.PubKey
+			}
+		}
+	}
+	return NewValidatorSet(validators, vs.fixedF)
+}
+
+// N returns the number of validators.
+func (vs *ValidatorSet) N() int {
+	return len(vs.validators)
+}
+
+// F returns the faulty voting power the set tolerates.
+func (vs *ValidatorSet) F() int64 {
+	return vs.f
+}
+
+// TotalPower returns the sum of the voting power of all validators.
+func (vs *ValidatorSet) TotalPower() int64 {
+	return vs.total
+}
+
+// Quorum returns the voting power needed for a quorum, total-f. Any two quorums
+// intersect in at least one correct validator, and the correct validators alone can
+// always form one. With n = 3f+1 validators of power 1 this is the familiar 2f+1.
+func (vs *ValidatorSet) Quorum() int64 {
+	return vs.total - vs.f
+}
+
+// WeakQuorum returns the voting power that guarantees at least one correct validator, f+1.
+func (vs *ValidatorSet) WeakQuorum() int64 {
+	return vs.f + 1
+}
+
+// HasQuorum reports whether the given validators together hold a quorum.
+func (vs *ValidatorSet) HasQuorum(ids []uint) bool {
+	return vs.PowerOf(ids) >= vs.Quorum()
+}
+
+// HasWeakQuorum reports whether the given validators together hold a weak quorum.
+func (vs *ValidatorSet) HasWeakQuorum(ids []uint) bool {
+	return vs.PowerOf(ids) >= vs.WeakQuorum()
+}
+
+// Power returns the voting power of a validator, or 0 if id is not in the set.
+func (vs *ValidatorSet) Power(id uint) int64 {
+	if i, ok := vs.index[id]; ok {
+		return vs.validators[i].VotingPower
+	}
+	return 0
+}
+
+// PowerOf returns the voting power held by the given validators. Each validator is
+// counted once, however many times it appears, and IDs outside the set count for nothing.
+func (vs *ValidatorSet) PowerOf(ids []uint) int64 {
+	seen := make(map[uint]struct{}, len(ids))
+	var power int64
+	for _, id := range ids {
+		if _, dup := seen[id]; dup {
+			continue
+		}
+		seen[id] = struct{}{}
+		power += vs.Power(id)
+	}
+	return power
+}
+
+// Powers returns the voting power of every validator, keyed by ID.
+func (vs *ValidatorSet) Powers() map[uint]int64 {
+	powers := make(map[uint]int64, len(vs.validators))
+	for _, v := range vs.validators {
+		powers[v.ID] = v.VotingPower
+	}
+	return powers
+}
+
+// Validator returns the validator with the given ID.
+func (vs *ValidatorSet) Validator(id uint) (Validator, bool) {
+	if i, ok := vs.index[id]; ok {
+		return vs.validators[i], true
+	}
+	return Validator{}, false
+}
+
+// Validators returns the validators in ascending ID order.
+func (vs *ValidatorSet) Validators() []Validator {
+	return append([]Validator(nil), vs.validators...)
+}
+
+// IDs returns the IDs of the validators in ascending order.
+func (vs *ValidatorSet) IDs() []uint {
+	ids := make([]uint, len(vs.validators))
+	for i, v := range vs.validators {
+		ids[i] = v.ID
+	}
+	return ids
+}
+
+// At returns the validator ID at position i of the ascending order, wrapping around,
+// which is how protocols rotate the leader role.
+func (vs *ValidatorSet) At(i int) uint {
+	return vs.validators[i%len(vs.validators)].ID
+}
+
+// Contains reports whether id belongs to the set.
+func (vs *ValidatorSet) Contains(id uint) bool {
+	_, ok := vs.index[id]
+	return ok
+}
@@ -0,0 +1,263 @@
+package types
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidatorSetThresholds(t *testing.T) {
+	tests := []struct {
+		name       string
+		powers     []int64
+		f          int64
+		wantF      int64
+		wantTotal  int64
+		wantQuorum int64
+		wantWeak   int64
+	}{
+		{"four uniform", []int64{1, 1, 1, 1}, 0, 1, 4, 3, 2},
+		{"five uniform", []int64{1, 1, 1, 1, 1}, 0, 1, 5, 4, 2},
+		{"seven uniform", []int64{1, 1, 1, 1, 1, 1, 1}, 0, 2, 7, 5, 3},
+		{"single validator", []int64{1}, 0, 0, 1, 1, 1},
+		{"explicit f below maximum", []int64{1, 1, 1, 1, 1, 1, 1}, 1, 1, 7, 6, 2},
+		{"weighted", []int64{10, 20, 30, 40}, 0, 33, 100, 67, 34},
+		{"one heavy validator", []int64{1, 1, 1, 7}, 0, 3, 10, 7, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vs, err := NewValidatorSet(validatorsWithPowers(tt.powers...), tt.f)
+			if err != nil {
+				t.Fatalf("NewValidatorSet: %v", err)
+			}
+			if vs.F() != tt.wantF || vs.TotalPower() != tt.wantTotal || vs.Quorum() != tt.wantQuorum || vs.WeakQuorum() != tt.wantWeak {
+				t.Errorf("f=%d total=%d quorum=%d weak=%d, want f=%d total=%d quorum=%d weak=%d",
+					vs.F(), vs.TotalPower(), vs.Quorum(), vs.WeakQuorum(), tt.wantF, tt.wantTotal, tt.wantQuorum, tt.wantWeak)
+			}
+			// Two quorums must overlap in more than f voting power.
+			if 2*vs.Quorum()-vs.TotalPower() <= vs.F() {
+				t.Errorf("quorums of %d out of %d do not intersect in a correct validator with f=%d", vs.Quorum(), vs.TotalPower(), vs.F())
+			}
+		})
+	}
+}
+
+func TestNewValidatorSetErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		validators []Validator
+		f          int64
+	}{
+		{"empty", nil, 0},
+		{"negative f", validatorsWithPowers(1, 1, 1, 1), -1},
+		{"f too large", validatorsWithPowers(1, 1, 1, 1), 2},
+		{"zero power", validatorsWithPowers(1, 0, 1, 1), 0},
+		{"negative power", validatorsWithPowers(1, -1, 1, 1), 0},
+		{"duplicate ID", []Validator{{ID: 1, VotingPower: 1}, {ID: 1, VotingPower: 1}}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewValidatorSet(tt.validators, tt.f); err == nil {
+				t.Errorf("NewValidatorSet succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestValidatorSetPowerOf(t *testing.T) {
+	vs, err := NewValidatorSet(validatorsWithPowers(10, 20, 30, 40), 0)
+	if err != nil {
+		t.Fatalf("NewValidatorSet: %v", err)
+	}
+	tests := []struct {
+		name       string
+		ids        []uint
+		wantPower  int64
+		wantQuorum bool
+		wantWeak   bool
+	}{
+		{"none", nil, 0, false, false},
+		{"one light", []uint{0}, 10, false, false},
+		{"weak quorum", []uint{0, 2}, 40, false, true},
+		{"just below quorum", []uint{1, 3}, 60, false, true},
+		{"quorum", []uint{0, 1, 3}, 70, true, true},
+		{"duplicates count once", []uint{3, 3, 3}, 40, false, true},
+		{"unknown IDs count for nothing", []uint{3, 7, 8}, 40, false, true},
+		{"everyone", []uint{0, 1, 2, 3}, 100, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := vs.PowerOf(tt.ids); got != tt.wantPower {
+				t.Errorf("PowerOf(%v) = %d, want %d", tt.ids, got, tt.wantPower)
+			}
+			if got := vs.HasQuorum(tt.ids); got != tt.wantQuorum {
+				t.Errorf("HasQuorum(%v) = %v, want %v", tt.ids, got, tt.wantQuorum)
+			}
+			if got := vs.HasWeakQuorum(tt.ids); got != tt.wantWeak {
+				t.Errorf("HasWeakQuorum(%v) = %v, want %v", tt.ids, got, tt.wantWeak)
+			}
+		})
+	}
+}
+
+func TestValidatorSetOrder(t *testing.T) {
+	ids := []uint{7, 2, 9, 4}
+	vs, err := NewUniformValidatorSet(ids, 0)
+	if err != nil {
+		t.Fatalf("NewUniformValidatorSet: %v", err)
+	}
+	if want := []uint{2, 4, 7, 9}; !reflect.DeepEqual(vs.IDs(), want) {
+		t.Errorf("IDs = %v, want %v", vs.IDs(), want)
+	}
+	if !reflect.DeepEqual(ids, []uint{7, 2, 9, 4}) {
+		t.Errorf("NewUniformValidatorSet reordered its argument to %v", ids)
+	}
+
+	// Leaders rotate through the sorted IDs.
+	for i, want := range []uint{2, 4, 7, 9, 2, 4} {
+		if got := vs.At(i); got != want {
+			t.Errorf("At(%d) = %d, want %d", i, got, want)
+		}
+	}
+	for _, id := range []uint{2, 4, 7, 9} {
+		if !vs.Contains(id) || vs.Power(id) != 1 {
+			t.Errorf("validator %d: Contains = %v, Power = %d", id, vs.Contains(id), vs.Power(id))
+		}
+	}
+	for _, id := range []uint{0, 3, 10} {
+		if vs.Contains(id) || vs.Power(id) != 0 {
+			t.Errorf("non-validator %d: Contains = %v, Power = %d", id, vs.Contains(id), vs.Power(id))
+		}
+	}
+}
+
+func TestValidatorSetApply(t *testing.T) {
+	tests := []struct {
+		name       string
+		f          int64
+		updates    []ValidatorUpdate
+		wantPowers map[uint]int64
+		wantF      int64
+		wantErr    bool
+	}{
+		{
+			name:       "no updates",
+			updates:    nil,
+			wantPowers: map[uint]int64{0: 1, 1: 1, 2: 1, 3: 1},
+			wantF:      1,
+		},
+		{
+			name:       "add validator",
+			updates:    []ValidatorUpdate{{ID: 4, VotingPower: 1}},
+			wantPowers: map[uint]int64{0: 1, 1: 1, 2: 1, 3: 1, 4: 1},
+			wantF:      1,
+		},
+		{
+			name:       "remove validator",
+			updates:    []ValidatorUpdate{{ID: 2, VotingPower: 0}},
+			wantPowers: map[uint]int64{0: 1, 1: 1, 3: 1},
+			wantF:      0,
+		},
+		{
+			name:       "change power",
+			updates:    []ValidatorUpdate{{ID: 0, VotingPower: 3}},
+			wantPowers: map[uint]int64{0: 3, 1: 1, 2: 1, 3: 1},
+			wantF:      1,
+		},
+		{
+			name:       "updates apply in order",
+			updates:    []ValidatorUpdate{{ID: 4, VotingPower: 2}, {ID: 4, VotingPower: 0}, {ID: 5, VotingPower: 3}},
+			wantPowers: map[uint]int64{0: 1, 1: 1, 2: 1, 3: 1, 5: 3},
+			wantF:      2,
+		},
+		{
+			name:       "fixed f is kept",
+			f:          1,
+			updates:    []ValidatorUpdate{{ID: 4, VotingPower: 1}, {ID: 5, VotingPower: 1}, {ID: 6, VotingPower: 1}},
+			wantPowers: map[uint]int64{0: 1, 1: 1, 2: 1, 3: 1, 4: 1, 5: 1, 6: 1},
+			wantF:      1,
+		},
+		{
+			name:    "fixed f no longer tolerated",
+			f:       1,
+			updates: []ValidatorUpdate{{ID: 3, VotingPower: 0}},
+			wantErr: true,
+		},
+		{
+			name:    "remove unknown validator",
+			updates: []ValidatorUpdate{{ID: 9, VotingPower: 0}},
+			wantErr: true,
+		},
+		{
+			name:    "negative power",
+			updates: []ValidatorUpdate{{ID: 1, VotingPower: -1}},
+			wantErr: true,
+		},
+		{
+			name:    "remove everyone",
+			updates: []ValidatorUpdate{{ID: 0}, {ID: 1}, {ID: 2}, {ID: 3}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vs, err := NewValidatorSet(validatorsWithPowers(1, 1, 1, 1), tt.f)
+			if err != nil {
+				t.Fatalf("NewValidatorSet: %v", err)
+			}
+			before := vs.Powers()
+
+			next, err := vs.Apply(tt.updates)
+			if !reflect.DeepEqual(vs.Powers(), before) {
+				t.Errorf("Apply modified the receiver: %v, was %v", vs.Powers(), before)
+			}
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Apply succeeded with powers %v, want an error", next.Powers())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Apply: %v", err)
+			}
+			if !reflect.DeepEqual(next.Powers(), tt.wantPowers) {
+				t.Errorf("powers = %v, want %v", next.Powers(), tt.wantPowers)
+			}
+			if next.F() != tt.wantF {
+				t.Errorf("f = %d, want %d", next.F(), tt.wantF)
+			}
+		})
+	}
+}
+
+func TestValidatorSetApplyKeepsPubKey(t *testing.T) {
+	vs, err := NewValidatorSet([]Validator{
+		{ID: 0, PubKey: []byte("key0"), VotingPower: 1},
+		{ID: 1, PubKey: []byte("key1"), VotingPower: 1},
+	}, 0)
+	if err != nil {
+		t.Fatalf("NewValidatorSet: %v", err)
+	}
+	next, err := vs.Apply([]ValidatorUpdate{
+		{ID: 0, VotingPower: 2},
+		{ID: 1, PubKey: []byte("new1"), VotingPower: 1},
+		{ID: 2, PubKey: []byte("key2"), VotingPower: 1},
+	})
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	for id, want := range map[uint]string{0: "key0", 1: "new1", 2: "key2"} {
+		v, ok := next.Validator(id)
+		if !ok || string(v.PubKey) != want {
+			t.Errorf("validator %d has key %q, want %q", id, v.PubKey, want)
+		}
+	}
+}
+
+// validatorsWithPowers returns validators 0, 1, ... with the given voting powers.
+func validatorsWithPowers(powers ...int64) []Validator {
+	validators := make([]Validator, len(powers))
+	for i, power := range powers {
+		validators[i] = Validator{ID: uint(i), VotingPower: power}
+	}
+	return validators
+}
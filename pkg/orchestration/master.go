@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"fmt"
 	"log"
+	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -21,6 +22,10 @@ type Master struct {
 	hosts      []string
 }
 
+// collectGrace é o tempo que o mestre espera, além da duração do experimento,
+// antes de coletar as métricas dos workers.
+const collectGrace = 10 * time.Second
+
 // NewMaster cria uma nova instância do orquestrador mestre.
 func NewMaster(protocol string, duration time.Duration, hostsFile string, configFile string) *Master {
 	return &Master{
@@ -50,11 +55,10 @@ func (m *Master) Run() error {
 	}
 	log.Println("Todos os workers foram implantados e estão em execução.")
 
-	// TODO: Adicionar lógica para enviar configuração e sinal de início aos workers.
-	// Por enquanto, apenas esperamos a duração do experimento.
-
+	// Os workers salvam as métricas logo após o experimento; a margem cobre a
+	// inicialização das réplicas.
 	log.Printf("Experimento em andamento por %v...", m.duration)
-	time.Sleep(m.duration)
+	time.Sleep(m.duration + collectGrace)
 
 	log.Println("Tempo de experimento esgotado. Coletando métricas...")
 
@@ -89,7 +93,18 @@ func (m *Master) loadHosts() error {
 	return scanner.Err()
 }
 
-// deployWorkers usa SSH para iniciar contêineres Docker em cada host.
+// sshTarget retorna o destino SSH de uma linha do arquivo de hosts, que pode
+// incluir a porta em que a réplica escuta.
+func sshTarget(entry string) string {
+	if host, _, err := net.SplitHostPort(entry); err == nil {
+		return host
+	}
+	return entry
+}
+
+// deployWorkers usa SSH para iniciar contêineres Docker em cada host. Cada worker
+// executa a réplica com o ID da linha do seu host e se conecta às demais pelo
+// endereço listado no mesmo arquivo de hosts, que a imagem traz em configs/.
 func (m *Master) deployWorkers() error {
 	var wg sync.WaitGroup
 	errChan := make(chan error, len(m.hosts))
@@ -102,13 +117,13 @@ func (m *Master) deployWorkers() error {
 			log.Printf("Implantando worker %d em %s", id, h)
 
 			// Comando para iniciar o worker em um contêiner Docker
-			// Mapeia uma porta para comunicação com o mestre e monta um volume para resultados
+			// Usa a rede do host, para que as réplicas se alcancem pelas portas do arquivo de hosts
 			cmdStr := fmt.Sprintf(
-				"docker run -d --rm --name worker-%d -p 8080:8080 %s --mode=worker",
-				id, imageName,
+				"docker run -d --rm --name worker-%d --network host %s --mode=worker --id=%d --protocol=%s --duration=%s --config=%s --hosts=%s",
+				id, imageName, id, m.protocol, m.duration, m.configFile, m.hostsFile,
 			)
 
-			cmd := exec.Command("ssh", h, cmdStr)
+			cmd := exec.Command("ssh", sshTarget(h), cmdStr)
 			output, err := cmd.CombinedOutput()
 			if err != nil {
 				errChan <- fmt.Errorf("falha ao implantar em %s: %v\nOutput: %s", h, err, string(output))
@@ -148,15 +163,15 @@ func (m *Master) collectMetrics() error {
 			localPath := filepath.Join(resultsDir, fmt.Sprintf("metrics-node-%d.json", id))
 
 			// 1. Copia do contêiner para o host remoto
-			copyCmdStr := fmt.Sprintf("docker cp %s:/app/results/metrics.json %s", containerName, remoteTempPath)
-			cmd := exec.Command("ssh", h, copyCmdStr)
+			copyCmdStr := fmt.Sprintf("docker cp %s:/app/%s %s", containerName, MetricsFile(uint(id)), remoteTempPath)
+			cmd := exec.Command("ssh", sshTarget(h), copyCmdStr)
 			if output, err := cmd.CombinedOutput(); err != nil {
 				errChan <- fmt.Errorf("falha ao copiar métricas do contêiner em %s: %v\nOutput: %s", h, err, string(output))
 				return
 			}
 
 			// 2. Copia do host remoto para a máquina mestre
-			scpCmd := exec.Command("scp", fmt.Sprintf("%s:%s", h, remoteTempPath), localPath)
+			scpCmd := exec.Command("scp", fmt.Sprintf("%s:%s", sshTarget(h), remoteTempPath), localPath)
 			if output, err := scpCmd.CombinedOutput(); err != nil {
 				errChan <- fmt.Errorf("falha ao fazer scp de %s: %v\nOutput: %s", h, err, string(output))
 				return
@@ -182,7 +197,7 @@ func (m *Master) cleanupWorkers() error {
 		go func(h string, id int) {
 			defer wg.Done()
 			cmdStr := fmt.Sprintf("docker stop worker-%d", id)
-			cmd := exec.Command("ssh", h, cmdStr)
+			cmd := exec.Command("ssh", sshTarget(h), cmdStr)
 			cmd.Run() // Ignora erros, pois o contêiner pode já não existir
 			log.Printf("Worker %d em %s parado.", id, h)
 		}(host, i)
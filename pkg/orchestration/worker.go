@@ -1,70 +1,117 @@
 package orchestration
 
 import (
-	"babel-bft/internal/core"
-	"babel-bft/internal/metrics"
+	"babel-bft/internal/config"
+	"babel-bft/internal/network"
+	"babel-bft/internal/run"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
+	"sync"
 	"time"
 )
 
-// Worker representa um nó escravo que executa o protocolo BFT.
+// Worker representa um nó escravo que executa uma réplica do protocolo BFT,
+// comunicando-se com as réplicas dos demais workers por TCP ou QUIC.
 type Worker struct {
-	node *core.Node
+	id          uint
+	protocol    string
+	duration    time.Duration
+	configFile  string
+	hostsFile   string
+	controlAddr string
+	done        chan struct{}
+	stopOnce    sync.Once
 }
 
-// NewWorker cria uma nova instância de um worker.
-func NewWorker() *Worker {
-	// TODO: A inicialização do nó deve ser mais sofisticada,
-	// recebendo configuração do mestre.
-	metricsCollector := metrics.NewCollector()
-	node := core.NewNode(0, metricsCollector) // id 0 é um placeholder
-	return &Worker{node: node}
+// NewWorker cria uma nova instância de um worker para a réplica id, cujo endereço é
+// a linha de mesmo índice do arquivo de hosts. controlAddr é o endereço em que o
+// worker aguarda o comando de término do mestre; vazio, o worker termina sozinho ao
+// fim do experimento, como ao executar várias réplicas em portas de loopback.
+func NewWorker(id uint, protocol string, duration time.Duration, configFile, hostsFile, controlAddr string) *Worker {
+	return &Worker{
+		id:          id,
+		protocol:    protocol,
+		duration:    duration,
+		configFile:  configFile,
+		hostsFile:   hostsFile,
+		controlAddr: controlAddr,
+		done:        make(chan struct{}),
+	}
+}
+
+// MetricsFile retorna o caminho em que o worker da réplica id salva suas métricas.
+func MetricsFile(id uint) string {
+	return filepath.Join("results", fmt.Sprintf("metrics-node-%d.json", id))
 }
 
-// Run inicia o worker, que escuta por comandos do mestre.
+// Run executa a réplica durante o experimento e salva suas métricas. Com um endereço
+// de controle, continua aguardando o comando 'stop' do mestre, para que o mestre
+// possa coletar as métricas antes de o contêiner ser removido.
 func (w *Worker) Run() error {
-	// Inicia o loop de eventos do nó em uma goroutine
-	w.node.Start()
+	cfg, err := config.Load(w.configFile)
+	if err != nil {
+		return err
+	}
+	book, err := network.LoadAddressBook(w.hostsFile)
+	if err != nil {
+		return err
+	}
 
 	// Configura um servidor HTTP simples para receber comandos do mestre
-	http.HandleFunc("/start", w.handleStart)
-	http.HandleFunc("/stop", w.handleStop)
+	serverErr := make(chan error, 1)
+	if w.controlAddr != "" {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/stop", w.handleStop)
+		log.Printf("Worker escutando por comandos em %s...", w.controlAddr)
+		go func() {
+			serverErr <- http.ListenAndServe(w.controlAddr, mux)
+		}()
+	}
+
+	report, err := run.RunReplica(w.id, w.protocol, w.duration, cfg, book)
+	if err != nil {
+		return err
+	}
+	if err := saveReport(MetricsFile(w.id), report); err != nil {
+		return fmt.Errorf("falha ao salvar métricas: %w", err)
+	}
+	log.Printf("Métricas salvas em %s.", MetricsFile(w.id))
 
-	log.Println("Worker escutando por comandos na porta 8080...")
-	return http.ListenAndServe(":8080", nil)
+	if w.controlAddr == "" {
+		return nil
+	}
+	select {
+	case <-w.done:
+		return nil
+	case err := <-serverErr:
+		return err
+	}
 }
 
-// handleStart é o handler para o comando de início do experimento.
-func (w *Worker) handleStart(rw http.ResponseWriter, r *http.Request) {
-	log.Println("Comando 'start' recebido do mestre.")
-	// TODO: Aqui, o worker começaria a lógica de consenso ativa,
-	// possivelmente após receber a configuração completa.
-	// Por enquanto, apenas registramos o evento.
-	w.node.Metrics.RecordEvent("experiment_started")
-	fmt.Fprintln(rw, "Experimento iniciado.")
+// saveReport grava o relatório da réplica em JSON.
+func saveReport(path string, report *run.ReplicaReport) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
 }
 
 // handleStop é o handler para o comando de término do experimento.
 func (w *Worker) handleStop(rw http.ResponseWriter, r *http.Request) {
 	log.Println("Comando 'stop' recebido do mestre.")
-	w.node.Metrics.RecordEvent("experiment_stopped")
-
-	// Salva as métricas em um arquivo
-	if err := w.node.Metrics.Save("/app/results/metrics.json"); err != nil {
-		log.Printf("ERRO: Falha ao salvar métricas: %v", err)
-		http.Error(rw, "Falha ao salvar métricas", http.StatusInternalServerError)
-		return
-	}
-
-	log.Println("Métricas salvas com sucesso.")
-	fmt.Fprintln(rw, "Métricas salvas. Encerrando.")
+	fmt.Fprintln(rw, "Encerrando.")
 
 	// Dá um tempo para a resposta HTTP ser enviada antes de sair
 	go func() {
 		time.Sleep(1 * time.Second)
-		os.Exit(0)
+		w.stopOnce.Do(func() { close(w.done) })
 	}()
 }